@@ -0,0 +1,127 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a MoodleCacheCluster.
+const (
+	// ConditionCacheClusterReady reports whether every cache instance is ready.
+	ConditionCacheClusterReady = "Ready"
+)
+
+// MoodleCacheClusterSpec defines the desired state of MoodleCacheCluster
+// +kubebuilder:validation:XValidation:rule="self.namespace == oldSelf.namespace",message="namespace is immutable"
+// +kubebuilder:validation:XValidation:rule="!has(self.replicas) || self.replicas == 1 || self.type == 'memcached'",message="redis runs a single instance"
+type MoodleCacheClusterSpec struct {
+	// Type is redis for a Redis server holding the application cache and the sessions of
+	// its tenants, or memcached for a pool of Memcached instances holding the application
+	// cache, next to sessions in moodledata or the database.
+	// +kubebuilder:validation:Enum=memcached;redis
+	// +kubebuilder:validation:Required
+	Type string `json:"type"`
+
+	// Namespace the cache instances run in. It is created when missing.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:default:="moodle-cache"
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Replicas is the number of Memcached instances. Moodle spreads the keys over them.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=1
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// MemoryMB is the memory limit of a cache instance in megabytes. The least recently
+	// used keys of all tenants are evicted when it is full.
+	// +kubebuilder:validation:Minimum=32
+	// +kubebuilder:default:=1024
+	// +optional
+	MemoryMB int `json:"memoryMB,omitempty"`
+
+	// Image of the cache instances. Defaults to redis:7-alpine and memcached:alpine.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Auth makes the Memcached instances require SASL authentication with generated
+	// credentials, which tenants get a copy of. Redis always requires a password.
+	// +optional
+	Auth bool `json:"auth,omitempty"`
+}
+
+// MoodleCacheClusterStatus defines the observed state of MoodleCacheCluster
+type MoodleCacheClusterStatus struct {
+	// Servers are the host:port addresses of the cache instances tenants connect to.
+	// +optional
+	Servers []string `json:"servers,omitempty"`
+
+	// PasswordSecret is the name of the secret in spec.namespace with the password in
+	// the "password" key, and for Memcached the SASL user in "username". Tenants get a
+	// copy in their namespace.
+	// +optional
+	PasswordSecret string `json:"passwordSecret,omitempty"`
+
+	// ReadyReplicas is the number of ready cache instances.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
+	// Tenants is the number of MoodleTenants referencing the cache cluster.
+	// +optional
+	Tenants int32 `json:"tenants,omitempty"`
+
+	// Conditions represent the latest available observations of the cache cluster.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Type",type=string,JSONPath=`.spec.type`
+// +kubebuilder:printcolumn:name="Namespace",type=string,JSONPath=`.spec.namespace`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+// +kubebuilder:printcolumn:name="Tenants",type=integer,JSONPath=`.status.tenants`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MoodleCacheCluster is the Schema for the moodlecacheclusters API. It runs a Redis
+// server or a Memcached pool that MoodleTenants share through spec.cache.clusterRef,
+// each under a key prefix of its own.
+type MoodleCacheCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MoodleCacheClusterSpec   `json:"spec,omitempty"`
+	Status MoodleCacheClusterStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MoodleCacheClusterList contains a list of MoodleCacheCluster
+type MoodleCacheClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MoodleCacheCluster `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MoodleCacheCluster{}, &MoodleCacheClusterList{})
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a MoodleDatabaseDump.
+const (
+	// ConditionDumpComplete reports whether the dump has finished, successfully or not.
+	ConditionDumpComplete = "Complete"
+)
+
+// Phases of a MoodleDatabaseDump.
+const (
+	DumpPhasePending   = "Pending"
+	DumpPhaseRunning   = "Running"
+	DumpPhaseSucceeded = "Succeeded"
+	DumpPhaseFailed    = "Failed"
+)
+
+// MoodleDatabaseDumpSpec defines the desired state of MoodleDatabaseDump. A dump runs
+// once; create a new MoodleDatabaseDump for another dump.
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+type MoodleDatabaseDumpSpec struct {
+	// TenantRef is the MoodleTenant in the same namespace whose database is dumped.
+	// +kubebuilder:validation:Required
+	TenantRef corev1.LocalObjectReference `json:"tenantRef"`
+
+	// Destination of the dump file.
+	// +kubebuilder:validation:Required
+	Destination DumpDestinationSpec `json:"destination"`
+
+	// Format is plain for a gzip-compressed SQL script, or custom for the pg_dump custom
+	// format restored with pg_restore, PostgreSQL only.
+	// +kubebuilder:validation:Enum=plain;custom
+	// +kubebuilder:default:="plain"
+	// +optional
+	Format string `json:"format,omitempty"`
+
+	// Image with the dump client. Defaults to postgres:17-alpine for PostgreSQL and
+	// mariadb:11 for MySQL and MariaDB.
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// DumpDestinationSpec defines where the dump file is written.
+// +kubebuilder:validation:XValidation:rule="has(self.pvc) != has(self.s3)",message="exactly one of pvc and s3 is required"
+type DumpDestinationSpec struct {
+	// PVC writes the dump to a PersistentVolumeClaim in the tenant namespace.
+	// +optional
+	PVC *DumpPVCDestination `json:"pvc,omitempty"`
+
+	// S3 uploads the dump to an S3-compatible object store.
+	// +optional
+	S3 *DumpS3Destination `json:"s3,omitempty"`
+}
+
+// DumpPVCDestination is a PersistentVolumeClaim destination.
+type DumpPVCDestination struct {
+	// ClaimName of a PersistentVolumeClaim in the tenant namespace, e.g. <tenant>-data
+	// for moodledata.
+	// +kubebuilder:validation:Required
+	ClaimName string `json:"claimName"`
+
+	// Path of the dump directory inside the volume.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9._/-]*$`
+	// +kubebuilder:default:="dumps"
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// DumpS3Destination is an object store destination.
+type DumpS3Destination struct {
+	// Bucket of the dump.
+	// +kubebuilder:validation:Required
+	Bucket string `json:"bucket"`
+
+	// Prefix of the object key.
+	// +optional
+	Prefix string `json:"prefix,omitempty"`
+
+	// EndpointURL of an S3-compatible object store other than AWS.
+	// +optional
+	EndpointURL string `json:"endpointURL,omitempty"`
+
+	// Region of the bucket.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// CredentialsSecretRef is the name of a secret in the MoodleDatabaseDump namespace
+	// with the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY keys. It is copied into the
+	// tenant namespace while the dump runs.
+	// +kubebuilder:validation:Required
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+}
+
+// MoodleDatabaseDumpStatus defines the observed state of MoodleDatabaseDump
+type MoodleDatabaseDumpStatus struct {
+	// Phase of the dump: Pending, Running, Succeeded or Failed.
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// Artifact is the location of the dump file, pvc://<namespace>/<claim>/<path> or
+	// s3://<bucket>/<key>.
+	// +optional
+	Artifact string `json:"artifact,omitempty"`
+
+	// JobName is the Job running the dump in the tenant namespace.
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+
+	// StartTime is when the dump Job was created.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the dump finished.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Conditions represent the latest available observations of the dump.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Tenant",type=string,JSONPath=`.spec.tenantRef.name`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Artifact",type=string,JSONPath=`.status.artifact`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MoodleDatabaseDump is the Schema for the moodledatabasedumps API. It dumps the
+// database of a MoodleTenant once.
+type MoodleDatabaseDump struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MoodleDatabaseDumpSpec   `json:"spec,omitempty"`
+	Status MoodleDatabaseDumpStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MoodleDatabaseDumpList contains a list of MoodleDatabaseDump
+type MoodleDatabaseDumpList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MoodleDatabaseDump `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MoodleDatabaseDump{}, &MoodleDatabaseDumpList{})
+}
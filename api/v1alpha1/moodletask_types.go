@@ -0,0 +1,127 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a MoodleTask.
+const (
+	// ConditionTaskComplete reports whether the task has finished, successfully or not.
+	ConditionTaskComplete = "Complete"
+)
+
+// Phases of a MoodleTask.
+const (
+	TaskPhasePending   = "Pending"
+	TaskPhaseRunning   = "Running"
+	TaskPhaseSucceeded = "Succeeded"
+	TaskPhaseFailed    = "Failed"
+)
+
+// MoodleTaskSpec defines the desired state of MoodleTask. A task runs once; create a new
+// MoodleTask to run the script again.
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+type MoodleTaskSpec struct {
+	// TenantRef is the MoodleTenant in the same namespace the script runs for.
+	// +kubebuilder:validation:Required
+	TenantRef corev1.LocalObjectReference `json:"tenantRef"`
+
+	// Script is the path of a Moodle CLI script relative to the Moodle root, e.g.
+	// admin/cli/purge_caches.php. The operator only runs scripts allowed by its
+	// --task-allowed-scripts flag.
+	// +kubebuilder:validation:Pattern=`^([a-z0-9_]+/)+cli/[a-z0-9_]+\.php$`
+	// +kubebuilder:validation:Required
+	Script string `json:"script"`
+
+	// Args of the script, e.g. --username=admin.
+	// +optional
+	Args []string `json:"args,omitempty"`
+
+	// TimeoutSeconds is how long the script may run before it is stopped.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=3600
+	// +optional
+	TimeoutSeconds int64 `json:"timeoutSeconds,omitempty"`
+}
+
+// MoodleTaskStatus defines the observed state of MoodleTask
+type MoodleTaskStatus struct {
+	// Phase of the task: Pending, Running, Succeeded or Failed.
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// JobName is the Job running the script in the tenant namespace.
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+
+	// PodName is the pod of the Job in the tenant namespace, whose logs hold the output
+	// of the script: kubectl logs -n tenant-<tenant> <podName>.
+	// +optional
+	PodName string `json:"podName,omitempty"`
+
+	// ExitCode of the script.
+	// +optional
+	ExitCode *int32 `json:"exitCode,omitempty"`
+
+	// StartTime is when the Job was created.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the task finished.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Conditions represent the latest available observations of the task.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Tenant",type=string,JSONPath=`.spec.tenantRef.name`
+// +kubebuilder:printcolumn:name="Script",type=string,JSONPath=`.spec.script`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Exit Code",type=integer,JSONPath=`.status.exitCode`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MoodleTask is the Schema for the moodletasks API. It runs a Moodle CLI script for a
+// MoodleTenant once, so that site administrators need no kubectl exec.
+type MoodleTask struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MoodleTaskSpec   `json:"spec,omitempty"`
+	Status MoodleTaskStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MoodleTaskList contains a list of MoodleTask
+type MoodleTaskList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MoodleTask `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MoodleTask{}, &MoodleTaskList{})
+}
@@ -18,6 +18,7 @@ package v1alpha1
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -26,15 +27,47 @@ import (
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // MoodleTenantSpec defines the desired state of MoodleTenant
+// +kubebuilder:validation:XValidation:rule="!has(self.storage.layout) || self.storage.layout.type != 'emptyDir' || !has(self.hpa) || !has(self.hpa.enabled) || !self.hpa.enabled || (has(self.hpa.maxReplicas) && self.hpa.maxReplicas <= 1)",message="a storage layout of type emptyDir cannot be shared by the replicas of the HPA, use type pvc"
+// +kubebuilder:validation:XValidation:rule="!has(self.sessions) || !has(self.sessions.backend) || self.sessions.backend == 'auto' || !has(self.cache) || !has(self.cache.sessions) || self.cache.sessions == 'auto'",message="sessions.backend replaces cache.sessions, set only one of them"
+// +kubebuilder:validation:XValidation:rule="!has(self.sessions) || !has(self.sessions.backend) || self.sessions.backend != 'redis' || (has(self.cache) && (has(self.cache.clusterRef) || (has(self.cache.type) && self.cache.type == 'redis')))",message="sessions backend redis requires cache type redis or a cache cluster"
+// +kubebuilder:validation:XValidation:rule="!has(self.sessions) || !has(self.sessions.backend) || self.sessions.backend != 'memcached' || (has(self.cache) && has(self.cache.clusterRef)) || (has(self.memcached) && has(self.memcached.mode) && self.memcached.mode == 'shared')",message="sessions backend memcached requires memcached mode shared or a cache cluster"
+// +kubebuilder:validation:XValidation:rule="!has(self.cache) || !has(self.cache.exporter) || has(self.cache.clusterRef) || (has(self.cache.type) && self.cache.type == 'redis') || !has(self.memcached) || !has(self.memcached.auth)",message="cache.exporter cannot read the statistics of Memcached with auth"
+// +kubebuilder:validation:XValidation:rule="!has(self.dnsPolicy) || self.dnsPolicy != 'None' || has(self.dnsConfig)",message="dnsPolicy None requires dnsConfig"
 type MoodleTenantSpec struct {
-	// Hostname for the Moodle instance.
+	// Hostname for the Moodle instance. This is the canonical wwwroot.
 	// +kubebuilder:validation:Required
 	Hostname string `json:"hostname"`
 
+	// AdditionalHostnames are alias domains served by the same Moodle instance,
+	// e.g. legacy short domains. Moodle redirects them to the canonical hostname.
+	// +listType=set
+	// +optional
+	AdditionalHostnames []string `json:"additionalHostnames,omitempty"`
+
 	// Image for the Moodle container.
 	// +kubebuilder:validation:Required
 	Image string `json:"image"`
 
+	// ClassRef is the cluster-scoped MoodleTenantClass whose presets fill in the
+	// resources, HPA, PHP settings, cache and storage class fields the tenant leaves
+	// unset. A field counts as unset at its zero value or schema default.
+	// +optional
+	ClassRef *corev1.LocalObjectReference `json:"classRef,omitempty"`
+
+	// Upgrade configures the backups taken before the upgrade to a new image.
+	// +optional
+	Upgrade UpgradeSpec `json:"upgrade,omitempty"`
+
+	// Rollout configures how the Moodle Deployment moves to a new pod template.
+	// +optional
+	Rollout RolloutSpec `json:"rollout,omitempty"`
+
+	// MaintenanceWindow restricts disruptive actions, upgrades with the rollout of their
+	// image and storage resizes, to recurring windows outside freeze periods. They run at
+	// any time when unset.
+	// +optional
+	MaintenanceWindow *MaintenanceWindowSpec `json:"maintenanceWindow,omitempty"`
+
 	// Resources for the Moodle container.
 	// +optional
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
@@ -43,6 +76,11 @@ type MoodleTenantSpec struct {
 	// +optional
 	HPA HPASpec `json:"hpa,omitempty"`
 
+	// Scaling changes the replicas of Moodle on a schedule, e.g. up before morning lectures
+	// and down at night, through the bounds of the HPA while it is enabled.
+	// +optional
+	Scaling *ScalingSpec `json:"scaling,omitempty"`
+
 	// Storage configuration for the Moodle instance.
 	// +kubebuilder:validation:Required
 	Storage StorageSpec `json:"storage"`
@@ -51,6 +89,11 @@ type MoodleTenantSpec struct {
 	// +kubebuilder:validation:Required
 	DatabaseRef DatabaseRefSpec `json:"databaseRef"`
 
+	// Install installs Moodle into an empty database before the Deployment starts,
+	// instead of leaving the web installer to the first visitor.
+	// +optional
+	Install *InstallSpec `json:"install,omitempty"`
+
 	// PHPSettings for the Moodle instance.
 	// +optional
 	PHPSettings PHPSettingsSpec `json:"phpSettings,omitempty"`
@@ -58,6 +101,478 @@ type MoodleTenantSpec struct {
 	// Memcached configuration for the Moodle instance.
 	// +optional
 	Memcached MemcachedSpec `json:"memcached,omitempty"`
+
+	// Cache selects the cache and session backend of the Moodle instance.
+	// +optional
+	Cache CacheSpec `json:"cache,omitempty"`
+
+	// Sessions selects where the Moodle instance keeps sessions.
+	// +optional
+	Sessions SessionsSpec `json:"sessions,omitempty"`
+
+	// CacheWarmup primes the caches of the Moodle instance once the rollout of a new
+	// image has completed, so that the first users after an upgrade do not wait for
+	// them to be rebuilt.
+	// +optional
+	CacheWarmup *CacheWarmupSpec `json:"cacheWarmup,omitempty"`
+
+	// Cron configures how Moodle's cron.php runs, from a CronJob or a Deployment.
+	// +optional
+	Cron CronSpec `json:"cron,omitempty"`
+
+	// ExtraCronJobs are scheduled CLI scripts run next to cron.php, e.g. automated
+	// backups or plugin maintenance, in pods set up like the cron pods.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	ExtraCronJobs []ExtraCronJobSpec `json:"extraCronJobs,omitempty"`
+
+	// Housekeeping runs a CronJob that removes stale files from the temp, trash and
+	// session directories, which Moodle itself does not fully clean up.
+	// +optional
+	Housekeeping *HousekeepingSpec `json:"housekeeping,omitempty"`
+
+	// Notifications configures where the operator reports problems of the tenant that
+	// need attention, e.g. repeated cron failures.
+	// +optional
+	Notifications *NotificationsSpec `json:"notifications,omitempty"`
+
+	// Exposure configuration for in-cluster access to the Moodle instance.
+	// +optional
+	Exposure ExposureSpec `json:"exposure,omitempty"`
+
+	// Locale defaults for the Moodle instance.
+	// +optional
+	Locale LocaleSpec `json:"locale,omitempty"`
+
+	// DNSPolicy for the Moodle and cron pods. Defaults to ClusterFirst. None requires
+	// dnsConfig with the nameservers.
+	// +kubebuilder:validation:Enum=ClusterFirst;ClusterFirstWithHostNet;Default;None
+	// +optional
+	DNSPolicy corev1.DNSPolicy `json:"dnsPolicy,omitempty"`
+
+	// DNSConfig for the Moodle and cron pods, e.g. a corporate resolver or a lower ndots.
+	// +optional
+	DNSConfig *corev1.PodDNSConfig `json:"dnsConfig,omitempty"`
+
+	// Integrations with external services.
+	// +optional
+	Integrations IntegrationsSpec `json:"integrations,omitempty"`
+
+	// DataRetention policies enforced through Moodle site settings.
+	// +optional
+	DataRetention DataRetentionSpec `json:"dataRetention,omitempty"`
+
+	// Ingress configuration for the Moodle instance.
+	// +optional
+	Ingress IngressSpec `json:"ingress,omitempty"`
+
+	// TLS configuration for the Moodle instance.
+	// +optional
+	TLS TLSSpec `json:"tls,omitempty"`
+
+	// BackendTLS encrypts the traffic between the Ingress and the Moodle pods.
+	// +optional
+	BackendTLS *BackendTLSSpec `json:"backendTLS,omitempty"`
+
+	// Service configuration for the Moodle instance.
+	// +optional
+	Service ServiceSpec `json:"service,omitempty"`
+
+	// DataScan configures an anti-virus and orphaned file scan of moodledata, e.g. after
+	// importing legacy data. A tenant restored from databaseRef.restoreFrom, such as a
+	// clone, is scanned once the restore finished.
+	// +optional
+	DataScan *DataScanSpec `json:"dataScan,omitempty"`
+
+	// ExternalDNS publishes DNS records for the tenant hostname through external-dns.
+	// +optional
+	ExternalDNS *ExternalDNSSpec `json:"externalDNS,omitempty"`
+
+	// Routing configuration for external traffic to the Moodle instance.
+	// +optional
+	Routing RoutingSpec `json:"routing,omitempty"`
+
+	// Mesh integrates the Moodle instance with an Istio service mesh.
+	// +optional
+	Mesh *MeshSpec `json:"mesh,omitempty"`
+
+	// NetworkPolicy configuration for the tenant namespace.
+	// +optional
+	NetworkPolicy NetworkPolicySpec `json:"networkPolicy,omitempty"`
+
+	// Mail configures outgoing email through an SMTP relay. Without it Moodle never sends email.
+	// +optional
+	Mail *MailSpec `json:"mail,omitempty"`
+
+	// MaintenancePage configures the static page served while no Moodle pod is ready.
+	// +optional
+	MaintenancePage MaintenancePageSpec `json:"maintenancePage,omitempty"`
+
+	// MaintenanceMode puts the site into the CLI maintenance mode of Moodle while set,
+	// and takes it out again when removed.
+	// +optional
+	MaintenanceMode *MaintenanceModeSpec `json:"maintenanceMode,omitempty"`
+
+	// Suspended scales Moodle and cron to zero and serves a "temporarily unavailable" page,
+	// e.g. for an inactive faculty. The data volume and the database are kept.
+	// +optional
+	Suspended bool `json:"suspended,omitempty"`
+
+	// Hibernation hibernates the tenant like spec.suspended once no user has accessed the
+	// site for a while, and wakes it on the first request.
+	// +optional
+	Hibernation *HibernationSpec `json:"hibernation,omitempty"`
+
+	// Decommission archives the tenant to an object store when the MoodleTenant is
+	// deleted. The namespace and the database are only removed once the archive is complete.
+	// +optional
+	Decommission *DecommissionSpec `json:"decommission,omitempty"`
+}
+
+// HibernationSpec defines when an idle MoodleTenant is hibernated.
+type HibernationSpec struct {
+	// IdleDays is how many days no user may have accessed the site before it is hibernated.
+	// +kubebuilder:default:=30
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	IdleDays int32 `json:"idleDays,omitempty"`
+
+	// WakeOnRequest wakes the hibernated tenant on the first request to the site, when the
+	// operator runs its activator. Otherwise it is woken through the moodle.bsu.by/wake
+	// annotation or by removing spec.hibernation. Defaults to true.
+	// +kubebuilder:default:=true
+	// +optional
+	WakeOnRequest *bool `json:"wakeOnRequest,omitempty"`
+}
+
+// DecommissionSpec defines the final archive of a deleted MoodleTenant: a dump of the
+// database, a tarball of moodledata and backups of all courses, uploaded to
+// <prefix>/<tenant>/ in the bucket.
+type DecommissionSpec struct {
+	// S3 is the object store of the archive. The credentials Secret is in the MoodleTenant
+	// namespace.
+	// +kubebuilder:validation:Required
+	S3 DumpS3Destination `json:"s3"`
+
+	// CourseBackups includes a Moodle backup (.mbz) of every course, made with the general
+	// backup settings of the site.
+	// +kubebuilder:default:=true
+	// +optional
+	CourseBackups *bool `json:"courseBackups,omitempty"`
+}
+
+// InstallSpec defines the first-time installation of a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="self.agreeLicense",message="the installation requires agreeing to the GPL license of Moodle"
+type InstallSpec struct {
+	// AgreeLicense agrees to the GPL license of Moodle on behalf of the site.
+	// +kubebuilder:validation:Required
+	AgreeLicense bool `json:"agreeLicense"`
+
+	// SiteName is the full name of the site.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	SiteName string `json:"siteName"`
+
+	// ShortName is the short name of the site, shown in the navigation bar.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	ShortName string `json:"shortName"`
+
+	// Summary is the description of the site on its front page.
+	// +optional
+	Summary string `json:"summary,omitempty"`
+
+	// Lang is the default language of the site. Other languages than en need their
+	// language pack in the image.
+	// +kubebuilder:default:="en"
+	// +optional
+	Lang string `json:"lang,omitempty"`
+
+	// AdminUser is the username of the administrator account.
+	// +kubebuilder:default:="admin"
+	// +optional
+	AdminUser string `json:"adminUser,omitempty"`
+
+	// AdminEmail is the email address of the administrator account.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	AdminEmail string `json:"adminEmail"`
+
+	// AdminPasswordSecretRef is a Secret in the namespace of the MoodleTenant with the
+	// password of the administrator account under the key password. A password is
+	// generated into the <name>-admin Secret of the tenant namespace when unset.
+	// +optional
+	AdminPasswordSecretRef *corev1.LocalObjectReference `json:"adminPasswordSecretRef,omitempty"`
+
+	// SupportEmail is the address users are shown for support. Defaults to adminEmail.
+	// +optional
+	SupportEmail string `json:"supportEmail,omitempty"`
+}
+
+// MaintenanceModeSpec defines the maintenance mode of a MoodleTenant.
+type MaintenanceModeSpec struct {
+	// Message shown to users instead of Moodle's default, as HTML.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StaticPage also routes the Ingress to the maintenance page instead of Moodle.
+	// +optional
+	StaticPage bool `json:"staticPage,omitempty"`
+}
+
+// MaintenancePageSpec defines the maintenance page of a MoodleTenant.
+type MaintenancePageSpec struct {
+	// Enabled swaps the Ingress backend to a static maintenance page while no Moodle pod
+	// is ready, e.g. during upgrades, and back once Moodle is ready again. Defaults to true.
+	// +kubebuilder:default:=true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// CronSpec defines how Moodle's cron.php runs for a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="!has(self.keepAliveSeconds) || !has(self.staleAfterMinutes) || self.keepAliveSeconds < self.staleAfterMinutes * 60",message="keepAliveSeconds must be shorter than staleAfterMinutes"
+type CronSpec struct {
+	// Suspend stops cron, e.g. for a maintenance window. Runs already started are not
+	// stopped. Cron is also suspended while an upgrade or a database restore is pending.
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Mode is cronjob to start cron.php from a CronJob on schedule, or deployment for
+	// an always-on Deployment that runs cron.php with --keep-alive in a loop. The
+	// runner picks up due tasks within a minute, without scheduling a pod for every
+	// run, at the cost of a pod that is always there.
+	// +kubebuilder:validation:Enum=cronjob;deployment
+	// +kubebuilder:default:="cronjob"
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// KeepAliveSeconds is how long a cron.php run of the deployment mode, or of the
+	// cronjob mode with a parallelism above one, keeps processing tasks before it exits.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=300
+	// +optional
+	KeepAliveSeconds int32 `json:"keepAliveSeconds,omitempty"`
+
+	// Replicas is the number of runners of the deployment mode. Moodle locks every
+	// task, so additional runners process more tasks side by side.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=1
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Schedule of cron.php in cron format for the cronjob mode. Moodle recommends every
+	// minute to every five minutes.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:default:="*/5 * * * *"
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// TimeZone of the schedules of the CronJobs, including extraCronJobs and
+	// housekeeping, e.g. Europe/Minsk, so that nightly jobs run at night on campus.
+	// Defaults to the time zone of the controller manager, usually UTC. Moodle runs its
+	// scheduled tasks in the site timezone regardless.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// ConcurrencyPolicy is Forbid to skip a run while the previous one is still going,
+	// so that slow runs do not pile up, Allow to run them side by side, or Replace to
+	// stop the previous run.
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	// +kubebuilder:default:="Forbid"
+	// +optional
+	ConcurrencyPolicy string `json:"concurrencyPolicy,omitempty"`
+
+	// Parallelism is the number of cron.php processes of a run in the cronjob mode.
+	// With more than one, each process keeps processing tasks for keepAliveSeconds, so
+	// that a task queue longer than the schedule interval is worked off side by side.
+	// keepAliveSeconds should then stay below the interval of the schedule.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	// +kubebuilder:default:=1
+	// +optional
+	Parallelism int32 `json:"parallelism,omitempty"`
+
+	// ScheduledConcurrencyLimit is the number of scheduled tasks Moodle runs at the
+	// same time across all cron processes, 3 by default. Raise it together with
+	// parallelism or replicas, or the additional processes find no task to run.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ScheduledConcurrencyLimit *int32 `json:"scheduledConcurrencyLimit,omitempty"`
+
+	// AdhocConcurrencyLimit is the number of ad hoc tasks Moodle runs at the same time
+	// across all cron processes, 3 by default.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	AdhocConcurrencyLimit *int32 `json:"adhocConcurrencyLimit,omitempty"`
+
+	// ScheduledMaxRuntimeSeconds is how long a cron.php run keeps starting scheduled
+	// tasks, 1800 by default.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ScheduledMaxRuntimeSeconds *int32 `json:"scheduledMaxRuntimeSeconds,omitempty"`
+
+	// AdhocMaxRuntimeSeconds is how long a cron.php run keeps starting ad hoc tasks,
+	// 1800 by default.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	AdhocMaxRuntimeSeconds *int32 `json:"adhocMaxRuntimeSeconds,omitempty"`
+
+	// StartingDeadlineSeconds is how late a missed run may still start, e.g. after the
+	// controller manager was down. Without it missed runs always start.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	StartingDeadlineSeconds *int64 `json:"startingDeadlineSeconds,omitempty"`
+
+	// SuccessfulJobsHistoryLimit is the number of finished Jobs kept.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default:=3
+	// +optional
+	SuccessfulJobsHistoryLimit *int32 `json:"successfulJobsHistoryLimit,omitempty"`
+
+	// FailedJobsHistoryLimit is the number of failed Jobs kept for their logs.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default:=1
+	// +optional
+	FailedJobsHistoryLimit *int32 `json:"failedJobsHistoryLimit,omitempty"`
+
+	// ActiveDeadlineSeconds stops a cron Job that runs longer, so that a hung cron.php
+	// does not hold its pod forever. It should exceed keepAliveSeconds and the longest
+	// task.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// BackoffLimit is how often a failed cron.php is retried within its Job, 6 by
+	// default. The next scheduled run starts anyway, so 0 keeps failing runs from
+	// hammering a broken database.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// Resources of the cron container. The requests and limits given replace the
+	// defaults of 100m CPU and 256Mi memory requested, and 500m CPU and 512Mi memory at
+	// most. Backups run through cron and need far more memory on big sites.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// NodeSelector places the cron pods, e.g. on batch nodes.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations of the cron pods, e.g. for tainted batch nodes.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity of the cron pods.
+	// +optional
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// ScheduledTasks override the schedules of Moodle scheduled tasks through config.php,
+	// so that they survive re-provisioning and cannot be changed in the admin UI.
+	// +listType=map
+	// +listMapKey=task
+	// +optional
+	ScheduledTasks []ScheduledTaskOverride `json:"scheduledTasks,omitempty"`
+
+	// FailureThreshold is the number of cron Jobs failing in a row after which the
+	// CronFailing condition turns True, a Warning event is emitted and the notification
+	// webhook is called.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=3
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+
+	// StaleAfterMinutes is how long after the last successful run the CronStale
+	// condition turns True. It must exceed the interval of the schedule.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=60
+	// +optional
+	StaleAfterMinutes int32 `json:"staleAfterMinutes,omitempty"`
+}
+
+// HousekeepingSpec defines the moodledata housekeeping of a MoodleTenant.
+type HousekeepingSpec struct {
+	// Schedule of the housekeeping in cron format.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:default:="30 3 * * *"
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// TempRetentionHours is how long files stay in $CFG->tempdir after their last
+	// change. It must exceed the longest backup or restore.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=24
+	// +optional
+	TempRetentionHours int32 `json:"tempRetentionHours,omitempty"`
+
+	// TrashRetentionHours is how long files stay in $CFG->trashdir, from where Moodle
+	// restores files of the file pool that went missing.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=96
+	// +optional
+	TrashRetentionHours int32 `json:"trashRetentionHours,omitempty"`
+
+	// SessionRetentionHours is how long file sessions stay in moodledata after their
+	// last use. It must exceed the session timeout of the site.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=24
+	// +optional
+	SessionRetentionHours int32 `json:"sessionRetentionHours,omitempty"`
+}
+
+// NotificationsSpec defines the notifications of a MoodleTenant.
+type NotificationsSpec struct {
+	// WebhookSecretRef is the name of a secret in the MoodleTenant namespace whose url
+	// key holds the URL notifications are posted to as JSON, e.g. a Slack, Mattermost or
+	// Teams incoming webhook. The message is in the text field.
+	// +kubebuilder:validation:Required
+	WebhookSecretRef corev1.LocalObjectReference `json:"webhookSecretRef"`
+}
+
+// ScheduledTaskOverride overrides the schedule of Moodle scheduled tasks.
+// +kubebuilder:validation:XValidation:rule="has(self.schedule) || has(self.disabled)",message="schedule or disabled is required"
+type ScheduledTaskOverride struct {
+	// Task is the class name of the task, e.g. \core\task\stats_cron_task, or a
+	// pattern ending in * for all tasks of a component, e.g. \mod_forum\task\*.
+	// +kubebuilder:validation:Pattern=`^(\\[A-Za-z0-9_]+)+(\\\*)?$`
+	// +kubebuilder:validation:Required
+	Task string `json:"task"`
+
+	// Schedule of the task as minute, hour, day, month and day of week, e.g. 0 * * * *
+	// for hourly. Moodle's R for a random value is allowed.
+	// +kubebuilder:validation:Pattern=`^\S+ \S+ \S+ \S+ \S+$`
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Disabled stops the task from running.
+	// +optional
+	Disabled *bool `json:"disabled,omitempty"`
+}
+
+// ExtraCronJobSpec defines a scheduled CLI script of a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="has(self.command) || has(self.args)",message="command or args is required"
+type ExtraCronJobSpec struct {
+	// Name of the job, which suffixes the <name>-cron- CronJob.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=20
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Schedule of the job in cron format.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Schedule string `json:"schedule"`
+
+	// Command of the job. Defaults to /usr/local/bin/php.
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// Args of the command, e.g. /var/www/html/admin/cli/automated_backups.php. Relative
+	// paths are resolved in /var/www/html.
+	// +optional
+	Args []string `json:"args,omitempty"`
 }
 
 // HPASpec defines the HPA configuration for a MoodleTenant.
@@ -83,70 +598,1861 @@ type HPASpec struct {
 	TargetCPU *int32 `json:"targetCPU,omitempty"`
 }
 
-// StorageSpec defines the storage configuration for a MoodleTenant.
-type StorageSpec struct {
-	// Size of the persistent volume.
-	// +kubebuilder:validation:Required
-	Size resource.Quantity `json:"size"`
-
-	// StorageClass for the persistent volume.
-	// +kubebuilder:default:="csi-cephfs-sc"
+// ScalingSpec defines the scheduled scaling of a MoodleTenant.
+type ScalingSpec struct {
+	// TimeZone of the schedules, e.g. Europe/Minsk. Defaults to UTC.
+	// +kubebuilder:validation:MinLength=1
 	// +optional
-	StorageClass string `json:"storageClass,omitempty"`
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// Schedules set the replicas from when they fire until another one does. Without a
+	// schedule that fired in the last 8 days, the replicas of the HPA apply.
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:MinItems=1
+	Schedules []ScalingSchedule `json:"schedules"`
 }
 
-// DatabaseRefSpec defines the database reference for a MoodleTenant.
-type DatabaseRefSpec struct {
-	// Host of the database.
+// ScalingSchedule is a scheduled change of the replicas of a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="!has(self.maxReplicas) || self.maxReplicas >= self.minReplicas",message="maxReplicas must not be below minReplicas"
+type ScalingSchedule struct {
+	// Name identifies the schedule, e.g. lectures.
+	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:validation:Required
-	Host string `json:"host"`
+	Name string `json:"name"`
 
-	// AdminSecret is the name of the secret containing the admin credentials for the database.
+	// Schedule of the change as minute, hour, day, month and day of week, e.g.
+	// 30 7 * * 1-5 for 7:30 am on weekdays.
+	// +kubebuilder:validation:Pattern=`^\S+ \S+ \S+ \S+ \S+$`
 	// +kubebuilder:validation:Required
-	AdminSecret string `json:"adminSecret"`
+	Schedule string `json:"schedule"`
 
-	// Name of the database.
+	// MinReplicas is the number of replicas, or the minimum of the HPA while it is enabled.
+	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:validation:Required
-	Name string `json:"name"`
+	MinReplicas int32 `json:"minReplicas"`
 
-	// User for the database.
+	// MaxReplicas is the maximum of the HPA. Defaults to hpa.maxReplicas, raised to
+	// minReplicas if below.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxReplicas *int32 `json:"maxReplicas,omitempty"`
+}
+
+// RolloutSpec defines how the Moodle Deployment of a MoodleTenant is rolled out.
+type RolloutSpec struct {
+	// Strategy is RollingUpdate to replace the pods of the Deployment a few at a time, or
+	// BlueGreen to bring up a second Deployment with the new pod template against the
+	// same data and switch the Service to it once all its pods are ready.
+	// +kubebuilder:validation:Enum=RollingUpdate;BlueGreen
+	// +kubebuilder:default:="RollingUpdate"
+	// +optional
+	Strategy string `json:"strategy,omitempty"`
+
+	// ScaleDownDelaySeconds is how long the previous Deployment of the BlueGreen
+	// strategy keeps running after the switch, for the moodle.bsu.by/revert-rollout
+	// annotation to switch back to it.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default:=600
+	// +optional
+	ScaleDownDelaySeconds *int32 `json:"scaleDownDelaySeconds,omitempty"`
+}
+
+// MaintenanceWindowSpec defines when disruptive actions may run on a MoodleTenant.
+type MaintenanceWindowSpec struct {
+	// Schedule of the starts of the windows as minute, hour, day, month and day of week,
+	// e.g. 0 2 * * 6,0 for 2 am on weekends.
+	// +kubebuilder:validation:Pattern=`^\S+ \S+ \S+ \S+ \S+$`
 	// +kubebuilder:validation:Required
-	User string `json:"user"`
+	Schedule string `json:"schedule"`
+
+	// DurationMinutes is how long each window stays open.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10080
+	// +kubebuilder:default:=120
+	// +optional
+	DurationMinutes int32 `json:"durationMinutes,omitempty"`
+
+	// TimeZone of the schedule, e.g. Europe/Minsk. Defaults to UTC.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	TimeZone *string `json:"timeZone,omitempty"`
+
+	// Freezes are periods, e.g. exam sessions, in which no window opens.
+	// +optional
+	Freezes []FreezePeriod `json:"freezes,omitempty"`
+}
 
-	// Password for the database.
+// FreezePeriod is a period without maintenance windows.
+// +kubebuilder:validation:XValidation:rule="self.start < self.end",message="start must be before end"
+type FreezePeriod struct {
+	// Start of the freeze.
 	// +kubebuilder:validation:Required
-	Password string `json:"password"`
+	Start metav1.Time `json:"start"`
+
+	// End of the freeze.
+	// +kubebuilder:validation:Required
+	End metav1.Time `json:"end"`
+
+	// Reason of the freeze, e.g. winter exams.
+	// +optional
+	Reason string `json:"reason,omitempty"`
 }
 
-// PHPSettingsSpec defines the PHP settings for a MoodleTenant.
-type PHPSettingsSpec struct {
-	// MaxExecutionTime for PHP scripts.
-	// +kubebuilder:default:=60
+// UpgradeSpec defines the backups taken before an upgrade of a MoodleTenant. The upgrade
+// waits for them and is blocked when one fails.
+// +kubebuilder:validation:XValidation:rule="!has(self.rollback) || has(self.dump)",message="rollback restores the database from the dump and requires it"
+type UpgradeSpec struct {
+	// Snapshot takes a CSI VolumeSnapshot of moodledata.
 	// +optional
-	MaxExecutionTime int `json:"maxExecutionTime,omitempty"`
+	Snapshot *UpgradeSnapshotSpec `json:"snapshot,omitempty"`
 
-	// MemoryLimit for PHP scripts.
-	// +kubebuilder:default:="512M"
+	// Dump creates a MoodleDatabaseDump of the database to this destination.
 	// +optional
-	MemoryLimit string `json:"memoryLimit,omitempty"`
+	Dump *DumpDestinationSpec `json:"dump,omitempty"`
+
+	// Rollback rolls a failed upgrade back to the previous image and restores the
+	// database from the dump. Moodle refuses to run code older than its database, so the
+	// image is never rolled back alone.
+	// +optional
+	Rollback *UpgradeRollbackSpec `json:"rollback,omitempty"`
 }
 
-// MemcachedSpec defines the Memcached configuration for a MoodleTenant.
-type MemcachedSpec struct {
-	// MemoryMB is the memory limit for Memcached in megabytes.
-	// +kubebuilder:default:=128
+// UpgradeRollbackSpec defines when a failed upgrade of a MoodleTenant is rolled back.
+type UpgradeRollbackSpec struct {
+	// RolloutTimeoutSeconds is how long the rollout of the new image may take after
+	// upgrade.php succeeded before the upgrade counts as failed. A failed upgrade.php is
+	// rolled back right away.
+	// +kubebuilder:validation:Minimum=60
+	// +kubebuilder:default:=600
 	// +optional
-	MemoryMB int `json:"memoryMB,omitempty"`
+	RolloutTimeoutSeconds int32 `json:"rolloutTimeoutSeconds,omitempty"`
 }
 
-// MoodleTenantStatus defines the observed state of MoodleTenant
-type MoodleTenantStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+// UpgradeSnapshotSpec defines the moodledata VolumeSnapshot taken before an upgrade.
+type UpgradeSnapshotSpec struct {
+	// VolumeSnapshotClassName of the snapshot. Defaults to the default class of the CSI
+	// driver of moodledata.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+}
+
+// StorageSpec defines the storage configuration for a MoodleTenant.
+type StorageSpec struct {
+	// Size of the persistent volume.
+	// +kubebuilder:validation:Required
+	Size resource.Quantity `json:"size"`
+
+	// StorageClass for the persistent volume.
+	// +kubebuilder:default:="csi-cephfs-sc"
+	// +optional
+	StorageClass string `json:"storageClass,omitempty"`
+
+	// Layout moves the temp, cache and trash directories off moodledata, e.g. to
+	// cheaper or ephemeral storage.
+	// +optional
+	Layout *StorageLayoutSpec `json:"layout,omitempty"`
+
+	// LocalCache configures the local cache directory of the Moodle pods.
+	// +optional
+	LocalCache LocalCacheSpec `json:"localCache,omitempty"`
+}
+
+// StorageLayoutSpec places scratch directories of Moodle on a volume of their own, so
+// that moodledata only holds the file pool.
+// +kubebuilder:validation:XValidation:rule="self.type != 'pvc' || has(self.size)",message="size is required for type pvc"
+type StorageLayoutSpec struct {
+	// Type is pvc for a PersistentVolumeClaim shared by all pods, or emptyDir for a
+	// volume of each pod that is lost with it, for a single replica only.
+	// +kubebuilder:validation:Enum=pvc;emptyDir
+	// +kubebuilder:default:="pvc"
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Directories moved to the volume: temp for $CFG->tempdir, cache for $CFG->cachedir
+	// and trash for $CFG->trashdir.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:items:Enum=temp;cache;trash
+	// +kubebuilder:default:={"temp","cache","trash"}
+	// +listType=set
+	// +optional
+	Directories []string `json:"directories,omitempty"`
+
+	// Size of the PersistentVolumeClaim, or the size limit of the emptyDir.
+	// +optional
+	Size *resource.Quantity `json:"size,omitempty"`
+
+	// StorageClass of the PersistentVolumeClaim. Defaults to the storage class of
+	// moodledata.
+	// +optional
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+// LocalCacheSpec defines the local cache directory of a MoodleTenant.
+type LocalCacheSpec struct {
+	// Enabled keeps $CFG->localcachedir, which Moodle reads on nearly every request, on an
+	// emptyDir of each pod instead of the moodledata volume, which is slow on network
+	// storage such as CephFS. Defaults to true.
+	// +kubebuilder:default:=true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// SizeLimit of the emptyDir. Pods exceeding it are evicted.
+	// +kubebuilder:default:="1Gi"
+	// +optional
+	SizeLimit *resource.Quantity `json:"sizeLimit,omitempty"`
+}
+
+// DatabaseRefSpec defines the database reference for a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="(has(self.mode) && self.mode in ['cnpg', 'zalando']) || has(self.externalSecretRef) || ((has(self.host) || (has(self.iam) && self.iam.provider == 'gcp')) && (has(self.password) || has(self.iam) || has(self.provisioning)))",message="host and password are required unless mode is cnpg or zalando, they come from externalSecretRef or IAM authentication, or the password is generated for provisioning"
+// +kubebuilder:validation:XValidation:rule="!has(self.mode) || self.mode == 'external' || !has(self.provisioning)",message="provisioning requires mode external"
+// +kubebuilder:validation:XValidation:rule="!has(self.mode) || self.mode == 'external' || !has(self.externalSecretRef)",message="externalSecretRef requires mode external"
+// +kubebuilder:validation:XValidation:rule="!has(self.externalSecretRef) || (!has(self.provisioning) && !has(self.pooler))",message="externalSecretRef cannot be combined with provisioning or pooler"
+// +kubebuilder:validation:XValidation:rule="!has(self.type) || self.type == 'pgsql' || ((!has(self.mode) || self.mode == 'external') && !has(self.provisioning) && !has(self.ssl) && !has(self.exporter))",message="cnpg and zalando modes, provisioning, ssl and exporter require type pgsql"
+// +kubebuilder:validation:XValidation:rule="!has(self.exporter) || !has(self.iam)",message="exporter cannot be combined with iam"
+// +kubebuilder:validation:XValidation:rule="!has(self.pooler) || (has(self.type) && self.type != 'pgsql')",message="pooler requires type mysqli or mariadb"
+// +kubebuilder:validation:XValidation:rule="!has(self.restoreFrom) || (has(oldSelf.restoreFrom) && self.restoreFrom == oldSelf.restoreFrom)",message="restoreFrom can only be set when the tenant is created"
+// +kubebuilder:validation:XValidation:rule="!has(self.restoreFrom) || !has(self.provisioning) || !has(self.provisioning.schema)",message="restoreFrom cannot be combined with a shared database schema"
+// +kubebuilder:validation:XValidation:rule="!has(self.charset) || self.charset == ((!has(self.type) || self.type == 'pgsql') ? 'UTF8' : 'utf8mb4')",message="charset must be UTF8 for pgsql and utf8mb4 for mysqli and mariadb"
+// +kubebuilder:validation:XValidation:rule="!has(self.collation) || !has(self.type) || self.type == 'pgsql' || self.collation.startsWith('utf8mb4_')",message="collation of mysqli and mariadb must be a utf8mb4 collation"
+type DatabaseRefSpec struct {
+	// Mode selects an external database server (default), a CloudNativePG Cluster that
+	// the operator creates in the tenant namespace, or a Zalando postgres-operator cluster.
+	// +kubebuilder:validation:Enum=external;cnpg;zalando
+	// +kubebuilder:default:="external"
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// Type is the Moodle database driver.
+	// +kubebuilder:validation:Enum=pgsql;mysqli;mariadb
+	// +kubebuilder:default:="pgsql"
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Charset of the database. Moodle only supports UTF8 on PostgreSQL and utf8mb4 on
+	// MySQL and MariaDB, which are also the defaults; the field makes the requirement
+	// explicit and is verified against the PostgreSQL server encoding.
+	// +kubebuilder:validation:Enum=UTF8;utf8mb4
+	// +optional
+	Charset string `json:"charset,omitempty"`
+
+	// Collation of the database. On PostgreSQL it is the libc locale, e.g. en_US.UTF-8,
+	// that provisioning and CloudNativePG create the database with and the database
+	// check verifies. On MySQL and MariaDB it is Moodle's dbcollation, by default
+	// utf8mb4_unicode_ci.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_.@-]+$`
+	// +optional
+	Collation string `json:"collation,omitempty"`
+
+	// Port of the database. Defaults to 5432 for pgsql and 3306 for mysqli and mariadb.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port *int32 `json:"port,omitempty"`
+
+	// CNPG configures the CloudNativePG Cluster in cnpg mode.
+	// +optional
+	CNPG CNPGSpec `json:"cnpg,omitempty"`
+
+	// Zalando configures the Zalando postgres-operator cluster in zalando mode.
+	// +optional
+	Zalando ZalandoSpec `json:"zalando,omitempty"`
+
+	// Host of the database. Required unless mode is cnpg or zalando, or the Cloud SQL
+	// Auth Proxy is used.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// AdminSecret is the name of the secret containing the admin credentials for the database.
+	// +kubebuilder:validation:Required
+	AdminSecret string `json:"adminSecret"`
+
+	// Name of the database.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// User for the database.
+	// +kubebuilder:validation:Required
+	User string `json:"user"`
+
+	// Password for the database. Required unless mode is cnpg or zalando, where the
+	// database operator generates it, or IAM authentication is used. With provisioning
+	// the operator generates it when empty and keeps it only in the database Secret.
+	// +optional
+	Password string `json:"password,omitempty"`
+
+	// ExternalSecretRef pulls the database credentials from an external secret manager,
+	// such as Vault or AWS Secrets Manager, through the External Secrets Operator instead
+	// of embedding them in the MoodleTenant. The host, database, username and password
+	// keys of the materialized Secret override the fields above, and the Deployment
+	// waits until the Secret exists. Provisioning and the pooler need the password in
+	// the MoodleTenant and cannot be combined with it.
+	// +optional
+	ExternalSecretRef *DatabaseExternalSecretSpec `json:"externalSecretRef,omitempty"`
+
+	// RestoreFrom seeds the database of a new tenant from a dump, e.g. of a legacy Moodle
+	// site. The restore Job runs once the database is ready and before Moodle first
+	// starts. It can only be set when the tenant is created.
+	// +optional
+	RestoreFrom *DatabaseRestoreSpec `json:"restoreFrom,omitempty"`
+
+	// TablePrefix of the Moodle tables. Tenants sharing one database need distinct prefixes.
+	// +kubebuilder:validation:Pattern=`^[a-z][a-z0-9]*_$`
+	// +kubebuilder:validation:MaxLength=10
+	// +kubebuilder:default:="mdl_"
+	// +optional
+	TablePrefix string `json:"tablePrefix,omitempty"`
+
+	// Options tunes the database connections of Moodle.
+	// +optional
+	Options DatabaseOptionsSpec `json:"options,omitempty"`
+
+	// ReadReplicas are hosts of read-only replicas that Moodle sends reads to through
+	// its readonly database option. They listen on the same port as Host.
+	// +optional
+	ReadReplicas []string `json:"readReplicas,omitempty"`
+
+	// PublishService creates a <tenant>-db Service in the tenant namespace that points to
+	// Host, an ExternalName for hostnames or a Service with an EndpointSlice for IP addresses.
+	// Moodle then connects to the stable in-cluster name, so moving the database only
+	// requires changing Host.
+	// +optional
+	PublishService bool `json:"publishService,omitempty"`
+
+	// IAM authenticates to a managed cloud database with a workload identity instead of
+	// a static password.
+	// +optional
+	IAM *DatabaseIAMSpec `json:"iam,omitempty"`
+
+	// SSL configures TLS for the database connection.
+	// +optional
+	SSL *DatabaseSSLSpec `json:"ssl,omitempty"`
+
+	// Pooler runs ProxySQL in front of a MySQL or MariaDB database. Moodle connects to
+	// ProxySQL, which pools connections and sends reads to the reader hosts.
+	// +optional
+	Pooler *DatabasePoolerSpec `json:"pooler,omitempty"`
+
+	// Provisioning lets the operator create the database and role on the database server.
+	// +optional
+	Provisioning *DatabaseProvisioningSpec `json:"provisioning,omitempty"`
+
+	// Exporter runs a Prometheus postgres_exporter connected with the tenant credentials,
+	// so that database load can be attributed to the tenant.
+	// +optional
+	Exporter *DatabaseExporterSpec `json:"exporter,omitempty"`
+}
+
+// DatabaseExporterSpec defines the Prometheus postgres_exporter of the tenant database.
+type DatabaseExporterSpec struct {
+	// Image of postgres_exporter.
+	// +kubebuilder:default:="quay.io/prometheuscommunity/postgres-exporter:v0.16.0"
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// StatStatements enables the pg_stat_statements collector for per-query latency.
+	// The extension must be installed, and the role needs pg_read_all_stats to see
+	// statements of other roles.
+	// +optional
+	StatStatements bool `json:"statStatements,omitempty"`
+
+	// ServiceMonitor creates a Prometheus Operator ServiceMonitor for the exporter.
+	// Without it the Service carries the prometheus.io scrape annotations.
+	// +optional
+	ServiceMonitor bool `json:"serviceMonitor,omitempty"`
+
+	// PrometheusNamespace is allowed to scrape the exporter through the tenant
+	// NetworkPolicy.
+	// +kubebuilder:default:="monitoring"
+	// +optional
+	PrometheusNamespace string `json:"prometheusNamespace,omitempty"`
+}
+
+// DatabaseExternalSecretSpec references the External Secrets Operator resources that
+// provide the database credentials.
+// +kubebuilder:validation:XValidation:rule="has(self.name) != has(self.storeRef)",message="exactly one of name and storeRef is required"
+// +kubebuilder:validation:XValidation:rule="!has(self.storeRef) || has(self.remoteKey)",message="remoteKey is required with storeRef"
+type DatabaseExternalSecretSpec struct {
+	// Name of an existing ExternalSecret in the MoodleTenant namespace whose target
+	// Secret holds the credentials.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// StoreRef is a SecretStore in the MoodleTenant namespace, or a ClusterSecretStore,
+	// from which the operator pulls the credentials with its own ExternalSecret.
+	// +optional
+	StoreRef *ExternalSecretStoreRef `json:"storeRef,omitempty"`
+
+	// RemoteKey is the key of the credentials in the store. All of its properties are
+	// extracted into the Secret.
+	// +optional
+	RemoteKey string `json:"remoteKey,omitempty"`
+
+	// RefreshInterval is how often the External Secrets Operator syncs the credentials.
+	// +kubebuilder:default:="1h"
+	// +optional
+	RefreshInterval string `json:"refreshInterval,omitempty"`
+}
+
+// ExternalSecretStoreRef references an External Secrets Operator store.
+type ExternalSecretStoreRef struct {
+	// Name of the store.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Kind of the store.
+	// +kubebuilder:validation:Enum=SecretStore;ClusterSecretStore
+	// +kubebuilder:default:="ClusterSecretStore"
+	// +optional
+	Kind string `json:"kind,omitempty"`
+}
+
+// DatabaseOptionsSpec defines the connection options passed to Moodle's dboptions.
+type DatabaseOptionsSpec struct {
+	// Persistent keeps database connections open across requests of a PHP worker.
+	// +optional
+	Persistent bool `json:"persistent,omitempty"`
+
+	// ConnectTimeoutSeconds limits how long Moodle waits for a database connection.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ConnectTimeoutSeconds *int32 `json:"connectTimeoutSeconds,omitempty"`
+}
+
+// DatabaseIAMSpec defines IAM database authentication through a workload identity.
+// +kubebuilder:validation:XValidation:rule="self.provider != 'gcp' || has(self.instanceConnectionName)",message="instanceConnectionName is required for gcp"
+// +kubebuilder:validation:XValidation:rule="self.provider != 'aws' || has(self.region)",message="region is required for aws"
+// +kubebuilder:validation:XValidation:rule="!has(self.serviceAccountName) || (!has(self.roleARN) && !has(self.gcpServiceAccount))",message="serviceAccountName cannot be combined with roleARN or gcpServiceAccount"
+type DatabaseIAMSpec struct {
+	// Provider is aws for RDS IAM authentication, with a sidecar refreshing the token,
+	// or gcp for Cloud SQL IAM authentication through the Cloud SQL Auth Proxy sidecar.
+	// +kubebuilder:validation:Enum=aws;gcp
+	// +kubebuilder:validation:Required
+	Provider string `json:"provider"`
+
+	// ServiceAccountName of an existing ServiceAccount in the tenant namespace bound to
+	// the cloud identity. When empty, the operator creates one from roleARN or
+	// gcpServiceAccount.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// RoleARN is the IAM role bound to the created ServiceAccount through IRSA.
+	// +optional
+	RoleARN string `json:"roleARN,omitempty"`
+
+	// GCPServiceAccount is the Google service account bound to the created
+	// ServiceAccount through GKE Workload Identity.
+	// +optional
+	GCPServiceAccount string `json:"gcpServiceAccount,omitempty"`
+
+	// Region of the RDS instance.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// InstanceConnectionName of the Cloud SQL instance, project:region:instance.
+	// +optional
+	InstanceConnectionName string `json:"instanceConnectionName,omitempty"`
+
+	// Image of the sidecar. Defaults to the AWS CLI or the Cloud SQL Auth Proxy.
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// DatabaseSSLSpec defines the TLS settings of the database connection. They are passed
+// to libpq through the PGSSL* environment variables.
+type DatabaseSSLSpec struct {
+	// Mode is the libpq sslmode.
+	// +kubebuilder:validation:Enum=disable;allow;prefer;require;verify-ca;verify-full
+	// +kubebuilder:default:="verify-full"
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// CASecretRef is the name of a secret in the MoodleTenant namespace with the CA
+	// certificate of the database server in its "ca.crt" key.
+	// +optional
+	CASecretRef *corev1.LocalObjectReference `json:"caSecretRef,omitempty"`
+
+	// CertSecretRef is the name of a kubernetes.io/tls secret in the MoodleTenant
+	// namespace with the client certificate and key.
+	// +optional
+	CertSecretRef *corev1.LocalObjectReference `json:"certSecretRef,omitempty"`
+}
+
+// DatabasePoolerSpec defines the ProxySQL pooler of a MoodleTenant.
+type DatabasePoolerSpec struct {
+	// Replicas of the ProxySQL Deployment.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=2
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Image of ProxySQL.
+	// +kubebuilder:default:="proxysql/proxysql:2.7.1"
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// ReaderHosts are replicas that receive SELECT statements outside transactions.
+	// Writes, locking reads and transactions stay on the primary host.
+	// +optional
+	ReaderHosts []string `json:"readerHosts,omitempty"`
+
+	// MaxConnections to the database per ProxySQL pod and host.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=100
+	// +optional
+	MaxConnections int32 `json:"maxConnections,omitempty"`
+}
+
+// CNPGSpec defines the CloudNativePG Cluster of a MoodleTenant.
+type CNPGSpec struct {
+	// Instances is the number of PostgreSQL instances, the first being the primary.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=1
+	// +optional
+	Instances int32 `json:"instances,omitempty"`
+
+	// ImageName is the PostgreSQL image. Defaults to the CloudNativePG operator default.
+	// +optional
+	ImageName string `json:"imageName,omitempty"`
+
+	// Storage of each instance.
+	// +kubebuilder:default:={size:"10Gi"}
+	// +optional
+	Storage DatabaseStorageSpec `json:"storage,omitempty"`
+
+	// Backup configures barman backups to S3-compatible object storage.
+	// +optional
+	Backup *CNPGBackupSpec `json:"backup,omitempty"`
+
+	// OperatorNamespace is where the CloudNativePG operator runs; it is allowed to reach
+	// the instance status port through the tenant NetworkPolicy.
+	// +kubebuilder:default:="cnpg-system"
+	// +optional
+	OperatorNamespace string `json:"operatorNamespace,omitempty"`
+}
+
+// ZalandoSpec defines the Zalando postgres-operator cluster of a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="!has(self.clusterRef) || !has(self.backup)",message="backup is configured on the referenced cluster itself"
+type ZalandoSpec struct {
+	// ClusterRef references an existing cluster instead of creating one in the tenant
+	// namespace. The database and user must be declared in that cluster.
+	// +optional
+	ClusterRef *ZalandoClusterRef `json:"clusterRef,omitempty"`
+
+	// TeamID of the created cluster, which prefixes its name.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:default:="moodle"
+	// +optional
+	TeamID string `json:"teamId,omitempty"`
+
+	// NumberOfInstances of the created cluster.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=1
+	// +optional
+	NumberOfInstances int32 `json:"numberOfInstances,omitempty"`
+
+	// Version of PostgreSQL of the created cluster.
+	// +kubebuilder:default:="17"
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Volume of each instance of the created cluster.
+	// +kubebuilder:default:={size:"10Gi"}
+	// +optional
+	Volume DatabaseStorageSpec `json:"volume,omitempty"`
+
+	// Backup archives WAL and takes base backups of the created cluster with WAL-G, so
+	// that it can be restored to any point in time.
+	// +optional
+	Backup *ZalandoBackupSpec `json:"backup,omitempty"`
+
+	// OperatorNamespace is where the Zalando postgres-operator runs; it is allowed to
+	// reach the Patroni API of the created cluster through the tenant NetworkPolicy.
+	// +kubebuilder:default:="postgres-operator"
+	// +optional
+	OperatorNamespace string `json:"operatorNamespace,omitempty"`
+}
+
+// ZalandoBackupSpec defines the WAL-G backups of a Zalando postgres-operator cluster
+// in an S3-compatible object store.
+type ZalandoBackupSpec struct {
+	// Bucket of the backups. Spilo stores them under spilo/<cluster>.
+	// +kubebuilder:validation:Required
+	Bucket string `json:"bucket"`
+
+	// EndpointURL of an S3-compatible object store other than AWS.
+	// +optional
+	EndpointURL string `json:"endpointURL,omitempty"`
+
+	// Region of the bucket.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// CredentialsSecretRef is the name of a secret in the MoodleTenant namespace with the
+	// ACCESS_KEY_ID and ACCESS_SECRET_KEY keys. It is copied into the tenant namespace.
+	// +kubebuilder:validation:Required
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+
+	// Schedule of base backups in cron format.
+	// +kubebuilder:default:="0 1 * * *"
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Retain is the number of base backups kept, which bounds how far back the
+	// cluster can be restored.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=5
+	// +optional
+	Retain int32 `json:"retain,omitempty"`
+}
+
+// ZalandoClusterRef references an existing Zalando postgresql resource.
+type ZalandoClusterRef struct {
+	// Name of the postgresql resource.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace of the postgresql resource, where its credentials secrets are.
+	// +kubebuilder:validation:Required
+	Namespace string `json:"namespace"`
+}
+
+// DatabaseStorageSpec defines the volume of each instance of a database cluster
+// managed by a database operator.
+type DatabaseStorageSpec struct {
+	// Size of the volume.
+	// +kubebuilder:default:="10Gi"
+	// +optional
+	Size resource.Quantity `json:"size,omitempty"`
+
+	// StorageClass for the volume. Defaults to the cluster default StorageClass.
+	// +optional
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+// CNPGBackupSpec defines the barman object store backups of the CloudNativePG Cluster.
+type CNPGBackupSpec struct {
+	// DestinationPath is the object store path, e.g. s3://backups/moodle.
+	// +kubebuilder:validation:Required
+	DestinationPath string `json:"destinationPath"`
+
+	// EndpointURL of an S3-compatible object store other than AWS.
+	// +optional
+	EndpointURL string `json:"endpointURL,omitempty"`
+
+	// CredentialsSecretRef is the name of a secret in the MoodleTenant namespace with the
+	// ACCESS_KEY_ID and ACCESS_SECRET_KEY keys. It is copied into the tenant namespace.
+	// +kubebuilder:validation:Required
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+
+	// RetentionPolicy for base backups and WAL, e.g. 30d.
+	// +kubebuilder:default:="30d"
+	// +optional
+	RetentionPolicy string `json:"retentionPolicy,omitempty"`
+
+	// Schedule of base backups in the six-field cron format of CloudNativePG,
+	// seconds first. No ScheduledBackup is created when empty.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// DatabaseRestoreSpec defines the dump a new tenant database is restored from. Files
+// ending in .sql or .sql.gz are replayed with psql or mariadb, files ending in .dump are
+// restored with pg_restore. Plain PostgreSQL dumps must be taken without ownership and
+// privileges (pg_dump --no-owner --no-privileges), as MoodleDatabaseDump does.
+// +kubebuilder:validation:XValidation:rule="has(self.pvc) != has(self.s3)",message="exactly one of pvc and s3 is required"
+type DatabaseRestoreSpec struct {
+	// PVC reads the dump from a PersistentVolumeClaim in the tenant namespace.
+	// +optional
+	PVC *RestorePVCSource `json:"pvc,omitempty"`
+
+	// S3 downloads the dump from an S3-compatible object store.
+	// +optional
+	S3 *RestoreS3Source `json:"s3,omitempty"`
+
+	// Image with the database client. Defaults to postgres:17-alpine for PostgreSQL and
+	// mariadb:11 for MySQL and MariaDB.
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// RestorePVCSource is a dump file in a PersistentVolumeClaim.
+type RestorePVCSource struct {
+	// ClaimName of a PersistentVolumeClaim in the tenant namespace.
+	// +kubebuilder:validation:Required
+	ClaimName string `json:"claimName"`
+
+	// Path of the dump file inside the volume.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9._/-]*\.(sql|sql\.gz|dump)$`
+	// +kubebuilder:validation:Required
+	Path string `json:"path"`
+}
+
+// RestoreS3Source is a dump file in an object store.
+type RestoreS3Source struct {
+	// URL of the dump object, s3://<bucket>/<key>.
+	// +kubebuilder:validation:Pattern=`^s3://[^/]+/.+\.(sql|sql\.gz|dump)$`
+	// +kubebuilder:validation:Required
+	URL string `json:"url"`
+
+	// EndpointURL of an S3-compatible object store other than AWS.
+	// +optional
+	EndpointURL string `json:"endpointURL,omitempty"`
+
+	// Region of the bucket.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// CredentialsSecretRef is the name of a secret in the MoodleTenant namespace with the
+	// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY keys. It is copied into the tenant
+	// namespace.
+	// +kubebuilder:validation:Required
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+}
+
+// DatabaseProvisioningSpec defines how the tenant database and role are provisioned.
+type DatabaseProvisioningSpec struct {
+	// ServerSecretRef is the name of a secret in the MoodleTenant namespace with the
+	// "host", "username" and "password" keys, and optionally "port", of a server role
+	// allowed to create databases and roles.
+	// +kubebuilder:validation:Required
+	ServerSecretRef corev1.LocalObjectReference `json:"serverSecretRef"`
+
+	// Schema puts the tenant into its own schema of a database shared with other
+	// tenants, the one named by databaseRef.name, instead of a database of its own. The
+	// tenant role owns the schema, has it as its search_path and has no access to the
+	// schemas of other tenants.
+	// +kubebuilder:validation:Pattern=`^[a-z_][a-z0-9_]*$`
+	// +kubebuilder:validation:MaxLength=63
+	// +optional
+	Schema string `json:"schema,omitempty"`
+
+	// DeletionPolicy decides whether the database, or the schema in schema mode, and
+	// the role are dropped when the MoodleTenant is deleted.
+	// +kubebuilder:validation:Enum=Retain;Drop
+	// +kubebuilder:default:="Retain"
+	// +optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+
+	// Image with the psql client used by the provisioning Jobs.
+	// +kubebuilder:default:="postgres:17-alpine"
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// PHPSettingsSpec defines the PHP settings for a MoodleTenant.
+type PHPSettingsSpec struct {
+	// MaxExecutionTime for PHP scripts.
+	// +kubebuilder:default:=60
+	// +optional
+	MaxExecutionTime int `json:"maxExecutionTime,omitempty"`
+
+	// MemoryLimit for PHP scripts.
+	// +kubebuilder:default:="512M"
+	// +optional
+	MemoryLimit string `json:"memoryLimit,omitempty"`
+
+	// UploadMaxFilesize is the largest file PHP accepts, e.g. "100M". The Ingress body
+	// size limit is derived from it.
+	// +kubebuilder:validation:Pattern=`^[0-9]+[KMG]?$`
+	// +kubebuilder:default:="100M"
+	// +optional
+	UploadMaxFilesize string `json:"uploadMaxFilesize,omitempty"`
+}
+
+// MemcachedSpec defines the Memcached configuration for a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="!has(self.auth) || (has(self.mode) && self.mode == 'shared')",message="auth requires mode shared"
+type MemcachedSpec struct {
+	// MemoryMB is the memory limit for Memcached in megabytes, per instance.
+	// +kubebuilder:default:=128
+	// +optional
+	MemoryMB int `json:"memoryMB,omitempty"`
+
+	// Image of Memcached, e.g. a pinned version or a mirror. Defaults to memcached:alpine.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Resources of a Memcached container. The requests and limits given replace those
+	// derived from memoryMB, which still sizes the item memory.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Mode is sidecar for a Memcached container in every Moodle pod, or shared for
+	// Memcached instances of their own that all replicas use as the MUC application
+	// cache. It has no effect with cache type redis.
+	// +kubebuilder:validation:Enum=sidecar;shared
+	// +kubebuilder:default:="sidecar"
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// Replicas is the number of shared Memcached instances. Moodle spreads the keys
+	// over them by consistent hashing, so a restarted instance only takes its own share
+	// of the cache with it, and at most one instance is disrupted at a time.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=2
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Auth makes the shared Memcached instances require SASL authentication, so that
+	// only Moodle can use them.
+	// +optional
+	Auth *MemcachedAuthSpec `json:"auth,omitempty"`
+}
+
+// MemcachedAuthSpec defines the SASL authentication of the shared Memcached instances.
+type MemcachedAuthSpec struct {
+	// SecretRef is the name of a secret in the MoodleTenant namespace with the
+	// credentials in the "username" and "password" keys. Without it a password is
+	// generated. Memcached picks up changed credentials when its pods restart.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+}
+
+// CacheSpec defines the cache and session backend of a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="!has(self.redis) || (has(self.type) && self.type == 'redis')",message="redis requires type redis"
+// +kubebuilder:validation:XValidation:rule="!has(self.sessions) || self.sessions == 'auto' || !has(self.type) || self.type != 'redis'",message="sessions are kept in Redis with type redis"
+// +kubebuilder:validation:XValidation:rule="!has(self.clusterRef) || !has(self.redis)",message="clusterRef cannot be combined with redis"
+type CacheSpec struct {
+	// Type is memcached for a Memcached sidecar in every Moodle pod and sessions in
+	// moodledata, or redis for a Redis server shared by all replicas that holds the
+	// application cache and the sessions.
+	// +kubebuilder:validation:Enum=memcached;redis
+	// +kubebuilder:default:="memcached"
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// Redis configures the Redis server of type redis.
+	// +optional
+	Redis *RedisSpec `json:"redis,omitempty"`
+
+	// Sessions selects where the Memcached type keeps sessions: auto keeps them in
+	// moodledata with a single replica and in the database once the HPA may run more
+	// than one, file and database force the choice. With type redis the sessions are
+	// kept in Redis. Superseded by spec.sessions.backend.
+	// +kubebuilder:validation:Enum=auto;file;database
+	// +kubebuilder:default:="auto"
+	// +optional
+	Sessions string `json:"sessions,omitempty"`
+
+	// MUC is managed for Moodle Universal Cache stores and mode mappings set up from
+	// this spec whenever a Moodle pod starts, or manual to leave them to the site
+	// administrator.
+	// +kubebuilder:validation:Enum=managed;manual
+	// +kubebuilder:default:="managed"
+	// +optional
+	MUC string `json:"muc,omitempty"`
+
+	// ClusterRef is the name of a MoodleCacheCluster shared with other tenants. Its type
+	// replaces type and memcached.mode, and keys are prefixed with the tenant name.
+	// +optional
+	ClusterRef *corev1.LocalObjectReference `json:"clusterRef,omitempty"`
+
+	// Exporter runs a Prometheus exporter next to the cache instances the operator
+	// deploys for the tenant, the Memcached sidecar, the shared Memcached instances or
+	// the Redis server, for their hit rates, memory use and evictions. Existing Redis
+	// servers and cache clusters are not scraped.
+	// +optional
+	Exporter *CacheExporterSpec `json:"exporter,omitempty"`
+}
+
+// CacheExporterSpec defines the Prometheus exporter of the cache instances of a tenant.
+type CacheExporterSpec struct {
+	// Image of the exporter. Defaults to prom/memcached-exporter for Memcached and to
+	// oliver006/redis_exporter for Redis.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// ServiceMonitor creates a Prometheus Operator ServiceMonitor for the exporter.
+	// Without it the Service carries the prometheus.io scrape annotations.
+	// +optional
+	ServiceMonitor bool `json:"serviceMonitor,omitempty"`
+
+	// PrometheusNamespace is allowed to scrape the exporter through the tenant
+	// NetworkPolicy.
+	// +kubebuilder:default:="monitoring"
+	// +optional
+	PrometheusNamespace string `json:"prometheusNamespace,omitempty"`
+}
+
+// SessionsSpec defines where a MoodleTenant keeps sessions.
+type SessionsSpec struct {
+	// Backend is auto to follow cache.sessions and cache.type, file for moodledata,
+	// database, redis for the Redis server of the cache, or memcached for the shared
+	// Memcached instances or the Memcached cache cluster. File sessions take a lock on
+	// the moodledata volume for every request, which contends on network storage.
+	// Redis and Memcached sessions fall back to auto while the cache has no such server.
+	// +kubebuilder:validation:Enum=auto;file;database;redis;memcached
+	// +kubebuilder:default:="auto"
+	// +optional
+	Backend string `json:"backend,omitempty"`
+
+	// LockTimeoutSeconds is how long a request waits for the lock of its session in the
+	// database, Redis or Memcached.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=120
+	// +optional
+	LockTimeoutSeconds int32 `json:"lockTimeoutSeconds,omitempty"`
+
+	// LockExpireSeconds is how long Redis and Memcached hold the lock of a session
+	// whose request died.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=7200
+	// +optional
+	LockExpireSeconds int32 `json:"lockExpireSeconds,omitempty"`
+}
+
+// CacheWarmupSpec defines the cache warm-up Job of a MoodleTenant. It builds the
+// component cache, compiles the themes and loads the language strings into the MUC.
+type CacheWarmupSpec struct {
+	// Themes to compile. Defaults to the site theme.
+	// +optional
+	Themes []string `json:"themes,omitempty"`
+
+	// Languages whose strings are loaded. Defaults to all installed language packs.
+	// +optional
+	Languages []string `json:"languages,omitempty"`
+
+	// Trigger runs the warm-up again whenever its value changes, e.g. after a theme
+	// setting was changed.
+	// +optional
+	Trigger string `json:"trigger,omitempty"`
+}
+
+// RedisSpec defines the Redis server of a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="(has(self.host) ? 1 : 0) + (has(self.sentinel) ? 1 : 0) + (has(self.cluster) ? 1 : 0) <= 1",message="host, sentinel and cluster are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="!has(self.passwordSecretRef) || has(self.host) || has(self.sentinel) || has(self.cluster)",message="passwordSecretRef requires host, sentinel or cluster, the deployed Redis gets a generated password"
+// +kubebuilder:validation:XValidation:rule="!has(self.tls) || has(self.host) || has(self.sentinel) || has(self.cluster)",message="tls requires host, sentinel or cluster"
+type RedisSpec struct {
+	// Host of an existing Redis server. Without it, sentinel or cluster the operator
+	// deploys Redis in the tenant namespace. Keys are prefixed with the tenant name, so
+	// a server can be shared by several tenants.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Sentinel locates the master of an existing Redis server through Redis Sentinel, so
+	// that Moodle follows a failover.
+	// +optional
+	Sentinel *RedisSentinelSpec `json:"sentinel,omitempty"`
+
+	// Cluster connects to an existing Redis Cluster.
+	// +optional
+	Cluster *RedisClusterSpec `json:"cluster,omitempty"`
+
+	// TLS encrypts the connections to an existing Redis server.
+	// +optional
+	TLS *RedisTLSSpec `json:"tls,omitempty"`
+
+	// Port of the Redis server, also of the masters located through sentinel.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:default:=6379
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// PasswordSecretRef is the name of a secret in the MoodleTenant namespace with the
+	// password of the existing Redis server in the "password" key.
+	// +optional
+	PasswordSecretRef *corev1.LocalObjectReference `json:"passwordSecretRef,omitempty"`
+
+	// Image of the deployed Redis server.
+	// +kubebuilder:default:="redis:7-alpine"
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// MemoryMB is the memory limit of the deployed Redis server in megabytes. The least
+	// recently used keys are evicted when it is full.
+	// +kubebuilder:validation:Minimum=32
+	// +kubebuilder:default:=256
+	// +optional
+	MemoryMB int `json:"memoryMB,omitempty"`
+}
+
+// RedisSentinelSpec defines the Redis Sentinels of a Redis server.
+type RedisSentinelSpec struct {
+	// MasterName is the name of the master monitored by the Sentinels.
+	// +kubebuilder:validation:Required
+	MasterName string `json:"masterName"`
+
+	// Hosts are the host:port addresses of the Sentinels, asked in turn.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:items:Pattern=`^[^:,\s]+:[0-9]+$`
+	Hosts []string `json:"hosts"`
+}
+
+// RedisClusterSpec defines a Redis Cluster.
+type RedisClusterSpec struct {
+	// Hosts are the host:port addresses of cluster nodes the client discovers the
+	// cluster from.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:items:Pattern=`^[^:,\s]+:[0-9]+$`
+	Hosts []string `json:"hosts"`
+}
+
+// RedisTLSSpec defines the TLS connection to a Redis server.
+type RedisTLSSpec struct {
+	// CASecretRef is the name of a secret in the MoodleTenant namespace with the CA
+	// certificate of the Redis server in the "ca.crt" key. Without it the system trust
+	// store is used.
+	// +optional
+	CASecretRef *corev1.LocalObjectReference `json:"caSecretRef,omitempty"`
+}
+
+// ExposureSpec defines the in-cluster exposure of a MoodleTenant.
+type ExposureSpec struct {
+	// InternalHostname is the name of an additional ClusterIP Service that makes the
+	// tenant reachable from other tenants as <internalHostname>.tenant-<name>.svc.
+	// Used for hub-and-spoke integrations such as MNet or LTI between tenants. It must not
+	// start with <name>-, which prefixes the Services of the operator.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	InternalHostname string `json:"internalHostname,omitempty"`
+}
+
+// LocaleSpec defines the locale defaults for a MoodleTenant.
+type LocaleSpec struct {
+	// Language is the default site language pack code, e.g. "en" or "pt_br".
+	// +kubebuilder:validation:Pattern=`^[a-z]{2,3}(_[a-z0-9]+)*$`
+	// +optional
+	Language string `json:"language,omitempty"`
+
+	// Timezone is the default site timezone as an IANA name, e.g. "Europe/Minsk".
+	// +optional
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// IntegrationsSpec defines the external service integrations of a MoodleTenant.
+type IntegrationsSpec struct {
+	// Plagiarism configures a plagiarism detection service.
+	// +optional
+	Plagiarism *PlagiarismSpec `json:"plagiarism,omitempty"`
+}
+
+// PlagiarismSpec defines the plagiarism detection service for a MoodleTenant.
+// The plugin for the provider must be present in the Moodle image.
+type PlagiarismSpec struct {
+	// Provider of the plagiarism detection service.
+	// +kubebuilder:validation:Enum=turnitin;ouriginal
+	// +kubebuilder:validation:Required
+	Provider string `json:"provider"`
+
+	// APIEndpoint is the base URL of the provider API.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +kubebuilder:validation:Required
+	APIEndpoint string `json:"apiEndpoint"`
+
+	// CredentialsSecretRef is the name of a secret in the MoodleTenant namespace
+	// with the "accountId" and "apiKey" keys.
+	// +kubebuilder:validation:Required
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+}
+
+// DataRetentionSpec defines the data retention policies for a MoodleTenant.
+// Unset fields leave the corresponding site setting editable in Moodle.
+type DataRetentionSpec struct {
+	// LogLifetimeDays is how long standard log entries are kept. 0 keeps them forever.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	LogLifetimeDays *int32 `json:"logLifetimeDays,omitempty"`
+
+	// LogGuests logs the actions of guests in the standard log, which fills it quickly
+	// on sites with open courses.
+	// +optional
+	LogGuests *bool `json:"logGuests,omitempty"`
+
+	// LogCleanupSchedule is the schedule of the tasks that delete expired standard log
+	// entries and task logs, daily by default. Large sites delete the rows in smaller
+	// batches more often, e.g. */15 * * * *. cron.scheduledTasks of the same tasks take
+	// precedence.
+	// +kubebuilder:validation:Pattern=`^\S+ \S+ \S+ \S+ \S+$`
+	// +optional
+	LogCleanupSchedule string `json:"logCleanupSchedule,omitempty"`
+
+	// TaskLogRetentionDays is how long the logs of scheduled and ad hoc task runs are kept.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TaskLogRetentionDays *int32 `json:"taskLogRetentionDays,omitempty"`
+
+	// TaskLogRetainRuns is the number of runs of every task whose logs are kept beyond
+	// taskLogRetentionDays.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TaskLogRetainRuns *int32 `json:"taskLogRetainRuns,omitempty"`
+
+	// UnconfirmedUserPurgeHours is how long unconfirmed accounts are kept before deletion.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	UnconfirmedUserPurgeHours *int32 `json:"unconfirmedUserPurgeHours,omitempty"`
+
+	// IncompleteUserPurgeDays is how long accounts with incomplete profiles are kept before deletion.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	IncompleteUserPurgeDays *int32 `json:"incompleteUserPurgeDays,omitempty"`
+
+	// BackupMaxKept is the number of automated course backups kept. 0 keeps all of them.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	BackupMaxKept *int32 `json:"backupMaxKept,omitempty"`
+
+	// BackupDeleteDays is the age after which automated course backups are deleted.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	BackupDeleteDays *int32 `json:"backupDeleteDays,omitempty"`
+}
+
+// IngressSpec defines the Ingress configuration for a MoodleTenant.
+type IngressSpec struct {
+	// Annotations merged into the generated Ingress, e.g. proxy-body-size or timeouts.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Protection against abusive traffic, e.g. brute-forcing of the login endpoint.
+	// +optional
+	Protection IngressProtectionSpec `json:"protection,omitempty"`
+
+	// Security configures HTTPS redirection, HSTS and security headers. The headers are
+	// set through a snippet annotation, only with the operator's --allow-snippet-annotations.
+	// +optional
+	Security IngressSecuritySpec `json:"security,omitempty"`
+
+	// Proxy overrides the proxy limits derived from phpSettings, e.g. for huge SCORM uploads.
+	// +optional
+	Proxy IngressProxySpec `json:"proxy,omitempty"`
+
+	// Admin serves the site on an additional internal hostname through a separate Ingress.
+	// /admin is then only reachable through it, and blocked on the public hostnames by a
+	// snippet annotation with the operator's --allow-snippet-annotations.
+	// +optional
+	Admin *AdminIngressSpec `json:"admin,omitempty"`
+}
+
+// AdminIngressSpec defines the internal-only Ingress used for site administration.
+type AdminIngressSpec struct {
+	// Hostname of the admin endpoint, e.g. admin.physics.lms.bsu.by. With tls.issuerRef a
+	// certificate is issued for it too, otherwise the tenant TLS secret must cover it, e.g.
+	// a wildcard. The DNSEndpoint of externalDNS publishes it as well.
+	// +kubebuilder:validation:Required
+	Hostname string `json:"hostname"`
+
+	// IngressClassName of the internal ingress controller.
+	// +kubebuilder:default:="nginx-internal"
+	// +optional
+	IngressClassName string `json:"ingressClassName,omitempty"`
+
+	// ControllerNamespace is the namespace of the internal ingress controller. Ingress from
+	// it is allowed by the NetworkPolicy.
+	// +optional
+	ControllerNamespace string `json:"controllerNamespace,omitempty"`
+
+	// AllowedSourceRanges are the client CIDRs allowed on the admin endpoint, e.g. campus networks.
+	// +optional
+	AllowedSourceRanges []string `json:"allowedSourceRanges,omitempty"`
+}
+
+// IngressProxySpec overrides the proxy limits of the Ingress.
+type IngressProxySpec struct {
+	// BodySize is the maximum request body size, e.g. "2G". Defaults to phpSettings.uploadMaxFilesize.
+	// +kubebuilder:validation:Pattern=`^[0-9]+[kKmMgG]?$`
+	// +optional
+	BodySize string `json:"bodySize,omitempty"`
+
+	// ReadTimeoutSeconds is how long the proxy waits for Moodle to respond.
+	// Defaults to phpSettings.maxExecutionTime.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ReadTimeoutSeconds *int32 `json:"readTimeoutSeconds,omitempty"`
+}
+
+// IngressSecuritySpec defines HTTPS enforcement and the security headers of the Ingress.
+type IngressSecuritySpec struct {
+	// SSLRedirect redirects plain HTTP requests to HTTPS. Defaults to true.
+	// +optional
+	SSLRedirect *bool `json:"sslRedirect,omitempty"`
+
+	// HSTS sends the Strict-Transport-Security header.
+	// +optional
+	HSTS *HSTSSpec `json:"hsts,omitempty"`
+
+	// Headers adds X-Content-Type-Options, Referrer-Policy and X-Frame-Options headers.
+	// +optional
+	Headers bool `json:"headers,omitempty"`
+
+	// FrameAncestors are origins allowed to embed Moodle in a frame, e.g. LTI consumers
+	// such as https://lms.partner.by. They replace X-Frame-Options with a CSP frame-ancestors
+	// directive.
+	// +kubebuilder:validation:items:Pattern=`^https?://[A-Za-z0-9.*-]+(:[0-9]+)?$`
+	// +optional
+	FrameAncestors []string `json:"frameAncestors,omitempty"`
+}
+
+// HSTSSpec defines the Strict-Transport-Security header.
+type HSTSSpec struct {
+	// MaxAge in seconds browsers remember to only use HTTPS.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default:=31536000
+	// +optional
+	MaxAge int64 `json:"maxAge,omitempty"`
+
+	// IncludeSubDomains applies the policy to all subdomains of the hostname.
+	// +optional
+	IncludeSubDomains bool `json:"includeSubDomains,omitempty"`
+
+	// Preload allows the hostname to be included in browser preload lists.
+	// +optional
+	Preload bool `json:"preload,omitempty"`
+}
+
+// IngressProtectionSpec defines rate limiting and the web application firewall of the Ingress.
+type IngressProtectionSpec struct {
+	// RateLimit limits the requests per second accepted from a single client IP.
+	// +optional
+	RateLimit *RateLimitSpec `json:"rateLimit,omitempty"`
+
+	// WAF enables the ModSecurity web application firewall of ingress-nginx.
+	// +optional
+	WAF WAFSpec `json:"waf,omitempty"`
+}
+
+// RateLimitSpec defines the per-client rate limit of the Ingress.
+type RateLimitSpec struct {
+	// RPS is the number of requests per second accepted from a single client IP.
+	// +kubebuilder:validation:Minimum=1
+	RPS int32 `json:"rps"`
+
+	// BurstMultiplier sets the burst size as a multiple of rps. Defaults to 5 in ingress-nginx.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	BurstMultiplier *int32 `json:"burstMultiplier,omitempty"`
+}
+
+// WAFSpec defines the ModSecurity configuration of the Ingress.
+type WAFSpec struct {
+	// Enabled turns on ModSecurity for the tenant Ingress. The rule engine mode is set
+	// through a snippet annotation, only with the operator's --allow-snippet-annotations.
+	// +optional
+	Enabled bool `json:"enabled,omitempty"`
+
+	// OWASPCoreRules loads the OWASP Core Rule Set.
+	// +kubebuilder:default:=true
+	// +optional
+	OWASPCoreRules bool `json:"owaspCoreRules,omitempty"`
+
+	// DetectionOnly logs matching requests instead of blocking them.
+	// +optional
+	DetectionOnly bool `json:"detectionOnly,omitempty"`
+}
+
+// BackendTLSSpec defines TLS termination at the Moodle pods.
+type BackendTLSSpec struct {
+	// IssuerRef issues the serving certificate with cert-manager. The issuer must add the
+	// CA to the secret (ca.crt), e.g. a CA issuer. Without it the operator generates a
+	// self-signed certificate.
+	// +optional
+	IssuerRef *IssuerRefSpec `json:"issuerRef,omitempty"`
+}
+
+// TLSSpec defines the TLS configuration for a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="!has(self.copyFromNamespace) || has(self.secretName)",message="copyFromNamespace requires secretName"
+// +kubebuilder:validation:XValidation:rule="!has(self.copyFromNamespace) || !has(self.issuerRef)",message="copyFromNamespace and issuerRef are mutually exclusive"
+type TLSSpec struct {
+	// SecretName is the TLS secret used by the Ingress. Defaults to <tenant>-tls.
+	// Set it to reuse an existing certificate, e.g. a wildcard for *.lms.university.by.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// CopyFromNamespace copies the secretName secret from this namespace into the
+	// tenant namespace and keeps it in sync, so one wildcard certificate can serve
+	// many tenants.
+	// +optional
+	CopyFromNamespace string `json:"copyFromNamespace,omitempty"`
+
+	// IssuerRef is the cert-manager issuer for the tenant certificate.
+	// When unset, the <tenant>-tls secret must be provided externally.
+	// +optional
+	IssuerRef *IssuerRefSpec `json:"issuerRef,omitempty"`
+
+	// Mode selects how the certificate is requested: Certificate creates a
+	// cert-manager Certificate, IngressAnnotations lets cert-manager's ingress-shim
+	// issue it from annotations on the Ingress.
+	// +kubebuilder:validation:Enum=Certificate;IngressAnnotations
+	// +kubebuilder:default:="Certificate"
+	// +optional
+	Mode string `json:"mode,omitempty"`
+}
+
+// IssuerRefSpec references a cert-manager issuer.
+type IssuerRefSpec struct {
+	// Name of the issuer.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Kind of the issuer.
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	// +kubebuilder:default:="ClusterIssuer"
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Group of the issuer.
+	// +kubebuilder:default:="cert-manager.io"
+	// +optional
+	Group string `json:"group,omitempty"`
+}
+
+// ServiceSpec defines the Service configuration for a MoodleTenant.
+type ServiceSpec struct {
+	// TrafficDistribution expresses a preference for routing traffic to topologically
+	// close endpoints, keeping traffic zone-local in multi-zone clusters.
+	// +kubebuilder:validation:Enum=PreferClose;PreferSameZone;PreferSameNode
+	// +optional
+	TrafficDistribution *string `json:"trafficDistribution,omitempty"`
+
+	// TopologyAwareHints enables topology aware routing hints via the
+	// service.kubernetes.io/topology-mode annotation, for clusters without
+	// trafficDistribution support.
+	// +optional
+	TopologyAwareHints bool `json:"topologyAwareHints,omitempty"`
+}
+
+// DataScanSpec defines an anti-virus scan of the moodledata volume, which also lists the
+// files in the file pool that no file record of the database refers to.
+type DataScanSpec struct {
+	// Trigger starts a new scan whenever its value changes, e.g. a migration ID or a
+	// timestamp. Without it, moodledata is scanned once.
+	// +optional
+	Trigger string `json:"trigger,omitempty"`
+
+	// Image is the ClamAV image used for the scan.
+	// +kubebuilder:default:="clamav/clamav:stable"
+	// +optional
+	Image string `json:"image,omitempty"`
+}
+
+// ExternalDNSSpec defines how DNS records for a MoodleTenant are published through external-dns.
+// +kubebuilder:validation:XValidation:rule="self.mode != 'DNSEndpoint' || size(self.targets) > 0",message="targets are required in DNSEndpoint mode"
+type ExternalDNSSpec struct {
+	// Mode selects how records are requested: Annotations annotates the Ingress,
+	// DNSEndpoint creates an external-dns DNSEndpoint resource.
+	// +kubebuilder:validation:Enum=Annotations;DNSEndpoint
+	// +kubebuilder:default:="Annotations"
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// Targets the records point to, e.g. the load balancer IPs or hostname of the
+	// ingress controller. Optional in Annotations mode, where external-dns uses the
+	// Ingress status.
+	// +optional
+	Targets []string `json:"targets,omitempty"`
+
+	// TTL of the records in seconds.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TTL *int64 `json:"ttl,omitempty"`
+}
+
+// RoutingSpec defines how external traffic reaches a MoodleTenant.
+// +kubebuilder:validation:XValidation:rule="self.mode != 'gateway' || has(self.gatewayRef)",message="gatewayRef is required in gateway mode"
+type RoutingSpec struct {
+	// Mode selects between an Ingress and a Gateway API HTTPRoute.
+	// +kubebuilder:validation:Enum=ingress;gateway
+	// +kubebuilder:default:="ingress"
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// GatewayRef is the Gateway the HTTPRoute attaches to in gateway mode.
+	// TLS is terminated by the Gateway listener.
+	// +optional
+	GatewayRef *GatewayRefSpec `json:"gatewayRef,omitempty"`
+
+	// PathPrefix serves the tenant under a path of a shared hostname, e.g. "/physics"
+	// for lms.bsu.by/physics, instead of at the root of its own hostname. Requests keep
+	// the prefix, which nginx in the pods serves Moodle under, and it is part of the
+	// wwwroot.
+	// +kubebuilder:validation:Pattern=`^(/[a-z0-9][-a-z0-9_]*)+$`
+	// +optional
+	PathPrefix string `json:"pathPrefix,omitempty"`
+}
+
+// GatewayRefSpec references a Gateway API Gateway.
+type GatewayRefSpec struct {
+	// Name of the Gateway.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace of the Gateway. Ingress traffic from this namespace is allowed by the NetworkPolicy.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// SectionName is the Gateway listener to attach to.
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
+}
+
+// MeshSpec defines the Istio service mesh integration of a MoodleTenant.
+type MeshSpec struct {
+	// MTLSMode is the mutual TLS mode enforced for the Moodle pods. Defaults to STRICT
+	// with a Gateway and to PERMISSIVE without one, since an Ingress controller outside
+	// the mesh cannot reach the pods over mutual TLS.
+	// +kubebuilder:validation:Enum=PERMISSIVE;STRICT
+	// +optional
+	MTLSMode string `json:"mtlsMode,omitempty"`
+
+	// Gateway is the Istio Gateway, as <namespace>/<name>, that external traffic enters
+	// through. When set, a VirtualService routes the tenant hostnames and no Ingress is created.
+	// +optional
+	Gateway string `json:"gateway,omitempty"`
+
+	// ControlPlaneNamespace is the namespace of istiod and the Istio gateways.
+	// +kubebuilder:default:="istio-system"
+	// +optional
+	ControlPlaneNamespace string `json:"controlPlaneNamespace,omitempty"`
+}
+
+// NetworkPolicySpec defines additions to the generated tenant NetworkPolicy.
+type NetworkPolicySpec struct {
+	// Enabled generates the tenant NetworkPolicy. Disable it on clusters whose CNI does
+	// not enforce NetworkPolicy or where policies are managed separately.
+	// +kubebuilder:default:=true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// ExtraEgress rules are appended to the generated NetworkPolicy, e.g. to reach SSO
+	// identity providers, SMTP relays, LTI tools or campus APIs. The blocked ranges are
+	// excepted from their ipBlock peers, and peers inside them are dropped.
+	// +optional
+	ExtraEgress []networkingv1.NetworkPolicyEgressRule `json:"extraEgress,omitempty"`
+
+	// BlockedEgressCIDRs are excluded from all egress rules in addition
+	// to the cloud metadata endpoints 169.254.169.254/32 and fd00:ec2::254/128, e.g.
+	// 169.254.0.0/16 to block all link-local addresses.
+	// +optional
+	BlockedEgressCIDRs []string `json:"blockedEgressCIDRs,omitempty"`
+
+	// FQDNEgress restricts HTTP/HTTPS egress to the given hostnames, e.g. download.moodle.org,
+	// repo.packagist.org or *.idp.bsu.by. It requires Cilium: the operator emits a
+	// CiliumNetworkPolicy with toFQDNs rules and drops the open HTTP/HTTPS egress rule
+	// from the NetworkPolicy.
+	// +kubebuilder:validation:items:Pattern=`^(\*\.)?[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	// +optional
+	FQDNEgress []string `json:"fqdnEgress,omitempty"`
+
+	// IngressControllerNamespace overrides the operator-wide namespace of the ingress
+	// controller that is allowed to reach the Moodle pods.
+	// +optional
+	IngressControllerNamespace string `json:"ingressControllerNamespace,omitempty"`
+
+	// IngressControllerPodSelector further restricts the allowed ingress controller
+	// pods, e.g. app.kubernetes.io/name: traefik. Overrides the operator-wide selector.
+	// +optional
+	IngressControllerPodSelector *metav1.LabelSelector `json:"ingressControllerPodSelector,omitempty"`
+}
+
+// MailSpec defines the SMTP relay used for outgoing email.
+type MailSpec struct {
+	// SMTPHost is the hostname or IP address of the SMTP relay. Egress to it is
+	// allowed by the NetworkPolicy.
+	// +kubebuilder:validation:Required
+	SMTPHost string `json:"smtpHost"`
+
+	// Port of the SMTP relay.
+	// +kubebuilder:validation:Enum=25;465;587
+	// +kubebuilder:default:=587
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// Security is the transport security used towards the relay.
+	// +kubebuilder:validation:Enum=none;ssl;tls
+	// +kubebuilder:default:="tls"
+	// +optional
+	Security string `json:"security,omitempty"`
+
+	// CredentialsSecretRef is the name of a secret in the MoodleTenant namespace
+	// with the "username" and "password" keys. Omit it for relays without authentication.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+
+	// NoReplyAddress is the sender address of notifications, e.g. noreply@bsu.by.
+	// +optional
+	NoReplyAddress string `json:"noReplyAddress,omitempty"`
+}
+
+// Condition types reported in MoodleTenantStatus.
+const (
+	// ConditionCacheClusterResolved reports whether the MoodleCacheCluster of
+	// cache.clusterRef exists and is ready.
+	ConditionCacheClusterResolved = "CacheClusterResolved"
+
+	// ConditionClassResolved reports whether the MoodleTenantClass of classRef exists.
+	// The tenant is not reconciled without it.
+	ConditionClassResolved = "ClassResolved"
+
+	// ConditionMaintenanceMode reports whether the site is in maintenance mode.
+	ConditionMaintenanceMode = "MaintenanceMode"
+
+	// ConditionURLRewritten reports whether the URLs embedded in the database content
+	// have been rewritten after the wwwroot changed with spec.hostname.
+	ConditionURLRewritten = "URLRewritten"
+
+	// ConditionSuspended reports whether the tenant is suspended through spec.suspended.
+	ConditionSuspended = "Suspended"
+
+	// ConditionHibernated reports whether the tenant is hibernated through spec.hibernation.
+	ConditionHibernated = "Hibernated"
+
+	// ConditionDecommissioned reports whether the archive of spec.decommission has been
+	// uploaded after the MoodleTenant was deleted.
+	ConditionDecommissioned = "Decommissioned"
+
+	// ConditionCachesPurged reports whether the last cache purge requested through the
+	// moodle.bsu.by/purge-caches annotation has succeeded.
+	ConditionCachesPurged = "CachesPurged"
+
+	// ConditionCachesWarmed reports whether the caches have been primed for the running
+	// image. A failed warm-up only costs the first users some latency.
+	ConditionCachesWarmed = "CachesWarmed"
+
+	// ConditionCertificateReady reports whether the tenant TLS certificate is issued.
+	ConditionCertificateReady = "CertificateReady"
+
+	// ConditionCronStale reports whether cron.php has not succeeded for longer than
+	// cron.staleAfterMinutes, which silently stops forum mail and notifications.
+	ConditionCronStale = "CronStale"
+
+	// ConditionCronFailing reports whether cron.failureThreshold cron Jobs failed in a row.
+	ConditionCronFailing = "CronFailing"
+
+	// ConditionDataScanPassed reports whether the last moodledata scan found no infected
+	// files. Reason Infected is set for infected files, ScanError when the scan could not
+	// complete, e.g. because the virus signatures could not be updated.
+	ConditionDataScanPassed = "DataScanPassed"
+
+	// ConditionDatabaseProvisioned reports whether the tenant database and role exist.
+	ConditionDatabaseProvisioned = "DatabaseProvisioned"
+
+	// ConditionInstalled reports whether spec.install has installed Moodle into the
+	// database. The Moodle Deployment waits for it.
+	ConditionInstalled = "Installed"
+
+	// ConditionDatabaseRestored reports whether the dump of databaseRef.restoreFrom has
+	// been restored. The Moodle Deployment waits for it.
+	ConditionDatabaseRestored = "DatabaseRestored"
+
+	// ConditionDatabaseReady reports whether the database accepts connections, or in
+	// cnpg and zalando modes whether the database cluster is ready. The Moodle Deployment waits for it.
+	ConditionDatabaseReady = "DatabaseReady"
+
+	// ConditionDatabaseReachable reports whether Moodle can connect and authenticate to
+	// the database, with the failure kind as reason.
+	ConditionDatabaseReachable = "DatabaseReachable"
+
+	// ConditionDegraded reports whether rollouts are blocked by a failed upgrade.
+	ConditionDegraded = "Degraded"
+
+	// ConditionPromoted reports whether the active Deployment of the BlueGreen strategy
+	// runs the current pod template.
+	ConditionPromoted = "Promoted"
+
+	// ConditionMaintenanceWindow reports whether the maintenance window is open, and
+	// which disruptive actions wait for it.
+	ConditionMaintenanceWindow = "MaintenanceWindow"
+
+	// ConditionMaintenancePage reports whether the Ingress serves the maintenance page.
+	ConditionMaintenancePage = "MaintenancePage"
+
+	// ConditionSessionsShared reports whether all Moodle replicas see the same sessions.
+	// It is False when file sessions are kept on a volume that replicas cannot share.
+	ConditionSessionsShared = "SessionsShared"
+)
+
+// MoodleTenantStatus defines the observed state of MoodleTenant
+type MoodleTenantStatus struct {
+	// Conditions represent the latest available observations of the MoodleTenant's state.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// UpgradedImage is the image the database schema was last upgraded to. The Moodle
+	// Deployment and CronJob run it until the upgrade to spec.image has succeeded.
+	// +optional
+	UpgradedImage string `json:"upgradedImage,omitempty"`
+
+	// URL is the wwwroot the database content refers to. When spec.hostname or the path
+	// prefix changes, the content is rewritten from it to the new wwwroot.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// UpgradeBackup records the backups taken before the last upgrade, from which a
+	// failed upgrade is recovered.
+	// +optional
+	UpgradeBackup *UpgradeBackupStatus `json:"upgradeBackup,omitempty"`
+
+	// UpgradeRolloutDeadline is when the rollout of the upgraded image must have completed
+	// before the upgrade is rolled back. It is cleared once the rollout completes.
+	// +optional
+	UpgradeRolloutDeadline *metav1.Time `json:"upgradeRolloutDeadline,omitempty"`
+
+	// Rollback records the last rollback of a failed upgrade.
+	// +optional
+	Rollback *RollbackStatus `json:"rollback,omitempty"`
+
+	// BlueGreen is the state of the BlueGreen rollout strategy.
+	// +optional
+	BlueGreen *BlueGreenStatus `json:"blueGreen,omitempty"`
+
+	// AdminCredentialsSecret is the Secret in the tenant namespace with the username and
+	// password of the Moodle administrator account created by spec.install.
+	// +optional
+	AdminCredentialsSecret string `json:"adminCredentialsSecret,omitempty"`
+
+	// DatabaseSecretHash is the checksum of the database Secret. A change rolls the
+	// Moodle Deployment, which reads the credentials at startup.
+	// +optional
+	DatabaseSecretHash string `json:"databaseSecretHash,omitempty"`
+
+	// CacheCluster is the MoodleCacheCluster of cache.clusterRef as last resolved. Moodle
+	// keeps using it while the cache cluster is unavailable.
+	// +optional
+	CacheCluster *CacheClusterStatus `json:"cacheCluster,omitempty"`
+
+	// CachePurge is the last cache purge requested through the moodle.bsu.by/purge-caches
+	// annotation.
+	// +optional
+	CachePurge *CachePurgeStatus `json:"cachePurge,omitempty"`
+
+	// MaintenanceMode is the last change of the maintenance mode of spec.maintenanceMode.
+	// +optional
+	MaintenanceMode *MaintenanceModeStatus `json:"maintenanceMode,omitempty"`
+
+	// Hibernation is the idle detection of spec.hibernation.
+	// +optional
+	Hibernation *HibernationStatus `json:"hibernation,omitempty"`
+
+	// Scaling is the schedule of spec.scaling in effect.
+	// +optional
+	Scaling *ScalingStatus `json:"scaling,omitempty"`
+
+	// Decommission is the archive of spec.decommission, once the MoodleTenant is deleted.
+	// +optional
+	Decommission *DecommissionStatus `json:"decommission,omitempty"`
+
+	// LastCronRun is when the CronJob last completed cron.php successfully. The runners
+	// of cron mode deployment report their freshness through readiness instead.
+	// +optional
+	LastCronRun *metav1.Time `json:"lastCronRun,omitempty"`
+
+	// CronFailures counts the cron Jobs that failed in a row.
+	// +optional
+	CronFailures *CronFailuresStatus `json:"cronFailures,omitempty"`
+}
+
+// CronFailuresStatus counts the cron Jobs of a MoodleTenant that failed in a row.
+type CronFailuresStatus struct {
+	// Consecutive is the number of cron Jobs that failed since one last succeeded.
+	Consecutive int32 `json:"consecutive"`
+
+	// LastJob is the last finished cron Job that was counted.
+	// +optional
+	LastJob string `json:"lastJob,omitempty"`
+
+	// LastJobTime is the creation time of LastJob. Only Jobs created later are counted.
+	// +optional
+	LastJobTime *metav1.Time `json:"lastJobTime,omitempty"`
+
+	// NotifiedTime is when the notification webhook was called for these failures.
+	// +optional
+	NotifiedTime *metav1.Time `json:"notifiedTime,omitempty"`
+}
+
+// UpgradeBackupStatus is the backups of a MoodleTenant taken before an upgrade.
+type UpgradeBackupStatus struct {
+	// Image the backups were taken for the upgrade to.
+	Image string `json:"image"`
+
+	// FromImage is the image the backups were taken of.
+	// +optional
+	FromImage string `json:"fromImage,omitempty"`
+
+	// VolumeSnapshot is the name of the moodledata VolumeSnapshot in the tenant namespace.
+	// +optional
+	VolumeSnapshot string `json:"volumeSnapshot,omitempty"`
+
+	// DatabaseDump is the name of the MoodleDatabaseDump in the MoodleTenant namespace.
+	// +optional
+	DatabaseDump string `json:"databaseDump,omitempty"`
+}
+
+// RollbackStatus is the rollback of a failed upgrade of a MoodleTenant.
+type RollbackStatus struct {
+	// Image whose upgrade was rolled back. It is not upgraded to again until spec.image
+	// changes.
+	Image string `json:"image"`
+
+	// ToImage is the image rolled back to.
+	ToImage string `json:"toImage"`
+
+	// Reason is UpgradeFailed when upgrade.php failed, or RolloutFailed when the new
+	// image did not become available in time.
+	Reason string `json:"reason"`
+
+	// JobName is the Job restoring the database from the dump in the tenant namespace.
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+
+	// CompletionTime is when the rollback finished, successfully or not.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// BlueGreenStatus is the state of the BlueGreen rollout strategy of a MoodleTenant.
+type BlueGreenStatus struct {
+	// ActiveColor is blue or green, the Deployment the Service selects.
+	ActiveColor string `json:"activeColor"`
+
+	// ActiveHash is the hash of the pod template of the active Deployment.
+	// +optional
+	ActiveHash string `json:"activeHash,omitempty"`
+
+	// PreviousHash is the hash of the pod template of the other Deployment, which a
+	// revert switches back to.
+	// +optional
+	PreviousHash string `json:"previousHash,omitempty"`
+
+	// ScaleDownTime is when the previous Deployment is scaled to zero.
+	// +optional
+	ScaleDownTime *metav1.Time `json:"scaleDownTime,omitempty"`
+
+	// RevertedHash is the hash of the pod template that was reverted. It is not
+	// switched to again.
+	// +optional
+	RevertedHash string `json:"revertedHash,omitempty"`
+
+	// RevertTrigger is the value of the moodle.bsu.by/revert-rollout annotation that
+	// was last handled.
+	// +optional
+	RevertTrigger string `json:"revertTrigger,omitempty"`
+}
+
+// ScalingStatus is the scheduled scaling in effect for a MoodleTenant.
+type ScalingStatus struct {
+	// Schedule is the name of the schedule in effect, if any.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// MinReplicas is the number of replicas, or the minimum of the HPA, set by the schedule.
+	// +optional
+	MinReplicas int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the maximum of the HPA set by the schedule.
+	// +optional
+	MaxReplicas int32 `json:"maxReplicas,omitempty"`
+
+	// NextChange is when the next schedule fires.
+	// +optional
+	NextChange *metav1.Time `json:"nextChange,omitempty"`
+}
+
+// HibernationStatus is the idle detection of a MoodleTenant.
+type HibernationStatus struct {
+	// Hibernated is whether the tenant is hibernated.
+	Hibernated bool `json:"hibernated"`
+
+	// LastAccessTime is the last access of a user to the site found by the last check.
+	// +optional
+	LastAccessTime *metav1.Time `json:"lastAccessTime,omitempty"`
+
+	// LastCheckTime is when the last access was last checked.
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+
+	// CheckJobName is the Job checking the last access in the tenant namespace, while it runs.
+	// +optional
+	CheckJobName string `json:"checkJobName,omitempty"`
+
+	// HibernationTime is when the tenant was last hibernated.
+	// +optional
+	HibernationTime *metav1.Time `json:"hibernationTime,omitempty"`
+
+	// WakeTime is when the tenant was last woken.
+	// +optional
+	WakeTime *metav1.Time `json:"wakeTime,omitempty"`
+}
+
+// DecommissionStatus is the final archive of a deleted MoodleTenant.
+type DecommissionStatus struct {
+	// Archive is the location of the archive, s3://<bucket>/<prefix>/<tenant>/.
+	Archive string `json:"archive"`
+
+	// DatabaseDump is the MoodleDatabaseDump of the database, kept as a record of the archive.
+	// +optional
+	DatabaseDump string `json:"databaseDump,omitempty"`
+
+	// JobName is the Job archiving moodledata and the courses in the tenant namespace.
+	// +optional
+	JobName string `json:"jobName,omitempty"`
+
+	// StartTime is when the archive was started.
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is when the archive was complete.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// MaintenanceModeStatus is a change of the maintenance mode of a MoodleTenant.
+type MaintenanceModeStatus struct {
+	// Enabled is whether the change enabled or disabled the maintenance mode.
+	Enabled bool `json:"enabled"`
+
+	// Message shown to users while enabled.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// JobName is the Job changing the maintenance mode in the tenant namespace.
+	JobName string `json:"jobName"`
+
+	// CompletionTime is when the Job finished, successfully or not.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// CachePurgeStatus is a cache purge of a MoodleTenant.
+type CachePurgeStatus struct {
+	// Trigger is the value of the moodle.bsu.by/purge-caches annotation that requested
+	// the purge.
+	Trigger string `json:"trigger"`
+
+	// JobName is the Job running the purge in the tenant namespace.
+	JobName string `json:"jobName"`
+
+	// CompletionTime is when the purge finished, successfully or not.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// CacheClusterStatus is a resolved MoodleCacheCluster.
+type CacheClusterStatus struct {
+	// Name of the MoodleCacheCluster.
+	Name string `json:"name"`
+
+	// Namespace the cache instances run in.
+	Namespace string `json:"namespace"`
+
+	// Type of the MoodleCacheCluster, redis or memcached.
+	Type string `json:"type"`
+
+	// Servers are the host:port addresses of the cache instances.
+	Servers []string `json:"servers"`
+
+	// PasswordSecret is the name of the secret in namespace with the credentials of the
+	// cache instances, if they require authentication.
+	// +optional
+	PasswordSecret string `json:"passwordSecret,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:validation:XValidation:rule="!has(self.spec) || !has(self.spec.exposure) || !has(self.spec.exposure.internalHostname) || !self.spec.exposure.internalHostname.startsWith(self.metadata.name + '-')",message="spec.exposure.internalHostname must not start with the tenant name, which prefixes the Services of the operator"
 
 // MoodleTenant is the Schema for the moodletenants API
 type MoodleTenant struct {
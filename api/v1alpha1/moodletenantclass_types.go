@@ -0,0 +1,77 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MoodleTenantClassSpec defines the presets of a MoodleTenantClass. Each preset fills in
+// the field of the same name that a MoodleTenant of the class leaves unset.
+type MoodleTenantClassSpec struct {
+	// Resources for the Moodle container, per resource.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// HPA configuration of the tenants.
+	// +optional
+	HPA *HPASpec `json:"hpa,omitempty"`
+
+	// PHPSettings of the tenants.
+	// +optional
+	PHPSettings *PHPSettingsSpec `json:"phpSettings,omitempty"`
+
+	// Memcached configuration of the tenants.
+	// +optional
+	Memcached *MemcachedSpec `json:"memcached,omitempty"`
+
+	// Cache selects the cache and session backend of the tenants.
+	// +optional
+	Cache *CacheSpec `json:"cache,omitempty"`
+
+	// StorageClass of the moodledata volume of the tenants.
+	// +optional
+	StorageClass string `json:"storageClass,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MoodleTenantClass is the Schema for the moodletenantclasses API. It is a tier of
+// presets, e.g. small, medium or large, for the MoodleTenants referencing it through
+// spec.classRef.
+type MoodleTenantClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MoodleTenantClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MoodleTenantClassList contains a list of MoodleTenantClass
+type MoodleTenantClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MoodleTenantClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MoodleTenantClass{}, &MoodleTenantClassList{})
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a MoodleTenantClone.
+const (
+	// ConditionCloneReady reports whether the copy has been provisioned, successfully or not.
+	ConditionCloneReady = "Ready"
+)
+
+// Phases of a MoodleTenantClone.
+const (
+	ClonePhasePending      = "Pending"
+	ClonePhaseDumping      = "Dumping"
+	ClonePhaseSnapshotting = "Snapshotting"
+	ClonePhaseRestoring    = "Restoring"
+	ClonePhaseRewriting    = "Rewriting"
+	ClonePhaseAnonymizing  = "Anonymizing"
+	ClonePhaseReady        = "Ready"
+	ClonePhaseFailed       = "Failed"
+)
+
+// MoodleTenantCloneSpec defines the desired state of MoodleTenantClone. A clone is
+// provisioned once; create a new MoodleTenantClone to copy the source again.
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable"
+type MoodleTenantCloneSpec struct {
+	// SourceRef is the MoodleTenant in the same namespace that is copied.
+	// +kubebuilder:validation:Required
+	SourceRef corev1.LocalObjectReference `json:"sourceRef"`
+
+	// TargetName is the name of the MoodleTenant created in the same namespace.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=40
+	// +kubebuilder:validation:Required
+	TargetName string `json:"targetName"`
+
+	// Hostname of the copy, which replaces the URL of the source in its database.
+	// +kubebuilder:validation:Required
+	Hostname string `json:"hostname"`
+
+	// DatabaseRef is the empty database of the copy, which the dump of the source is
+	// restored into.
+	// +kubebuilder:validation:Required
+	DatabaseRef DatabaseRefSpec `json:"databaseRef"`
+
+	// VolumeSnapshotClassName of the snapshot of moodledata. Defaults to the default
+	// class of the CSI driver.
+	// +optional
+	VolumeSnapshotClassName string `json:"volumeSnapshotClassName,omitempty"`
+
+	// Anonymize scrambles the personal data in the copy before it goes live, so that it
+	// can be handed to developers. The copy stays suspended until it is anonymized.
+	// +optional
+	Anonymize *CloneAnonymizeSpec `json:"anonymize,omitempty"`
+
+	// DataScan scans the moodledata of the copy once its database is restored. Defaults
+	// to the dataScan of the source.
+	// +optional
+	DataScan *DataScanSpec `json:"dataScan,omitempty"`
+}
+
+// CloneAnonymizeSpec defines how the copy of a tenant is anonymized. The names, emails,
+// usernames, contact details, custom profile fields and passwords of all users except
+// the guest and keepUsers are replaced, and all sessions are ended.
+type CloneAnonymizeSpec struct {
+	// EmailDomain of the addresses user<id>@<emailDomain> that replace the email of
+	// every anonymized user.
+	// +kubebuilder:default:="example.invalid"
+	// +optional
+	EmailDomain string `json:"emailDomain,omitempty"`
+
+	// KeepUsers are the usernames left unchanged, e.g. the accounts developers log in with.
+	// +kubebuilder:default:={"admin"}
+	// +optional
+	KeepUsers []string `json:"keepUsers,omitempty"`
+
+	// StripSubmissions deletes the files and online text of assignment submissions.
+	// +kubebuilder:default:=true
+	// +optional
+	StripSubmissions *bool `json:"stripSubmissions,omitempty"`
+}
+
+// MoodleTenantCloneStatus defines the observed state of MoodleTenantClone
+type MoodleTenantCloneStatus struct {
+	// Phase of the clone: Pending, Dumping, Snapshotting, Restoring, Rewriting,
+	// Anonymizing, Ready or Failed.
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// DumpName is the MoodleDatabaseDump of the source, written to its moodledata.
+	// +optional
+	DumpName string `json:"dumpName,omitempty"`
+
+	// VolumeSnapshotName is the VolumeSnapshot of the moodledata of the source, in the
+	// namespaces of both tenants.
+	// +optional
+	VolumeSnapshotName string `json:"volumeSnapshotName,omitempty"`
+
+	// TaskName is the MoodleTask replacing the URL of the source in the copy.
+	// +optional
+	TaskName string `json:"taskName,omitempty"`
+
+	// AnonymizeJobName is the Job anonymizing the copy in its tenant namespace.
+	// +optional
+	AnonymizeJobName string `json:"anonymizeJobName,omitempty"`
+
+	// CompletionTime is when the clone finished.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Conditions represent the latest available observations of the clone.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Source",type=string,JSONPath=`.spec.sourceRef.name`
+// +kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.spec.targetName`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MoodleTenantClone is the Schema for the moodletenantclones API. It provisions a copy
+// of a MoodleTenant, e.g. for staging, from a dump of its database and a snapshot of
+// its moodledata.
+type MoodleTenantClone struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MoodleTenantCloneSpec   `json:"spec,omitempty"`
+	Status MoodleTenantCloneStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MoodleTenantCloneList contains a list of MoodleTenantClone
+type MoodleTenantCloneList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MoodleTenantClone `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MoodleTenantClone{}, &MoodleTenantCloneList{})
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a MoodleTenantSet.
+const (
+	// ConditionTenantSetSynced reports whether a tenant exists with the rendered
+	// template for every member of the set.
+	ConditionTenantSetSynced = "Synced"
+)
+
+// MoodleTenantSetSpec defines the desired state of MoodleTenantSet
+type MoodleTenantSetSpec struct {
+	// NamePattern is the name of the tenant of a member. {{name}} is replaced with the
+	// name of the member and {{<key>}} with its parameter key, e.g. {{name}}-lms.
+	// +kubebuilder:default:="{{name}}"
+	// +optional
+	NamePattern string `json:"namePattern,omitempty"`
+
+	// Template of the tenants. The placeholders of namePattern can be used in all of its
+	// string fields, e.g. hostname: "{{name}}.lms.bsu.by" or adminSecret: "{{name}}-db".
+	// +kubebuilder:validation:Required
+	Template MoodleTenantTemplate `json:"template"`
+
+	// Members of the set, one tenant each.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Members []TenantSetMember `json:"members,omitempty"`
+}
+
+// MoodleTenantTemplate is the template of the tenants of a MoodleTenantSet.
+type MoodleTenantTemplate struct {
+	// Labels added to every tenant, e.g. moodle.bsu.by/tier for a MoodleUpgradePlan.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations added to every tenant.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Spec of the tenants.
+	// +kubebuilder:validation:Required
+	Spec MoodleTenantSpec `json:"spec"`
+}
+
+// TenantSetMember is a tenant of a MoodleTenantSet, e.g. a faculty.
+type TenantSetMember struct {
+	// Name of the member, e.g. biology. It replaces {{name}} in the template.
+	// +kubebuilder:validation:MaxLength=50
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Parameters of the member. Each replaces {{<key>}} in the template, e.g. a
+	// displayName or a storage size for a large faculty.
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// MoodleTenantSetStatus defines the observed state of MoodleTenantSet
+type MoodleTenantSetStatus struct {
+	// Tenants is the number of tenants of the set.
+	// +optional
+	Tenants int32 `json:"tenants,omitempty"`
+
+	// UpdatedTenants is the number of tenants created or updated from the current
+	// template.
+	// +optional
+	UpdatedTenants int32 `json:"updatedTenants,omitempty"`
+
+	// ReadyTenants is the number of tenants whose database is ready and which are not
+	// degraded.
+	// +optional
+	ReadyTenants int32 `json:"readyTenants,omitempty"`
+
+	// Conditions represent the latest available observations of the set.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Tenants",type=integer,JSONPath=`.status.tenants`
+// +kubebuilder:printcolumn:name="Updated",type=integer,JSONPath=`.status.updatedTenants`
+// +kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyTenants`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MoodleTenantSet is the Schema for the moodletenantsets API. It provisions a
+// MoodleTenant from a template for each of its members, e.g. one per faculty, and owns
+// them like a ReplicaSet owns its Pods.
+type MoodleTenantSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MoodleTenantSetSpec   `json:"spec,omitempty"`
+	Status MoodleTenantSetStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MoodleTenantSetList contains a list of MoodleTenantSet
+type MoodleTenantSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MoodleTenantSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MoodleTenantSet{}, &MoodleTenantSetList{})
+}
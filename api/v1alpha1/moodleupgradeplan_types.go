@@ -0,0 +1,176 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Condition types of a MoodleUpgradePlan.
+const (
+	// ConditionPlanComplete reports whether every tenant of the plan runs its image.
+	ConditionPlanComplete = "Complete"
+)
+
+// Phases of a MoodleUpgradePlan.
+const (
+	PlanPhaseProgressing = "Progressing"
+	PlanPhaseSoaking     = "Soaking"
+	PlanPhasePaused      = "Paused"
+	PlanPhaseHalted      = "Halted"
+	PlanPhaseCompleted   = "Completed"
+)
+
+// MoodleUpgradePlanSpec defines the desired state of MoodleUpgradePlan
+type MoodleUpgradePlanSpec struct {
+	// Image the tenants are upgraded to, by setting their spec.image.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Required
+	Image string `json:"image"`
+
+	// Selector of the MoodleTenants of the plan, in all namespaces. All tenants when
+	// empty.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Stages are upgraded one after the other. Every tenant belongs to the first stage
+	// whose selector matches it; a stage without a selector takes all remaining tenants.
+	// Tenants of no stage are not upgraded.
+	// +kubebuilder:validation:MinItems=1
+	// +listType=map
+	// +listMapKey=name
+	// +kubebuilder:validation:Required
+	Stages []UpgradeStage `json:"stages"`
+
+	// MaxFailures is the number of failed tenant upgrades the plan tolerates. One more
+	// halts it: no further tenant upgrade is started.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxFailures int32 `json:"maxFailures,omitempty"`
+
+	// Paused stops starting tenant upgrades. Upgrades already started finish.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+}
+
+// UpgradeStage is a batch of tenants of a MoodleUpgradePlan.
+type UpgradeStage struct {
+	// Name of the stage, e.g. pilot.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Selector of the tenants of the stage, e.g. moodle.bsu.by/tier: pilot.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// MaxParallel is the number of tenants of the stage upgraded at the same time.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default:=5
+	// +optional
+	MaxParallel int32 `json:"maxParallel,omitempty"`
+
+	// SoakMinutes is how long the plan waits after the stage has finished before the
+	// next stage starts, to catch problems the upgrade did not show.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default:=60
+	// +optional
+	SoakMinutes *int32 `json:"soakMinutes,omitempty"`
+}
+
+// MoodleUpgradePlanStatus defines the observed state of MoodleUpgradePlan
+type MoodleUpgradePlanStatus struct {
+	// Phase of the plan: Progressing, Soaking, Paused, Halted or Completed.
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// CurrentStage is the stage being upgraded or soaked.
+	// +optional
+	CurrentStage string `json:"currentStage,omitempty"`
+
+	// SoakUntil is when the next stage starts while the current one soaks.
+	// +optional
+	SoakUntil *metav1.Time `json:"soakUntil,omitempty"`
+
+	// Stages reports the progress of every stage.
+	// +optional
+	Stages []UpgradeStageStatus `json:"stages,omitempty"`
+
+	// FailedTenants are the <namespace>/<name> of the tenants whose upgrade failed.
+	// +optional
+	FailedTenants []string `json:"failedTenants,omitempty"`
+
+	// Conditions represent the latest available observations of the plan.
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// UpgradeStageStatus is the progress of a stage of a MoodleUpgradePlan.
+type UpgradeStageStatus struct {
+	// Name of the stage.
+	Name string `json:"name"`
+
+	// Tenants is the number of tenants of the stage.
+	Tenants int32 `json:"tenants"`
+
+	// Upgraded is the number of tenants running the image of the plan.
+	Upgraded int32 `json:"upgraded"`
+
+	// Upgrading is the number of tenants whose upgrade is running.
+	Upgrading int32 `json:"upgrading"`
+
+	// Failed is the number of tenants whose upgrade failed.
+	Failed int32 `json:"failed"`
+
+	// CompletionTime is when the last tenant of the stage finished.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Image",type=string,JSONPath=`.spec.image`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Stage",type=string,JSONPath=`.status.currentStage`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MoodleUpgradePlan is the Schema for the moodleupgradeplans API. It upgrades the
+// MoodleTenants of the fleet to an image in stages, e.g. a few pilot tenants first, and
+// halts on failed upgrades.
+type MoodleUpgradePlan struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MoodleUpgradePlanSpec   `json:"spec,omitempty"`
+	Status MoodleUpgradePlanStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MoodleUpgradePlanList contains a list of MoodleUpgradePlan
+type MoodleUpgradePlanList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MoodleUpgradePlan `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MoodleUpgradePlan{}, &MoodleUpgradePlanList{})
+}
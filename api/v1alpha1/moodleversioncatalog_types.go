@@ -0,0 +1,78 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MoodleVersionCatalogSpec defines the desired state of MoodleVersionCatalog
+type MoodleVersionCatalogSpec struct {
+	// Versions of Moodle, with the images running them and the versions they can be
+	// upgraded from.
+	// +listType=map
+	// +listMapKey=version
+	// +kubebuilder:validation:MinItems=1
+	Versions []MoodleVersion `json:"versions"`
+}
+
+// MoodleVersion is a Moodle version of the catalog.
+type MoodleVersion struct {
+	// Version of Moodle, major.minor or major.minor.patch, e.g. 4.1 or 4.1.2.
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+(\.[0-9]+)?$`
+	// +kubebuilder:validation:Required
+	Version string `json:"version"`
+
+	// Images are path.Match patterns of the images running this version, e.g.
+	// registry.bsu.by/moodle:4.1.*.
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:Required
+	Images []string `json:"images"`
+
+	// MinUpgradeFrom is the oldest version this version can be upgraded from, e.g. 3.11.8
+	// for 4.3. Upgrades from older versions must go through an intermediate version first.
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+(\.[0-9]+)?$`
+	// +optional
+	MinUpgradeFrom string `json:"minUpgradeFrom,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MoodleVersionCatalog is the Schema for the moodleversioncatalogs API. It maps images
+// to Moodle versions, so that the operator refuses upgrades that skip a required
+// intermediate version. All catalogs of the cluster are combined.
+type MoodleVersionCatalog struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MoodleVersionCatalogSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MoodleVersionCatalogList contains a list of MoodleVersionCatalog
+type MoodleVersionCatalogList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MoodleVersionCatalog `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MoodleVersionCatalog{}, &MoodleVersionCatalogList{})
+}
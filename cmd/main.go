@@ -17,14 +17,20 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
+	"net"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -34,6 +40,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/yaml"
 
 	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
 	"bsu.by/moodle-lms-operator/internal/controller"
@@ -61,6 +68,17 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
+	var driftIgnoredFields string
+	var networkPolicyTemplatePath string
+	var ingressControllerNamespace string
+	var ingressControllerPodLabels string
+	var maintenanceImage string
+	var databaseCheckTimeout time.Duration
+	var databaseCheckInterval time.Duration
+	var allowSnippetAnnotations bool
+	var taskAllowedScripts string
+	var activatorAddr string
+	var activatorURL string
 	var tlsOpts []func(*tls.Config)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", "0", "The address the metrics endpoint binds to. "+
 		"Use :8443 for HTTPS or :8080 for HTTP, or leave as 0 to disable the metrics service.")
@@ -79,6 +97,33 @@ func main() {
 	flag.StringVar(&metricsCertKey, "metrics-cert-key", "tls.key", "The name of the metrics server key file.")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.StringVar(&driftIgnoredFields, "drift-ignore-fields", "",
+		"Comma-separated list of <Kind>:<path> fields excluded from drift correction of tenant resources, "+
+			"e.g. Deployment:spec.template.metadata.annotations")
+	flag.StringVar(&networkPolicyTemplatePath, "network-policy-template", "",
+		"Path to a YAML NetworkPolicy spec that replaces the built-in baseline rules of tenant NetworkPolicies.")
+	flag.StringVar(&ingressControllerNamespace, "ingress-controller-namespace", "ingress-nginx",
+		"Namespace of the ingress controller allowed to reach tenant pods by the tenant NetworkPolicies.")
+	flag.StringVar(&ingressControllerPodLabels, "ingress-controller-pod-labels", "",
+		"Label selector of the ingress controller pods allowed to reach tenant pods, "+
+			"e.g. app.kubernetes.io/name=ingress-nginx")
+	flag.StringVar(&maintenanceImage, "maintenance-image", "nginxinc/nginx-unprivileged:stable-alpine",
+		"Image serving the maintenance page while a tenant has no ready Moodle pods.")
+	flag.DurationVar(&databaseCheckTimeout, "database-check-timeout", 3*time.Second,
+		"Timeout of connecting to tenant databases in the database check that gates tenant Deployments. "+
+			"Set to 0 to disable the check.")
+	flag.DurationVar(&databaseCheckInterval, "database-check-interval", 5*time.Minute,
+		"How often the database check is repeated to keep the DatabaseReachable condition current. Set to 0 to disable.")
+	flag.BoolVar(&allowSnippetAnnotations, "allow-snippet-annotations", false,
+		"Set ingress-nginx snippet annotations for security headers, the admin path restriction and ModSecurity rules. "+
+			"Requires the ingress controller to run with allow-snippet-annotations=true.")
+	flag.StringVar(&taskAllowedScripts, "task-allowed-scripts", strings.Join(controller.DefaultTaskAllowedScripts, ","),
+		"Comma-separated list of path patterns of the Moodle CLI scripts MoodleTasks may run, relative to the Moodle root.")
+	flag.StringVar(&activatorAddr, "activator-bind-address", "0",
+		"The address the activator waking hibernated tenants binds to, e.g. :8082, or 0 to disable it.")
+	flag.StringVar(&activatorURL, "activator-url", "",
+		"The in-cluster URL of the activator Service, e.g. http://moodle-lms-operator-activator.moodle-lms-operator-system.svc:8082. "+
+			"Requests to hibernated tenants wake them only when set.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -178,15 +223,118 @@ func main() {
 		os.Exit(1)
 	}
 
+	var driftIgnoredFieldList []string
+	if driftIgnoredFields != "" {
+		driftIgnoredFieldList = strings.Split(driftIgnoredFields, ",")
+	}
+
+	var networkPolicyTemplate *networkingv1.NetworkPolicySpec
+	if networkPolicyTemplatePath != "" {
+		data, err := os.ReadFile(networkPolicyTemplatePath)
+		if err != nil {
+			setupLog.Error(err, "unable to read NetworkPolicy template")
+			os.Exit(1)
+		}
+		networkPolicyTemplate = &networkingv1.NetworkPolicySpec{}
+		if err := yaml.UnmarshalStrict(data, networkPolicyTemplate); err != nil {
+			setupLog.Error(err, "unable to parse NetworkPolicy template")
+			os.Exit(1)
+		}
+	}
+
+	var ingressControllerPodSelector *metav1.LabelSelector
+	if ingressControllerPodLabels != "" {
+		ingressControllerPodSelector, err = metav1.ParseToLabelSelector(ingressControllerPodLabels)
+		if err != nil {
+			setupLog.Error(err, "unable to parse ingress controller pod labels")
+			os.Exit(1)
+		}
+	}
+
+	// Tenant Deployments wait until their database accepts connections
+	var databaseDialer func(ctx context.Context, network, address string) (net.Conn, error)
+	if databaseCheckTimeout > 0 {
+		databaseDialer = (&net.Dialer{Timeout: databaseCheckTimeout}).DialContext
+	}
+
 	if err := (&controller.MoodleTenantReconciler{
+		Client:                       mgr.GetClient(),
+		Scheme:                       mgr.GetScheme(),
+		DriftIgnoredFields:           driftIgnoredFieldList,
+		NetworkPolicyTemplate:        networkPolicyTemplate,
+		IngressControllerNamespace:   ingressControllerNamespace,
+		IngressControllerPodSelector: ingressControllerPodSelector,
+		MaintenanceImage:             maintenanceImage,
+		DatabaseDialer:               databaseDialer,
+		DatabaseCheckInterval:        databaseCheckInterval,
+		Recorder:                     mgr.GetEventRecorderFor("moodletenant-controller"),
+		APIReader:                    mgr.GetAPIReader(),
+		ActivatorURL:                 activatorURL,
+		AllowSnippetAnnotations:      allowSnippetAnnotations,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MoodleTenant")
+		os.Exit(1)
+	}
+	if err := (&controller.MoodleDatabaseDumpReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "MoodleTenant")
+		setupLog.Error(err, "unable to create controller", "controller", "MoodleDatabaseDump")
+		os.Exit(1)
+	}
+	if err := (&controller.MoodleCacheClusterReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MoodleCacheCluster")
+		os.Exit(1)
+	}
+	if err := (&controller.MoodleTaskReconciler{
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		APIReader:      mgr.GetAPIReader(),
+		AllowedScripts: strings.Split(taskAllowedScripts, ","),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MoodleTask")
+		os.Exit(1)
+	}
+	if err := (&controller.MoodleUpgradePlanReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MoodleUpgradePlan")
+		os.Exit(1)
+	}
+	if err := (&controller.MoodleTenantCloneReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MoodleTenantClone")
+		os.Exit(1)
+	}
+	if err := (&controller.MoodleTenantSetReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "MoodleTenantSet")
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
 
+	// Requests to hibernated tenants are passed on to the activator, which wakes them
+	if activatorAddr != "0" {
+		if err := mgr.Add(&controller.ActivatorServer{Addr: activatorAddr, Client: mgr.GetClient()}); err != nil {
+			setupLog.Error(err, "unable to set up activator")
+			os.Exit(1)
+		}
+	}
+
+	// The fleet inventory is served next to the metrics and shares their authn/authz
+	if err := mgr.AddMetricsServerExtraHandler(controller.InventoryPath, controller.InventoryHandler(mgr.GetClient())); err != nil {
+		setupLog.Error(err, "unable to set up inventory endpoint")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -0,0 +1,125 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// ActivatorPath is the path prefix of the wake requests, followed by the namespace and
+// the name of the MoodleTenant
+const ActivatorPath = "/wake/"
+
+// ActivatorHandler wakes hibernated MoodleTenants through the wake annotation. The
+// hibernated page of a tenant passes every request on to it, and shows itself whatever
+// the answer, which is always 503 for a site that is not ready yet.
+func ActivatorHandler(c client.Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		logger := log.FromContext(req.Context())
+
+		namespace, name, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, ActivatorPath), "/")
+		if !strings.HasPrefix(req.URL.Path, ActivatorPath) || !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+			http.NotFound(w, req)
+			return
+		}
+
+		w.Header().Set("Retry-After", "30")
+		mt := &moodlev1alpha1.MoodleTenant{}
+		if err := c.Get(req.Context(), types.NamespacedName{Name: name, Namespace: namespace}, mt); err != nil {
+			http.Error(w, "the site is not available", http.StatusServiceUnavailable)
+			return
+		}
+		// Requests keep arriving while the tenant starts, but one wake is enough
+		if hibernated(mt) && wakeOnRequest(mt) && !wakeRequested(mt) {
+			patch := client.MergeFrom(mt.DeepCopy())
+			if mt.Annotations == nil {
+				mt.Annotations = map[string]string{}
+			}
+			mt.Annotations[wakeAnnotation] = time.Now().UTC().Format(time.RFC3339)
+			if err := c.Patch(req.Context(), mt, patch); err != nil {
+				logger.Error(err, "Failed to wake MoodleTenant", "Namespace", namespace, "Name", name)
+			} else {
+				logger.Info("Waking MoodleTenant on request", "Namespace", namespace, "Name", name)
+			}
+		}
+		http.Error(w, "the site is starting", http.StatusServiceUnavailable)
+	})
+}
+
+// activatorPort returns the port of the activator URL, or zero without an activator
+func activatorPort(activatorURL string) int32 {
+	if activatorURL == "" {
+		return 0
+	}
+	parsed, err := url.Parse(activatorURL)
+	if err != nil {
+		return 0
+	}
+	if port, err := strconv.ParseInt(parsed.Port(), 10, 32); err == nil {
+		return int32(port)
+	}
+	if parsed.Scheme == "https" {
+		return 443
+	}
+	return 80
+}
+
+// ActivatorServer serves the ActivatorHandler on every replica of the manager, since the
+// Service in front of it does not know the leader
+type ActivatorServer struct {
+	// Addr is the address the activator binds to
+	Addr string
+
+	// Client reads and wakes the MoodleTenants
+	Client client.Client
+}
+
+// Start serves the activator until the context is cancelled
+func (s *ActivatorServer) Start(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              s.Addr,
+		Handler:           ActivatorHandler(s.Client),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection lets every replica serve the activator
+func (s *ActivatorServer) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// cloneNamespaceLabel links the anonymization Job in the tenant namespace of the copy to
+// the namespace of its MoodleTenantClone
+const cloneNamespaceLabel = "moodle.bsu.by/clone-namespace"
+
+// anonymizeScript replaces the personal data of all users except the guest and
+// $ANONYMIZE_KEEP_USERS, optionally deletes assignment submissions, and ends all sessions
+const anonymizeScript = `set -e
+php <<'PHP'
+<?php
+define('CLI_SCRIPT', true);
+require '/var/www/html/config.php';
+
+$domain = getenv('ANONYMIZE_EMAIL_DOMAIN');
+$keep = array_filter(explode(',', getenv('ANONYMIZE_KEEP_USERS')));
+$keep[] = 'guest';
+
+$count = 0;
+$users = $DB->get_recordset_select('user', 'deleted = 0', null, '', 'id, username');
+foreach ($users as $user) {
+    if (in_array($user->username, $keep, true)) {
+        continue;
+    }
+    $DB->update_record('user', (object) [
+        'id' => $user->id,
+        'username' => 'user' . $user->id,
+        'email' => 'user' . $user->id . '@' . $domain,
+        'firstname' => 'User',
+        'lastname' => (string) $user->id,
+        'firstnamephonetic' => '',
+        'lastnamephonetic' => '',
+        'middlename' => '',
+        'alternatename' => '',
+        'idnumber' => '',
+        'password' => AUTH_PASSWORD_NOT_CACHED,
+        'phone1' => '',
+        'phone2' => '',
+        'institution' => '',
+        'department' => '',
+        'address' => '',
+        'city' => '',
+        'description' => '',
+        'lastip' => '',
+        'picture' => 0,
+    ]);
+    $DB->set_field('user_info_data', 'data', '', ['userid' => $user->id]);
+    $count++;
+}
+$users->close();
+echo "Anonymized $count users\n";
+
+if (getenv('ANONYMIZE_STRIP_SUBMISSIONS') === 'true') {
+    $fs = get_file_storage();
+    $files = $DB->get_recordset_select('files', $DB->sql_like('component', '?'), ['assignsubmission\_%']);
+    foreach ($files as $file) {
+        $fs->get_file_instance($file)->delete();
+    }
+    $files->close();
+    $DB->set_field('assignsubmission_onlinetext', 'onlinetext', '');
+    echo "Stripped assignment submissions\n";
+}
+
+\core\session\manager::kill_all_sessions();
+purge_caches();
+PHP
+`
+
+// anonymizeJobName returns the name of the anonymization Job of a clone
+func anonymizeJobName(clone *moodlev1alpha1.MoodleTenantClone) string {
+	return clone.Name + "-anonymize"
+}
+
+// reconcileCloneAnonymization runs the anonymization Job in the tenant namespace of the
+// copy and reports whether it succeeded, or why it failed. The Job cannot be owned by the
+// MoodleTenantClone; it is removed with the copy.
+func (r *MoodleTenantCloneReconciler) reconcileCloneAnonymization(ctx context.Context, clone *moodlev1alpha1.MoodleTenantClone, target *moodlev1alpha1.MoodleTenant) (bool, string, error) {
+	logger := log.FromContext(ctx)
+
+	job := anonymizeJobForMoodle(clone, target, "tenant-"+target.Name)
+	clone.Status.AnonymizeJobName = job.Name
+
+	found := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new anonymization Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new anonymization Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return false, "", err
+		}
+		return false, "", nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get anonymization Job")
+		return false, "", err
+	}
+
+	if jobFailed(found) {
+		return false, fmt.Sprintf("Job %s/%s failed, see its logs", found.Namespace, found.Name), nil
+	}
+	return found.Status.Succeeded > 0, "", nil
+}
+
+// anonymizeJobForMoodle returns the Job anonymizing the copy. It runs the cron pod of the
+// copy, with its environment and volumes, and is not retried.
+func anonymizeJobForMoodle(clone *moodlev1alpha1.MoodleTenantClone, mt *moodlev1alpha1.MoodleTenant, namespace string) *batchv1.Job {
+	anonymize := clone.Spec.Anonymize
+	domain := anonymize.EmailDomain
+	if domain == "" {
+		domain = "example.invalid"
+	}
+
+	template := moodleCronJob(mt, namespace).Spec.JobTemplate.Spec.Template
+	template.Labels = mergeStringMaps(template.Labels, map[string]string{"moodle.bsu.by/tenant": mt.Name})
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	container := &template.Spec.Containers[0]
+	container.Name = "anonymize"
+	container.Command = []string{"sh", "-c", anonymizeScript}
+	container.Args = nil
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "ANONYMIZE_EMAIL_DOMAIN", Value: domain},
+		corev1.EnvVar{Name: "ANONYMIZE_KEEP_USERS", Value: strings.Join(anonymize.KeepUsers, ",")},
+		corev1.EnvVar{Name: "ANONYMIZE_STRIP_SUBMISSIONS", Value: strconv.FormatBool(ptr.Deref(anonymize.StripSubmissions, true))},
+	)
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      anonymizeJobName(clone),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"moodle.bsu.by/tenant": mt.Name,
+				"moodle.bsu.by/job":    "anonymize",
+				cloneLabel:             clone.Name,
+				cloneNamespaceLabel:    clone.Namespace,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](0),
+			Template:     template,
+		},
+	}
+}
+
+// cloneForJob maps an anonymization Job in a tenant namespace to its MoodleTenantClone
+func cloneForJob(_ context.Context, obj client.Object) []reconcile.Request {
+	name, namespace := obj.GetLabels()[cloneLabel], obj.GetLabels()[cloneNamespaceLabel]
+	if name == "" || namespace == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}}
+}
@@ -0,0 +1,302 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// backendTLSPort is the port nginx in the Moodle pod terminates TLS on
+const backendTLSPort = 8443
+
+// backendTLSServerConfig is the nginx server block serving Moodle over TLS, included by the image
+const backendTLSServerConfig = `server {
+    listen 8443 ssl;
+    server_name _;
+    ssl_certificate /etc/nginx/moodle-tls-certs/tls.crt;
+    ssl_certificate_key /etc/nginx/moodle-tls-certs/tls.key;
+    ssl_protocols TLSv1.2 TLSv1.3;
+    include /etc/nginx/snippets/moodle-server.conf;
+}
+`
+
+// backendTLSName returns the name of the backend TLS secret, ConfigMap and Certificate
+func backendTLSName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-backend-tls"
+}
+
+// backendTLSEnabled reports whether the Ingress reaches Moodle over TLS. The maintenance
+// page is always served over plain HTTP.
+func backendTLSEnabled(mt *moodlev1alpha1.MoodleTenant) bool {
+	return mt.Spec.BackendTLS != nil && ingressBackendService(mt) == mt.Name+"-service"
+}
+
+// backendTLSDNSNames returns the names the Moodle Service is reached by
+func backendTLSDNSNames(mt *moodlev1alpha1.MoodleTenant, namespace string) []string {
+	service := mt.Name + "-service"
+	return []string{
+		service,
+		fmt.Sprintf("%s.%s.svc", service, namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", service, namespace),
+	}
+}
+
+// reconcileBackendTLS provides the serving certificate and nginx configuration for TLS at the pods
+func (r *MoodleTenantReconciler) reconcileBackendTLS(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Spec.BackendTLS == nil {
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: backendTLSName(mt), Namespace: namespace}}
+		if err := r.Delete(ctx, configMap); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete backend TLS ConfigMap", "ConfigMap.Namespace", namespace, "ConfigMap.Name", configMap.Name)
+			return err
+		}
+		return r.deleteUnstructured(ctx, certificateGVK, namespace, backendTLSName(mt))
+	}
+
+	if err := r.reconcileObject(ctx, mt, r.backendTLSConfigMapForMoodle(mt, namespace), &corev1.ConfigMap{}); err != nil {
+		return err
+	}
+
+	if mt.Spec.BackendTLS.IssuerRef != nil {
+		_, err := r.reconcileUnstructured(ctx, r.backendCertificateForMoodle(mt, namespace))
+		return err
+	}
+
+	// The self-signed certificate is generated once and kept for its lifetime
+	found := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: backendTLSName(mt), Namespace: namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		secret, err := r.backendTLSSecretForMoodle(mt, namespace)
+		if err != nil {
+			logger.Error(err, "Failed to generate backend TLS certificate")
+			return err
+		}
+		logger.Info("Creating a new backend TLS Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+		if err := r.Create(ctx, secret); err != nil {
+			logger.Error(err, "Failed to create new backend TLS Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get backend TLS Secret")
+		return err
+	}
+
+	return nil
+}
+
+// backendTLSConfigMapForMoodle returns the ConfigMap with the nginx TLS server block
+func (r *MoodleTenantReconciler) backendTLSConfigMapForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backendTLSName(mt),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":                  "moodle",
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+		},
+		Data: map[string]string{
+			"tls.conf": backendTLSServerConfig,
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, configMap, r.Scheme); err != nil {
+		return nil
+	}
+
+	return configMap
+}
+
+// backendCertificateForMoodle returns a cert-manager Certificate for the Moodle Service names
+func (r *MoodleTenantReconciler) backendCertificateForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	issuerRef := mt.Spec.BackendTLS.IssuerRef
+
+	dnsNames := []interface{}{}
+	for _, dnsName := range backendTLSDNSNames(mt, namespace) {
+		dnsNames = append(dnsNames, dnsName)
+	}
+
+	certificate := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"secretName": backendTLSName(mt),
+				"dnsNames":   dnsNames,
+				"issuerRef": map[string]interface{}{
+					"name":  issuerRef.Name,
+					"kind":  issuerRef.Kind,
+					"group": issuerRef.Group,
+				},
+			},
+		},
+	}
+	certificate.SetGroupVersionKind(certificateGVK)
+	certificate.SetName(backendTLSName(mt))
+	certificate.SetNamespace(namespace)
+	certificate.SetLabels(map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, certificate, r.Scheme); err != nil {
+		return nil
+	}
+
+	return certificate
+}
+
+// backendTLSSecretForMoodle returns a TLS secret with a freshly generated self-signed
+// certificate. The certificate is its own CA, so it is also stored as ca.crt for the
+// Ingress to verify the backend with.
+func (r *MoodleTenantReconciler) backendTLSSecretForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) (*corev1.Secret, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	dnsNames := backendTLSDNSNames(mt, namespace)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: dnsNames[1]},
+		DNSNames:              dnsNames,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backendTLSName(mt),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":                  "moodle",
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certPEM,
+			corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+			"ca.crt":                certPEM,
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// backendTLSAnnotations returns the ingress-nginx annotations proxying to Moodle over
+// TLS and verifying its certificate against the CA in the backend TLS secret
+func backendTLSAnnotations(mt *moodlev1alpha1.MoodleTenant, namespace string) map[string]string {
+	if !backendTLSEnabled(mt) {
+		return nil
+	}
+
+	return map[string]string{
+		nginxAnnotationPrefix + "backend-protocol":      "HTTPS",
+		nginxAnnotationPrefix + "proxy-ssl-secret":      namespace + "/" + backendTLSName(mt),
+		nginxAnnotationPrefix + "proxy-ssl-verify":      "on",
+		nginxAnnotationPrefix + "proxy-ssl-name":        backendTLSDNSNames(mt, namespace)[1],
+		nginxAnnotationPrefix + "proxy-ssl-server-name": "on",
+	}
+}
+
+// applyBackendTLS exposes the TLS port of nginx in the Moodle pod and mounts its certificate
+func applyBackendTLS(mt *moodlev1alpha1.MoodleTenant, podSpec *corev1.PodSpec) {
+	if mt.Spec.BackendTLS == nil {
+		return
+	}
+
+	container := &podSpec.Containers[0]
+	container.Ports = append(container.Ports, corev1.ContainerPort{
+		Name:          "https",
+		ContainerPort: backendTLSPort,
+		Protocol:      corev1.ProtocolTCP,
+	})
+	container.VolumeMounts = append(container.VolumeMounts,
+		corev1.VolumeMount{
+			Name:      "backend-tls-config",
+			MountPath: "/etc/nginx/moodle-tls",
+			ReadOnly:  true,
+		},
+		corev1.VolumeMount{
+			Name:      "backend-tls-certs",
+			MountPath: "/etc/nginx/moodle-tls-certs",
+			ReadOnly:  true,
+		},
+	)
+	podSpec.Volumes = append(podSpec.Volumes,
+		corev1.Volume{
+			Name: "backend-tls-config",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: backendTLSName(mt)},
+				},
+			},
+		},
+		corev1.Volume{
+			Name: "backend-tls-certs",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: backendTLSName(mt),
+				},
+			},
+		},
+	)
+}
@@ -0,0 +1,302 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// revertRolloutAnnotation switches the Service of the BlueGreen strategy back to the
+// previous Deployment whenever its value changes, e.g.
+// kubectl annotate moodletenant <name> moodle.bsu.by/revert-rollout="$(date +%s)" --overwrite
+const revertRolloutAnnotation = "moodle.bsu.by/revert-rollout"
+
+// colorLabel tells the pods of the two Deployments of the BlueGreen strategy apart
+const colorLabel = "moodle.bsu.by/color"
+
+// podTemplateHashAnnotation records on a Deployment the hash of the pod template it was
+// rendered from
+const podTemplateHashAnnotation = "moodle.bsu.by/pod-template-hash"
+
+const (
+	colorBlue  = "blue"
+	colorGreen = "green"
+)
+
+// blueGreen reports whether the Moodle Deployment is rolled out blue-green
+func blueGreen(mt *moodlev1alpha1.MoodleTenant) bool {
+	return mt.Spec.Rollout.Strategy == "BlueGreen"
+}
+
+// otherColor returns the color of the other Deployment
+func otherColor(color string) string {
+	if color == colorBlue {
+		return colorGreen
+	}
+	return colorBlue
+}
+
+// moodleDeploymentName returns the name of the Deployment of a color. Blue keeps the
+// name of the Deployment of the RollingUpdate strategy, so switching strategies keeps it.
+func moodleDeploymentName(mt *moodlev1alpha1.MoodleTenant, color string) string {
+	if color == colorGreen {
+		return mt.Name + "-deployment-green"
+	}
+	return mt.Name + "-deployment"
+}
+
+// activeDeploymentName returns the name of the Deployment serving the site
+func activeDeploymentName(mt *moodlev1alpha1.MoodleTenant) string {
+	if bg := mt.Status.BlueGreen; blueGreen(mt) && bg != nil {
+		return moodleDeploymentName(mt, bg.ActiveColor)
+	}
+	return mt.Name + "-deployment"
+}
+
+// serviceColor returns the color the Service selects, or "" for all Moodle pods. A blue
+// Deployment from before the BlueGreen strategy has no colored pods until its first
+// switch.
+func serviceColor(mt *moodlev1alpha1.MoodleTenant) string {
+	if bg := mt.Status.BlueGreen; blueGreen(mt) && bg != nil && bg.ActiveHash != "" {
+		return bg.ActiveColor
+	}
+	return ""
+}
+
+// colorSelector returns the selector of a Service in front of the Moodle pods. The
+// BlueGreen strategy switches the public and the internal Service between the pods of its
+// Deployments.
+func colorSelector(mt *moodlev1alpha1.MoodleTenant, labels map[string]string) map[string]string {
+	if color := serviceColor(mt); color != "" {
+		return mergeStringMaps(labels, map[string]string{colorLabel: color})
+	}
+	return labels
+}
+
+// blueGreenScaleDownDelay returns how long the previous Deployment keeps running
+func blueGreenScaleDownDelay(mt *moodlev1alpha1.MoodleTenant) time.Duration {
+	return time.Duration(ptr.Deref(mt.Spec.Rollout.ScaleDownDelaySeconds, 600)) * time.Second
+}
+
+// podTemplateHash returns the hash of a pod template, which changes with anything that
+// rolls the Deployment
+func podTemplateHash(template corev1.PodTemplateSpec) (string, error) {
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	hash := fnv.New32a()
+	hash.Write(data)
+	return fmt.Sprintf("%08x", hash.Sum32()), nil
+}
+
+// coloredDeployment returns the Deployment of a color rendered from the Moodle
+// Deployment. The selector of blue cannot change and keeps selecting both colors, which
+// the Deployment controller tells apart by the owners of the ReplicaSets.
+func coloredDeployment(mt *moodlev1alpha1.MoodleTenant, deployment *appsv1.Deployment, color, hash string) *appsv1.Deployment {
+	colored := deployment.DeepCopy()
+	colored.Name = moodleDeploymentName(mt, color)
+	colored.Annotations = mergeStringMaps(colored.Annotations, map[string]string{podTemplateHashAnnotation: hash})
+	colored.Spec.Template.Labels = mergeStringMaps(colored.Spec.Template.Labels, map[string]string{colorLabel: color})
+	if color == colorGreen {
+		colored.Spec.Selector = &metav1.LabelSelector{
+			MatchLabels: mergeStringMaps(colored.Spec.Selector.MatchLabels, map[string]string{colorLabel: color}),
+		}
+	}
+	return colored
+}
+
+// reconcileBlueGreen rolls a new pod template out on the other Deployment and switches
+// the Service to it once all its pods are ready. The previous Deployment keeps running
+// for scaleDownDelaySeconds, so that the switch can be reverted at once.
+func (r *MoodleTenantReconciler) reconcileBlueGreen(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	deployment := r.deploymentForMoodle(mt, namespace)
+	if deployment == nil {
+		return fmt.Errorf("failed to build the Deployment")
+	}
+	hash, err := podTemplateHash(deployment.Spec.Template)
+	if err != nil {
+		return err
+	}
+	bg := mt.Status.BlueGreen
+	if bg == nil {
+		bg = &moodlev1alpha1.BlueGreenStatus{ActiveColor: colorBlue}
+		mt.Status.BlueGreen = bg
+	}
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionPromoted,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Promoted",
+		ObservedGeneration: mt.Generation,
+	}
+
+	if trigger := mt.Annotations[revertRolloutAnnotation]; trigger != "" && trigger != bg.RevertTrigger {
+		bg.RevertTrigger = trigger
+		if err := r.revertBlueGreen(ctx, mt, namespace); err != nil {
+			return err
+		}
+	}
+
+	active := coloredDeployment(mt, deployment, bg.ActiveColor, hash)
+	found := &appsv1.Deployment{}
+	err = r.Get(ctx, types.NamespacedName{Name: active.Name, Namespace: namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new Deployment", "Deployment.Namespace", namespace, "Deployment.Name", active.Name)
+		if err := r.markApplied(mt, active); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, active); err != nil {
+			logger.Error(err, "Failed to create new Deployment", "Deployment.Namespace", namespace, "Deployment.Name", active.Name)
+			return err
+		}
+		bg.ActiveHash = hash
+		condition.Message = fmt.Sprintf("The %s Deployment runs the current pod template", bg.ActiveColor)
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get Deployment")
+		return err
+	}
+
+	switch hash {
+	case bg.ActiveHash:
+		if err := r.correctDrift(ctx, mt, active, found); err != nil {
+			return err
+		}
+		condition.Message = fmt.Sprintf("The %s Deployment runs the current pod template", bg.ActiveColor)
+	case bg.RevertedHash:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Reverted"
+		condition.Message = fmt.Sprintf("The rollout was reverted to the %s Deployment, and is retried when the MoodleTenant changes", bg.ActiveColor)
+	default:
+		color := otherColor(bg.ActiveColor)
+		preview := coloredDeployment(mt, deployment, color, hash)
+		preview.Spec.Replicas = found.Spec.Replicas
+		previewFound := &appsv1.Deployment{}
+		if err := r.reconcileObject(ctx, mt, preview, previewFound); err != nil {
+			return err
+		}
+		// The previous Deployment is reused for the preview, at the scale of the active
+		// one even where drift correction leaves the replicas to the HPA
+		bg.ScaleDownTime = nil
+		if previewFound.Name != "" && ptr.Deref(previewFound.Spec.Replicas, 1) != ptr.Deref(found.Spec.Replicas, 1) {
+			previewFound.Spec.Replicas = found.Spec.Replicas
+			if err := r.Update(ctx, previewFound); err != nil {
+				logger.Error(err, "Failed to scale Deployment", "Deployment.Namespace", namespace, "Deployment.Name", previewFound.Name)
+				return err
+			}
+		}
+		if previewFound.Annotations[podTemplateHashAnnotation] != hash || !rolloutComplete(previewFound, moodleImage(mt)) {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "PreviewRollingOut"
+			condition.Message = fmt.Sprintf("Waiting for all pods of the %s Deployment to become ready", color)
+			meta.SetStatusCondition(&mt.Status.Conditions, condition)
+			return nil
+		}
+
+		logger.Info("Switching the Service to the new Deployment", "Deployment.Namespace", namespace, "Deployment.Name", preview.Name)
+		bg.PreviousHash = bg.ActiveHash
+		bg.ActiveHash = hash
+		bg.ActiveColor = color
+		bg.ScaleDownTime = ptr.To(metav1.NewTime(time.Now().Add(blueGreenScaleDownDelay(mt))))
+		condition.Message = fmt.Sprintf("The %s Deployment runs the current pod template", bg.ActiveColor)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	if bg.ScaleDownTime == nil || time.Now().Before(bg.ScaleDownTime.Time) {
+		return nil
+	}
+	previous := &appsv1.Deployment{}
+	err = r.Get(ctx, types.NamespacedName{Name: moodleDeploymentName(mt, otherColor(bg.ActiveColor)), Namespace: namespace}, previous)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get Deployment")
+		return err
+	}
+	if err == nil && ptr.Deref(previous.Spec.Replicas, 1) != 0 {
+		logger.Info("Scaling the previous Deployment down", "Deployment.Namespace", namespace, "Deployment.Name", previous.Name)
+		previous.Spec.Replicas = ptr.To[int32](0)
+		if err := r.Update(ctx, previous); err != nil {
+			logger.Error(err, "Failed to scale Deployment down", "Deployment.Namespace", namespace, "Deployment.Name", previous.Name)
+			return err
+		}
+	}
+	bg.ScaleDownTime = nil
+	return nil
+}
+
+// revertBlueGreen switches the Service back to the previous Deployment while it still
+// runs all its pods. Its pod template is kept until the MoodleTenant changes.
+func (r *MoodleTenantReconciler) revertBlueGreen(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+	bg := mt.Status.BlueGreen
+
+	color := otherColor(bg.ActiveColor)
+	previous := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: moodleDeploymentName(mt, color), Namespace: namespace}, previous)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get Deployment")
+		return err
+	}
+	replicas := ptr.Deref(previous.Spec.Replicas, 1)
+	if err != nil || bg.PreviousHash == "" || previous.Annotations[podTemplateHashAnnotation] != bg.PreviousHash || replicas == 0 || previous.Status.AvailableReplicas < replicas {
+		r.warn(mt, "RevertFailed", fmt.Sprintf("The previous %s Deployment is not running, the rollout cannot be reverted", color))
+		return nil
+	}
+
+	logger.Info("Reverting the Service to the previous Deployment", "Deployment.Namespace", namespace, "Deployment.Name", previous.Name)
+	r.warn(mt, "RolloutReverted", fmt.Sprintf("The Service was switched back to the %s Deployment", color))
+	bg.RevertedHash = bg.ActiveHash
+	bg.ActiveHash, bg.PreviousHash = bg.PreviousHash, bg.ActiveHash
+	bg.ActiveColor = color
+	bg.ScaleDownTime = ptr.To(metav1.NewTime(time.Now().Add(blueGreenScaleDownDelay(mt))))
+	return nil
+}
+
+// deleteBlueGreen removes the green Deployment and the state of the BlueGreen strategy
+// once the tenant is rolled out in place again
+func (r *MoodleTenantReconciler) deleteBlueGreen(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Status.BlueGreen == nil {
+		return nil
+	}
+	green := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: moodleDeploymentName(mt, colorGreen), Namespace: namespace}}
+	if err := r.Delete(ctx, green); err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to delete Deployment", "Deployment.Namespace", namespace, "Deployment.Name", green.Name)
+		return err
+	}
+	mt.Status.BlueGreen = nil
+	meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionPromoted)
+	return nil
+}
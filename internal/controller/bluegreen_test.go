@@ -0,0 +1,125 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Blue-green rollout", func() {
+	It("should switch the Service once the new Deployment is ready, and back on revert", func() {
+		ctx := context.Background()
+
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "bluegreen", UID: "bluegreen-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Image:   "moodle:4.5.2",
+				Rollout: moodlev1alpha1.RolloutSpec{Strategy: "BlueGreen"},
+			},
+		}
+		namespace := "tenant-bluegreen"
+		getDeployment := func(name string) *appsv1.Deployment {
+			deployment := &appsv1.Deployment{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, deployment)).To(Succeed())
+			return deployment
+		}
+
+		Expect(reconciler.reconcileDeployment(ctx, mt, namespace)).To(Succeed())
+		blue := getDeployment("bluegreen-deployment")
+		Expect(blue.Spec.Template.Labels).To(HaveKeyWithValue(colorLabel, colorBlue))
+		Expect(reconciler.serviceForMoodle(mt, namespace).Spec.Selector).To(HaveKeyWithValue(colorLabel, colorBlue))
+
+		// A new image comes up on green while blue keeps serving
+		mt.Spec.Image = "moodle:4.5.3"
+		mt.Status.UpgradedImage = "moodle:4.5.3"
+		Expect(reconciler.reconcileDeployment(ctx, mt, namespace)).To(Succeed())
+		green := getDeployment("bluegreen-deployment-green")
+		Expect(green.Spec.Selector.MatchLabels).To(HaveKeyWithValue(colorLabel, colorGreen))
+		Expect(green.Spec.Template.Spec.Containers[0].Image).To(Equal("moodle:4.5.3"))
+		Expect(meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionPromoted).Reason).To(Equal("PreviewRollingOut"))
+		Expect(activeDeploymentName(mt)).To(Equal("bluegreen-deployment"))
+		Expect(getDeployment("bluegreen-deployment").Spec.Template.Spec.Containers[0].Image).To(Equal("moodle:4.5.2"))
+
+		green.Status = appsv1.DeploymentStatus{ObservedGeneration: green.Generation, Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+		Expect(c.Status().Update(ctx, green)).To(Succeed())
+		Expect(reconciler.reconcileDeployment(ctx, mt, namespace)).To(Succeed())
+		Expect(activeDeploymentName(mt)).To(Equal("bluegreen-deployment-green"))
+		Expect(reconciler.serviceForMoodle(mt, namespace).Spec.Selector).To(HaveKeyWithValue(colorLabel, colorGreen))
+		Expect(mt.Status.BlueGreen.ScaleDownTime).NotTo(BeNil())
+
+		// Blue still runs, so the switch is reverted at once and not retried
+		blue = getDeployment("bluegreen-deployment")
+		blue.Status = appsv1.DeploymentStatus{Replicas: 1, AvailableReplicas: 1}
+		Expect(c.Status().Update(ctx, blue)).To(Succeed())
+		mt.Annotations = map[string]string{revertRolloutAnnotation: "1"}
+		Expect(reconciler.reconcileDeployment(ctx, mt, namespace)).To(Succeed())
+		Expect(activeDeploymentName(mt)).To(Equal("bluegreen-deployment"))
+		Expect(meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionPromoted).Reason).To(Equal("Reverted"))
+		Expect(getDeployment("bluegreen-deployment").Spec.Template.Spec.Containers[0].Image).To(Equal("moodle:4.5.2"))
+
+		// Back to rolling updates, green is removed
+		mt.Spec.Rollout.Strategy = "RollingUpdate"
+		Expect(reconciler.reconcileDeployment(ctx, mt, namespace)).To(Succeed())
+		Expect(mt.Status.BlueGreen).To(BeNil())
+		Expect(c.Get(ctx, types.NamespacedName{Name: "bluegreen-deployment-green", Namespace: namespace}, &appsv1.Deployment{})).NotTo(Succeed())
+		Expect(getDeployment("bluegreen-deployment").Spec.Template.Spec.Containers[0].Image).To(Equal("moodle:4.5.3"))
+		Expect(ptr.Deref(getDeployment("bluegreen-deployment").Spec.Replicas, 1)).To(Equal(int32(1)))
+	})
+
+	It("should switch the internal Service together with the public one", func() {
+		reconciler := &MoodleTenantReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "bluegreen", UID: "bluegreen-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Rollout:  moodlev1alpha1.RolloutSpec{Strategy: "BlueGreen"},
+				Exposure: moodlev1alpha1.ExposureSpec{InternalHostname: "lti"},
+			},
+			Status: moodlev1alpha1.MoodleTenantStatus{
+				BlueGreen: &moodlev1alpha1.BlueGreenStatus{ActiveColor: colorGreen, ActiveHash: "1a2b3c"},
+			},
+		}
+
+		for _, service := range []*corev1.Service{
+			reconciler.serviceForMoodle(mt, "tenant-bluegreen"),
+			reconciler.internalServiceForMoodle(mt, "tenant-bluegreen"),
+		} {
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(colorLabel, colorGreen), service.Name)
+		}
+
+		mt.Status.BlueGreen.ActiveColor = colorBlue
+		for _, service := range []*corev1.Service{
+			reconciler.serviceForMoodle(mt, "tenant-bluegreen"),
+			reconciler.internalServiceForMoodle(mt, "tenant-bluegreen"),
+		} {
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(colorLabel, colorBlue), service.Name)
+		}
+	})
+})
@@ -0,0 +1,651 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// cacheTypeRedis selects Redis as the cache and session backend
+const cacheTypeRedis = "redis"
+
+// redisPort is the port of the deployed Redis server
+const redisPort = 6379
+
+// Session stores of Moodle
+const (
+	sessionStoreFile      = "file"
+	sessionStoreDatabase  = "database"
+	sessionStoreRedis     = "redis"
+	sessionStoreMemcached = "memcached"
+)
+
+// multipleReplicas reports whether more than one Moodle pod may serve requests
+func multipleReplicas(mt *moodlev1alpha1.MoodleTenant) bool {
+	if mt.Spec.HPA.Enabled && mt.Spec.HPA.MaxReplicas > 1 {
+		return true
+	}
+	if mt.Spec.Scaling != nil {
+		for _, schedule := range mt.Spec.Scaling.Schedules {
+			if schedule.MinReplicas > 1 || (mt.Spec.HPA.Enabled && ptr.Deref(schedule.MaxReplicas, 1) > 1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sessionStore returns where Moodle keeps sessions. File sessions live in moodledata,
+// so they are only shared between replicas on a ReadWriteMany volume, and even then
+// every request takes a file lock on network storage; auto therefore moves them to the
+// database as soon as there may be several replicas.
+func sessionStore(mt *moodlev1alpha1.MoodleTenant) string {
+	switch backend := mt.Spec.Sessions.Backend; {
+	case backend == sessionStoreFile || backend == sessionStoreDatabase:
+		return backend
+	case backend == sessionStoreRedis && redisEnabled(mt):
+		return sessionStoreRedis
+	case backend == sessionStoreMemcached && memcachedSessionServers(mt) != "":
+		return sessionStoreMemcached
+	}
+
+	switch {
+	case redisEnabled(mt):
+		return sessionStoreRedis
+	case mt.Spec.Cache.Sessions == sessionStoreFile || mt.Spec.Cache.Sessions == sessionStoreDatabase:
+		return mt.Spec.Cache.Sessions
+	case multipleReplicas(mt):
+		return sessionStoreDatabase
+	}
+	return sessionStoreFile
+}
+
+// cacheCluster returns the MoodleCacheCluster of cache.clusterRef as last resolved, or nil
+func cacheCluster(mt *moodlev1alpha1.MoodleTenant) *moodlev1alpha1.CacheClusterStatus {
+	ref, resolved := mt.Spec.Cache.ClusterRef, mt.Status.CacheCluster
+	if ref == nil || resolved == nil || resolved.Name != ref.Name || len(resolved.Servers) == 0 {
+		return nil
+	}
+	return resolved
+}
+
+// cacheType returns the cache type of the tenant. A cache cluster that has not been
+// resolved yet leaves Moodle with its default file cache.
+func cacheType(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.Cache.ClusterRef != nil {
+		if cc := cacheCluster(mt); cc != nil {
+			return cc.Type
+		}
+		return ""
+	}
+	return mt.Spec.Cache.Type
+}
+
+// redisEnabled reports whether the tenant caches in Redis instead of the Memcached sidecar
+func redisEnabled(mt *moodlev1alpha1.MoodleTenant) bool {
+	return cacheType(mt) == cacheTypeRedis
+}
+
+// redisDeployed reports whether the operator runs the Redis server of the tenant
+func redisDeployed(mt *moodlev1alpha1.MoodleTenant) bool {
+	if !redisEnabled(mt) || mt.Spec.Cache.ClusterRef != nil {
+		return false
+	}
+	redis := mt.Spec.Cache.Redis
+	return redis == nil || (redis.Host == "" && redis.Sentinel == nil && redis.Cluster == nil)
+}
+
+// redisName returns the name shared by the Redis resources
+func redisName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-redis"
+}
+
+// redisLabels returns the labels of the Redis pods
+func redisLabels(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	return map[string]string{
+		"app":                  "moodle-redis",
+		"moodle.bsu.by/tenant": mt.Name,
+	}
+}
+
+// redisAddress returns the host and port Moodle connects to
+func redisAddress(mt *moodlev1alpha1.MoodleTenant) (string, int32) {
+	if redisDeployed(mt) {
+		return redisName(mt), redisPort
+	}
+	if cc := cacheCluster(mt); cc != nil {
+		host, port, _ := net.SplitHostPort(cc.Servers[0])
+		number, _ := strconv.Atoi(port)
+		return host, int32(number)
+	}
+	port := mt.Spec.Cache.Redis.Port
+	if port == 0 {
+		port = redisPort
+	}
+	return mt.Spec.Cache.Redis.Host, port
+}
+
+// redisExternalPorts returns the ports Moodle connects to on an existing Redis server:
+// those of the Sentinels next to the masters, or those of the cluster nodes
+func redisExternalPorts(mt *moodlev1alpha1.MoodleTenant) []int32 {
+	redis := mt.Spec.Cache.Redis
+	_, port := redisAddress(mt)
+
+	var hosts []string
+	switch {
+	case redis.Sentinel != nil:
+		hosts = redis.Sentinel.Hosts
+	case redis.Cluster != nil:
+		hosts = redis.Cluster.Hosts
+		port = 0
+	}
+
+	ports := []int32{}
+	if port != 0 {
+		ports = append(ports, port)
+	}
+	for _, host := range hosts {
+		_, p, _ := net.SplitHostPort(host)
+		number, _ := strconv.Atoi(p)
+		if !slices.Contains(ports, int32(number)) {
+			ports = append(ports, int32(number))
+		}
+	}
+	return ports
+}
+
+// redisAuthenticated reports whether the Redis server of the tenant has a password, kept
+// in the <name>-redis Secret of the tenant namespace
+func redisAuthenticated(mt *moodlev1alpha1.MoodleTenant) bool {
+	if !redisEnabled(mt) {
+		return false
+	}
+	return redisDeployed(mt) || mt.Spec.Cache.ClusterRef != nil || mt.Spec.Cache.Redis.PasswordSecretRef != nil
+}
+
+// reconcileCache creates or removes the Redis server of the tenant and the Secret with
+// its password
+func (r *MoodleTenantReconciler) reconcileCache(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if err := r.resolveCacheCluster(ctx, mt); err != nil {
+		return err
+	}
+	setSessionsCondition(mt)
+
+	objectMeta := metav1.ObjectMeta{Name: redisName(mt), Namespace: namespace}
+	if !redisDeployed(mt) {
+		for _, obj := range []client.Object{
+			&corev1.Service{ObjectMeta: objectMeta},
+			&appsv1.Deployment{ObjectMeta: objectMeta},
+		} {
+			if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "Failed to delete Redis resource", "Namespace", namespace, "Name", obj.GetName())
+				return err
+			}
+		}
+	}
+
+	if redisDeployed(mt) {
+		if err := r.reconcileRedisPassword(ctx, mt, namespace); err != nil {
+			return err
+		}
+		if err := r.reconcileObject(ctx, mt, r.redisDeploymentForMoodle(mt, namespace), &appsv1.Deployment{}); err != nil {
+			return err
+		}
+		return r.reconcileObject(ctx, mt, r.redisServiceForMoodle(mt, namespace), &corev1.Service{})
+	}
+
+	if err := r.reconcileRedisTLSSecret(ctx, mt, namespace); err != nil {
+		return err
+	}
+
+	if redisAuthenticated(mt) {
+		var source types.NamespacedName
+		if cc := cacheCluster(mt); cc != nil {
+			source = types.NamespacedName{Name: cacheClusterName(cc.Name, cc.Type), Namespace: cc.Namespace}
+		} else {
+			source = types.NamespacedName{Name: mt.Spec.Cache.Redis.PasswordSecretRef.Name, Namespace: mt.Namespace}
+		}
+		return r.reconcileCopiedSecret(ctx, mt, source, namespace, redisName(mt))
+	}
+
+	if err := r.Delete(ctx, &corev1.Secret{ObjectMeta: objectMeta}); err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to delete Redis Secret", "Namespace", namespace, "Name", redisName(mt))
+		return err
+	}
+	return nil
+}
+
+// resolveCacheCluster records the MoodleCacheCluster of cache.clusterRef in the status.
+// Moodle keeps the last resolved cache cluster while it is missing or not ready.
+func (r *MoodleTenantReconciler) resolveCacheCluster(ctx context.Context, mt *moodlev1alpha1.MoodleTenant) error {
+	ref := mt.Spec.Cache.ClusterRef
+	if ref == nil {
+		mt.Status.CacheCluster = nil
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionCacheClusterResolved)
+		return nil
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionCacheClusterResolved,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: mt.Generation,
+	}
+	cc := &moodlev1alpha1.MoodleCacheCluster{}
+	err := r.Get(ctx, types.NamespacedName{Name: ref.Name}, cc)
+	switch {
+	case errors.IsNotFound(err):
+		condition.Reason = "NotFound"
+		condition.Message = fmt.Sprintf("MoodleCacheCluster %s not found", ref.Name)
+	case err != nil:
+		log.FromContext(ctx).Error(err, "Failed to get MoodleCacheCluster")
+		return err
+	case len(cc.Status.Servers) == 0:
+		condition.Reason = "NotReady"
+		condition.Message = fmt.Sprintf("MoodleCacheCluster %s has no servers yet", ref.Name)
+	default:
+		mt.Status.CacheCluster = &moodlev1alpha1.CacheClusterStatus{
+			Name:           cc.Name,
+			Namespace:      cacheClusterNamespace(cc),
+			Type:           cc.Spec.Type,
+			Servers:        cc.Status.Servers,
+			PasswordSecret: cc.Status.PasswordSecret,
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Resolved"
+		condition.Message = fmt.Sprintf("Caching in the %s of MoodleCacheCluster %s under the prefix %s_", cc.Spec.Type, cc.Name, mt.Name)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	return nil
+}
+
+// tenantsForCacheCluster maps a MoodleCacheCluster to the MoodleTenants referencing it
+func (r *MoodleTenantReconciler) tenantsForCacheCluster(ctx context.Context, obj client.Object) []reconcile.Request {
+	tenants := &moodlev1alpha1.MoodleTenantList{}
+	if err := r.List(ctx, tenants); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MoodleTenants")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, mt := range tenants.Items {
+		if ref := mt.Spec.Cache.ClusterRef; ref != nil && ref.Name == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: mt.Name, Namespace: mt.Namespace}})
+		}
+	}
+	return requests
+}
+
+// setSessionsCondition reports in the SessionsShared condition whether the replicas
+// share sessions, so that users are not silently logged out by the load balancer
+func setSessionsCondition(mt *moodlev1alpha1.MoodleTenant) {
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionSessionsShared,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: mt.Generation,
+	}
+	switch store := sessionStore(mt); {
+	case store == sessionStoreRedis:
+		condition.Reason = "Redis"
+		condition.Message = "Sessions are kept in Redis"
+	case store == sessionStoreMemcached:
+		condition.Reason = "Memcached"
+		condition.Message = "Sessions are kept in Memcached"
+	case store == sessionStoreDatabase:
+		condition.Reason = "Database"
+		condition.Message = "Sessions are kept in the database"
+	case !multipleReplicas(mt):
+		condition.Reason = "SingleReplica"
+		condition.Message = "Sessions are kept in moodledata of the single replica"
+	case dataAccessMode(mt) == corev1.ReadWriteMany:
+		condition.Reason = "SharedVolume"
+		condition.Message = "Sessions are kept in moodledata, shared through a ReadWriteMany volume"
+	default:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "PodLocalSessions"
+		condition.Message = "Sessions are kept in moodledata on a ReadWriteOnce volume while the HPA may add replicas; set sessions.backend to auto or database, or use Redis"
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+}
+
+// reconcileRedisPassword generates the password of the deployed Redis server once
+func (r *MoodleTenantReconciler) reconcileRedisPassword(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	found := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: redisName(mt), Namespace: namespace}, found)
+	if err == nil && len(found.Data["password"]) > 0 {
+		return nil
+	} else if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get Redis Secret")
+		return err
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redisName(mt),
+			Namespace: namespace,
+			Labels:    redisLabels(mt),
+		},
+		Data: map[string][]byte{
+			"password": []byte(password),
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	return r.reconcileSecretData(ctx, secret)
+}
+
+// redisDeploymentForMoodle returns the Redis Deployment of the tenant
+func (r *MoodleTenantReconciler) redisDeploymentForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *appsv1.Deployment {
+	image := "redis:7-alpine"
+	memoryMB := 256
+	if redis := mt.Spec.Cache.Redis; redis != nil {
+		if redis.Image != "" {
+			image = redis.Image
+		}
+		if redis.MemoryMB != 0 {
+			memoryMB = redis.MemoryMB
+		}
+	}
+
+	deployment := redisDeployment(redisName(mt), namespace, redisLabels(mt), image, memoryMB)
+	applyCacheExporter(mt, &deployment.Spec.Template)
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, deployment, r.Scheme); err != nil {
+		return nil
+	}
+
+	return deployment
+}
+
+// redisDeployment returns a Redis Deployment with the password of the Secret of the same
+// name. Nothing is persisted: a restart costs the cache and logs users out, like a
+// restart of the Memcached sidecar does.
+func redisDeployment(name, namespace string, labels map[string]string, image string, memoryMB int) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](1),
+			Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot: ptr.To(true),
+						RunAsUser:    ptr.To[int64](999), // redis
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "redis",
+							Image: image,
+							Args: []string{
+								"--requirepass", "$(REDIS_PASSWORD)",
+								"--maxmemory", fmt.Sprintf("%dmb", memoryMB),
+								"--maxmemory-policy", "allkeys-lru",
+								"--save", "",
+								"--appendonly", "no",
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "REDIS_PASSWORD",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{Name: name},
+											Key:                  "password",
+										},
+									},
+								},
+							},
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "redis",
+									ContainerPort: redisPort,
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									TCPSocket: &corev1.TCPSocketAction{
+										Port: intstr.FromInt(redisPort),
+									},
+								},
+								PeriodSeconds: 5,
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("50m"),
+									corev1.ResourceMemory: resource.MustParse(fmt.Sprintf("%dMi", memoryMB)),
+								},
+								Limits: corev1.ResourceList{
+									// Headroom for the allocator and client buffers above maxmemory
+									corev1.ResourceMemory: resource.MustParse(fmt.Sprintf("%dMi", memoryMB+64)),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// redisServiceForMoodle returns the Service in front of the deployed Redis server
+func (r *MoodleTenantReconciler) redisServiceForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.Service {
+	service := redisService(redisName(mt), namespace, redisLabels(mt))
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, service, r.Scheme); err != nil {
+		return nil
+	}
+
+	return service
+}
+
+// redisService returns the Service in front of a Redis server
+func redisService(name, namespace string, labels map[string]string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: labels,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "redis",
+					Port:       redisPort,
+					TargetPort: intstr.FromInt(redisPort),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+}
+
+// mucManual leaves the MUC configuration to the site administrator
+const mucManual = "manual"
+
+// sidecarMemcachedServer is the Memcached sidecar in every Moodle pod
+const sidecarMemcachedServer = "127.0.0.1:11211"
+
+// memcachedStoreServers returns the comma-separated Memcached instances of the MUC
+// application store, or "" for none. The sidecar is only used by a single replica: the
+// application cache must be consistent across replicas, and each replica would
+// otherwise keep stale entries in a cache of its own.
+func memcachedStoreServers(mt *moodlev1alpha1.MoodleTenant) string {
+	switch {
+	case redisEnabled(mt):
+		return ""
+	case memcachedShared(mt):
+		return memcachedServers(mt)
+	case mt.Spec.Cache.ClusterRef != nil:
+		if cc := cacheCluster(mt); cc != nil {
+			return strings.Join(cc.Servers, ",")
+		}
+		return ""
+	case !multipleReplicas(mt):
+		return sidecarMemcachedServer
+	}
+	return ""
+}
+
+// memcachedSessionServers returns the comma-separated Memcached instances that can hold
+// sessions, or "" for none. Sessions must be shared by all replicas, so the sidecar
+// never holds them.
+func memcachedSessionServers(mt *moodlev1alpha1.MoodleTenant) string {
+	if memcachedStoreServers(mt) == sidecarMemcachedServer {
+		return ""
+	}
+	return memcachedStoreServers(mt)
+}
+
+// mucStores returns the MUC stores of the application and session modes: redis,
+// memcached or the default file store in moodledata for the application cache, and
+// redis or the default store kept in the session itself for the session cache. Request
+// caches always stay in the memory of the request.
+func mucStores(mt *moodlev1alpha1.MoodleTenant) (string, string) {
+	switch {
+	case redisEnabled(mt):
+		return cacheTypeRedis, cacheTypeRedis
+	case memcachedStoreServers(mt) != "":
+		return "memcached", "default"
+	}
+	return "file", "default"
+}
+
+// cacheEnv returns the environment variables from which config.php and the MUC
+// configuration script of the image set up sessions and the MUC stores
+func cacheEnv(mt *moodlev1alpha1.MoodleTenant) []corev1.EnvVar {
+	lockTimeout, lockExpire := mt.Spec.Sessions.LockTimeoutSeconds, mt.Spec.Sessions.LockExpireSeconds
+	if lockTimeout == 0 {
+		lockTimeout = 120
+	}
+	if lockExpire == 0 {
+		lockExpire = 7200
+	}
+	env := []corev1.EnvVar{
+		{Name: "SESSION_HANDLER", Value: sessionStore(mt)},
+		{Name: "SESSION_LOCK_TIMEOUT", Value: strconv.Itoa(int(lockTimeout))},
+		{Name: "SESSION_LOCK_EXPIRE", Value: strconv.Itoa(int(lockExpire))},
+	}
+
+	if redisEnabled(mt) {
+		host, port := redisAddress(mt)
+		switch redis := mt.Spec.Cache.Redis; {
+		case redis != nil && redis.Sentinel != nil:
+			// config.php asks the Sentinels for the master on every request
+			env = append(env,
+				corev1.EnvVar{Name: "REDIS_SENTINELS", Value: strings.Join(redis.Sentinel.Hosts, ",")},
+				corev1.EnvVar{Name: "REDIS_SENTINEL_MASTER", Value: redis.Sentinel.MasterName},
+				corev1.EnvVar{Name: "REDIS_PORT", Value: strconv.Itoa(int(port))},
+			)
+		case redis != nil && redis.Cluster != nil:
+			env = append(env, corev1.EnvVar{Name: "REDIS_CLUSTER", Value: strings.Join(redis.Cluster.Hosts, ",")})
+		default:
+			env = append(env,
+				corev1.EnvVar{Name: "REDIS_HOST", Value: host},
+				corev1.EnvVar{Name: "REDIS_PORT", Value: strconv.Itoa(int(port))},
+			)
+		}
+		env = append(env, corev1.EnvVar{Name: "REDIS_PREFIX", Value: mt.Name + "_"})
+		if redisAuthenticated(mt) {
+			env = append(env, corev1.EnvVar{
+				Name: "REDIS_PASSWORD",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: redisName(mt)},
+						Key:                  "password",
+					},
+				},
+			})
+		}
+	}
+
+	if servers := memcachedStoreServers(mt); servers != "" {
+		env = append(env,
+			corev1.EnvVar{Name: "MEMCACHED_SERVERS", Value: servers},
+			corev1.EnvVar{Name: "MEMCACHED_PREFIX", Value: mt.Name + "_"},
+		)
+		// A pool shared with other tenants must never be flushed as a whole
+		if cacheCluster(mt) != nil {
+			env = append(env, corev1.EnvVar{Name: "MEMCACHED_SHARED", Value: "1"})
+		}
+		if memcachedAuthenticated(mt) {
+			for _, key := range []string{"username", "password"} {
+				env = append(env, corev1.EnvVar{
+					Name: "MEMCACHED_" + strings.ToUpper(key),
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: memcachedAuthName(mt)},
+							Key:                  key,
+						},
+					},
+				})
+			}
+		}
+	}
+
+	if mt.Spec.Cache.MUC != mucManual {
+		application, session := mucStores(mt)
+		env = append(env,
+			corev1.EnvVar{Name: "MUC_APPLICATION_STORE", Value: application},
+			corev1.EnvVar{Name: "MUC_SESSION_STORE", Value: session},
+		)
+	}
+	return env
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// memcachedExporterPort is the metrics port of memcached_exporter
+const memcachedExporterPort = 9150
+
+// redisExporterPort is the metrics port of redis_exporter
+const redisExporterPort = 9121
+
+// cacheExporterLabel marks the pods running the cache exporter next to a cache instance
+const cacheExporterLabel = "moodle.bsu.by/cache-exporter"
+
+// cacheExporterName returns the name shared by the cache exporter resources
+func cacheExporterName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-cache-exporter"
+}
+
+// cacheExporterLabels returns the labels of the cache exporter Service
+func cacheExporterLabels(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	return map[string]string{
+		"app":                  "moodle-cache-exporter",
+		"moodle.bsu.by/tenant": mt.Name,
+	}
+}
+
+// cacheExported reports whether the cache exporter runs, which needs a cache instance
+// deployed by the operator: the Redis server, or the Memcached sidecar or shared
+// instances
+func cacheExported(mt *moodlev1alpha1.MoodleTenant) bool {
+	if mt.Spec.Cache.Exporter == nil {
+		return false
+	}
+	return redisDeployed(mt) || (!redisEnabled(mt) && mt.Spec.Cache.ClusterRef == nil)
+}
+
+// cacheExporterPort returns the metrics port of the cache exporter
+func cacheExporterPort(mt *moodlev1alpha1.MoodleTenant) int {
+	if redisEnabled(mt) {
+		return redisExporterPort
+	}
+	return memcachedExporterPort
+}
+
+// cacheExporterPrometheusNamespace returns the namespace allowed to scrape the cache
+// exporter
+func cacheExporterPrometheusNamespace(mt *moodlev1alpha1.MoodleTenant) string {
+	if namespace := mt.Spec.Cache.Exporter.PrometheusNamespace; namespace != "" {
+		return namespace
+	}
+	return "monitoring"
+}
+
+// reconcileCacheExporter creates or removes the Service in front of the cache exporter
+// and the optional ServiceMonitor. The exporter itself runs in the pods of the cache.
+func (r *MoodleTenantReconciler) reconcileCacheExporter(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if !cacheExported(mt) || !mt.Spec.Cache.Exporter.ServiceMonitor {
+		if err := r.deleteUnstructured(ctx, serviceMonitorGVK, namespace, cacheExporterName(mt)); err != nil {
+			return err
+		}
+	}
+	if !cacheExported(mt) {
+		service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: cacheExporterName(mt), Namespace: namespace}}
+		if err := r.Delete(ctx, service); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete cache exporter Service", "Namespace", namespace, "Name", service.Name)
+			return err
+		}
+		return nil
+	}
+
+	if err := r.reconcileObject(ctx, mt, r.cacheExporterServiceForMoodle(mt, namespace), &corev1.Service{}); err != nil {
+		return err
+	}
+	if mt.Spec.Cache.Exporter.ServiceMonitor {
+		if _, err := r.reconcileUnstructured(ctx, r.serviceMonitorForMoodle(mt, namespace, cacheExporterName(mt), cacheExporterLabels(mt))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cacheExporterServiceForMoodle returns the Service in front of the cache exporter. It
+// selects every pod with a cache instance, so each one is scraped on its own.
+func (r *MoodleTenantReconciler) cacheExporterServiceForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.Service {
+	port := cacheExporterPort(mt)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cacheExporterName(mt),
+			Namespace: namespace,
+			Labels:    cacheExporterLabels(mt),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{
+				"moodle.bsu.by/tenant": mt.Name,
+				cacheExporterLabel:     "true",
+			},
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "metrics",
+					Port:       int32(port),
+					TargetPort: intstr.FromInt(port),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	// Annotation-based Prometheus discovery, for setups without the Prometheus Operator
+	if !mt.Spec.Cache.Exporter.ServiceMonitor {
+		service.Annotations = map[string]string{
+			"prometheus.io/scrape": "true",
+			"prometheus.io/port":   strconv.Itoa(port),
+		}
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, service, r.Scheme); err != nil {
+		return nil
+	}
+
+	return service
+}
+
+// applyCacheExporter adds the exporter container of the cache type to a pod template
+// with a cache instance, which it reaches on localhost
+func applyCacheExporter(mt *moodlev1alpha1.MoodleTenant, template *corev1.PodTemplateSpec) {
+	if !cacheExported(mt) {
+		return
+	}
+
+	container := corev1.Container{
+		Name:  "memcached-exporter",
+		Image: "quay.io/prometheus/memcached-exporter:v0.15.0",
+		Args:  []string{"--memcached.address=127.0.0.1:" + strconv.Itoa(memcachedPort)},
+		Ports: []corev1.ContainerPort{
+			{
+				Name:          "cache-metrics",
+				ContainerPort: int32(cacheExporterPort(mt)),
+				Protocol:      corev1.ProtocolTCP,
+			},
+		},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				HTTPGet: &corev1.HTTPGetAction{
+					Path: "/",
+					Port: intstr.FromInt(cacheExporterPort(mt)),
+				},
+			},
+			PeriodSeconds: 10,
+		},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("10m"),
+				corev1.ResourceMemory: resource.MustParse("16Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("64Mi"),
+			},
+		},
+	}
+	if redisEnabled(mt) {
+		container.Name = "redis-exporter"
+		container.Image = "oliver006/redis_exporter:v1.67.0"
+		container.Args = nil
+		container.Env = []corev1.EnvVar{
+			{Name: "REDIS_ADDR", Value: "redis://127.0.0.1:" + strconv.Itoa(redisPort)},
+			{
+				Name: "REDIS_PASSWORD",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: redisName(mt)},
+						Key:                  "password",
+					},
+				},
+			},
+		}
+	}
+	if image := mt.Spec.Cache.Exporter.Image; image != "" {
+		container.Image = image
+	}
+
+	template.Labels = mergeStringMaps(template.Labels, map[string]string{cacheExporterLabel: "true"})
+	template.Spec.Containers = append(template.Spec.Containers, container)
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+
+// certificateGVK is the cert-manager Certificate kind. Certificates are handled as
+// unstructured objects so that the operator does not depend on cert-manager's API module.
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// tlsModeIngressAnnotations lets cert-manager's ingress-shim issue the certificate
+const tlsModeIngressAnnotations = "IngressAnnotations"
+
+// tlsSecretName returns the name of the secret holding the tenant certificate
+func tlsSecretName(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.TLS.SecretName != "" {
+		return mt.Spec.TLS.SecretName
+	}
+	return mt.Name + "-tls"
+}
+
+// adminTLSSecretName returns the name of the secret holding the certificate of the admin
+// hostname. ingress-shim issues a certificate per annotated Ingress, so the admin Ingress
+// gets its own secret; otherwise the tenant certificate covers the admin hostname.
+func adminTLSSecretName(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.TLS.IssuerRef != nil && mt.Spec.TLS.Mode == tlsModeIngressAnnotations {
+		return mt.Name + "-admin-tls"
+	}
+	return tlsSecretName(mt)
+}
+
+// reconcileTLSSecret copies a shared TLS secret, such as a wildcard certificate, into the tenant namespace
+func (r *MoodleTenantReconciler) reconcileTLSSecret(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	if mt.Spec.TLS.CopyFromNamespace == "" {
+		return nil
+	}
+
+	source := types.NamespacedName{Name: mt.Spec.TLS.SecretName, Namespace: mt.Spec.TLS.CopyFromNamespace}
+	return r.reconcileCopiedSecret(ctx, mt, source, namespace, tlsSecretName(mt))
+}
+
+// reconcileCertificate creates or updates the cert-manager Certificate and reports its
+// readiness in the CertificateReady condition
+func (r *MoodleTenantReconciler) reconcileCertificate(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	// Only manage certificates if an issuer is configured
+	if mt.Spec.TLS.IssuerRef == nil {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionCertificateReady)
+		return nil
+	}
+
+	// With ingress-shim, cert-manager creates the Certificate itself and names it after the secret
+	if mt.Spec.TLS.Mode != tlsModeIngressAnnotations {
+		if _, err := r.reconcileUnstructured(ctx, r.certificateForMoodle(mt, namespace)); err != nil {
+			return err
+		}
+	}
+
+	return r.updateCertificateCondition(ctx, mt, namespace)
+}
+
+// updateCertificateCondition mirrors the Ready condition of the tenant Certificate
+func (r *MoodleTenantReconciler) updateCertificateCondition(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionCertificateReady,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "Pending",
+		Message:            "Waiting for cert-manager to issue the certificate",
+		ObservedGeneration: mt.Generation,
+	}
+
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(certificateGVK)
+	err := r.Get(ctx, types.NamespacedName{Name: tlsSecretName(mt), Namespace: namespace}, certificate)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(certificate.Object, "status", "conditions")
+	for _, c := range conditions {
+		certCondition, ok := c.(map[string]interface{})
+		if !ok || certCondition["type"] != "Ready" {
+			continue
+		}
+		if status, ok := certCondition["status"].(string); ok {
+			condition.Status = metav1.ConditionStatus(status)
+		}
+		if reason, ok := certCondition["reason"].(string); ok && reason != "" {
+			condition.Reason = reason
+		}
+		if message, ok := certCondition["message"].(string); ok {
+			condition.Message = message
+		}
+	}
+
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	return nil
+}
+
+// certificateForMoodle returns a cert-manager Certificate for the MoodleTenant hostnames,
+// including the admin hostname
+func (r *MoodleTenantReconciler) certificateForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	issuerRef := mt.Spec.TLS.IssuerRef
+
+	dnsNames := []interface{}{}
+	for _, hostname := range publishedHostnames(mt) {
+		dnsNames = append(dnsNames, hostname)
+	}
+
+	certificate := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"secretName": tlsSecretName(mt),
+				"dnsNames":   dnsNames,
+				"issuerRef": map[string]interface{}{
+					"name":  issuerRef.Name,
+					"kind":  issuerRef.Kind,
+					"group": issuerRef.Group,
+				},
+			},
+		},
+	}
+	certificate.SetGroupVersionKind(certificateGVK)
+	certificate.SetName(tlsSecretName(mt))
+	certificate.SetNamespace(namespace)
+	certificate.SetLabels(map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, certificate, r.Scheme); err != nil {
+		return nil
+	}
+
+	return certificate
+}
+
+// certificateAnnotations returns the ingress-shim annotations requesting the certificate
+func certificateAnnotations(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	issuerRef := mt.Spec.TLS.IssuerRef
+	if issuerRef == nil || mt.Spec.TLS.Mode != tlsModeIngressAnnotations {
+		return nil
+	}
+
+	if issuerRef.Kind == "Issuer" {
+		return map[string]string{"cert-manager.io/issuer": issuerRef.Name}
+	}
+	return map[string]string{"cert-manager.io/cluster-issuer": issuerRef.Name}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=cilium.io,resources=ciliumnetworkpolicies,verbs=get;list;watch;create;update;patch;delete
+
+// ciliumNetworkPolicyGVK is the Cilium network policy kind, handled as an unstructured object
+var ciliumNetworkPolicyGVK = schema.GroupVersionKind{Group: "cilium.io", Version: "v2", Kind: "CiliumNetworkPolicy"}
+
+// ciliumNetworkPolicyName is the name of the FQDN egress policy in the tenant namespace
+const ciliumNetworkPolicyName = "tenant-fqdn-egress"
+
+// reconcileCiliumNetworkPolicy creates or updates the CiliumNetworkPolicy allowing egress
+// to the configured FQDNs and removes it when FQDN egress is not used
+func (r *MoodleTenantReconciler) reconcileCiliumNetworkPolicy(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	enabled := mt.Spec.NetworkPolicy.Enabled == nil || *mt.Spec.NetworkPolicy.Enabled
+	if !enabled || len(mt.Spec.NetworkPolicy.FQDNEgress) == 0 {
+		return r.deleteUnstructured(ctx, ciliumNetworkPolicyGVK, namespace, ciliumNetworkPolicyName)
+	}
+
+	_, err := r.reconcileUnstructured(ctx, r.ciliumNetworkPolicyForMoodle(mt, namespace))
+	return err
+}
+
+// ciliumNetworkPolicyForMoodle returns a CiliumNetworkPolicy allowing HTTP/HTTPS egress to
+// the tenant FQDNs. Cilium learns the addresses behind the names from DNS responses, so
+// DNS traffic to kube-dns goes through its DNS proxy.
+func (r *MoodleTenantReconciler) ciliumNetworkPolicyForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	fqdns := []interface{}{}
+	for _, fqdn := range mt.Spec.NetworkPolicy.FQDNEgress {
+		if strings.Contains(fqdn, "*") {
+			fqdns = append(fqdns, map[string]interface{}{"matchPattern": fqdn})
+		} else {
+			fqdns = append(fqdns, map[string]interface{}{"matchName": fqdn})
+		}
+	}
+
+	policy := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"endpointSelector": map[string]interface{}{},
+				"egress": []interface{}{
+					map[string]interface{}{
+						"toEndpoints": []interface{}{
+							map[string]interface{}{
+								"matchLabels": map[string]interface{}{
+									"k8s:io.kubernetes.pod.namespace": "kube-system",
+									"k8s-app":                         "kube-dns",
+								},
+							},
+						},
+						"toPorts": []interface{}{
+							map[string]interface{}{
+								"ports": []interface{}{
+									map[string]interface{}{"port": "53", "protocol": "ANY"},
+								},
+								"rules": map[string]interface{}{
+									"dns": []interface{}{
+										map[string]interface{}{"matchPattern": "*"},
+									},
+								},
+							},
+						},
+					},
+					map[string]interface{}{
+						"toFQDNs": fqdns,
+						"toPorts": []interface{}{
+							map[string]interface{}{
+								"ports": []interface{}{
+									map[string]interface{}{"port": "80", "protocol": "TCP"},
+									map[string]interface{}{"port": "443", "protocol": "TCP"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	policy.SetGroupVersionKind(ciliumNetworkPolicyGVK)
+	policy.SetName(ciliumNetworkPolicyName)
+	policy.SetNamespace(namespace)
+	policy.SetLabels(map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, policy, r.Scheme); err != nil {
+		return nil
+	}
+
+	return policy
+}
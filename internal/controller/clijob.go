@@ -0,0 +1,80 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// cliJobForMoodle returns the Job name running command in the Moodle container of the
+// Deployment, with its database settings, site configuration and moodledata. kind is
+// the moodle.bsu.by/job label and names the container. Callers add their own env,
+// annotations and backoff limit.
+func (r *MoodleTenantReconciler) cliJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace, name, kind string, command []string) (*batchv1.Job, error) {
+	deployment := r.deploymentForMoodle(mt, namespace)
+	if deployment == nil {
+		return nil, fmt.Errorf("failed to build the Moodle Deployment")
+	}
+	podSpec := deployment.Spec.Template.Spec
+	container := podSpec.Containers[0]
+	container.Name = "moodle-" + kind
+	container.Command = command
+	container.Env = append([]corev1.EnvVar{}, container.Env...)
+	container.Ports = nil
+	container.LivenessProbe = nil
+	container.ReadinessProbe = nil
+	podSpec.Containers = []corev1.Container{container}
+	podSpec.RestartPolicy = corev1.RestartPolicyNever
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"moodle.bsu.by/tenant": mt.Name,
+				"moodle.bsu.by/job":    kind,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](1),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"moodle.bsu.by/tenant": mt.Name,
+					},
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+	setSidecarInjection(mt, &job.Spec.Template, false)
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, job, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
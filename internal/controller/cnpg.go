@@ -0,0 +1,265 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=postgresql.cnpg.io,resources=clusters;scheduledbackups,verbs=get;list;watch;create;update;patch;delete
+
+var (
+	// cnpgClusterGVK is the CloudNativePG Cluster kind, handled as unstructured like the
+	// other third-party APIs
+	cnpgClusterGVK = schema.GroupVersionKind{Group: "postgresql.cnpg.io", Version: "v1", Kind: "Cluster"}
+
+	// cnpgScheduledBackupGVK is the CloudNativePG ScheduledBackup kind
+	cnpgScheduledBackupGVK = schema.GroupVersionKind{Group: "postgresql.cnpg.io", Version: "v1", Kind: "ScheduledBackup"}
+)
+
+// databaseModeCNPG runs the tenant database as a CloudNativePG Cluster
+const databaseModeCNPG = "cnpg"
+
+// cnpgStatusPort is the instance manager port polled by the CloudNativePG operator
+const cnpgStatusPort = 8000
+
+// cnpgClusterName returns the name of the tenant CloudNativePG Cluster
+func cnpgClusterName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-postgres"
+}
+
+// reconcileCNPGCluster creates or updates the CloudNativePG Cluster, mirrors its readiness
+// in the DatabaseReady condition and wires the generated application secret into the
+// database Secret read by Moodle
+func (r *MoodleTenantReconciler) reconcileCNPGCluster(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	backup := mt.Spec.DatabaseRef.CNPG.Backup
+	if backup != nil {
+		source := types.NamespacedName{Name: backup.CredentialsSecretRef.Name, Namespace: mt.Namespace}
+		if err := r.reconcileCopiedSecret(ctx, mt, source, namespace, cnpgClusterName(mt)+"-backup"); err != nil {
+			return err
+		}
+	}
+
+	cluster, err := r.reconcileUnstructured(ctx, r.cnpgClusterForMoodle(mt, namespace))
+	if err != nil {
+		return err
+	}
+
+	if backup != nil && backup.Schedule != "" {
+		if _, err := r.reconcileUnstructured(ctx, r.cnpgScheduledBackupForMoodle(mt, namespace)); err != nil {
+			return err
+		}
+	} else if err := r.deleteUnstructured(ctx, cnpgScheduledBackupGVK, namespace, cnpgClusterName(mt)); err != nil {
+		return err
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDatabaseReady,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "Pending",
+		Message:            "Waiting for CloudNativePG to bring up the cluster",
+		ObservedGeneration: mt.Generation,
+	}
+	conditions, _, _ := unstructured.NestedSlice(cluster.Object, "status", "conditions")
+	for _, c := range conditions {
+		clusterCondition, ok := c.(map[string]interface{})
+		if !ok || clusterCondition["type"] != "Ready" {
+			continue
+		}
+		if status, ok := clusterCondition["status"].(string); ok {
+			condition.Status = metav1.ConditionStatus(status)
+		}
+		if reason, ok := clusterCondition["reason"].(string); ok && reason != "" {
+			condition.Reason = reason
+		}
+		if message, ok := clusterCondition["message"].(string); ok {
+			condition.Message = message
+		}
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	return r.reconcileCNPGSecret(ctx, mt, namespace)
+}
+
+// reconcileCNPGSecret copies the credentials generated by CloudNativePG into the database
+// Secret, using the same keys as for an external database
+func (r *MoodleTenantReconciler) reconcileCNPGSecret(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	generated := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: cnpgClusterName(mt) + "-app", Namespace: namespace}, generated)
+	if err != nil && errors.IsNotFound(err) {
+		// The secret appears once the cluster is bootstrapped; the requeue picks it up
+		logger.Info("Waiting for the CloudNativePG application Secret", "Secret.Namespace", namespace, "Cluster.Name", cnpgClusterName(mt))
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get CloudNativePG application Secret")
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mt.Spec.DatabaseRef.AdminSecret,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			"host":     generated.Data["host"],
+			"database": generated.Data["dbname"],
+			"username": generated.Data["username"],
+			"password": generated.Data["password"],
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	return r.reconcileSecretData(ctx, secret)
+}
+
+// cnpgClusterForMoodle returns the CloudNativePG Cluster of the MoodleTenant
+func (r *MoodleTenantReconciler) cnpgClusterForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	spec := mt.Spec.DatabaseRef.CNPG
+
+	instances := spec.Instances
+	if instances == 0 {
+		instances = 1
+	}
+	size := "10Gi"
+	if !spec.Storage.Size.IsZero() {
+		size = spec.Storage.Size.String()
+	}
+
+	storage := map[string]interface{}{
+		"size": size,
+	}
+	if spec.Storage.StorageClass != "" {
+		storage["storageClass"] = spec.Storage.StorageClass
+	}
+
+	initdb := map[string]interface{}{
+		"database": mt.Spec.DatabaseRef.Name,
+		"owner":    mt.Spec.DatabaseRef.User,
+	}
+	if collation := mt.Spec.DatabaseRef.Collation; collation != "" {
+		initdb["localeCollate"] = collation
+		initdb["localeCType"] = collation
+	}
+
+	clusterSpec := map[string]interface{}{
+		"instances": int64(instances),
+		"storage":   storage,
+		"bootstrap": map[string]interface{}{
+			"initdb": initdb,
+		},
+	}
+	if spec.ImageName != "" {
+		clusterSpec["imageName"] = spec.ImageName
+	}
+
+	if backup := spec.Backup; backup != nil {
+		credentialsSecret := cnpgClusterName(mt) + "-backup"
+		objectStore := map[string]interface{}{
+			"destinationPath": backup.DestinationPath,
+			"s3Credentials": map[string]interface{}{
+				"accessKeyId": map[string]interface{}{
+					"name": credentialsSecret,
+					"key":  "ACCESS_KEY_ID",
+				},
+				"secretAccessKey": map[string]interface{}{
+					"name": credentialsSecret,
+					"key":  "ACCESS_SECRET_KEY",
+				},
+			},
+		}
+		if backup.EndpointURL != "" {
+			objectStore["endpointURL"] = backup.EndpointURL
+		}
+
+		retentionPolicy := "30d"
+		if backup.RetentionPolicy != "" {
+			retentionPolicy = backup.RetentionPolicy
+		}
+
+		clusterSpec["backup"] = map[string]interface{}{
+			"barmanObjectStore": objectStore,
+			"retentionPolicy":   retentionPolicy,
+		}
+	}
+
+	cluster := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": clusterSpec,
+		},
+	}
+	cluster.SetGroupVersionKind(cnpgClusterGVK)
+	cluster.SetName(cnpgClusterName(mt))
+	cluster.SetNamespace(namespace)
+	cluster.SetLabels(map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, cluster, r.Scheme); err != nil {
+		return nil
+	}
+
+	return cluster
+}
+
+// cnpgScheduledBackupForMoodle returns the ScheduledBackup of the tenant Cluster
+func (r *MoodleTenantReconciler) cnpgScheduledBackupForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	scheduledBackup := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"schedule":             mt.Spec.DatabaseRef.CNPG.Backup.Schedule,
+				"backupOwnerReference": "self",
+				"cluster": map[string]interface{}{
+					"name": cnpgClusterName(mt),
+				},
+			},
+		},
+	}
+	scheduledBackup.SetGroupVersionKind(cnpgScheduledBackupGVK)
+	scheduledBackup.SetName(cnpgClusterName(mt))
+	scheduledBackup.SetNamespace(namespace)
+	scheduledBackup.SetLabels(map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, scheduledBackup, r.Scheme); err != nil {
+		return nil
+	}
+
+	return scheduledBackup
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// cronModeDeployment runs cron.php from an always-on Deployment instead of a CronJob
+const cronModeDeployment = "deployment"
+
+// cronRunnerName returns the name of the cron runner Deployment
+func cronRunnerName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-cron"
+}
+
+// cronRunnerLabels returns the labels of the cron runner pods
+func cronRunnerLabels(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	return map[string]string{
+		"app":                  "moodle-cron",
+		"moodle.bsu.by/tenant": mt.Name,
+	}
+}
+
+// reconcileCronRunner creates or removes the cron runner Deployment of the deployment
+// mode, and removes the CronJob it replaces
+func (r *MoodleTenantReconciler) reconcileCronRunner(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Spec.Cron.Mode != cronModeDeployment {
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: cronRunnerName(mt), Namespace: namespace}}
+		if err := r.Delete(ctx, deployment); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete cron runner Deployment", "Namespace", namespace, "Name", deployment.Name)
+			return err
+		}
+		return nil
+	}
+
+	cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: mt.Name + "-cron", Namespace: namespace}}
+	if err := r.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to delete CronJob", "Namespace", namespace, "Name", cronJob.Name)
+		return err
+	}
+
+	deployment := r.cronRunnerForMoodle(mt, namespace)
+	if deployment == nil {
+		return fmt.Errorf("failed to build the cron runner Deployment")
+	}
+	return r.reconcileObject(ctx, mt, deployment, &appsv1.Deployment{})
+}
+
+// cronKeepAlive returns how long a cron.php run keeps processing tasks
+func cronKeepAlive(mt *moodlev1alpha1.MoodleTenant) int32 {
+	if keepAlive := mt.Spec.Cron.KeepAliveSeconds; keepAlive > 0 {
+		return keepAlive
+	}
+	return 300
+}
+
+// cronRunnerForMoodle returns the cron runner Deployment. Its pods are those of the
+// CronJob, with cron.php started again in a loop whenever its keep-alive has run out.
+func (r *MoodleTenantReconciler) cronRunnerForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *appsv1.Deployment {
+	cronJob := moodleCronJob(mt, namespace)
+
+	replicas := mt.Spec.Cron.Replicas
+	if replicas == 0 {
+		replicas = 1
+	}
+	if cronSuspendedReason(mt) != "" {
+		replicas = 0
+	}
+
+	script := fmt.Sprintf("/usr/local/bin/php /var/www/html/admin/cli/cron.php --keep-alive=%d", cronKeepAlive(mt))
+	if cronConfiguresMUC(mt) {
+		script = "/usr/local/bin/php /usr/local/share/moodle/configure-muc.php && " + script
+	}
+
+	labels := cronRunnerLabels(mt)
+	template := cronJob.Spec.JobTemplate.Spec.Template
+	template.Labels = mergeStringMaps(template.Labels, labels)
+	template.Spec.RestartPolicy = corev1.RestartPolicyAlways
+	// A failed run is retried after a pause rather than in a tight loop. The runner
+	// counts as fresh for cron.staleAfterMinutes after it starts and after every
+	// successful run, and is unready otherwise.
+	container := &template.Spec.Containers[0]
+	container.Command = []string{
+		"/bin/sh", "-c",
+		fmt.Sprintf("touch %[1]s; while true; do if %[2]s; then touch %[1]s; else sleep 30; fi; done", cronLastRunFile, script),
+	}
+	container.ReadinessProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{
+					"/bin/sh", "-c",
+					fmt.Sprintf("test -n \"$(find %s -mmin -%d)\"", cronLastRunFile, int(cronStaleAfter(mt).Minutes())),
+				},
+			},
+		},
+		PeriodSeconds: 60,
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cronRunnerName(mt),
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To(replicas),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: template,
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, deployment, r.Scheme); err != nil {
+		return nil
+	}
+
+	return deployment
+}
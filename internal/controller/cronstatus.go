@@ -0,0 +1,269 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// cronLastRunFile is touched by the cron runners after every successful run of cron.php
+const cronLastRunFile = "/tmp/cron-last-run"
+
+// cronStaleAfter returns how long after its last successful run cron counts as stale
+func cronStaleAfter(mt *moodlev1alpha1.MoodleTenant) time.Duration {
+	minutes := mt.Spec.Cron.StaleAfterMinutes
+	if minutes == 0 {
+		minutes = 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// cronSuspendedReason returns why cron is suspended, or "" while it runs. A cron run in
+// the middle of an upgrade or a restore works on a half-migrated database.
+func cronSuspendedReason(mt *moodlev1alpha1.MoodleTenant) string {
+	switch {
+	case mt.Spec.Cron.Suspend:
+		return "cron.suspend is set"
+	case mt.Spec.Suspended:
+		return "the tenant is suspended"
+	case hibernated(mt):
+		return "the tenant is hibernated"
+	// cron.php refuses to run in maintenance mode
+	case mt.Spec.MaintenanceMode != nil:
+		return "the site is in maintenance mode"
+	case rollbackStarted(mt) && mt.Status.Rollback.CompletionTime == nil:
+		return fmt.Sprintf("the upgrade to %s is rolled back", mt.Spec.Image)
+	case rolledBack(mt):
+		// The previous image runs on its own database again
+	// Cron keeps running while the upgrade waits for the maintenance window or is refused
+	case mt.Status.UpgradedImage != "" && mt.Status.UpgradedImage != mt.Spec.Image && !upgradeWaitingForWindow(mt) && !upgradeRefused(mt):
+		return fmt.Sprintf("the upgrade to %s is pending", mt.Spec.Image)
+	case mt.Spec.DatabaseRef.RestoreFrom != nil && !meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseRestored):
+		return "the database restore is pending"
+	case mt.Spec.Install != nil && !meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionInstalled):
+		return "the installation is pending"
+	}
+	return ""
+}
+
+// cronRunning reports whether cron may still start or is running tasks: a CronJob of the
+// tenant that is not suspended yet or has active Jobs, or a cron runner pod
+func (r *MoodleTenantReconciler) cronRunning(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	cronJobs := &batchv1.CronJobList{}
+	if err := r.List(ctx, cronJobs, client.InNamespace(namespace), client.MatchingLabels{"moodle.bsu.by/tenant": mt.Name}); err != nil {
+		logger.Error(err, "Failed to list CronJobs")
+		return false, err
+	}
+	for _, cronJob := range cronJobs.Items {
+		if !ptr.Deref(cronJob.Spec.Suspend, false) || len(cronJob.Status.Active) > 0 {
+			return true, nil
+		}
+	}
+
+	runner := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: cronRunnerName(mt), Namespace: namespace}, runner); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		logger.Error(err, "Failed to get cron runner Deployment")
+		return false, err
+	}
+	return ptr.Deref(runner.Spec.Replicas, 1) > 0 || runner.Status.Replicas > 0, nil
+}
+
+// reconcileCronFreshness records the last successful cron run of the CronJob and reports
+// in the CronStale condition whether cron has stopped succeeding. It needs no polling: the
+// CronJob status changes with every scheduled run, and the Deployment status whenever a
+// cron runner turns unready.
+func (r *MoodleTenantReconciler) reconcileCronFreshness(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	staleAfter := cronStaleAfter(mt)
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionCronStale,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Fresh",
+		ObservedGeneration: mt.Generation,
+	}
+
+	if reason := cronSuspendedReason(mt); reason != "" {
+		condition.Reason = "Suspended"
+		condition.Message = fmt.Sprintf("Cron is suspended while %s", reason)
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	if mt.Spec.Cron.Mode == cronModeDeployment {
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, types.NamespacedName{Name: cronRunnerName(mt), Namespace: namespace}, deployment); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			logger.Error(err, "Failed to get cron runner Deployment")
+			return err
+		}
+		condition.Message = fmt.Sprintf("%d cron runners completed cron.php in the last %s", deployment.Status.ReadyReplicas, staleAfter)
+		if deployment.Status.ReadyReplicas == 0 {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "RunnerNotReady"
+			condition.Message = fmt.Sprintf("No cron runner completed cron.php in the last %s; see the logs of the %s pods", staleAfter, cronRunnerName(mt))
+		}
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	cronJob := &batchv1.CronJob{}
+	if err := r.Get(ctx, types.NamespacedName{Name: mt.Name + "-cron", Namespace: namespace}, cronJob); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		logger.Error(err, "Failed to get CronJob")
+		return err
+	}
+	if lastRun := cronJob.Status.LastSuccessfulTime; lastRun != nil {
+		mt.Status.LastCronRun = lastRun.DeepCopy()
+	}
+
+	switch lastRun := mt.Status.LastCronRun; {
+	case lastRun == nil && time.Since(cronJob.CreationTimestamp.Time) > staleAfter:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "NeverSucceeded"
+		condition.Message = fmt.Sprintf("cron.php has not succeeded since the CronJob was created %s ago; see the logs of its Jobs", time.Since(cronJob.CreationTimestamp.Time).Round(time.Minute))
+	case lastRun == nil:
+		condition.Message = "Waiting for the first run of cron.php"
+	case time.Since(lastRun.Time) > staleAfter:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Stale"
+		condition.Message = fmt.Sprintf("cron.php last succeeded %s ago; see the logs of the failed Jobs", time.Since(lastRun.Time).Round(time.Minute))
+	default:
+		condition.Message = fmt.Sprintf("cron.php last succeeded at %s", lastRun.UTC().Format(time.RFC3339))
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	return nil
+}
+
+// cronFailureThreshold returns the number of cron Jobs failing in a row that counts as
+// repeated failure
+func cronFailureThreshold(mt *moodlev1alpha1.MoodleTenant) int32 {
+	if threshold := mt.Spec.Cron.FailureThreshold; threshold > 0 {
+		return threshold
+	}
+	return 3
+}
+
+// reconcileCronFailures counts the cron Jobs that failed in a row and reports repeated
+// failures in the CronFailing condition, with a Warning event and a notification when
+// they start. Only a few failed Jobs are kept, so every finished Job is counted once, in
+// the order they were created. The runners of the deployment mode report failures
+// through CronStale instead.
+func (r *MoodleTenantReconciler) reconcileCronFailures(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Spec.Cron.Mode == cronModeDeployment {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionCronFailing)
+		mt.Status.CronFailures = nil
+		return nil
+	}
+
+	jobs := &batchv1.JobList{}
+	if err := r.List(ctx, jobs, client.InNamespace(namespace)); err != nil {
+		logger.Error(err, "Failed to list cron Jobs")
+		return err
+	}
+	finished := []batchv1.Job{}
+	for _, job := range jobs.Items {
+		owner := metav1.GetControllerOf(&job)
+		if owner == nil || owner.Kind != "CronJob" || owner.Name != mt.Name+"-cron" {
+			continue
+		}
+		if job.Status.Succeeded > 0 || jobFailed(&job) {
+			finished = append(finished, job)
+		}
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].CreationTimestamp.Before(&finished[j].CreationTimestamp)
+	})
+
+	failures := mt.Status.CronFailures
+	if failures == nil {
+		failures = &moodlev1alpha1.CronFailuresStatus{}
+		mt.Status.CronFailures = failures
+	}
+	for _, job := range finished {
+		if failures.LastJobTime != nil && !failures.LastJobTime.Before(&job.CreationTimestamp) {
+			continue
+		}
+		if jobFailed(&job) {
+			failures.Consecutive++
+		} else {
+			failures.Consecutive = 0
+			failures.NotifiedTime = nil
+		}
+		failures.LastJob = job.Name
+		failures.LastJobTime = job.CreationTimestamp.DeepCopy()
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionCronFailing,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Succeeding",
+		Message:            fmt.Sprintf("%d cron Jobs failed in a row", failures.Consecutive),
+		ObservedGeneration: mt.Generation,
+	}
+	if failures.Consecutive < cronFailureThreshold(mt) {
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = "RepeatedFailures"
+	condition.Message = fmt.Sprintf("%d cron Jobs failed in a row, the last %s; see its logs", failures.Consecutive, failures.LastJob)
+	if !meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionCronFailing) {
+		r.warn(mt, "CronFailing", condition.Message)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	// An unreachable webhook is retried on the next reconcile
+	if mt.Spec.Notifications != nil && failures.NotifiedTime == nil {
+		if err := r.notify(ctx, mt, condition.Reason, condition.Message); err != nil {
+			logger.Error(err, "Failed to notify about cron failures")
+			r.warn(mt, "NotificationFailed", err.Error())
+			return nil
+		}
+		failures.NotifiedTime = ptr.To(metav1.Now())
+	}
+
+	return nil
+}
@@ -0,0 +1,398 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch;create;update;patch;delete
+
+// databasePort returns the port of the tenant database, the default port of its type
+// unless set explicitly
+func databasePort(mt *moodlev1alpha1.MoodleTenant) int32 {
+	if mt.Spec.DatabaseRef.Port != nil {
+		return *mt.Spec.DatabaseRef.Port
+	}
+	if databaseType(mt) != "pgsql" {
+		return 3306
+	}
+	return 5432
+}
+
+// databaseType returns the Moodle database driver of the tenant
+func databaseType(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.DatabaseRef.Type != "" {
+		return mt.Spec.DatabaseRef.Type
+	}
+	return "pgsql"
+}
+
+// tablePrefix returns the prefix of the Moodle tables of the tenant
+func tablePrefix(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.DatabaseRef.TablePrefix != "" {
+		return mt.Spec.DatabaseRef.TablePrefix
+	}
+	return "mdl_"
+}
+
+// databaseDriverEnv returns the environment variables carrying the database driver and
+// the port Moodle connects to
+func databaseDriverEnv(mt *moodlev1alpha1.MoodleTenant, typeName, portName string) []corev1.EnvVar {
+	port := databasePort(mt)
+	if mt.Spec.DatabaseRef.Pooler != nil {
+		port = proxySQLPort
+	}
+
+	return []corev1.EnvVar{
+		{Name: typeName, Value: databaseType(mt)},
+		{Name: portName, Value: strconv.Itoa(int(port))},
+	}
+}
+
+// moodleDatabasePasswordFileEnv names the file with the IAM token config.php reads
+// instead of DB_PASS
+const moodleDatabasePasswordFileEnv = "DB_PASS_FILE"
+
+// moodleDatabaseEnv returns the database configuration config.php reads. The web pods and
+// all CLI pods take it from here, so that their variable names cannot drift apart.
+func moodleDatabaseEnv(mt *moodlev1alpha1.MoodleTenant) []corev1.EnvVar {
+	databaseSecretEnv := func(name, key string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: mt.Spec.DatabaseRef.AdminSecret},
+					Key:                  key,
+				},
+			},
+		}
+	}
+
+	env := []corev1.EnvVar{
+		databaseHostEnv(mt, "DB_HOST"),
+		databaseSecretEnv("DB_NAME", "database"),
+		databaseSecretEnv("DB_USER", "username"),
+		databaseSecretEnv("DB_PASS", "password"),
+	}
+	env = append(env, databaseDriverEnv(mt, "DB_TYPE", "DB_PORT")...)
+	return append(env, databaseReplicaEnv(mt, "DB_READONLY_HOSTS")...)
+}
+
+// databaseClientEnv returns the environment of psql or mariadb client containers that
+// connect with the credentials of the database Secret, straight to the database rather
+// than through the pooler. In a shared database DB_SCHEMA names the tenant schema.
+func databaseClientEnv(mt *moodlev1alpha1.MoodleTenant) []corev1.EnvVar {
+	databaseSecretEnv := func(name, key string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: mt.Spec.DatabaseRef.AdminSecret},
+					Key:                  key,
+				},
+			},
+		}
+	}
+
+	host := databaseSecretEnv("DB_HOST", "host")
+	if mt.Spec.DatabaseRef.PublishService {
+		host = corev1.EnvVar{Name: "DB_HOST", Value: databaseServiceName(mt)}
+	}
+	env := []corev1.EnvVar{
+		host,
+		{Name: "DB_PORT", Value: strconv.Itoa(int(databasePort(mt)))},
+		databaseSecretEnv("DB_NAME", "database"),
+		databaseSecretEnv("DB_USER", "username"),
+		databaseSecretEnv("DB_PASS", "password"),
+	}
+	if databaseType(mt) == "pgsql" {
+		env = append(env,
+			corev1.EnvVar{Name: "PGHOST", Value: "$(DB_HOST)"},
+			corev1.EnvVar{Name: "PGPORT", Value: "$(DB_PORT)"},
+			corev1.EnvVar{Name: "PGDATABASE", Value: "$(DB_NAME)"},
+			corev1.EnvVar{Name: "PGUSER", Value: "$(DB_USER)"},
+			corev1.EnvVar{Name: "PGPASSWORD", Value: "$(DB_PASS)"},
+		)
+	} else {
+		env = append(env, corev1.EnvVar{Name: "MYSQL_PWD", Value: "$(DB_PASS)"})
+	}
+
+	if provisioning := mt.Spec.DatabaseRef.Provisioning; provisioning != nil && provisioning.Schema != "" {
+		env = append(env, corev1.EnvVar{Name: "DB_SCHEMA", Value: provisioning.Schema})
+	}
+	return env
+}
+
+// databaseReady reports whether the database is known to answer or is not checked at all
+func databaseReady(mt *moodlev1alpha1.MoodleTenant) bool {
+	condition := meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseReady)
+	return condition == nil || condition.Status == metav1.ConditionTrue
+}
+
+// databaseReplicaEnv returns the environment variable carrying the comma-separated
+// read replica hosts, or nil when there are none
+func databaseReplicaEnv(mt *moodlev1alpha1.MoodleTenant, name string) []corev1.EnvVar {
+	if len(mt.Spec.DatabaseRef.ReadReplicas) == 0 {
+		return nil
+	}
+	return []corev1.EnvVar{{Name: name, Value: strings.Join(mt.Spec.DatabaseRef.ReadReplicas, ",")}}
+}
+
+// managedDatabase returns the status port of database instances that a database operator
+// runs in the tenant namespace, and the namespace of that operator
+func managedDatabase(mt *moodlev1alpha1.MoodleTenant) (int, string, bool) {
+	switch {
+	case mt.Spec.DatabaseRef.Mode == databaseModeCNPG:
+		operatorNamespace := "cnpg-system"
+		if mt.Spec.DatabaseRef.CNPG.OperatorNamespace != "" {
+			operatorNamespace = mt.Spec.DatabaseRef.CNPG.OperatorNamespace
+		}
+		return cnpgStatusPort, operatorNamespace, true
+	case mt.Spec.DatabaseRef.Mode == databaseModeZalando && mt.Spec.DatabaseRef.Zalando.ClusterRef == nil:
+		operatorNamespace := "postgres-operator"
+		if mt.Spec.DatabaseRef.Zalando.OperatorNamespace != "" {
+			operatorNamespace = mt.Spec.DatabaseRef.Zalando.OperatorNamespace
+		}
+		return patroniPort, operatorNamespace, true
+	}
+	return 0, "", false
+}
+
+// databaseServiceName returns the name of the Service publishing the tenant database
+func databaseServiceName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-db"
+}
+
+// databaseHostEnv returns the environment variable carrying the database host: the Cloud
+// SQL Auth Proxy sidecar, the ProxySQL pooler or the published Service if any, the host
+// from the database secret otherwise
+func databaseHostEnv(mt *moodlev1alpha1.MoodleTenant, name string) corev1.EnvVar {
+	if cloudSQLProxyEnabled(mt) {
+		return corev1.EnvVar{Name: name, Value: "127.0.0.1"}
+	}
+	if mt.Spec.DatabaseRef.Pooler != nil {
+		return corev1.EnvVar{Name: name, Value: proxySQLName(mt)}
+	}
+	if mt.Spec.DatabaseRef.PublishService {
+		return corev1.EnvVar{Name: name, Value: databaseServiceName(mt)}
+	}
+
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: mt.Spec.DatabaseRef.AdminSecret,
+				},
+				Key: "host",
+			},
+		},
+	}
+}
+
+// reconcileDatabaseService creates or updates the Service publishing the database host
+// and removes it when publishing is disabled
+func (r *MoodleTenantReconciler) reconcileDatabaseService(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	objectMeta := metav1.ObjectMeta{Name: databaseServiceName(mt), Namespace: namespace}
+	endpointSlice := &discoveryv1.EndpointSlice{ObjectMeta: objectMeta}
+	isIP := net.ParseIP(mt.Spec.DatabaseRef.Host) != nil
+
+	if !mt.Spec.DatabaseRef.PublishService {
+		service := &corev1.Service{ObjectMeta: objectMeta}
+		if err := r.Delete(ctx, service); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete database Service", "Service.Namespace", namespace, "Service.Name", service.Name)
+			return err
+		}
+		isIP = false
+	}
+	if !isIP {
+		if err := r.Delete(ctx, endpointSlice); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete database EndpointSlice", "EndpointSlice.Namespace", namespace, "EndpointSlice.Name", endpointSlice.Name)
+			return err
+		}
+	}
+	if !mt.Spec.DatabaseRef.PublishService {
+		return nil
+	}
+
+	service := r.databaseServiceForMoodle(mt, namespace)
+
+	// The Service type cannot change between ExternalName and ClusterIP in place
+	found := &corev1.Service{}
+	err := r.Get(ctx, types.NamespacedName{Name: service.Name, Namespace: service.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get database Service")
+		return err
+	} else if err == nil && found.Spec.Type != service.Spec.Type {
+		logger.Info("Replacing database Service", "Service.Namespace", found.Namespace, "Service.Name", found.Name, "Type", service.Spec.Type)
+		if err := r.Delete(ctx, found); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete database Service", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
+			return err
+		}
+		if err := r.Create(ctx, service); err != nil {
+			logger.Error(err, "Failed to create new database Service", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
+			return err
+		}
+	} else if err := r.reconcileObject(ctx, mt, service, found); err != nil {
+		return err
+	}
+
+	if isIP {
+		return r.reconcileDatabaseEndpointSlice(ctx, mt, namespace)
+	}
+	return nil
+}
+
+// reconcileDatabaseEndpointSlice creates or updates the EndpointSlice backing the database Service
+func (r *MoodleTenantReconciler) reconcileDatabaseEndpointSlice(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	endpointSlice := r.databaseEndpointSliceForMoodle(mt, namespace)
+
+	found := &discoveryv1.EndpointSlice{}
+	err := r.Get(ctx, types.NamespacedName{Name: endpointSlice.Name, Namespace: endpointSlice.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new database EndpointSlice", "EndpointSlice.Namespace", endpointSlice.Namespace, "EndpointSlice.Name", endpointSlice.Name)
+		if err := r.Create(ctx, endpointSlice); err != nil {
+			logger.Error(err, "Failed to create new database EndpointSlice", "EndpointSlice.Namespace", endpointSlice.Namespace, "EndpointSlice.Name", endpointSlice.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get database EndpointSlice")
+		return err
+	}
+
+	// EndpointSlices have no spec, so the addresses are compared directly. The address type is immutable.
+	if found.AddressType != endpointSlice.AddressType {
+		if err := r.Delete(ctx, found); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete database EndpointSlice", "EndpointSlice.Namespace", found.Namespace, "EndpointSlice.Name", found.Name)
+			return err
+		}
+		return r.Create(ctx, endpointSlice)
+	}
+	if !equality.Semantic.DeepDerivative(endpointSlice.Endpoints, found.Endpoints) || !equality.Semantic.DeepDerivative(endpointSlice.Ports, found.Ports) {
+		found.Endpoints = endpointSlice.Endpoints
+		found.Ports = endpointSlice.Ports
+		logger.Info("Correcting drift", "Kind", "EndpointSlice", "Namespace", found.Namespace, "Name", found.Name)
+		if err := r.Update(ctx, found); err != nil {
+			logger.Error(err, "Failed to correct drift", "Kind", "EndpointSlice", "Namespace", found.Namespace, "Name", found.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// databaseServiceForMoodle returns the Service publishing the database host
+func (r *MoodleTenantReconciler) databaseServiceForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      databaseServiceName(mt),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":                  "moodle",
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "postgresql",
+					Port:       databasePort(mt),
+					TargetPort: intstr.FromInt32(databasePort(mt)),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	// ExternalName only accepts DNS names; IP addresses are published through an EndpointSlice
+	if net.ParseIP(mt.Spec.DatabaseRef.Host) != nil {
+		service.Spec.Type = corev1.ServiceTypeClusterIP
+	} else {
+		service.Spec.Type = corev1.ServiceTypeExternalName
+		service.Spec.ExternalName = mt.Spec.DatabaseRef.Host
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, service, r.Scheme); err != nil {
+		return nil
+	}
+
+	return service
+}
+
+// databaseEndpointSliceForMoodle returns the EndpointSlice backing the database Service with the host IP
+func (r *MoodleTenantReconciler) databaseEndpointSliceForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *discoveryv1.EndpointSlice {
+	addressType := discoveryv1.AddressTypeIPv4
+	if net.ParseIP(mt.Spec.DatabaseRef.Host).To4() == nil {
+		addressType = discoveryv1.AddressTypeIPv6
+	}
+
+	endpointSlice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      databaseServiceName(mt),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":                        "moodle",
+				"moodle.bsu.by/tenant":       mt.Name,
+				discoveryv1.LabelServiceName: databaseServiceName(mt),
+				discoveryv1.LabelManagedBy:   "moodle.bsu.by",
+			},
+		},
+		AddressType: addressType,
+		Endpoints: []discoveryv1.Endpoint{
+			{
+				Addresses: []string{mt.Spec.DatabaseRef.Host},
+			},
+		},
+		Ports: []discoveryv1.EndpointPort{
+			{
+				Name:     ptr.To("postgresql"),
+				Port:     ptr.To(databasePort(mt)),
+				Protocol: ptr.To(corev1.ProtocolTCP),
+			},
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, endpointSlice, r.Scheme); err != nil {
+		return nil
+	}
+
+	return endpointSlice
+}
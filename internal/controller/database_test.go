@@ -0,0 +1,63 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Database env", func() {
+	It("should configure the CLI pods like the web pods", func() {
+		reconciler := &MoodleTenantReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "biology.bsu.by",
+				Image:    "moodle:4.5",
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Type:         "mysqli",
+					Host:         "mysql.db-tier.svc",
+					AdminSecret:  "biology-db",
+					ReadReplicas: []string{"mysql-ro.db-tier.svc"},
+				},
+			},
+		}
+
+		envByName := func(env []corev1.EnvVar) map[string]corev1.EnvVar {
+			byName := map[string]corev1.EnvVar{}
+			for _, e := range env {
+				byName[e.Name] = e
+			}
+			return byName
+		}
+		web := envByName(reconciler.deploymentForMoodle(mt, "tenant-biology").Spec.Template.Spec.Containers[0].Env)
+		cli := envByName(reconciler.cronJobForMoodle(mt, "tenant-biology").Spec.JobTemplate.Spec.Template.Spec.Containers[0].Env)
+		for _, name := range []string{"MOODLE_URL", "DB_HOST", "DB_NAME", "DB_USER", "DB_PASS", "DB_TYPE", "DB_PORT", "DB_READONLY_HOSTS"} {
+			Expect(cli).To(HaveKey(name))
+			Expect(cli[name]).To(Equal(web[name]), name)
+		}
+		Expect(cli["DB_TYPE"].Value).To(Equal("mysqli"))
+		for name := range cli {
+			Expect(name).NotTo(HavePrefix("MOODLE_DATABASE_"))
+		}
+	})
+})
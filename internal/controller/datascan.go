@@ -0,0 +1,297 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+
+// dataScanOrphanScript lists the files of the file pool that no file record of the
+// database refers to into $ORPHAN_REPORT, and writes their number to the termination log
+const dataScanOrphanScript = `set -e
+mkdir -p "$(dirname "$ORPHAN_REPORT")"
+php > /dev/termination-log <<'PHP'
+<?php
+define('CLI_SCRIPT', true);
+require '/var/www/html/config.php';
+$known = array_flip($DB->get_fieldset_sql('SELECT DISTINCT contenthash FROM {files}'));
+$report = fopen(getenv('ORPHAN_REPORT'), 'w');
+$orphans = 0;
+$filedir = $CFG->dataroot . '/filedir';
+if (is_dir($filedir)) {
+    $files = new RecursiveIteratorIterator(new RecursiveDirectoryIterator($filedir, FilesystemIterator::SKIP_DOTS));
+    foreach ($files as $file) {
+        $hash = $file->getFilename();
+        if (preg_match('/^[0-9a-f]{40}$/', $hash) && !isset($known[$hash])) {
+            fwrite($report, $file->getPathname() . "\n");
+            $orphans++;
+        }
+    }
+}
+fclose($report);
+echo $orphans;
+PHP
+`
+
+// dataScanScript updates the virus signatures and scans the file pool into $SCAN_REPORT.
+// It exits with 1 only for infected files; other failures are written to the termination log.
+const dataScanScript = `freshclam --stdout --datadir=/var/lib/clamav || { echo "freshclam could not update the virus signatures" > /dev/termination-log; exit 2; }
+clamscan --recursive --infected --database=/var/lib/clamav --log="$SCAN_REPORT" /var/www/moodledata/filedir
+code=$?
+if [ $code -gt 1 ]; then echo "clamscan failed with exit code $code" > /dev/termination-log; fi
+exit $code
+`
+
+// reconcileDataScan runs the moodledata scan Job for the current trigger and reports its
+// outcome in the DataScanPassed condition. A restored tenant is scanned once the restore
+// finished, so that imported data is checked before it is used.
+func (r *MoodleTenantReconciler) reconcileDataScan(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Spec.DataScan == nil {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionDataScanPassed)
+		return nil
+	}
+
+	job, err := r.dataScanJobForMoodle(mt, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to build the data scan Job: %w", err)
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDataScanPassed,
+		Status:             metav1.ConditionUnknown,
+		ObservedGeneration: mt.Generation,
+	}
+
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		// The orphaned file check reads the file records of the database
+		switch {
+		case mt.Spec.DatabaseRef.RestoreFrom != nil && !meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseRestored):
+			condition.Reason = "WaitingForRestore"
+			condition.Message = "Waiting for the database restore before scanning moodledata"
+			meta.SetStatusCondition(&mt.Status.Conditions, condition)
+			return nil
+		case !databaseReady(mt):
+			condition.Reason = "WaitingForDatabase"
+			condition.Message = "Waiting for the database before scanning moodledata"
+			meta.SetStatusCondition(&mt.Status.Conditions, condition)
+			return nil
+		}
+
+		logger.Info("Creating a new data scan Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new data scan Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return err
+		}
+		found = job
+	} else if err != nil {
+		logger.Error(err, "Failed to get data scan Job")
+		return err
+	}
+
+	condition.Reason = "Scanning"
+	condition.Message = fmt.Sprintf("Scan %s is running", found.Name)
+	if found.Status.Succeeded == 0 && !jobFailed(found) {
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	pod, err := r.dataScanPod(ctx, found)
+	if err != nil {
+		return err
+	}
+	orphanCheck := terminatedContainer(pod, "orphan-check")
+	clamscan := terminatedContainer(pod, "clamscan")
+
+	orphans := ""
+	if orphanCheck != nil && orphanCheck.ExitCode == 0 {
+		orphans = fmt.Sprintf(", %s orphaned files listed in %s", strings.TrimSpace(orphanCheck.Message), dataScanOrphanReportPath(found.Name))
+	}
+
+	switch {
+	case found.Status.Succeeded > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Clean"
+		condition.Message = fmt.Sprintf("No infected files found, report in %s%s", dataScanReportPath(found.Name), orphans)
+	case orphanCheck != nil && orphanCheck.ExitCode != 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ScanError"
+		condition.Message = fmt.Sprintf("The orphaned file check of scan %s failed: %s", found.Name, terminationMessage(orphanCheck))
+	case clamscan != nil && clamscan.ExitCode == 1:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Infected"
+		condition.Message = fmt.Sprintf("Scan %s found infected files, report in %s%s", found.Name, dataScanReportPath(found.Name), orphans)
+	default:
+		// The signatures could not be updated, clamscan failed or the pod is gone
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ScanError"
+		condition.Message = fmt.Sprintf("Scan %s could not complete: %s", found.Name, terminationMessage(clamscan))
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	return nil
+}
+
+// dataScanJobForMoodle returns the scan Job for the current trigger of the MoodleTenant.
+// The orphaned file check runs first in the Moodle container of the Deployment, which
+// reads the database, and ClamAV then scans the file pool.
+func (r *MoodleTenantReconciler) dataScanJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) (*batchv1.Job, error) {
+	name := dataScanJobName(mt)
+	job, err := r.cliJobForMoodle(mt, namespace, name, "data-scan", []string{"sh", "-c", dataScanOrphanScript})
+	if err != nil {
+		return nil, err
+	}
+	job.Annotations = map[string]string{
+		"moodle.bsu.by/trigger": mt.Spec.DataScan.Trigger,
+	}
+	job.Spec.BackoffLimit = ptr.To[int32](0)
+
+	orphanCheck := job.Spec.Template.Spec.Containers[0]
+	orphanCheck.Name = "orphan-check"
+	orphanCheck.Env = append(orphanCheck.Env, corev1.EnvVar{Name: "ORPHAN_REPORT", Value: dataScanOrphanReportPath(name)})
+	orphanCheck.TerminationMessagePath = corev1.TerminationMessagePathDefault
+	orphanCheck.TerminationMessagePolicy = corev1.TerminationMessageReadFile
+
+	image := "clamav/clamav:stable"
+	if mt.Spec.DataScan.Image != "" {
+		image = mt.Spec.DataScan.Image
+	}
+
+	podSpec := &job.Spec.Template.Spec
+	podSpec.InitContainers = append(podSpec.InitContainers, orphanCheck)
+	podSpec.Containers = []corev1.Container{
+		{
+			Name:    "clamscan",
+			Image:   image,
+			Command: []string{"sh", "-c", dataScanScript},
+			Env: []corev1.EnvVar{
+				{Name: "SCAN_REPORT", Value: dataScanReportPath(name)},
+			},
+			TerminationMessagePath:   corev1.TerminationMessagePathDefault,
+			TerminationMessagePolicy: corev1.TerminationMessageReadFile,
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "moodle-data",
+					MountPath: "/var/www/moodledata",
+				},
+				{
+					Name:      "clamav-db",
+					MountPath: "/var/lib/clamav",
+				},
+			},
+		},
+	}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "clamav-db",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{},
+		},
+	})
+
+	return job, nil
+}
+
+// dataScanJobName returns the name of the scan Job. Each trigger value, and the restore
+// of a restored tenant, gets its own Job so that a new scan can be requested declaratively.
+func dataScanJobName(mt *moodlev1alpha1.MoodleTenant) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(mt.Spec.DataScan.Trigger))
+	if mt.Spec.DatabaseRef.RestoreFrom != nil {
+		hash.Write([]byte("\x00" + restoreSource(mt)))
+	}
+	return fmt.Sprintf("%s-scan-%08x", mt.Name, hash.Sum32())
+}
+
+// dataScanPod returns the pod of the finished scan Job, or nil if it is gone
+func (r *MoodleTenantReconciler) dataScanPod(ctx context.Context, job *batchv1.Job) (*corev1.Pod, error) {
+	reader := client.Reader(r.Client)
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+
+	pods := &corev1.PodList{}
+	if err := reader.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"batch.kubernetes.io/job-name": job.Name}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list data scan pods")
+		return nil, err
+	}
+	if len(pods.Items) == 0 {
+		return nil, nil
+	}
+	return &pods.Items[0], nil
+}
+
+// terminatedContainer returns the terminated state of the named container or init
+// container of the pod, or nil
+func terminatedContainer(pod *corev1.Pod, name string) *corev1.ContainerStateTerminated {
+	if pod == nil {
+		return nil
+	}
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		if status.Name == name {
+			return status.State.Terminated
+		}
+	}
+	return nil
+}
+
+// terminationMessage returns the message a failed container left, or a pointer to its logs
+func terminationMessage(terminated *corev1.ContainerStateTerminated) string {
+	if terminated == nil || strings.TrimSpace(terminated.Message) == "" {
+		return "see its logs"
+	}
+	return strings.TrimSpace(terminated.Message)
+}
+
+// dataScanReportPath returns where the scan Job writes its report inside moodledata
+func dataScanReportPath(jobName string) string {
+	return "/var/www/moodledata/scan-reports/" + jobName + ".log"
+}
+
+// dataScanOrphanReportPath returns where the scan Job lists the orphaned files
+func dataScanOrphanReportPath(jobName string) string {
+	return "/var/www/moodledata/scan-reports/" + jobName + "-orphans.log"
+}
+
+// jobFailed reports whether a Job has finished unsuccessfully
+func jobFailed(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Data scan", func() {
+	It("should scan restored data and tell infected files from scan errors", func() {
+		ctx := context.Background()
+
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", UID: "legacy-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Host:        "postgres-cluster.db-tier.svc",
+					AdminSecret: "legacy-db",
+					RestoreFrom: &moodlev1alpha1.DatabaseRestoreSpec{
+						PVC: &moodlev1alpha1.RestorePVCSource{ClaimName: "legacy-data", Path: "import/moodle.sql.gz"},
+					},
+				},
+				DataScan: &moodlev1alpha1.DataScanSpec{},
+			},
+		}
+		scanCondition := func() *metav1.Condition {
+			return meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionDataScanPassed)
+		}
+
+		Expect(reconciler.reconcileDataScan(ctx, mt, "tenant-legacy")).To(Succeed())
+		Expect(scanCondition().Reason).To(Equal("WaitingForRestore"))
+		jobs := &batchv1.JobList{}
+		Expect(c.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+
+		meta.SetStatusCondition(&mt.Status.Conditions, metav1.Condition{
+			Type: moodlev1alpha1.ConditionDatabaseRestored, Status: metav1.ConditionTrue, Reason: "Restored",
+		})
+		Expect(reconciler.reconcileDataScan(ctx, mt, "tenant-legacy")).To(Succeed())
+		Expect(scanCondition().Reason).To(Equal("Scanning"))
+		Expect(c.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(1))
+		job := &jobs.Items[0]
+		Expect(job.Spec.Template.Spec.InitContainers).To(HaveLen(1))
+		Expect(job.Spec.Template.Spec.InitContainers[0].Name).To(Equal("orphan-check"))
+		Expect(job.Spec.Template.Spec.Containers[0].Name).To(Equal("clamscan"))
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      job.Name + "-x7k2p",
+				Namespace: "tenant-legacy",
+				Labels:    map[string]string{"batch.kubernetes.io/job-name": job.Name},
+			},
+		}
+		Expect(c.Create(ctx, pod)).To(Succeed())
+		finish := func(orphanCheck, clamscan corev1.ContainerStateTerminated) {
+			pod.Status.InitContainerStatuses = []corev1.ContainerStatus{{Name: "orphan-check", State: corev1.ContainerState{Terminated: &orphanCheck}}}
+			pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "clamscan", State: corev1.ContainerState{Terminated: &clamscan}}}
+			Expect(c.Status().Update(ctx, pod)).To(Succeed())
+			Expect(reconciler.reconcileDataScan(ctx, mt, "tenant-legacy")).To(Succeed())
+		}
+
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+		finish(corev1.ContainerStateTerminated{Message: "3"}, corev1.ContainerStateTerminated{ExitCode: 2, Message: "freshclam could not update the virus signatures\n"})
+		Expect(scanCondition().Reason).To(Equal("ScanError"))
+		Expect(scanCondition().Message).To(ContainSubstring("freshclam could not update the virus signatures"))
+
+		finish(corev1.ContainerStateTerminated{Message: "3"}, corev1.ContainerStateTerminated{ExitCode: 1})
+		Expect(scanCondition().Status).To(Equal(metav1.ConditionFalse))
+		Expect(scanCondition().Reason).To(Equal("Infected"))
+		Expect(scanCondition().Message).To(ContainSubstring("3 orphaned files listed in /var/www/moodledata/scan-reports/" + job.Name + "-orphans.log"))
+
+		job.Status.Conditions = nil
+		job.Status.Succeeded = 1
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+		finish(corev1.ContainerStateTerminated{Message: "0"}, corev1.ContainerStateTerminated{})
+		Expect(scanCondition().Status).To(Equal(metav1.ConditionTrue))
+		Expect(scanCondition().Reason).To(Equal("Clean"))
+
+		// A new trigger scans again
+		mt.Spec.DataScan.Trigger = "2025-09-01"
+		Expect(reconciler.reconcileDataScan(ctx, mt, "tenant-legacy")).To(Succeed())
+		Expect(c.List(ctx, jobs, client.InNamespace("tenant-legacy"))).To(Succeed())
+		Expect(jobs.Items).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,490 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// databaseCheckDeadline bounds a whole database check once the connection is open
+const databaseCheckDeadline = 10 * time.Second
+
+// databaseCheckError is a failed database check with the reason reported in the
+// DatabaseReachable condition
+type databaseCheckError struct {
+	reason string
+	err    error
+}
+
+func (e *databaseCheckError) Error() string {
+	return e.err.Error()
+}
+
+// checkDatabase connects to the database as Moodle does and reports the outcome in the
+// DatabaseReachable condition, telling network, authentication and missing database
+// failures apart. PostgreSQL is checked down to authentication, MySQL and MariaDB and
+// RDS IAM authentication only for TCP connectivity. With an external database the
+// outcome also decides the DatabaseReady condition that gates the Deployment.
+func (r *MoodleTenantReconciler) checkDatabase(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) {
+	external := mt.Spec.DatabaseRef.Mode != databaseModeCNPG && mt.Spec.DatabaseRef.Mode != databaseModeZalando
+
+	// The Cloud SQL Auth Proxy only runs inside the Moodle pods
+	if r.DatabaseDialer == nil || cloudSQLProxyEnabled(mt) {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseReachable)
+		if external {
+			meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseReady)
+		}
+		return
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDatabaseReachable,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Reachable",
+		ObservedGeneration: mt.Generation,
+	}
+	address, checked, err := r.probeDatabase(ctx, mt, namespace)
+	switch {
+	case err != nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ServerError"
+		var checkErr *databaseCheckError
+		if errors.As(err, &checkErr) {
+			condition.Reason = checkErr.reason
+		}
+		condition.Message = fmt.Sprintf("Database %s: %v", address, err)
+	case checked:
+		condition.Message = fmt.Sprintf("Database %s accepts connections and the credentials", address)
+	default:
+		condition.Message = fmt.Sprintf("Database %s accepts connections, credentials are not checked", address)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	if external {
+		condition.Type = moodlev1alpha1.ConditionDatabaseReady
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	}
+}
+
+// probeDatabase opens a connection to the database and, for PostgreSQL with a password,
+// authenticates. It reports whether the credentials were checked.
+func (r *MoodleTenantReconciler) probeDatabase(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) (string, bool, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: mt.Spec.DatabaseRef.AdminSecret, Namespace: namespace}, secret); err != nil {
+		return mt.Spec.DatabaseRef.AdminSecret, false, &databaseCheckError{"CredentialsMissing", fmt.Errorf("database Secret: %w", err)}
+	}
+
+	// The operator runs in another namespace, so in-cluster Services need their full name
+	host := string(secret.Data["host"])
+	if mt.Spec.DatabaseRef.PublishService {
+		host = databaseServiceName(mt)
+	}
+	if host == "" {
+		return mt.Spec.DatabaseRef.AdminSecret, false, &databaseCheckError{"CredentialsMissing", errors.New("database Secret has no host")}
+	}
+	if !strings.Contains(host, ".") && net.ParseIP(host) == nil {
+		host = host + "." + namespace + ".svc"
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(int(databasePort(mt))))
+
+	conn, err := r.DatabaseDialer(ctx, "tcp", address)
+	if err != nil {
+		return address, false, classifyNetworkError(err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(time.Now().Add(databaseCheckDeadline))
+
+	if databaseType(mt) != "pgsql" || mt.Spec.DatabaseRef.IAM != nil {
+		return address, false, nil
+	}
+
+	tlsConfig, sslMode, err := r.databaseCheckTLSConfig(ctx, mt, host)
+	if err != nil {
+		return address, false, &databaseCheckError{"TLSError", err}
+	}
+	err = probePostgres(conn, tlsConfig, sslMode, string(secret.Data["username"]), string(secret.Data["password"]), string(secret.Data["database"]), mt.Spec.DatabaseRef.Collation)
+	return address, true, err
+}
+
+// classifyNetworkError tells unknown hosts and timeouts from other network errors
+func classifyNetworkError(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return &databaseCheckError{"HostNotFound", err}
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) {
+		return &databaseCheckError{"Timeout", err}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &databaseCheckError{"Timeout", err}
+	}
+	return &databaseCheckError{"NetworkError", err}
+}
+
+// databaseCheckTLSConfig returns the TLS settings of the check, following the libpq
+// sslmode of the tenant. Without SSL settings TLS is used when offered, like libpq's
+// default prefer mode.
+func (r *MoodleTenantReconciler) databaseCheckTLSConfig(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, host string) (*tls.Config, string, error) {
+	ssl := mt.Spec.DatabaseRef.SSL
+	sslMode := "prefer"
+	if ssl != nil && ssl.Mode != "" {
+		sslMode = ssl.Mode
+	} else if ssl != nil {
+		sslMode = "verify-full"
+	}
+
+	// Like libpq, only verify-ca and verify-full check the server certificate
+	config := &tls.Config{ServerName: host, InsecureSkipVerify: true} //nolint:gosec
+	if ssl == nil {
+		return config, sslMode, nil
+	}
+
+	if ssl.CASecretRef != nil {
+		caSecret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ssl.CASecretRef.Name, Namespace: mt.Namespace}, caSecret); err != nil {
+			return nil, sslMode, err
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caSecret.Data["ca.crt"]) {
+			return nil, sslMode, fmt.Errorf("no CA certificate in secret %s", ssl.CASecretRef.Name)
+		}
+		config.RootCAs = roots
+	}
+	if ssl.CertSecretRef != nil {
+		certSecret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ssl.CertSecretRef.Name, Namespace: mt.Namespace}, certSecret); err != nil {
+			return nil, sslMode, err
+		}
+		certificate, err := tls.X509KeyPair(certSecret.Data[corev1.TLSCertKey], certSecret.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, sslMode, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	switch sslMode {
+	case "verify-full":
+		config.InsecureSkipVerify = false
+	case "verify-ca":
+		// Verify the chain but not the hostname
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("no server certificate")
+			}
+			intermediates := x509.NewCertPool()
+			for _, certificate := range state.PeerCertificates[1:] {
+				intermediates.AddCert(certificate)
+			}
+			_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{Roots: config.RootCAs, Intermediates: intermediates})
+			return err
+		}
+	}
+	return config, sslMode, nil
+}
+
+// probePostgres starts a PostgreSQL session, authenticates with cleartext, MD5 or
+// SCRAM-SHA-256 and waits until the server is ready for queries, which also confirms
+// that the database exists. Moodle needs a UTF8 database, so the encoding is verified,
+// and so is the collation when one is requested.
+func probePostgres(conn net.Conn, tlsConfig *tls.Config, sslMode, user, password, database, collation string) error {
+	var rw io.ReadWriter = conn
+
+	if sslMode != "disable" && sslMode != "allow" {
+		// SSLRequest
+		request := make([]byte, 8)
+		binary.BigEndian.PutUint32(request[0:4], 8)
+		binary.BigEndian.PutUint32(request[4:8], 80877103)
+		if _, err := conn.Write(request); err != nil {
+			return classifyNetworkError(err)
+		}
+		answer := make([]byte, 1)
+		if _, err := io.ReadFull(conn, answer); err != nil {
+			return classifyNetworkError(err)
+		}
+		switch {
+		case answer[0] == 'S':
+			tlsConn := tls.Client(conn, tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return &databaseCheckError{"TLSError", err}
+			}
+			rw = tlsConn
+		case sslMode != "prefer":
+			return &databaseCheckError{"TLSError", fmt.Errorf("server does not support TLS, required by sslmode %s", sslMode)}
+		}
+	}
+	reader := bufio.NewReader(rw)
+
+	// StartupMessage for protocol 3.0
+	startup := []byte{0, 0, 0, 0, 0, 3, 0, 0}
+	for _, parameter := range []string{"user", user, "database", database} {
+		startup = append(startup, parameter...)
+		startup = append(startup, 0)
+	}
+	startup = append(startup, 0)
+	binary.BigEndian.PutUint32(startup[0:4], uint32(len(startup)))
+	if _, err := rw.Write(startup); err != nil {
+		return classifyNetworkError(err)
+	}
+
+	var scram *scramClient
+	var encoding, actualCollation string
+	querying := false
+	for {
+		messageType, body, err := readPostgresMessage(reader)
+		if err != nil {
+			return classifyNetworkError(err)
+		}
+
+		switch messageType {
+		case 'E':
+			return postgresError(body)
+		case 'S':
+			// ParameterStatus, server_encoding is the encoding of the database
+			if parameter := strings.Split(string(body), "\x00"); len(parameter) > 1 && parameter[0] == "server_encoding" {
+				encoding = parameter[1]
+			}
+		case 'D':
+			// DataRow of the collation query, a single text column
+			if len(body) >= 6 && int32(binary.BigEndian.Uint32(body[2:6])) >= 0 {
+				length := int(binary.BigEndian.Uint32(body[2:6]))
+				if len(body) >= 6+length {
+					actualCollation = string(body[6 : 6+length])
+				}
+			}
+		case 'Z':
+			// ReadyForQuery
+			if !querying && collation != "" {
+				querying = true
+				err = writePostgresMessage(rw, 'Q', []byte("SELECT datcollate FROM pg_database WHERE datname = current_database()\x00"))
+				if err != nil {
+					return classifyNetworkError(err)
+				}
+				continue
+			}
+
+			// End the session politely
+			_, _ = rw.Write([]byte{'X', 0, 0, 0, 4})
+			if encoding != "" && encoding != "UTF8" {
+				return &databaseCheckError{"EncodingMismatch", fmt.Errorf("database encoding is %s, Moodle requires UTF8", encoding)}
+			}
+			if collation != "" && normalizeLocale(actualCollation) != normalizeLocale(collation) {
+				return &databaseCheckError{"CollationMismatch", fmt.Errorf("database collation is %s, expected %s", actualCollation, collation)}
+			}
+			return nil
+		case 'R':
+			if len(body) < 4 {
+				return fmt.Errorf("malformed authentication request")
+			}
+			switch code := binary.BigEndian.Uint32(body[0:4]); code {
+			case 0:
+				// AuthenticationOk, wait for ReadyForQuery
+			case 3:
+				err = writePostgresMessage(rw, 'p', append([]byte(password), 0))
+			case 5:
+				inner := md5.Sum([]byte(password + user))
+				outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), body[4:8]...))
+				err = writePostgresMessage(rw, 'p', append([]byte("md5"+hex.EncodeToString(outer[:])), 0))
+			case 10:
+				if !strings.Contains(string(body[4:]), "SCRAM-SHA-256\x00") {
+					return &databaseCheckError{"AuthenticationFailed", fmt.Errorf("no supported SASL mechanism offered")}
+				}
+				if scram, err = newSCRAMClient(password); err != nil {
+					return err
+				}
+				first := scram.clientFirst()
+				message := append([]byte("SCRAM-SHA-256\x00"), 0, 0, 0, 0)
+				binary.BigEndian.PutUint32(message[len(message)-4:], uint32(len(first)))
+				err = writePostgresMessage(rw, 'p', append(message, first...))
+			case 11:
+				if scram == nil {
+					return fmt.Errorf("unexpected SASL continuation")
+				}
+				var final string
+				if final, err = scram.clientFinal(string(body[4:])); err != nil {
+					return &databaseCheckError{"AuthenticationFailed", err}
+				}
+				err = writePostgresMessage(rw, 'p', []byte(final))
+			case 12:
+				if scram == nil || !scram.verifyServerFinal(string(body[4:])) {
+					return &databaseCheckError{"AuthenticationFailed", fmt.Errorf("server signature mismatch")}
+				}
+			default:
+				return &databaseCheckError{"AuthenticationFailed", fmt.Errorf("unsupported authentication method %d", code)}
+			}
+			if err != nil {
+				return classifyNetworkError(err)
+			}
+		}
+	}
+}
+
+// normalizeLocale folds the spellings of a locale codeset, so that en_US.UTF-8 matches
+// en_US.utf8
+func normalizeLocale(locale string) string {
+	return strings.ReplaceAll(strings.ToLower(locale), "-", "")
+}
+
+// readPostgresMessage reads a backend message
+func readPostgresMessage(reader *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:5])
+	if length < 4 || length > 1<<20 {
+		return 0, nil, fmt.Errorf("malformed message of length %d", length)
+	}
+	body := make([]byte, length-4)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// writePostgresMessage writes a frontend message
+func writePostgresMessage(w io.Writer, messageType byte, body []byte) error {
+	message := make([]byte, 5, 5+len(body))
+	message[0] = messageType
+	binary.BigEndian.PutUint32(message[1:5], uint32(4+len(body)))
+	_, err := w.Write(append(message, body...))
+	return err
+}
+
+// postgresError classifies an ErrorResponse by its SQLSTATE
+func postgresError(body []byte) error {
+	fields := map[byte]string{}
+	for _, field := range strings.Split(string(body), "\x00") {
+		if len(field) > 1 {
+			fields[field[0]] = field[1:]
+		}
+	}
+	err := fmt.Errorf("%s (SQLSTATE %s)", fields['M'], fields['C'])
+
+	switch code := fields['C']; {
+	case code == "28P01" || code == "28000":
+		return &databaseCheckError{"AuthenticationFailed", err}
+	case code == "3D000":
+		return &databaseCheckError{"DatabaseMissing", err}
+	case code == "53300" || code == "57P03":
+		return &databaseCheckError{"Unavailable", err}
+	}
+	return &databaseCheckError{"ServerError", err}
+}
+
+// scramClient is the client side of a SCRAM-SHA-256 exchange without channel binding
+type scramClient struct {
+	password        string
+	nonce           string
+	clientFirstBare string
+	authMessage     string
+	saltedPassword  []byte
+}
+
+func newSCRAMClient(password string) (*scramClient, error) {
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	c := &scramClient{password: password, nonce: base64.StdEncoding.EncodeToString(nonce)}
+	// PostgreSQL takes the user name from the startup message
+	c.clientFirstBare = "n=,r=" + c.nonce
+	return c, nil
+}
+
+func (c *scramClient) clientFirst() string {
+	return "n,," + c.clientFirstBare
+}
+
+func (c *scramClient) clientFinal(serverFirst string) (string, error) {
+	var serverNonce, salt string
+	iterations := 0
+	for _, attribute := range strings.Split(serverFirst, ",") {
+		key, value, _ := strings.Cut(attribute, "=")
+		switch key {
+		case "r":
+			serverNonce = value
+		case "s":
+			salt = value
+		case "i":
+			iterations, _ = strconv.Atoi(value)
+		}
+	}
+	if !strings.HasPrefix(serverNonce, c.nonce) || iterations <= 0 {
+		return "", fmt.Errorf("invalid SCRAM server message")
+	}
+	saltBytes, err := base64.StdEncoding.DecodeString(salt)
+	if err != nil {
+		return "", err
+	}
+
+	c.saltedPassword, err = pbkdf2.Key(sha256.New, c.password, saltBytes, iterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	clientKey := scramHMAC(c.saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+
+	clientFinalWithoutProof := "c=biws,r=" + serverNonce
+	c.authMessage = c.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof
+	proof := scramHMAC(storedKey[:], c.authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	return clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) verifyServerFinal(serverFinal string) bool {
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(serverFinal, "v="))
+	if err != nil || c.saltedPassword == nil {
+		return false
+	}
+	serverKey := scramHMAC(c.saltedPassword, "Server Key")
+	return hmac.Equal(signature, scramHMAC(serverKey, c.authMessage))
+}
+
+func scramHMAC(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
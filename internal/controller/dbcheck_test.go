@@ -0,0 +1,62 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Database check", func() {
+	It("should report a Secret without a host instead of dialing", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "physics-db", Namespace: "tenant-physics"},
+			Data:       map[string][]byte{"username": []byte("physics"), "password": []byte("secret")},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).WithObjects(secret).Build()
+		dialed := false
+		reconciler := &MoodleTenantReconciler{
+			Client: c,
+			Scheme: c.Scheme(),
+			DatabaseDialer: func(ctx context.Context, network, address string) (net.Conn, error) {
+				dialed = true
+				return nil, &net.OpError{Op: "dial", Net: network}
+			},
+		}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "physics"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{AdminSecret: "physics-db"},
+			},
+		}
+
+		reconciler.checkDatabase(context.Background(), mt, "tenant-physics")
+		Expect(dialed).To(BeFalse())
+		condition := meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseReachable)
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal("CredentialsMissing"))
+	})
+})
@@ -0,0 +1,368 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// databaseDeletionPolicyDrop drops the tenant database and role with the MoodleTenant
+const databaseDeletionPolicyDrop = "Drop"
+
+// databaseSettingsAnnotation records the database settings a provisioning Job applies
+const databaseSettingsAnnotation = "moodle.bsu.by/database-settings"
+
+// databaseProvisionScript creates the tenant role and database, with the requested
+// collation, if they are missing and keeps the role password in sync. It is idempotent,
+// so a Job can be re-run safely.
+const databaseProvisionScript = `psql -v ON_ERROR_STOP=1 -v role="$DB_USER" -v password="$DB_PASS" -v db="$DB_NAME" -v collation="$DB_COLLATION" -d postgres <<'SQL'
+SELECT format('CREATE ROLE %I LOGIN', :'role') WHERE NOT EXISTS (SELECT FROM pg_roles WHERE rolname = :'role') \gexec
+SELECT format('ALTER ROLE %I PASSWORD %L', :'role', :'password') \gexec
+SELECT format('CREATE DATABASE %I OWNER %I ENCODING ''UTF8''', :'db', :'role') || CASE WHEN :'collation' = '' THEN '' ELSE format(' TEMPLATE template0 LC_COLLATE %L LC_CTYPE %L', :'collation', :'collation') END WHERE NOT EXISTS (SELECT FROM pg_database WHERE datname = :'db') \gexec
+SELECT format('GRANT ALL PRIVILEGES ON DATABASE %I TO %I', :'db', :'role') \gexec
+SQL
+`
+
+// databaseSchemaProvisionScript creates the tenant role and its schema in the shared
+// database. Other tenants' roles only get to connect to the database; the schemas are
+// private to their owners. The server role joins the tenant role to create its schema.
+const databaseSchemaProvisionScript = `psql -v ON_ERROR_STOP=1 -v role="$DB_USER" -v password="$DB_PASS" -v db="$DB_NAME" -v schema="$DB_SCHEMA" -v collation="$DB_COLLATION" -d postgres <<'SQL'
+SELECT format('CREATE ROLE %I LOGIN', :'role') WHERE NOT EXISTS (SELECT FROM pg_roles WHERE rolname = :'role') \gexec
+SELECT format('ALTER ROLE %I PASSWORD %L', :'role', :'password') \gexec
+SELECT format('GRANT %I TO current_user', :'role') WHERE NOT pg_has_role(current_user, :'role', 'MEMBER') \gexec
+SELECT format('CREATE DATABASE %I ENCODING ''UTF8''', :'db') || CASE WHEN :'collation' = '' THEN '' ELSE format(' TEMPLATE template0 LC_COLLATE %L LC_CTYPE %L', :'collation', :'collation') END WHERE NOT EXISTS (SELECT FROM pg_database WHERE datname = :'db') \gexec
+SELECT format('REVOKE ALL ON DATABASE %I FROM PUBLIC', :'db') \gexec
+SELECT format('GRANT CONNECT, TEMPORARY ON DATABASE %I TO %I', :'db', :'role') \gexec
+SELECT format('ALTER ROLE %I IN DATABASE %I SET search_path = %I', :'role', :'db', :'schema') \gexec
+\connect :"db"
+REVOKE ALL ON SCHEMA public FROM PUBLIC;
+SELECT format('CREATE SCHEMA IF NOT EXISTS %I AUTHORIZATION %I', :'schema', :'role') \gexec
+SQL
+`
+
+// databaseSchemaDropScript drops the tenant schema, with everything else the role owns
+// in the shared database, and the role
+const databaseSchemaDropScript = `psql -v ON_ERROR_STOP=1 -v role="$DB_USER" -v db="$DB_NAME" -d postgres <<'SQL'
+SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE usename = :'role';
+\connect :"db"
+DROP OWNED BY :"role" CASCADE;
+\connect postgres
+DROP ROLE IF EXISTS :"role";
+SQL
+`
+
+// databaseDropScript drops the tenant database and role
+const databaseDropScript = `psql -v ON_ERROR_STOP=1 -v role="$DB_USER" -v db="$DB_NAME" -d postgres <<'SQL'
+SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = :'db';
+DROP DATABASE IF EXISTS :"db";
+DROP ROLE IF EXISTS :"role";
+SQL
+`
+
+// scramIterations is the PBKDF2 iteration count of generated SCRAM-SHA-256 verifiers,
+// the PostgreSQL default
+const scramIterations = 4096
+
+// databasePasswordGenerated reports whether the operator generates the database password
+// because it provisions the role and none is given
+func databasePasswordGenerated(mt *moodlev1alpha1.MoodleTenant) bool {
+	return mt.Spec.DatabaseRef.Provisioning != nil && mt.Spec.DatabaseRef.Password == "" && mt.Spec.DatabaseRef.IAM == nil
+}
+
+// generatePassword returns a random password of 32 URL-safe characters
+func generatePassword() (string, error) {
+	password := make([]byte, 24)
+	if _, err := rand.Read(password); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(password), nil
+}
+
+// scramVerifier returns the SCRAM-SHA-256 verifier of a password in the form stored by
+// PostgreSQL, which ALTER ROLE accepts in place of the password. The salt is derived
+// from the MoodleTenant UID, so the verifier and the Job name stay stable.
+func scramVerifier(mt *moodlev1alpha1.MoodleTenant, password string) (string, error) {
+	saltSum := sha256.Sum256([]byte(string(mt.UID) + "/" + mt.Spec.DatabaseRef.User))
+	salt := saltSum[:16]
+
+	saltedPassword, err := pbkdf2.Key(sha256.New, password, salt, scramIterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	storedKey := sha256.Sum256(scramHMAC(saltedPassword, "Client Key"))
+	serverKey := scramHMAC(saltedPassword, "Server Key")
+
+	encode := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s", scramIterations, encode(salt), encode(storedKey[:]), encode(serverKey)), nil
+}
+
+// reconcileDatabaseProvisioning runs the provisioning Job for the current database settings
+// and reports its outcome in the DatabaseProvisioned condition. The Jobs run in the
+// MoodleTenant namespace, next to the server credentials. A generated password is only
+// stored in the database Secret in the tenant namespace; the Job sets its SCRAM verifier,
+// which it reads from the <name>-db-provision Secret. The Job is replaced when the
+// settings change.
+func (r *MoodleTenantReconciler) reconcileDatabaseProvisioning(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Spec.DatabaseRef.Provisioning == nil {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseProvisioned)
+		return nil
+	}
+
+	password := mt.Spec.DatabaseRef.Password
+	if databasePasswordGenerated(mt) {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: mt.Spec.DatabaseRef.AdminSecret, Namespace: namespace}, secret); err != nil {
+			logger.Error(err, "Failed to get database Secret", "Secret.Namespace", namespace, "Secret.Name", mt.Spec.DatabaseRef.AdminSecret)
+			return err
+		}
+		verifier, err := scramVerifier(mt, string(secret.Data["password"]))
+		if err != nil {
+			return err
+		}
+		password = verifier
+	}
+
+	// The password reaches the Job through a Secret next to it
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mt.Name + "-db-provision",
+			Namespace: mt.Namespace,
+			Labels: map[string]string{
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+		},
+		Data: map[string][]byte{
+			"password": []byte(password),
+		},
+	}
+	if err := ctrl.SetControllerReference(mt, secret, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.reconcileSecretData(ctx, secret); err != nil {
+		return err
+	}
+
+	// Changing the role, schema or password provisions again. A new password shows in
+	// the resource version of the Secret, never in the settings themselves.
+	hash := fnv.New32a()
+	hash.Write([]byte(mt.Spec.DatabaseRef.Name + "/" + mt.Spec.DatabaseRef.User + "/" + secret.ResourceVersion))
+	script := databaseProvisionScript
+	if schema := mt.Spec.DatabaseRef.Provisioning.Schema; schema != "" {
+		hash.Write([]byte("/" + schema))
+		script = databaseSchemaProvisionScript
+	}
+	settings := fmt.Sprintf("%08x", hash.Sum32())
+
+	job, err := r.databaseJobForMoodle(mt, mt.Name+"-db-provision", script)
+	if err != nil {
+		return fmt.Errorf("failed to build the database provisioning Job: %w", err)
+	}
+	job.Annotations = map[string]string{databaseSettingsAnnotation: settings}
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name: "DB_PASS",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secret.Name},
+				Key:                  "password",
+			},
+		},
+	})
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDatabaseProvisioned,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "Provisioning",
+		Message:            fmt.Sprintf("Job %s is provisioning the database", job.Name),
+		ObservedGeneration: mt.Generation,
+	}
+
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new database provisioning Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new database provisioning Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return err
+		}
+		found = job
+	} else if err != nil {
+		logger.Error(err, "Failed to get database provisioning Job")
+		return err
+	} else if found.Annotations[databaseSettingsAnnotation] != settings {
+		// The Job of the previous settings is replaced once it is gone
+		logger.Info("Deleting the database provisioning Job of previous settings", "Job.Namespace", found.Namespace, "Job.Name", found.Name)
+		if err := r.Delete(ctx, found, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete database provisioning Job", "Job.Namespace", found.Namespace, "Job.Name", found.Name)
+			return err
+		}
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	switch {
+	case found.Status.Succeeded > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Provisioned"
+		condition.Message = fmt.Sprintf("Database %s and role %s exist", mt.Spec.DatabaseRef.Name, mt.Spec.DatabaseRef.User)
+		if schema := mt.Spec.DatabaseRef.Provisioning.Schema; schema != "" {
+			condition.Message = fmt.Sprintf("Schema %s in database %s and role %s exist", schema, mt.Spec.DatabaseRef.Name, mt.Spec.DatabaseRef.User)
+		}
+	case jobFailed(found):
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ProvisioningFailed"
+		condition.Message = fmt.Sprintf("Job %s failed, see its logs", found.Name)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	return nil
+}
+
+// finalizeDatabase drops the tenant database and role when the deletion policy asks for it.
+// It reports whether the MoodleTenant may be released; a failed drop blocks deletion until
+// it is fixed or the policy is changed to Retain.
+func (r *MoodleTenantReconciler) finalizeDatabase(ctx context.Context, mt *moodlev1alpha1.MoodleTenant) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	provisioning := mt.Spec.DatabaseRef.Provisioning
+	if provisioning == nil || provisioning.DeletionPolicy != databaseDeletionPolicyDrop {
+		return true, nil
+	}
+
+	script := databaseDropScript
+	if provisioning.Schema != "" {
+		script = databaseSchemaDropScript
+	}
+	job, err := r.databaseJobForMoodle(mt, mt.Name+"-db-drop", script)
+	if err != nil {
+		return false, fmt.Errorf("failed to build the database drop Job: %w", err)
+	}
+
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new database drop Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new database drop Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return false, err
+		}
+		return false, nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get database drop Job")
+		return false, err
+	}
+
+	if jobFailed(found) {
+		return false, fmt.Errorf("database drop Job %s/%s failed", found.Namespace, found.Name)
+	}
+	return found.Status.Succeeded > 0, nil
+}
+
+// databaseJobForMoodle returns a Job running a psql script against the database server
+func (r *MoodleTenantReconciler) databaseJobForMoodle(mt *moodlev1alpha1.MoodleTenant, name, script string) (*batchv1.Job, error) {
+	provisioning := mt.Spec.DatabaseRef.Provisioning
+
+	image := "postgres:17-alpine"
+	if provisioning.Image != "" {
+		image = provisioning.Image
+	}
+
+	serverSecretEnv := func(name, key string, optional bool) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: provisioning.ServerSecretRef,
+					Key:                  key,
+					Optional:             ptr.To(optional),
+				},
+			},
+		}
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: mt.Namespace,
+			Labels: map[string]string{
+				"moodle.bsu.by/tenant": mt.Name,
+				"moodle.bsu.by/job":    "database",
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](3),
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot: ptr.To(true),
+						RunAsUser:    ptr.To[int64](70), // postgres
+						FSGroup:      ptr.To[int64](70),
+					},
+					Containers: []corev1.Container{
+						{
+							Name:    "psql",
+							Image:   image,
+							Command: []string{"sh", "-c", script},
+							Env: []corev1.EnvVar{
+								serverSecretEnv("PGHOST", "host", false),
+								serverSecretEnv("PGPORT", "port", true),
+								serverSecretEnv("PGUSER", "username", false),
+								serverSecretEnv("PGPASSWORD", "password", false),
+								{Name: "DB_NAME", Value: mt.Spec.DatabaseRef.Name},
+								{Name: "DB_USER", Value: mt.Spec.DatabaseRef.User},
+								{Name: "DB_SCHEMA", Value: provisioning.Schema},
+								{Name: "DB_COLLATION", Value: mt.Spec.DatabaseRef.Collation},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// The Job runs next to the referenced secrets, so it mounts them directly
+	applyDatabaseTLS(mt, &job.Spec.Template.Spec, false)
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, job, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
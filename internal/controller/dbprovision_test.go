@@ -0,0 +1,83 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Database provisioning", func() {
+	It("should pass the password through a Secret and replace the Job when it changes", func() {
+		ctx := context.Background()
+
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "chemistry", Namespace: "default", UID: "chemistry-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Name:         "moodle_chemistry",
+					User:         "chemistry",
+					Password:     "first-password",
+					Provisioning: &moodlev1alpha1.DatabaseProvisioningSpec{ServerSecretRef: corev1.LocalObjectReference{Name: "postgres-server"}},
+				},
+			},
+		}
+		jobKey := types.NamespacedName{Name: "chemistry-db-provision", Namespace: "default"}
+
+		Expect(reconciler.reconcileDatabaseProvisioning(ctx, mt, "tenant-chemistry")).To(Succeed())
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, jobKey, job)).To(Succeed())
+		Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+			Name: "DB_PASS",
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "chemistry-db-provision"},
+				Key:                  "password",
+			}},
+		}))
+		for _, env := range job.Spec.Template.Spec.Containers[0].Env {
+			Expect(env.Value).NotTo(ContainSubstring("first-password"))
+		}
+		secret := &corev1.Secret{}
+		Expect(c.Get(ctx, jobKey, secret)).To(Succeed())
+		Expect(string(secret.Data["password"])).To(Equal("first-password"))
+		settings := job.Annotations[databaseSettingsAnnotation]
+
+		// The same settings keep the Job
+		Expect(reconciler.reconcileDatabaseProvisioning(ctx, mt, "tenant-chemistry")).To(Succeed())
+		Expect(c.Get(ctx, jobKey, job)).To(Succeed())
+		Expect(job.Annotations[databaseSettingsAnnotation]).To(Equal(settings))
+
+		// A new password replaces the Job under the same name
+		mt.Spec.DatabaseRef.Password = "second-password"
+		Expect(reconciler.reconcileDatabaseProvisioning(ctx, mt, "tenant-chemistry")).To(Succeed())
+		Expect(c.Get(ctx, jobKey, job)).NotTo(Succeed())
+		Expect(reconciler.reconcileDatabaseProvisioning(ctx, mt, "tenant-chemistry")).To(Succeed())
+		Expect(c.Get(ctx, jobKey, job)).To(Succeed())
+		Expect(job.Annotations[databaseSettingsAnnotation]).NotTo(Equal(settings))
+	})
+})
@@ -0,0 +1,124 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// databaseTLSPath is where the database CA and client certificate are mounted
+const databaseTLSPath = "/etc/moodle/db-tls"
+
+// reconcileDatabaseTLSSecrets copies the database CA and client certificate into the
+// tenant namespace
+func (r *MoodleTenantReconciler) reconcileDatabaseTLSSecrets(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	ssl := mt.Spec.DatabaseRef.SSL
+	if ssl == nil {
+		return nil
+	}
+
+	if ssl.CASecretRef != nil {
+		source := types.NamespacedName{Name: ssl.CASecretRef.Name, Namespace: mt.Namespace}
+		if err := r.reconcileCopiedSecret(ctx, mt, source, namespace, mt.Name+"-db-ca"); err != nil {
+			return err
+		}
+	}
+	if ssl.CertSecretRef != nil {
+		source := types.NamespacedName{Name: ssl.CertSecretRef.Name, Namespace: mt.Namespace}
+		if err := r.reconcileCopiedSecret(ctx, mt, source, namespace, mt.Name+"-db-cert"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyDatabaseTLS mounts the database CA and client certificate into the first container
+// of the pod and points libpq at them. Pods in the tenant namespace use the copied secrets,
+// Jobs in the MoodleTenant namespace the referenced ones.
+func applyDatabaseTLS(mt *moodlev1alpha1.MoodleTenant, podSpec *corev1.PodSpec, copied bool) {
+	ssl := mt.Spec.DatabaseRef.SSL
+	if ssl == nil {
+		return
+	}
+
+	mode := "verify-full"
+	if ssl.Mode != "" {
+		mode = ssl.Mode
+	}
+
+	container := &podSpec.Containers[0]
+	container.Env = append(container.Env, corev1.EnvVar{Name: "PGSSLMODE", Value: mode})
+
+	sources := []corev1.VolumeProjection{}
+	if ssl.CASecretRef != nil {
+		name := ssl.CASecretRef.Name
+		if copied {
+			name = mt.Name + "-db-ca"
+		}
+		sources = append(sources, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+				Items:                []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+			},
+		})
+		container.Env = append(container.Env, corev1.EnvVar{Name: "PGSSLROOTCERT", Value: databaseTLSPath + "/ca.crt"})
+	}
+	if ssl.CertSecretRef != nil {
+		name := ssl.CertSecretRef.Name
+		if copied {
+			name = mt.Name + "-db-cert"
+		}
+		sources = append(sources, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+				Items: []corev1.KeyToPath{
+					{Key: corev1.TLSCertKey, Path: corev1.TLSCertKey},
+					{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey},
+				},
+			},
+		})
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "PGSSLCERT", Value: databaseTLSPath + "/" + corev1.TLSCertKey},
+			corev1.EnvVar{Name: "PGSSLKEY", Value: databaseTLSPath + "/" + corev1.TLSPrivateKeyKey},
+		)
+	}
+	if len(sources) == 0 {
+		return
+	}
+
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "db-tls",
+		MountPath: databaseTLSPath,
+		ReadOnly:  true,
+	})
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "db-tls",
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: sources,
+				// libpq refuses keys readable by others; root-owned keys may be group-readable
+				DefaultMode: ptr.To[int32](0o640),
+			},
+		},
+	})
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// archiveScript writes a tarball of moodledata to /archive, without the caches and
+// temporary files Moodle recreates
+const archiveScript = `set -e
+tar czf /archive/moodledata.tar.gz -C /var/www/moodledata \
+  --exclude=./cache --exclude=./localcache --exclude=./sessions --exclude=./temp --exclude=./trashdir .
+`
+
+// courseBackupScript writes a Moodle backup of every course to /archive/courses
+const courseBackupScript = `set -e
+mkdir -p /archive/courses
+courses=$(php <<'PHP'
+<?php
+define('CLI_SCRIPT', true);
+require '/var/www/html/config.php';
+echo implode(' ', $DB->get_fieldset_select('course', 'id', 'id <> ?', [SITEID]));
+PHP
+)
+for id in $courses; do
+  php /var/www/html/admin/cli/backup.php --courseid="$id" --destination=/archive/courses
+done
+`
+
+// archiveUploadScript uploads the archive next to the database dump
+const archiveUploadScript = `set -e
+aws s3 cp --recursive /archive "s3://$S3_BUCKET/$S3_PREFIX/" ${S3_ENDPOINT_URL:+--endpoint-url "$S3_ENDPOINT_URL"}
+`
+
+// decommissionName returns the name of the archive Job, the copied credentials and the
+// MoodleDatabaseDump of a decommissioned tenant
+func decommissionName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-decommission"
+}
+
+// decommissionPrefix returns the object key prefix of the archive
+func decommissionPrefix(mt *moodlev1alpha1.MoodleTenant) string {
+	return path.Join(mt.Spec.Decommission.S3.Prefix, mt.Name)
+}
+
+// reconcileDecommission archives a deleted tenant with spec.decommission and reports
+// whether its namespace and database may be removed. The database is dumped through a
+// MoodleDatabaseDump, which is kept as a record of the archive, while a Job archives
+// moodledata and the courses. A failed archive blocks the deletion until its
+// MoodleDatabaseDump or Job is deleted to retry, or spec.decommission is removed.
+func (r *MoodleTenantReconciler) reconcileDecommission(ctx context.Context, mt *moodlev1alpha1.MoodleTenant) (bool, error) {
+	decommission := mt.Spec.Decommission
+	if decommission == nil || meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionDecommissioned) {
+		return true, nil
+	}
+	namespace := "tenant-" + mt.Name
+	name := decommissionName(mt)
+
+	status := mt.Status.Decommission
+	if status == nil {
+		status = &moodlev1alpha1.DecommissionStatus{
+			Archive:   "s3://" + decommission.S3.Bucket + "/" + decommissionPrefix(mt) + "/",
+			StartTime: ptr.To(metav1.Now()),
+		}
+		mt.Status.Decommission = status
+	}
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDecommissioned,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Archiving",
+		ObservedGeneration: mt.Generation,
+	}
+
+	if err := r.reconcileDecommissionCredentials(ctx, mt, namespace); err != nil {
+		if !errors.IsNotFound(err) {
+			return false, err
+		}
+		condition.Reason = "CredentialsNotFound"
+		condition.Message = fmt.Sprintf("Secret %s not found", decommission.S3.CredentialsSecretRef.Name)
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return false, nil
+	}
+
+	pending, failed := []string{}, []string{}
+
+	// The dump lands in <prefix>/<tenant>/ like the rest of the archive
+	status.DatabaseDump = name
+	destination := moodlev1alpha1.DumpDestinationSpec{S3: decommission.S3.DeepCopy()}
+	done, failure, err := r.reconcileTenantDump(ctx, mt, name, destination)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case failure != "":
+		failed = append(failed, fmt.Sprintf("MoodleDatabaseDump %s failed: %s", name, failure))
+	case !done:
+		pending = append(pending, "MoodleDatabaseDump "+name)
+	}
+
+	done, failure, err = r.reconcileArchiveJob(ctx, mt, namespace)
+	if err != nil {
+		return false, err
+	}
+	status.JobName = name
+	switch {
+	case failure != "":
+		failed = append(failed, failure)
+	case !done:
+		pending = append(pending, "Job "+name)
+	}
+
+	switch {
+	case len(failed) > 0:
+		condition.Reason = "ArchiveFailed"
+		condition.Message = fmt.Sprintf("%v; delete the failed MoodleDatabaseDump or Job to retry, the tenant is kept until then", failed)
+	case len(pending) > 0:
+		condition.Message = fmt.Sprintf("Waiting for %v before deleting the tenant", pending)
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Archived"
+		condition.Message = fmt.Sprintf("Archived to %s", status.Archive)
+		status.CompletionTime = ptr.To(metav1.Now())
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	return condition.Status == metav1.ConditionTrue, nil
+}
+
+// reconcileDecommissionCredentials copies the object store credentials into the tenant
+// namespace. The copy is removed with the namespace.
+func (r *MoodleTenantReconciler) reconcileDecommissionCredentials(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	source := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: mt.Spec.Decommission.S3.CredentialsSecretRef.Name, Namespace: mt.Namespace}, source); err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      decommissionName(mt),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+		},
+		Data: source.Data,
+	}
+	if err := r.Create(ctx, secret); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// reconcileArchiveJob runs the Job archiving moodledata and the courses and reports
+// whether it succeeded, or why it failed
+func (r *MoodleTenantReconciler) reconcileArchiveJob(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) (bool, string, error) {
+	logger := log.FromContext(ctx)
+
+	job, err := r.archiveJobForMoodle(mt, namespace)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to build the archive Job: %w", err)
+	}
+
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new archive Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new archive Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return false, "", err
+		}
+		return false, "", nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get archive Job")
+		return false, "", err
+	}
+
+	if jobFailed(found) {
+		return false, fmt.Sprintf("Job %s failed, see its logs", found.Name), nil
+	}
+	return found.Status.Succeeded > 0, "", nil
+}
+
+// archiveJobForMoodle returns the Job archiving moodledata and the courses. The archive
+// is written to an emptyDir by the Moodle container of the Deployment and uploaded by
+// the AWS CLI. Moodle keeps serving while it runs, so the archive is crash-consistent.
+func (r *MoodleTenantReconciler) archiveJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) (*batchv1.Job, error) {
+	job, err := r.cliJobForMoodle(mt, namespace, decommissionName(mt), "decommission", []string{"sh", "-c", archiveScript})
+	if err != nil {
+		return nil, err
+	}
+	s3 := mt.Spec.Decommission.S3
+	archiveMount := corev1.VolumeMount{Name: "archive", MountPath: "/archive"}
+
+	podSpec := &job.Spec.Template.Spec
+	moodle := podSpec.Containers[0]
+	moodle.VolumeMounts = append(moodle.VolumeMounts, archiveMount)
+
+	moodledata := moodle
+	moodledata.Name = "archive-moodledata"
+	podSpec.InitContainers = append(podSpec.InitContainers, moodledata)
+
+	if ptr.Deref(mt.Spec.Decommission.CourseBackups, true) {
+		courses := moodle
+		courses.Name = "archive-courses"
+		courses.Command = []string{"sh", "-c", courseBackupScript}
+		podSpec.InitContainers = append(podSpec.InitContainers, courses)
+	}
+
+	uploadEnv := []corev1.EnvVar{
+		{Name: "S3_BUCKET", Value: s3.Bucket},
+		{Name: "S3_PREFIX", Value: decommissionPrefix(mt)},
+		{Name: "S3_ENDPOINT_URL", Value: s3.EndpointURL},
+	}
+	if s3.Region != "" {
+		uploadEnv = append(uploadEnv, corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: s3.Region})
+	}
+	podSpec.Containers = []corev1.Container{{
+		Name:    "upload",
+		Image:   "amazon/aws-cli:2.22.0",
+		Command: []string{"sh", "-c", archiveUploadScript},
+		Env:     uploadEnv,
+		EnvFrom: []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: decommissionName(mt)},
+			},
+		}},
+		VolumeMounts: []corev1.VolumeMount{archiveMount},
+	}}
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name:         "archive",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+
+	return job, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Decommission", func() {
+	It("should archive the tenant before it is removed", func() {
+		ctx := context.Background()
+
+		credentials := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "archive-s3"},
+			Data:       map[string][]byte{"AWS_ACCESS_KEY_ID": []byte("key")},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithObjects(credentials).
+			WithStatusSubresource(&moodlev1alpha1.MoodleDatabaseDump{}).
+			Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "retired", UID: "retired-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "retired.bsu.by",
+				Image:    "moodle:4.5",
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Host:        "postgres-cluster.db-tier.svc",
+					AdminSecret: "retired-db",
+				},
+				Decommission: &moodlev1alpha1.DecommissionSpec{
+					S3: moodlev1alpha1.DumpS3Destination{
+						Bucket:               "moodle-archive",
+						Prefix:               "retired-sites",
+						CredentialsSecretRef: corev1.LocalObjectReference{Name: "archive-s3"},
+					},
+				},
+			},
+		}
+
+		archived, err := reconciler.reconcileDecommission(ctx, mt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(archived).To(BeFalse())
+		Expect(mt.Status.Decommission.Archive).To(Equal("s3://moodle-archive/retired-sites/retired/"))
+
+		dump := &moodlev1alpha1.MoodleDatabaseDump{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "retired-decommission"}, dump)).To(Succeed())
+		Expect(dump.Spec.Destination.S3.Bucket).To(Equal("moodle-archive"))
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "retired-decommission", Namespace: "tenant-retired"}, job)).To(Succeed())
+		initContainers := []string{}
+		for _, container := range job.Spec.Template.Spec.InitContainers {
+			initContainers = append(initContainers, container.Name)
+		}
+		Expect(initContainers).To(Equal([]string{"archive-moodledata", "archive-courses"}))
+		Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "S3_PREFIX", Value: "retired-sites/retired"}))
+
+		By("blocking the deletion while the archive fails")
+		dump.Status.Phase = moodlev1alpha1.DumpPhaseFailed
+		Expect(c.Status().Update(ctx, dump)).To(Succeed())
+		archived, err = reconciler.reconcileDecommission(ctx, mt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(archived).To(BeFalse())
+		Expect(meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionDecommissioned).Reason).To(Equal("ArchiveFailed"))
+
+		By("allowing the deletion once the archive is complete")
+		dump.Status.Phase = moodlev1alpha1.DumpPhaseSucceeded
+		Expect(c.Status().Update(ctx, dump)).To(Succeed())
+		job.Status.Succeeded = 1
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+		archived, err = reconciler.reconcileDecommission(ctx, mt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(archived).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionDecommissioned)).To(BeTrue())
+		Expect(mt.Status.Decommission.CompletionTime).NotTo(BeNil())
+	})
+})
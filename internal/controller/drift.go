@@ -0,0 +1,370 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// lastAppliedAnnotation records what the operator last applied to an object: the keys of
+// its labels and annotations and a hash of its spec. Drift correction uses it to remove
+// labels, annotations and spec fields that are no longer rendered.
+const lastAppliedAnnotation = "moodle.bsu.by/last-applied"
+
+// lastApplied is the value of the lastAppliedAnnotation
+type lastApplied struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+	Spec        string   `json:"spec"`
+}
+
+// defaultDriftIgnoredFields are fields allocated by the API server that must never
+// be overwritten, in the same "<Kind>:<path>" form as the --drift-ignore-fields flag
+var defaultDriftIgnoredFields = []string{
+	"Service:spec.clusterIP",
+	"Service:spec.clusterIPs",
+}
+
+// driftIgnoredFields returns the dot-separated field paths of the given kind that are
+// excluded from drift detection for the MoodleTenant
+func (r *MoodleTenantReconciler) driftIgnoredFields(mt *moodlev1alpha1.MoodleTenant, kind string) [][]string {
+	fields := append([]string{}, defaultDriftIgnoredFields...)
+	fields = append(fields, r.DriftIgnoredFields...)
+
+	// The HPA owns the replica count while it is enabled, unless the tenant is parked
+	if mt.Spec.HPA.Enabled && !parked(mt) {
+		fields = append(fields, "Deployment:spec.replicas")
+	}
+
+	return fieldPaths(fields, kind)
+}
+
+// fieldPaths returns the dot-separated paths of the "<Kind>:<path>" fields of the given kind
+func fieldPaths(fields []string, kind string) [][]string {
+	paths := [][]string{}
+	for _, field := range fields {
+		fieldKind, path, ok := strings.Cut(field, ":")
+		if ok && fieldKind == kind && path != "" {
+			paths = append(paths, strings.Split(path, "."))
+		}
+	}
+	return paths
+}
+
+// lastAppliedFor returns the record of desired. Its spec, or the data of objects without
+// one such as ConfigMaps, is hashed without the ignored fields, which belong to other
+// controllers.
+func lastAppliedFor(ignored [][]string, desired client.Object) (*lastApplied, error) {
+	fields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range ignored {
+		unstructured.RemoveNestedField(fields, path...)
+	}
+	state, ok := fields["spec"]
+	if !ok {
+		state = fields["data"]
+	}
+	spec, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	hash := fnv.New32a()
+	hash.Write(spec)
+
+	applied := &lastApplied{Spec: fmt.Sprintf("%08x", hash.Sum32())}
+	for key := range desired.GetLabels() {
+		applied.Labels = append(applied.Labels, key)
+	}
+	for key := range desired.GetAnnotations() {
+		if key != lastAppliedAnnotation {
+			applied.Annotations = append(applied.Annotations, key)
+		}
+	}
+	sort.Strings(applied.Labels)
+	sort.Strings(applied.Annotations)
+	return applied, nil
+}
+
+// setLastApplied records applied in obj
+func setLastApplied(obj client.Object, applied *lastApplied) error {
+	value, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	obj.SetAnnotations(mergeStringMaps(obj.GetAnnotations(), map[string]string{lastAppliedAnnotation: string(value)}))
+	return nil
+}
+
+// getLastApplied returns the record of obj, or nil if obj was not created or corrected
+// by this version of the operator
+func getLastApplied(obj client.Object) *lastApplied {
+	value, ok := obj.GetAnnotations()[lastAppliedAnnotation]
+	if !ok {
+		return nil
+	}
+	applied := &lastApplied{}
+	if err := json.Unmarshal([]byte(value), applied); err != nil {
+		return nil
+	}
+	return applied
+}
+
+// staleKeys returns the keys of live that were applied before but are no longer desired
+func staleKeys(applied []string, desired, live map[string]string) []string {
+	stale := []string{}
+	for _, key := range applied {
+		_, isDesired := desired[key]
+		_, isLive := live[key]
+		if !isDesired && isLive {
+			stale = append(stale, key)
+		}
+	}
+	return stale
+}
+
+// withoutKeys returns m without the given keys
+func withoutKeys(m map[string]string, keys []string) map[string]string {
+	if len(keys) == 0 {
+		return m
+	}
+	result := map[string]string{}
+	for key, value := range m {
+		if !slices.Contains(keys, key) {
+			result[key] = value
+		}
+	}
+	return result
+}
+
+// markApplied records desired in itself before it is created, so that later drift
+// corrections know what the operator owns
+func (r *MoodleTenantReconciler) markApplied(mt *moodlev1alpha1.MoodleTenant, desired client.Object) error {
+	applied, err := lastAppliedFor(r.driftIgnoredFields(mt, reflect.TypeOf(desired).Elem().Name()), desired)
+	if err != nil {
+		return err
+	}
+	return setLastApplied(desired, applied)
+}
+
+// correctDrift updates live when it has drifted from desired. desired and live must be
+// of the same type and have a Spec field, or a Data field like ConfigMaps.
+//
+// Before comparison desired is normalized: ignored fields are taken over from live, and
+// fields left unset in desired are not compared at all, so values defaulted by the API
+// server (Deployment strategy, Service clusterIP, container terminationMessagePath, ...)
+// never cause an update. Labels and annotations are merged so that keys added by other
+// controllers are kept, while the keys recorded in the lastAppliedAnnotation and no
+// longer rendered are removed. A changed spec hash in the record replaces the spec even
+// when only a field was unset.
+func (r *MoodleTenantReconciler) correctDrift(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, desired, live client.Object) error {
+	return correctObjectDrift(ctx, r.Client, r.driftIgnoredFields(mt, reflect.TypeOf(live).Elem().Name()), desired, live)
+}
+
+// correctObjectDrift is correctDrift with the given ignored field paths
+func correctObjectDrift(ctx context.Context, c client.Client, ignored [][]string, desired, live client.Object) error {
+	logger := log.FromContext(ctx)
+
+	kind := reflect.TypeOf(live).Elem().Name()
+
+	applied, err := lastAppliedFor(ignored, desired)
+	if err != nil {
+		return err
+	}
+	var staleLabels, staleAnnotations []string
+	specChanged := false
+	if previous := getLastApplied(live); previous != nil {
+		staleLabels = staleKeys(previous.Labels, desired.GetLabels(), live.GetLabels())
+		staleAnnotations = staleKeys(previous.Annotations, desired.GetAnnotations(), live.GetAnnotations())
+		specChanged = previous.Spec != applied.Spec
+	}
+
+	desiredFields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return err
+	}
+	liveFields, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+	if err != nil {
+		return err
+	}
+	for _, path := range ignored {
+		value, found, err := unstructured.NestedFieldCopy(liveFields, path...)
+		if err != nil {
+			return err
+		}
+		if found {
+			if err := unstructured.SetNestedField(desiredFields, value, path...); err != nil {
+				return err
+			}
+		} else {
+			unstructured.RemoveNestedField(desiredFields, path...)
+		}
+	}
+
+	normalized := live.DeepCopyObject().(client.Object)
+	reflect.ValueOf(normalized).Elem().Set(reflect.Zero(reflect.TypeOf(normalized).Elem()))
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(desiredFields, normalized); err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepDerivative(normalized, live) && len(staleLabels) == 0 && len(staleAnnotations) == 0 && !specChanged {
+		return nil
+	}
+
+	updated := live.DeepCopyObject().(client.Object)
+	updated.SetLabels(mergeStringMaps(withoutKeys(updated.GetLabels(), staleLabels), normalized.GetLabels()))
+	updated.SetAnnotations(mergeStringMaps(withoutKeys(updated.GetAnnotations(), staleAnnotations), normalized.GetAnnotations()))
+	if err := setLastApplied(updated, applied); err != nil {
+		return err
+	}
+	field := "Spec"
+	if !reflect.ValueOf(updated).Elem().FieldByName(field).IsValid() {
+		field = "Data"
+	}
+	reflect.ValueOf(updated).Elem().FieldByName(field).Set(reflect.ValueOf(normalized).Elem().FieldByName(field))
+
+	logger.Info("Correcting drift", "Kind", kind, "Namespace", live.GetNamespace(), "Name", live.GetName())
+	if err := c.Update(ctx, updated); err != nil {
+		logger.Error(err, "Failed to correct drift", "Kind", kind, "Namespace", live.GetNamespace(), "Name", live.GetName())
+		return err
+	}
+	return nil
+}
+
+// reconcileObject creates desired if it does not exist and corrects drift otherwise.
+// found must be an empty object of the same type as desired.
+func (r *MoodleTenantReconciler) reconcileObject(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, desired, found client.Object) error {
+	logger := log.FromContext(ctx)
+	kind := reflect.TypeOf(desired).Elem().Name()
+
+	err := r.Get(ctx, types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new "+kind, "Namespace", desired.GetNamespace(), "Name", desired.GetName())
+		if err := r.markApplied(mt, desired); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, desired); err != nil {
+			logger.Error(err, "Failed to create new "+kind, "Namespace", desired.GetNamespace(), "Name", desired.GetName())
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get "+kind)
+		return err
+	}
+
+	return r.correctDrift(ctx, mt, desired, found)
+}
+
+// reconcileUnstructured creates or updates an object of a third-party API, such as
+// cert-manager or external-dns, that the operator handles without typed clients. Only
+// the spec is corrected on drift, using the same semantic comparison and spec hash as
+// correctDrift.
+func (r *MoodleTenantReconciler) reconcileUnstructured(ctx context.Context, desired *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	logger := log.FromContext(ctx)
+	kind := desired.GetKind()
+
+	applied, err := lastAppliedFor(nil, desired)
+	if err != nil {
+		return nil, err
+	}
+
+	found := &unstructured.Unstructured{}
+	found.SetGroupVersionKind(desired.GroupVersionKind())
+	err = r.Get(ctx, types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new "+kind, "Namespace", desired.GetNamespace(), "Name", desired.GetName())
+		if err := setLastApplied(desired, applied); err != nil {
+			return nil, err
+		}
+		if err := r.Create(ctx, desired); err != nil {
+			logger.Error(err, "Failed to create new "+kind, "Namespace", desired.GetNamespace(), "Name", desired.GetName())
+			return nil, err
+		}
+		return desired, nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get "+kind)
+		return nil, err
+	}
+
+	previous := getLastApplied(found)
+	specChanged := previous != nil && previous.Spec != applied.Spec
+	if !equality.Semantic.DeepDerivative(desired.Object["spec"], found.Object["spec"]) || specChanged {
+		found.Object["spec"] = desired.Object["spec"]
+		if err := setLastApplied(found, applied); err != nil {
+			return nil, err
+		}
+		logger.Info("Correcting drift", "Kind", kind, "Namespace", found.GetNamespace(), "Name", found.GetName())
+		if err := r.Update(ctx, found); err != nil {
+			logger.Error(err, "Failed to correct drift", "Kind", kind, "Namespace", found.GetNamespace(), "Name", found.GetName())
+			return nil, err
+		}
+	}
+
+	return found, nil
+}
+
+// deleteUnstructured removes an object of a third-party API if it exists. It is a no-op
+// when the API is not installed in the cluster.
+func (r *MoodleTenantReconciler) deleteUnstructured(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string) error {
+	logger := log.FromContext(ctx)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(name)
+	obj.SetNamespace(namespace)
+	if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		logger.Error(err, "Failed to delete "+gvk.Kind, "Namespace", namespace, "Name", name)
+		return err
+	}
+	return nil
+}
+
+// mergeStringMaps returns base with the entries of overrides applied on top
+func mergeStringMaps(base, overrides map[string]string) map[string]string {
+	if len(overrides) == 0 {
+		return base
+	}
+	merged := map[string]string{}
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overrides {
+		merged[key] = value
+	}
+	return merged
+}
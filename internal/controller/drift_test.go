@@ -0,0 +1,142 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Drift correction", func() {
+	ctx := context.Background()
+
+	var (
+		c          client.Client
+		reconciler *MoodleTenantReconciler
+		mt         *moodlev1alpha1.MoodleTenant
+		desired    *appsv1.Deployment
+	)
+
+	BeforeEach(func() {
+		c = fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).Build()
+		reconciler = &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		mt = &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "drift", UID: "drift-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Image: "moodle:4.5",
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2000m")},
+				},
+			},
+		}
+		desired = reconciler.deploymentForMoodle(mt, "tenant-drift")
+
+		// Simulate what the API server stores: defaulted and canonicalized fields
+		live := desired.DeepCopy()
+		live.Spec.RevisionHistoryLimit = ptr.To(int32(10))
+		live.Spec.Strategy = appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType}
+		live.Spec.Template.Spec.Containers[0].TerminationMessagePath = "/dev/termination-log"
+		live.Spec.Template.Spec.Containers[0].ImagePullPolicy = corev1.PullIfNotPresent
+		live.Spec.Template.Spec.Containers[0].Resources.Limits[corev1.ResourceCPU] = resource.MustParse("2")
+		live.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyAlways
+		Expect(c.Create(ctx, live)).To(Succeed())
+	})
+
+	getLive := func() *appsv1.Deployment {
+		live := &appsv1.Deployment{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, live)).To(Succeed())
+		return live
+	}
+
+	It("should not update when only server-defaulted fields differ", func() {
+		live := getLive()
+		Expect(reconciler.correctDrift(ctx, mt, desired, live)).To(Succeed())
+		Expect(getLive().ResourceVersion).To(Equal(live.ResourceVersion))
+	})
+
+	It("should update drifted fields and keep defaulted ones", func() {
+		live := getLive()
+		live.Spec.Template.Spec.Containers[0].Image = "moodle:tampered"
+		Expect(c.Update(ctx, live)).To(Succeed())
+
+		Expect(reconciler.correctDrift(ctx, mt, desired, getLive())).To(Succeed())
+		Expect(getLive().Spec.Template.Spec.Containers[0].Image).To(Equal("moodle:4.5"))
+	})
+
+	It("should leave ignored fields to their owner", func() {
+		reconciler.DriftIgnoredFields = []string{"Deployment:spec.replicas"}
+		live := getLive()
+		live.Spec.Replicas = ptr.To(int32(7))
+		Expect(c.Update(ctx, live)).To(Succeed())
+
+		live = getLive()
+		Expect(reconciler.correctDrift(ctx, mt, desired, live)).To(Succeed())
+		Expect(getLive().ResourceVersion).To(Equal(live.ResourceVersion))
+		Expect(*getLive().Spec.Replicas).To(Equal(int32(7)))
+	})
+
+	It("should remove annotations and spec fields that are no longer rendered", func() {
+		Expect(c.Delete(ctx, getLive())).To(Succeed())
+		previous := desired.DeepCopy()
+		previous.ResourceVersion = ""
+		previous.Annotations = map[string]string{"moodle.bsu.by/stale": "true"}
+		previous.Spec.Template.Spec.DNSConfig = &corev1.PodDNSConfig{Nameservers: []string{"10.0.0.10"}}
+		Expect(reconciler.markApplied(mt, previous)).To(Succeed())
+		Expect(c.Create(ctx, previous)).To(Succeed())
+
+		// Keys added by other controllers are kept
+		live := getLive()
+		live.Annotations["kubectl.kubernetes.io/restartedAt"] = "now"
+		Expect(c.Update(ctx, live)).To(Succeed())
+
+		Expect(reconciler.correctDrift(ctx, mt, desired, getLive())).To(Succeed())
+		live = getLive()
+		Expect(live.Annotations).NotTo(HaveKey("moodle.bsu.by/stale"))
+		Expect(live.Annotations).To(HaveKey("kubectl.kubernetes.io/restartedAt"))
+		Expect(live.Spec.Template.Spec.DNSConfig).To(BeNil())
+
+		// The corrected object is stable
+		Expect(reconciler.correctDrift(ctx, mt, desired, live)).To(Succeed())
+		Expect(getLive().ResourceVersion).To(Equal(live.ResourceVersion))
+	})
+
+	It("should correct the data of objects without a spec", func() {
+		mt.Spec.Routing.PathPrefix = "/drift"
+		configMap := reconciler.serverConfigMapForMoodle(mt, "tenant-drift")
+		live := configMap.DeepCopy()
+		live.Data["nginx.conf"] = "# tampered"
+		Expect(c.Create(ctx, live)).To(Succeed())
+
+		found := &corev1.ConfigMap{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: configMap.Name, Namespace: configMap.Namespace}, found)).To(Succeed())
+		Expect(reconciler.correctDrift(ctx, mt, configMap, found)).To(Succeed())
+		Expect(c.Get(ctx, types.NamespacedName{Name: configMap.Name, Namespace: configMap.Namespace}, found)).To(Succeed())
+		Expect(found.Data["nginx.conf"]).To(Equal(nginxConfigForMoodle(mt)))
+	})
+})
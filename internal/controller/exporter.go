@@ -0,0 +1,302 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors,verbs=get;list;watch;create;update;patch;delete
+
+// serviceMonitorGVK is the Prometheus Operator ServiceMonitor kind
+var serviceMonitorGVK = schema.GroupVersionKind{Group: "monitoring.coreos.com", Version: "v1", Kind: "ServiceMonitor"}
+
+// exporterPort is the metrics port of postgres_exporter
+const exporterPort = 9187
+
+// exporterName returns the name shared by the exporter resources
+func exporterName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-db-exporter"
+}
+
+// exporterLabels returns the labels of the exporter pods
+func exporterLabels(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	return map[string]string{
+		"app":                  "moodle-db-exporter",
+		"moodle.bsu.by/tenant": mt.Name,
+	}
+}
+
+// reconcileExporter creates or removes the postgres_exporter Deployment, its Service and
+// the optional ServiceMonitor
+func (r *MoodleTenantReconciler) reconcileExporter(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	exporter := mt.Spec.DatabaseRef.Exporter
+	if exporter == nil || !exporter.ServiceMonitor {
+		if err := r.deleteUnstructured(ctx, serviceMonitorGVK, namespace, exporterName(mt)); err != nil {
+			return err
+		}
+	}
+	if exporter == nil {
+		objectMeta := metav1.ObjectMeta{Name: exporterName(mt), Namespace: namespace}
+		for _, obj := range []client.Object{
+			&corev1.Service{ObjectMeta: objectMeta},
+			&appsv1.Deployment{ObjectMeta: objectMeta},
+		} {
+			if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "Failed to delete exporter resource", "Namespace", namespace, "Name", obj.GetName())
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := r.reconcileObject(ctx, mt, r.exporterDeploymentForMoodle(mt, namespace), &appsv1.Deployment{}); err != nil {
+		return err
+	}
+	if err := r.reconcileObject(ctx, mt, r.exporterServiceForMoodle(mt, namespace), &corev1.Service{}); err != nil {
+		return err
+	}
+	if exporter.ServiceMonitor {
+		if _, err := r.reconcileUnstructured(ctx, r.serviceMonitorForMoodle(mt, namespace, exporterName(mt), exporterLabels(mt))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exporterDeploymentForMoodle returns the postgres_exporter Deployment. It connects to the
+// database like Moodle, with the credentials and TLS settings of the tenant.
+func (r *MoodleTenantReconciler) exporterDeploymentForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *appsv1.Deployment {
+	exporter := mt.Spec.DatabaseRef.Exporter
+	labels := exporterLabels(mt)
+
+	image := "quay.io/prometheuscommunity/postgres-exporter:v0.16.0"
+	if exporter.Image != "" {
+		image = exporter.Image
+	}
+
+	args := []string{}
+	if exporter.StatStatements {
+		args = append(args, "--collector.stat_statements")
+	}
+
+	// Without SSL settings the connection is unencrypted, as lib/pq has no prefer mode
+	dataSourceURI := "$(DB_HOST):" + strconv.Itoa(int(databasePort(mt))) + "/$(DB_NAME)"
+	if mt.Spec.DatabaseRef.SSL == nil {
+		dataSourceURI += "?sslmode=disable"
+	}
+
+	databaseSecretEnv := func(name, key string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: mt.Spec.DatabaseRef.AdminSecret},
+					Key:                  key,
+				},
+			},
+		}
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      exporterName(mt),
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot: ptr.To(true),
+						RunAsUser:    ptr.To[int64](65534), // nobody
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "postgres-exporter",
+							Image: image,
+							Args:  args,
+							Env: []corev1.EnvVar{
+								databaseHostEnv(mt, "DB_HOST"),
+								databaseSecretEnv("DB_NAME", "database"),
+								{Name: "DATA_SOURCE_URI", Value: dataSourceURI},
+								databaseSecretEnv("DATA_SOURCE_USER", "username"),
+								databaseSecretEnv("DATA_SOURCE_PASS", "password"),
+							},
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "metrics",
+									ContainerPort: exporterPort,
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									HTTPGet: &corev1.HTTPGetAction{
+										Path: "/",
+										Port: intstr.FromInt(exporterPort),
+									},
+								},
+								PeriodSeconds: 10,
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("10m"),
+									corev1.ResourceMemory: resource.MustParse("32Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("128Mi"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// The credentials are only read at startup
+	if mt.Status.DatabaseSecretHash != "" {
+		deployment.Spec.Template.Annotations = map[string]string{
+			"moodle.bsu.by/database-secret-hash": mt.Status.DatabaseSecretHash,
+		}
+	}
+
+	// lib/pq reads the PGSSL* variables but only knows the verifying modes and require
+	applyDatabaseTLS(mt, &deployment.Spec.Template.Spec, true)
+	env := deployment.Spec.Template.Spec.Containers[0].Env
+	for i := range env {
+		if env[i].Name == "PGSSLMODE" && (env[i].Value == "allow" || env[i].Value == "prefer") {
+			env[i].Value = "require"
+		}
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, deployment, r.Scheme); err != nil {
+		return nil
+	}
+
+	return deployment
+}
+
+// exporterServiceForMoodle returns the Service in front of the exporter
+func (r *MoodleTenantReconciler) exporterServiceForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      exporterName(mt),
+			Namespace: namespace,
+			Labels:    exporterLabels(mt),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: exporterLabels(mt),
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "metrics",
+					Port:       exporterPort,
+					TargetPort: intstr.FromInt(exporterPort),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	// Annotation-based Prometheus discovery, for setups without the Prometheus Operator
+	if !mt.Spec.DatabaseRef.Exporter.ServiceMonitor {
+		service.Annotations = map[string]string{
+			"prometheus.io/scrape": "true",
+			"prometheus.io/port":   strconv.Itoa(exporterPort),
+		}
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, service, r.Scheme); err != nil {
+		return nil
+	}
+
+	return service
+}
+
+// serviceMonitorForMoodle returns the ServiceMonitor scraping the exporter Service with
+// the given name and labels. The tenant label of the Service is added to every series,
+// so database and cache load is attributed to it.
+func (r *MoodleTenantReconciler) serviceMonitorForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	matchLabels := map[string]interface{}{}
+	for key, value := range labels {
+		matchLabels[key] = value
+	}
+
+	serviceMonitor := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchLabels": matchLabels,
+				},
+				"targetLabels": []interface{}{"moodle.bsu.by/tenant"},
+				"endpoints": []interface{}{
+					map[string]interface{}{
+						"port":     "metrics",
+						"interval": "30s",
+					},
+				},
+			},
+		},
+	}
+	serviceMonitor.SetGroupVersionKind(serviceMonitorGVK)
+	serviceMonitor.SetName(name)
+	serviceMonitor.SetNamespace(namespace)
+	serviceMonitor.SetLabels(labels)
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, serviceMonitor, r.Scheme); err != nil {
+		return nil
+	}
+
+	return serviceMonitor
+}
+
+// exporterPrometheusNamespace returns the namespace allowed to scrape the exporter
+func exporterPrometheusNamespace(mt *moodlev1alpha1.MoodleTenant) string {
+	if namespace := mt.Spec.DatabaseRef.Exporter.PrometheusNamespace; namespace != "" {
+		return namespace
+	}
+	return "monitoring"
+}
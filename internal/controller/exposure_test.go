@@ -0,0 +1,62 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Internal exposure", func() {
+	It("should name the internal Service after internalHostname next to the tenant Services", func() {
+		ctx := context.Background()
+
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "hub", UID: "hub-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "hub.bsu.by",
+				Exposure: moodlev1alpha1.ExposureSpec{InternalHostname: "lti"},
+			},
+		}
+
+		Expect(reconciler.reconcileService(ctx, mt, "tenant-hub")).To(Succeed())
+		Expect(reconciler.reconcileInternalService(ctx, mt, "tenant-hub")).To(Succeed())
+
+		services := &corev1.ServiceList{}
+		Expect(c.List(ctx, services, client.InNamespace("tenant-hub"))).To(Succeed())
+		names := []string{}
+		for _, service := range services.Items {
+			names = append(names, service.Name)
+		}
+		Expect(names).To(ConsistOf("hub-service", "lti"))
+		for _, name := range names {
+			if name != "lti" {
+				Expect(name).To(HavePrefix(mt.Name + "-"))
+			}
+		}
+	})
+})
@@ -0,0 +1,122 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=externaldns.k8s.io,resources=dnsendpoints,verbs=get;list;watch;create;update;patch;delete
+
+// dnsEndpointGVK is the external-dns DNSEndpoint kind, handled as an unstructured object
+var dnsEndpointGVK = schema.GroupVersionKind{Group: "externaldns.k8s.io", Version: "v1alpha1", Kind: "DNSEndpoint"}
+
+// externalDNSModeDNSEndpoint publishes records through a DNSEndpoint resource
+const externalDNSModeDNSEndpoint = "DNSEndpoint"
+
+// reconcileDNSEndpoint creates or updates the DNSEndpoint publishing the tenant hostnames.
+// Records are removed by external-dns when the DNSEndpoint is garbage collected with the tenant.
+func (r *MoodleTenantReconciler) reconcileDNSEndpoint(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	if mt.Spec.ExternalDNS == nil || mt.Spec.ExternalDNS.Mode != externalDNSModeDNSEndpoint {
+		return nil
+	}
+
+	_, err := r.reconcileUnstructured(ctx, r.dnsEndpointForMoodle(mt, namespace))
+	return err
+}
+
+// dnsEndpointForMoodle returns a DNSEndpoint with a record per tenant hostname and the
+// admin hostname
+func (r *MoodleTenantReconciler) dnsEndpointForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	externalDNS := mt.Spec.ExternalDNS
+
+	// A records for IP targets, CNAME records for hostname targets
+	recordType := "CNAME"
+	targets := []interface{}{}
+	for _, target := range externalDNS.Targets {
+		if ip := net.ParseIP(target); ip != nil {
+			recordType = "A"
+			if ip.To4() == nil {
+				recordType = "AAAA"
+			}
+		}
+		targets = append(targets, target)
+	}
+
+	endpoints := []interface{}{}
+	for _, hostname := range publishedHostnames(mt) {
+		endpoint := map[string]interface{}{
+			"dnsName":    hostname,
+			"recordType": recordType,
+			"targets":    targets,
+		}
+		if externalDNS.TTL != nil {
+			endpoint["recordTTL"] = *externalDNS.TTL
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	dnsEndpoint := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"endpoints": endpoints,
+			},
+		},
+	}
+	dnsEndpoint.SetGroupVersionKind(dnsEndpointGVK)
+	dnsEndpoint.SetName(mt.Name + "-dns")
+	dnsEndpoint.SetNamespace(namespace)
+	dnsEndpoint.SetLabels(map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, dnsEndpoint, r.Scheme); err != nil {
+		return nil
+	}
+
+	return dnsEndpoint
+}
+
+// externalDNSAnnotations returns the Ingress annotations requesting DNS records from external-dns
+func externalDNSAnnotations(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	externalDNS := mt.Spec.ExternalDNS
+	if externalDNS == nil || externalDNS.Mode == externalDNSModeDNSEndpoint {
+		return nil
+	}
+
+	annotations := map[string]string{
+		"external-dns.alpha.kubernetes.io/hostname": strings.Join(tenantHostnames(mt), ","),
+	}
+	if len(externalDNS.Targets) > 0 {
+		annotations["external-dns.alpha.kubernetes.io/target"] = strings.Join(externalDNS.Targets, ",")
+	}
+	if externalDNS.TTL != nil {
+		annotations["external-dns.alpha.kubernetes.io/ttl"] = fmt.Sprintf("%d", *externalDNS.TTL)
+	}
+	return annotations
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=external-secrets.io,resources=externalsecrets,verbs=get;list;watch;create;update;patch;delete
+
+// externalSecretGVK is the External Secrets Operator ExternalSecret kind
+var externalSecretGVK = schema.GroupVersionKind{Group: "external-secrets.io", Version: "v1", Kind: "ExternalSecret"}
+
+// reconcileExternalDatabaseSecret builds the database Secret from the Secret materialized
+// by the External Secrets Operator. It reports whether the Secret exists; until it does,
+// the DatabaseReady condition is False.
+func (r *MoodleTenantReconciler) reconcileExternalDatabaseSecret(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) (bool, error) {
+	logger := log.FromContext(ctx)
+	ref := mt.Spec.DatabaseRef.ExternalSecretRef
+
+	externalSecret := &unstructured.Unstructured{}
+	externalSecret.SetGroupVersionKind(externalSecretGVK)
+	if ref.StoreRef != nil {
+		desired := r.externalSecretForMoodle(mt)
+		if desired == nil {
+			return false, fmt.Errorf("failed to build ExternalSecret for %s", mt.Name)
+		}
+		live, err := r.reconcileUnstructured(ctx, desired)
+		if err != nil {
+			return false, err
+		}
+		externalSecret = live
+	} else if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: mt.Namespace}, externalSecret); err != nil {
+		if !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			logger.Error(err, "Failed to get ExternalSecret", "Namespace", mt.Namespace, "Name", ref.Name)
+			return false, err
+		}
+		setExternalSecretPending(mt, fmt.Sprintf("ExternalSecret %s/%s not found", mt.Namespace, ref.Name))
+		return false, nil
+	}
+
+	// The target Secret is named after the ExternalSecret unless set otherwise
+	targetName, _, _ := unstructured.NestedString(externalSecret.Object, "spec", "target", "name")
+	if targetName == "" {
+		targetName = externalSecret.GetName()
+	}
+
+	source := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: targetName, Namespace: mt.Namespace}, source); err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to get Secret", "Secret.Namespace", mt.Namespace, "Secret.Name", targetName)
+			return false, err
+		}
+		message := fmt.Sprintf("Waiting for the External Secrets Operator to create Secret %s/%s", mt.Namespace, targetName)
+		conditions, _, _ := unstructured.NestedSlice(externalSecret.Object, "status", "conditions")
+		for _, c := range conditions {
+			if esCondition, ok := c.(map[string]interface{}); ok && esCondition["type"] == "Ready" && esCondition["status"] == "False" {
+				message = fmt.Sprintf("ExternalSecret %s is not ready: %v", externalSecret.GetName(), esCondition["message"])
+			}
+		}
+		setExternalSecretPending(mt, message)
+		return false, nil
+	}
+
+	// The materialized Secret overrides the credentials of the MoodleTenant
+	data := map[string][]byte{
+		"host":     []byte(mt.Spec.DatabaseRef.Host),
+		"database": []byte(mt.Spec.DatabaseRef.Name),
+		"username": []byte(mt.Spec.DatabaseRef.User),
+		"password": []byte(mt.Spec.DatabaseRef.Password),
+	}
+	for key := range data {
+		if value, ok := source.Data[key]; ok {
+			data[key] = value
+		}
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mt.Spec.DatabaseRef.AdminSecret,
+			Namespace: namespace,
+		},
+		Data: data,
+	}
+	if err := ctrl.SetControllerReference(mt, secret, r.Scheme); err != nil {
+		return false, err
+	}
+	return true, r.reconcileSecretData(ctx, secret)
+}
+
+// setExternalSecretPending holds the Deployment back until the credentials are available
+func setExternalSecretPending(mt *moodlev1alpha1.MoodleTenant, message string) {
+	meta.SetStatusCondition(&mt.Status.Conditions, metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDatabaseReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "ExternalSecretPending",
+		Message:            message,
+		ObservedGeneration: mt.Generation,
+	})
+}
+
+// externalSecretForMoodle returns the ExternalSecret that pulls the database credentials
+// from the referenced store into the MoodleTenant namespace
+func (r *MoodleTenantReconciler) externalSecretForMoodle(mt *moodlev1alpha1.MoodleTenant) *unstructured.Unstructured {
+	ref := mt.Spec.DatabaseRef.ExternalSecretRef
+
+	kind := "ClusterSecretStore"
+	if ref.StoreRef.Kind != "" {
+		kind = ref.StoreRef.Kind
+	}
+	refreshInterval := "1h"
+	if ref.RefreshInterval != "" {
+		refreshInterval = ref.RefreshInterval
+	}
+
+	externalSecret := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"refreshInterval": refreshInterval,
+				"secretStoreRef": map[string]interface{}{
+					"name": ref.StoreRef.Name,
+					"kind": kind,
+				},
+				"target": map[string]interface{}{
+					"name":           mt.Name + "-db-external",
+					"creationPolicy": "Owner",
+				},
+				"dataFrom": []interface{}{
+					map[string]interface{}{
+						"extract": map[string]interface{}{
+							"key": ref.RemoteKey,
+						},
+					},
+				},
+			},
+		},
+	}
+	externalSecret.SetGroupVersionKind(externalSecretGVK)
+	externalSecret.SetName(mt.Name + "-db-external")
+	externalSecret.SetNamespace(mt.Namespace)
+	externalSecret.SetLabels(map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, externalSecret, r.Scheme); err != nil {
+		return nil
+	}
+
+	return externalSecret
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// extraCronJobLabel carries the name of an extra CronJob in spec.extraCronJobs
+const extraCronJobLabel = "moodle.bsu.by/extra-cronjob"
+
+// extraCronJobName returns the name of an extra CronJob
+func extraCronJobName(mt *moodlev1alpha1.MoodleTenant, name string) string {
+	return mt.Name + "-cron-" + name
+}
+
+// reconcileExtraCronJobs creates the CronJobs of spec.extraCronJobs and removes those no
+// longer listed
+func (r *MoodleTenantReconciler) reconcileExtraCronJobs(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	listed := map[string]bool{}
+	for i := range mt.Spec.ExtraCronJobs {
+		cronJob := r.extraCronJobForMoodle(mt, namespace, &mt.Spec.ExtraCronJobs[i])
+		if cronJob == nil {
+			return fmt.Errorf("failed to build the extra CronJob %s", mt.Spec.ExtraCronJobs[i].Name)
+		}
+		listed[cronJob.Name] = true
+		if err := r.reconcileObject(ctx, mt, cronJob, &batchv1.CronJob{}); err != nil {
+			return err
+		}
+	}
+
+	cronJobs := &batchv1.CronJobList{}
+	if err := r.List(ctx, cronJobs, client.InNamespace(namespace), client.MatchingLabels{"moodle.bsu.by/tenant": mt.Name}, client.HasLabels{extraCronJobLabel}); err != nil {
+		logger.Error(err, "Failed to list extra CronJobs")
+		return err
+	}
+	for i := range cronJobs.Items {
+		cronJob := &cronJobs.Items[i]
+		if listed[cronJob.Name] {
+			continue
+		}
+		logger.Info("Deleting extra CronJob", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+		if err := r.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete extra CronJob", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extraCronJobForMoodle returns the CronJob of an extra job. It runs the cron pod with
+// the command of the job, so it has the same environment, volumes, resources and
+// placement as cron.php.
+func (r *MoodleTenantReconciler) extraCronJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string, extra *moodlev1alpha1.ExtraCronJobSpec) *batchv1.CronJob {
+	cronJob := moodleCronJob(mt, namespace)
+	cronJob.Name = extraCronJobName(mt, extra.Name)
+	cronJob.Labels = map[string]string{
+		"moodle.bsu.by/tenant": mt.Name,
+		extraCronJobLabel:      extra.Name,
+	}
+	cronJob.Spec.Schedule = extra.Schedule
+	// The parallelism of cron.php does not apply to other scripts
+	cronJob.Spec.JobTemplate.Spec.Parallelism = nil
+	cronJob.Spec.JobTemplate.Spec.Completions = nil
+
+	container := &cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0]
+	container.Name = "moodle-" + extra.Name
+	container.Command = extra.Command
+	if len(container.Command) == 0 {
+		container.Command = []string{"/usr/local/bin/php"}
+	}
+	container.Args = extra.Args
+	container.WorkingDir = "/var/www/html"
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, cronJob, r.Scheme); err != nil {
+		return nil
+	}
+
+	return cronJob
+}
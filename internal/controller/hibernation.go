@@ -0,0 +1,283 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// wakeAnnotation wakes a hibernated tenant when set to a time after it was hibernated,
+// in RFC 3339. The activator sets it on the first request to the hibernated site.
+const wakeAnnotation = "moodle.bsu.by/wake"
+
+// idleCheckInterval is how often the last access of an awake tenant is checked
+const idleCheckInterval = 6 * time.Hour
+
+// idleCheckScript writes the last access of any user to the site, as a Unix time, to the
+// termination message of the pod
+const idleCheckScript = `set -e
+php > /dev/termination-log <<'PHP'
+<?php
+define('CLI_SCRIPT', true);
+require '/var/www/html/config.php';
+echo (int) $DB->get_field_sql('SELECT MAX(lastaccess) FROM {user} WHERE deleted = 0');
+PHP
+`
+
+// hibernated reports whether the tenant is hibernated
+func hibernated(mt *moodlev1alpha1.MoodleTenant) bool {
+	return mt.Spec.Hibernation != nil && mt.Status.Hibernation != nil && mt.Status.Hibernation.Hibernated
+}
+
+// parked reports whether Moodle and cron are scaled to zero behind a static page, because
+// the tenant is suspended or hibernated
+func parked(mt *moodlev1alpha1.MoodleTenant) bool {
+	return mt.Spec.Suspended || hibernated(mt)
+}
+
+// wakeOnRequest reports whether a request to the hibernated site wakes the tenant
+func wakeOnRequest(mt *moodlev1alpha1.MoodleTenant) bool {
+	return mt.Spec.Hibernation != nil && ptr.Deref(mt.Spec.Hibernation.WakeOnRequest, true)
+}
+
+// wakeRequested reports whether the wake annotation asks for the hibernated tenant to be woken
+func wakeRequested(mt *moodlev1alpha1.MoodleTenant) bool {
+	value, ok := mt.Annotations[wakeAnnotation]
+	if !ok || mt.Status.Hibernation == nil || mt.Status.Hibernation.HibernationTime == nil {
+		return false
+	}
+	requested, err := time.Parse(time.RFC3339, value)
+	return err == nil && requested.After(mt.Status.Hibernation.HibernationTime.Time)
+}
+
+// idleCheckJobName returns the name of the Job checking the last access of the tenant
+func idleCheckJobName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-idle-check"
+}
+
+// reconcileHibernation hibernates the tenant once the last access of any user, checked by
+// a Job every idleCheckInterval while Moodle can run, is older than idleDays, and wakes it
+// when requested. The state is reported in the Hibernated condition.
+func (r *MoodleTenantReconciler) reconcileHibernation(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string, ready bool) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Spec.Hibernation == nil {
+		if hibernated := mt.Status.Hibernation; hibernated != nil && hibernated.CheckJobName != "" {
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: hibernated.CheckJobName, Namespace: namespace}}
+			if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "Failed to delete idle check Job", "Job.Namespace", namespace, "Job.Name", job.Name)
+				return err
+			}
+		}
+		mt.Status.Hibernation = nil
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionHibernated)
+		return nil
+	}
+
+	status := mt.Status.Hibernation
+	if status == nil {
+		status = &moodlev1alpha1.HibernationStatus{}
+		mt.Status.Hibernation = status
+	}
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionHibernated,
+		ObservedGeneration: mt.Generation,
+	}
+
+	if status.Hibernated {
+		if !wakeRequested(mt) {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "Idle"
+			condition.Message = fmt.Sprintf("No user has accessed the site for %d days, Moodle and cron are scaled to zero", idleDays(mt))
+			meta.SetStatusCondition(&mt.Status.Conditions, condition)
+			return nil
+		}
+		logger.Info("Waking the hibernated tenant", "Name", mt.Name)
+		status.Hibernated = false
+		status.WakeTime = ptr.To(metav1.Now())
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Woken"
+		condition.Message = fmt.Sprintf("The tenant was woken at %s", status.WakeTime.UTC().Format(time.RFC3339))
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	// The check runs the Moodle container, which needs its database
+	if !ready {
+		return nil
+	}
+
+	if status.CheckJobName == "" {
+		if status.LastCheckTime != nil && time.Since(status.LastCheckTime.Time) < idleCheckInterval {
+			return nil
+		}
+		job, err := r.idleCheckJobForMoodle(mt, namespace)
+		if err != nil {
+			return fmt.Errorf("failed to build the idle check Job: %w", err)
+		}
+		err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, &batchv1.Job{})
+		if err != nil && errors.IsNotFound(err) {
+			logger.Info("Creating a new idle check Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			if err := r.Create(ctx, job); err != nil {
+				logger.Error(err, "Failed to create new idle check Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+				return err
+			}
+		} else if err != nil {
+			logger.Error(err, "Failed to get idle check Job")
+			return err
+		}
+		status.CheckJobName = job.Name
+		return nil
+	}
+
+	name := status.CheckJobName
+	found := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get idle check Job")
+		return err
+	}
+	if err == nil && found.Status.Succeeded == 0 && !jobFailed(found) {
+		return nil
+	}
+
+	var lastAccess *time.Time
+	if err == nil && found.Status.Succeeded > 0 {
+		if lastAccess, err = r.idleCheckResult(ctx, found); err != nil {
+			return err
+		}
+	}
+	if err == nil {
+		if err := r.Delete(ctx, found, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete idle check Job", "Job.Namespace", namespace, "Job.Name", found.Name)
+			return err
+		}
+	}
+	status.CheckJobName = ""
+	status.LastCheckTime = ptr.To(metav1.Now())
+
+	if lastAccess == nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "CheckFailed"
+		condition.Message = fmt.Sprintf("Idle check Job %s failed to find the last access; it is retried in %s", name, idleCheckInterval)
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+	status.LastAccessTime = ptr.To(metav1.NewTime(*lastAccess))
+
+	// A new or just woken site is given idleDays before it is hibernated
+	active := *lastAccess
+	for _, since := range []*metav1.Time{&mt.CreationTimestamp, status.WakeTime} {
+		if since != nil && since.After(active) {
+			active = since.Time
+		}
+	}
+	idle := time.Duration(idleDays(mt)) * 24 * time.Hour
+	if time.Since(active) < idle {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Active"
+		condition.Message = fmt.Sprintf("The site was last active at %s and is hibernated after %d idle days", active.UTC().Format(time.RFC3339), idleDays(mt))
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	logger.Info("Hibernating the idle tenant", "Name", mt.Name, "LastActive", active)
+	status.Hibernated = true
+	status.HibernationTime = ptr.To(metav1.Now())
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = "Idle"
+	condition.Message = fmt.Sprintf("No user has accessed the site for %d days, Moodle and cron are scaled to zero", idleDays(mt))
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	return nil
+}
+
+// idleDays returns the idle days after which the tenant is hibernated
+func idleDays(mt *moodlev1alpha1.MoodleTenant) int32 {
+	if mt.Spec.Hibernation.IdleDays > 0 {
+		return mt.Spec.Hibernation.IdleDays
+	}
+	return 30
+}
+
+// idleCheckResult returns the last access written by the succeeded idle check Job, or nil
+// if no pod reported it
+func (r *MoodleTenantReconciler) idleCheckResult(ctx context.Context, job *batchv1.Job) (*time.Time, error) {
+	reader := client.Reader(r.Client)
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+
+	pods := &corev1.PodList{}
+	if err := reader.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"batch.kubernetes.io/job-name": job.Name}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list idle check pods")
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name != "moodle-idle-check" || status.State.Terminated == nil || status.State.Terminated.ExitCode != 0 {
+				continue
+			}
+			seconds, err := strconv.ParseInt(strings.TrimSpace(status.State.Terminated.Message), 10, 64)
+			if err != nil {
+				continue
+			}
+			lastAccess := time.Unix(seconds, 0)
+			return &lastAccess, nil
+		}
+	}
+	return nil, nil
+}
+
+// hibernationRequeue returns when the last access of the awake tenant is checked next, or
+// zero without hibernation
+func hibernationRequeue(mt *moodlev1alpha1.MoodleTenant) time.Duration {
+	status := mt.Status.Hibernation
+	if mt.Spec.Hibernation == nil || status == nil || status.Hibernated || status.LastCheckTime == nil {
+		return 0
+	}
+	return max(time.Until(status.LastCheckTime.Add(idleCheckInterval)), 0) + time.Second
+}
+
+// idleCheckJobForMoodle returns the Job checking the last access to the site. Like the
+// upgrade Job it runs the Moodle container of the Deployment.
+func (r *MoodleTenantReconciler) idleCheckJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) (*batchv1.Job, error) {
+	job, err := r.cliJobForMoodle(mt, namespace, idleCheckJobName(mt), "idle-check", []string{"sh", "-c", idleCheckScript})
+	if err != nil {
+		return nil, err
+	}
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.TerminationMessagePath = corev1.TerminationMessagePathDefault
+	container.TerminationMessagePolicy = corev1.TerminationMessageReadFile
+
+	return job, nil
+}
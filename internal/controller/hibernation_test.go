@@ -0,0 +1,111 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Hibernation", func() {
+	It("should hibernate an idle tenant and wake it on request", func() {
+		ctx := context.Background()
+
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme(), ActivatorURL: "http://activator.operator.svc:8082"}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              "archive",
+				UID:               "archive-uid",
+				CreationTimestamp: metav1.NewTime(time.Now().Add(-100 * 24 * time.Hour)),
+			},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Image:       "moodle:4.5.2",
+				Hibernation: &moodlev1alpha1.HibernationSpec{IdleDays: 30},
+			},
+		}
+		namespace := "tenant-archive"
+
+		// The last access is checked by a Job reporting it in its termination message
+		Expect(reconciler.reconcileHibernation(ctx, mt, namespace, true)).To(Succeed())
+		Expect(mt.Status.Hibernation.CheckJobName).To(Equal("archive-idle-check"))
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "archive-idle-check", Namespace: namespace}, job)).To(Succeed())
+		job.Status.Succeeded = 1
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+		lastAccess := time.Now().Add(-60 * 24 * time.Hour).Truncate(time.Second)
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "archive-idle-check-x",
+				Namespace: namespace,
+				Labels:    map[string]string{"batch.kubernetes.io/job-name": "archive-idle-check"},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name: "moodle-idle-check",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+						Message: strconv.FormatInt(lastAccess.Unix(), 10) + "\n",
+					}},
+				}},
+			},
+		}
+		Expect(c.Create(ctx, pod)).To(Succeed())
+
+		Expect(reconciler.reconcileHibernation(ctx, mt, namespace, true)).To(Succeed())
+		Expect(mt.Status.Hibernation.Hibernated).To(BeTrue())
+		Expect(mt.Status.Hibernation.LastAccessTime.Time.Equal(lastAccess)).To(BeTrue())
+		Expect(mt.Status.Hibernation.CheckJobName).To(BeEmpty())
+		Expect(meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionHibernated)).To(BeTrue())
+		Expect(*reconciler.deploymentForMoodle(mt, namespace).Spec.Replicas).To(BeZero())
+		Expect(cronSuspendedReason(mt)).To(Equal("the tenant is hibernated"))
+		Expect(reconciler.maintenancePageData(mt)["default.conf"]).To(ContainSubstring("proxy_pass http://activator.operator.svc:8082;"))
+
+		// A request through the hibernated page wakes it
+		mt.Namespace = "default"
+		Expect(reconciler.maintenancePageData(mt)["default.conf"]).To(ContainSubstring("rewrite ^ /wake/default/archive break;"))
+		Expect(c.Create(ctx, mt.DeepCopy())).To(Succeed())
+		recorder := httptest.NewRecorder()
+		ActivatorHandler(c).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/wake/default/archive", nil))
+		Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		woken := &moodlev1alpha1.MoodleTenant{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "archive", Namespace: "default"}, woken)).To(Succeed())
+		Expect(woken.Annotations).To(HaveKey(wakeAnnotation))
+
+		// The wake annotation is only honoured once it is newer than the hibernation, which
+		// is recorded in seconds
+		mt.Annotations = woken.Annotations
+		mt.Status.Hibernation.HibernationTime = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+		Expect(reconciler.reconcileHibernation(ctx, mt, namespace, true)).To(Succeed())
+		Expect(mt.Status.Hibernation.Hibernated).To(BeFalse())
+		Expect(meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionHibernated).Reason).To(Equal("Woken"))
+		Expect(parked(mt)).To(BeFalse())
+	})
+})
@@ -0,0 +1,115 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// housekeepingScript removes the files of a directory that have not changed for the
+// given number of minutes, then the directories left empty. Directories that do not
+// exist yet are skipped.
+const housekeepingScript = `clean() {
+  [ -d "$1" ] || return 0
+  find "$1" -mindepth 1 -type f -mmin "+$2" -delete
+  find "$1" -mindepth 1 -type d -empty -mmin "+$2" -delete
+}
+clean "${MOODLE_TEMP_DIR:-/var/www/moodledata/temp}" %d
+clean "${MOODLE_TRASH_DIR:-/var/www/moodledata/trashdir}" %d
+clean /var/www/moodledata/sessions %d
+`
+
+// housekeepingName returns the name of the housekeeping CronJob
+func housekeepingName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-housekeeping"
+}
+
+// reconcileHousekeeping creates the housekeeping CronJob of spec.housekeeping, or removes
+// it when housekeeping is turned off
+func (r *MoodleTenantReconciler) reconcileHousekeeping(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Spec.Housekeeping == nil {
+		cronJob := &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: housekeepingName(mt), Namespace: namespace}}
+		if err := r.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete housekeeping CronJob", "CronJob.Namespace", namespace, "CronJob.Name", cronJob.Name)
+			return err
+		}
+		return nil
+	}
+
+	cronJob := r.housekeepingCronJobForMoodle(mt, namespace)
+	if cronJob == nil {
+		return fmt.Errorf("failed to build the housekeeping CronJob")
+	}
+	return r.reconcileObject(ctx, mt, cronJob, &batchv1.CronJob{})
+}
+
+// housekeepingCronJobForMoodle returns the housekeeping CronJob. It runs the cron pod, so
+// it mounts moodledata and the volume of the storage layout where the directories are.
+// Directories on an emptyDir of the storage layout belong to their pods and are not
+// cleaned.
+func (r *MoodleTenantReconciler) housekeepingCronJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *batchv1.CronJob {
+	housekeeping := mt.Spec.Housekeeping
+	schedule := housekeeping.Schedule
+	if schedule == "" {
+		schedule = "30 3 * * *"
+	}
+	hours := func(value, fallback int32) int32 {
+		if value == 0 {
+			value = fallback
+		}
+		return value * 60
+	}
+
+	cronJob := moodleCronJob(mt, namespace)
+	cronJob.Name = housekeepingName(mt)
+	cronJob.Labels = map[string]string{
+		"moodle.bsu.by/tenant": mt.Name,
+		"moodle.bsu.by/job":    "housekeeping",
+	}
+	cronJob.Spec.Schedule = schedule
+	cronJob.Spec.JobTemplate.Spec.Parallelism = nil
+	cronJob.Spec.JobTemplate.Spec.Completions = nil
+
+	container := &cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0]
+	container.Name = "moodle-housekeeping"
+	container.Command = []string{
+		"/bin/sh", "-c",
+		fmt.Sprintf(housekeepingScript,
+			hours(housekeeping.TempRetentionHours, 24),
+			hours(housekeeping.TrashRetentionHours, 96),
+			hours(housekeeping.SessionRetentionHours, 24)),
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, cronJob, r.Scheme); err != nil {
+		return nil
+	}
+
+	return cronJob
+}
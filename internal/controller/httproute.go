@@ -0,0 +1,120 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+
+// httpRouteGVK is the Gateway API HTTPRoute kind, handled as an unstructured object
+var httpRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1", Kind: "HTTPRoute"}
+
+// routingModeGateway routes traffic through a Gateway API HTTPRoute instead of an Ingress
+const routingModeGateway = "gateway"
+
+// reconcileHTTPRoute creates or updates the HTTPRoute in gateway mode and removes it otherwise
+func (r *MoodleTenantReconciler) reconcileHTTPRoute(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	// Clean up a route left over from gateway mode
+	if mt.Spec.Routing.Mode != routingModeGateway {
+		return r.deleteUnstructured(ctx, httpRouteGVK, namespace, mt.Name+"-route")
+	}
+
+	_, err := r.reconcileUnstructured(ctx, r.httpRouteForMoodle(mt, namespace))
+	return err
+}
+
+// httpRouteForMoodle returns an HTTPRoute attaching the tenant hostnames to the configured Gateway
+func (r *MoodleTenantReconciler) httpRouteForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	gatewayRef := mt.Spec.Routing.GatewayRef
+
+	parentRef := map[string]interface{}{
+		"name": gatewayRef.Name,
+	}
+	if gatewayRef.Namespace != "" {
+		parentRef["namespace"] = gatewayRef.Namespace
+	}
+	if gatewayRef.SectionName != "" {
+		parentRef["sectionName"] = gatewayRef.SectionName
+	}
+
+	hostnames := []interface{}{}
+	for _, hostname := range tenantHostnames(mt) {
+		hostnames = append(hostnames, hostname)
+	}
+
+	rule := map[string]interface{}{
+		"matches": []interface{}{
+			map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":  "PathPrefix",
+					"value": "/",
+				},
+			},
+		},
+		"backendRefs": []interface{}{
+			map[string]interface{}{
+				"name": ingressBackendService(mt),
+				"port": int64(80),
+			},
+		},
+	}
+
+	// Serve the tenant under its path prefix, which is passed on to Moodle
+	if prefix := mt.Spec.Routing.PathPrefix; prefix != "" {
+		rule["matches"] = []interface{}{
+			map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":  "PathPrefix",
+					"value": prefix,
+				},
+			},
+		}
+	}
+
+	route := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"parentRefs": []interface{}{parentRef},
+				"hostnames":  hostnames,
+				"rules":      []interface{}{rule},
+			},
+		},
+	}
+	route.SetGroupVersionKind(httpRouteGVK)
+	route.SetName(mt.Name + "-route")
+	route.SetNamespace(namespace)
+	route.SetLabels(map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+	route.SetAnnotations(externalDNSAnnotations(mt))
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, route, r.Scheme); err != nil {
+		return nil
+	}
+
+	return route
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+
+const (
+	// databaseIAMProviderAWS authenticates to RDS with tokens from the AWS CLI
+	databaseIAMProviderAWS = "aws"
+	// databaseIAMProviderGCP authenticates to Cloud SQL through the Cloud SQL Auth Proxy
+	databaseIAMProviderGCP = "gcp"
+)
+
+// databaseTokenPath is where the RDS token refresher writes the current token
+const databaseTokenPath = "/var/run/moodle-db"
+
+// databaseIAMServiceAccountName returns the ServiceAccount bound to the cloud identity
+func databaseIAMServiceAccountName(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.DatabaseRef.IAM.ServiceAccountName != "" {
+		return mt.Spec.DatabaseRef.IAM.ServiceAccountName
+	}
+	return mt.Name + "-db-iam"
+}
+
+// cloudSQLProxyEnabled reports whether Moodle reaches the database through the Cloud SQL Auth Proxy
+func cloudSQLProxyEnabled(mt *moodlev1alpha1.MoodleTenant) bool {
+	return mt.Spec.DatabaseRef.IAM != nil && mt.Spec.DatabaseRef.IAM.Provider == databaseIAMProviderGCP
+}
+
+// reconcileDatabaseIAM creates the ServiceAccount bound to the cloud identity unless an
+// existing one is referenced, and removes it when IAM authentication is disabled
+func (r *MoodleTenantReconciler) reconcileDatabaseIAM(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	iam := mt.Spec.DatabaseRef.IAM
+	if iam == nil || iam.ServiceAccountName != "" {
+		serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: mt.Name + "-db-iam", Namespace: namespace}}
+		if err := r.Delete(ctx, serviceAccount); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete database ServiceAccount", "ServiceAccount.Namespace", namespace, "ServiceAccount.Name", serviceAccount.Name)
+			return err
+		}
+		return nil
+	}
+
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      databaseIAMServiceAccountName(mt),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":                  "moodle",
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+			Annotations: map[string]string{},
+		},
+	}
+	if iam.RoleARN != "" {
+		serviceAccount.Annotations["eks.amazonaws.com/role-arn"] = iam.RoleARN
+	}
+	if iam.GCPServiceAccount != "" {
+		serviceAccount.Annotations["iam.gke.io/gcp-service-account"] = iam.GCPServiceAccount
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, serviceAccount, r.Scheme); err != nil {
+		return err
+	}
+
+	found := &corev1.ServiceAccount{}
+	err := r.Get(ctx, types.NamespacedName{Name: serviceAccount.Name, Namespace: serviceAccount.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new ServiceAccount", "ServiceAccount.Namespace", serviceAccount.Namespace, "ServiceAccount.Name", serviceAccount.Name)
+		if err := r.Create(ctx, serviceAccount); err != nil {
+			logger.Error(err, "Failed to create new ServiceAccount", "ServiceAccount.Namespace", serviceAccount.Namespace, "ServiceAccount.Name", serviceAccount.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get ServiceAccount")
+		return err
+	}
+
+	annotations := mergeStringMaps(found.Annotations, serviceAccount.Annotations)
+	if !reflect.DeepEqual(annotations, found.Annotations) {
+		found.Annotations = annotations
+		logger.Info("Updating ServiceAccount", "ServiceAccount.Namespace", found.Namespace, "ServiceAccount.Name", found.Name)
+		if err := r.Update(ctx, found); err != nil {
+			logger.Error(err, "Failed to update ServiceAccount", "ServiceAccount.Namespace", found.Namespace, "ServiceAccount.Name", found.Name)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyDatabaseIAM runs the pod under the workload identity and adds the sidecar that
+// authenticates the first container to the database. The sidecars are native sidecars
+// whose startup probes hold back Moodle until the database can be reached, and which do
+// not keep cron Jobs from completing.
+func applyDatabaseIAM(mt *moodlev1alpha1.MoodleTenant, podSpec *corev1.PodSpec, passwordFileEnv string) {
+	iam := mt.Spec.DatabaseRef.IAM
+	if iam == nil {
+		return
+	}
+
+	podSpec.ServiceAccountName = databaseIAMServiceAccountName(mt)
+	port := fmt.Sprintf("%d", databasePort(mt))
+
+	switch iam.Provider {
+	case databaseIAMProviderGCP:
+		image := "gcr.io/cloud-sql-connectors/cloud-sql-proxy:2.14.1"
+		if iam.Image != "" {
+			image = iam.Image
+		}
+		podSpec.InitContainers = append(podSpec.InitContainers, corev1.Container{
+			Name:          "cloud-sql-proxy",
+			Image:         image,
+			RestartPolicy: ptr.To(corev1.ContainerRestartPolicyAlways),
+			Args: []string{
+				"--auto-iam-authn",
+				"--port", port,
+				"--health-check",
+				"--http-address", "0.0.0.0",
+				"--structured-logs",
+				iam.InstanceConnectionName,
+			},
+			StartupProbe: &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					HTTPGet: &corev1.HTTPGetAction{
+						Path: "/startup",
+						Port: intstr.FromInt(9090),
+					},
+				},
+				PeriodSeconds:    2,
+				FailureThreshold: 30,
+			},
+		})
+
+	case databaseIAMProviderAWS:
+		image := "amazon/aws-cli:2.22.0"
+		if iam.Image != "" {
+			image = iam.Image
+		}
+		// RDS tokens are valid for 15 minutes; config.php reads the current one per request
+		script := fmt.Sprintf(`while true; do
+  aws rds generate-db-auth-token --hostname "$DB_HOST" --port "$DB_PORT" --region "$AWS_REGION" --username "$DB_USER" > %[1]s/token.tmp && mv %[1]s/token.tmp %[1]s/token
+  sleep 600
+done`, databaseTokenPath)
+
+		tokenMount := corev1.VolumeMount{
+			Name:      "db-token",
+			MountPath: databaseTokenPath,
+		}
+		podSpec.InitContainers = append(podSpec.InitContainers, corev1.Container{
+			Name:          "rds-token-refresher",
+			Image:         image,
+			RestartPolicy: ptr.To(corev1.ContainerRestartPolicyAlways),
+			Command:       []string{"sh", "-c", script},
+			Env: []corev1.EnvVar{
+				databaseHostEnv(mt, "DB_HOST"),
+				{Name: "DB_PORT", Value: port},
+				{Name: "DB_USER", Value: mt.Spec.DatabaseRef.User},
+				{Name: "AWS_REGION", Value: iam.Region},
+				{Name: "HOME", Value: "/tmp"},
+			},
+			VolumeMounts: []corev1.VolumeMount{tokenMount},
+			StartupProbe: &corev1.Probe{
+				ProbeHandler: corev1.ProbeHandler{
+					Exec: &corev1.ExecAction{
+						Command: []string{"test", "-s", databaseTokenPath + "/token"},
+					},
+				},
+				PeriodSeconds:    2,
+				FailureThreshold: 30,
+			},
+		})
+
+		container := &podSpec.Containers[0]
+		tokenMount.ReadOnly = true
+		container.VolumeMounts = append(container.VolumeMounts, tokenMount)
+		container.Env = append(container.Env, corev1.EnvVar{Name: passwordFileEnv, Value: databaseTokenPath + "/token"})
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: "db-token",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+			},
+		})
+	}
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// nginxAnnotationPrefix is the prefix of the ingress-nginx annotations
+const nginxAnnotationPrefix = "nginx.ingress.kubernetes.io/"
+
+// ingressRulesForMoodle returns Ingress rules routing the given hostnames to the tenant Service
+func ingressRulesForMoodle(mt *moodlev1alpha1.MoodleTenant, hostnames []string) []networkingv1.IngressRule {
+	// Requests keep the path prefix, which nginx in the pod serves Moodle under
+	path := "/"
+	if mt.Spec.Routing.PathPrefix != "" {
+		path = mt.Spec.Routing.PathPrefix
+	}
+	pathType := networkingv1.PathTypePrefix
+
+	port := int32(80)
+	if backendTLSEnabled(mt) {
+		port = 443
+	}
+
+	rules := []networkingv1.IngressRule{}
+	for _, hostname := range hostnames {
+		rules = append(rules, networkingv1.IngressRule{
+			Host: hostname,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{
+					Paths: []networkingv1.HTTPIngressPath{
+						{
+							Path:     path,
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: ingressBackendService(mt),
+									Port: networkingv1.ServiceBackendPort{
+										Number: port,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+	}
+	return rules
+}
+
+// reconcileAdminIngress creates or updates the internal admin Ingress and removes it
+// when no admin hostname is configured
+func (r *MoodleTenantReconciler) reconcileAdminIngress(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Spec.Ingress.Admin == nil {
+		ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: mt.Name + "-admin-ingress", Namespace: namespace}}
+		if err := r.Delete(ctx, ingress); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete admin Ingress", "Ingress.Namespace", ingress.Namespace, "Ingress.Name", ingress.Name)
+			return err
+		}
+		return nil
+	}
+
+	ingress := r.adminIngressForMoodle(mt, namespace)
+
+	// Check if the admin Ingress already exists
+	found := &networkingv1.Ingress{}
+	err := r.Get(ctx, types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new admin Ingress", "Ingress.Namespace", ingress.Namespace, "Ingress.Name", ingress.Name)
+		if err := r.markApplied(mt, ingress); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, ingress); err != nil {
+			logger.Error(err, "Failed to create new admin Ingress", "Ingress.Namespace", ingress.Namespace, "Ingress.Name", ingress.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get admin Ingress")
+		return err
+	}
+
+	return r.correctDrift(ctx, mt, ingress, found)
+}
+
+// adminIngressForMoodle returns the Ingress serving the admin hostname on the internal ingress class
+func (r *MoodleTenantReconciler) adminIngressForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *networkingv1.Ingress {
+	admin := mt.Spec.Ingress.Admin
+
+	ingressClassName := "nginx-internal"
+	if admin.IngressClassName != "" {
+		ingressClassName = admin.IngressClassName
+	}
+
+	annotations := mergeStringMaps(certificateAnnotations(mt), securityAnnotations(mt))
+	annotations = mergeStringMaps(annotations, proxyAnnotations(mt))
+	annotations = mergeStringMaps(annotations, backendTLSAnnotations(mt, namespace))
+	if len(admin.AllowedSourceRanges) > 0 {
+		annotations[nginxAnnotationPrefix+"whitelist-source-range"] = strings.Join(admin.AllowedSourceRanges, ",")
+	}
+	annotations = r.withoutSnippets(mt, annotations)
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mt.Name + "-admin-ingress",
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":                  "moodle",
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+			Annotations: annotations,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &ingressClassName,
+			TLS: []networkingv1.IngressTLS{
+				{
+					Hosts:      []string{admin.Hostname},
+					SecretName: adminTLSSecretName(mt),
+				},
+			},
+			Rules: ingressRulesForMoodle(mt, []string{admin.Hostname}),
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, ingress, r.Scheme); err != nil {
+		return nil
+	}
+
+	return ingress
+}
+
+// adminRestrictionAnnotations returns the ingress-nginx annotations blocking /admin on the
+// public hostnames when the site is administered through the admin Ingress
+func adminRestrictionAnnotations(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	if mt.Spec.Ingress.Admin == nil {
+		return nil
+	}
+
+	return map[string]string{
+		nginxAnnotationPrefix + "server-snippet": fmt.Sprintf("location ~ ^%s/admin(/|$) {\n  return 403;\n}\n", mt.Spec.Routing.PathPrefix),
+	}
+}
+
+// withoutSnippets removes the snippet annotations unless the operator runs with
+// --allow-snippet-annotations. ingress-nginx rejects Ingresses carrying them unless the
+// controller enables allow-snippet-annotations, which is off by default since 1.9, so the
+// features relying on them are reported by a SnippetAnnotationsDisabled event instead.
+func (r *MoodleTenantReconciler) withoutSnippets(mt *moodlev1alpha1.MoodleTenant, annotations map[string]string) map[string]string {
+	if r.AllowSnippetAnnotations {
+		return annotations
+	}
+
+	snippets := []string{}
+	for key := range annotations {
+		if strings.HasSuffix(key, "-snippet") {
+			snippets = append(snippets, key)
+		}
+	}
+	if len(snippets) == 0 {
+		return annotations
+	}
+	sort.Strings(snippets)
+
+	r.warn(mt, "SnippetAnnotationsDisabled", fmt.Sprintf(
+		"%s not set on the Ingress: the operator runs without --allow-snippet-annotations", strings.Join(snippets, ", ")))
+	return withoutKeys(annotations, snippets)
+}
+
+// protectionAnnotations returns the ingress-nginx annotations for rate limiting and ModSecurity
+func protectionAnnotations(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	protection := mt.Spec.Ingress.Protection
+	annotations := map[string]string{}
+
+	if protection.RateLimit != nil {
+		annotations[nginxAnnotationPrefix+"limit-rps"] = strconv.Itoa(int(protection.RateLimit.RPS))
+		if protection.RateLimit.BurstMultiplier != nil {
+			annotations[nginxAnnotationPrefix+"limit-burst-multiplier"] = strconv.Itoa(int(*protection.RateLimit.BurstMultiplier))
+		}
+	}
+
+	if protection.WAF.Enabled {
+		annotations[nginxAnnotationPrefix+"enable-modsecurity"] = "true"
+		annotations[nginxAnnotationPrefix+"enable-owasp-core-rules"] = strconv.FormatBool(protection.WAF.OWASPCoreRules)
+		if protection.WAF.DetectionOnly {
+			annotations[nginxAnnotationPrefix+"modsecurity-snippet"] = "SecRuleEngine DetectionOnly"
+		} else {
+			annotations[nginxAnnotationPrefix+"modsecurity-snippet"] = "SecRuleEngine On"
+		}
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// securityAnnotations returns the ingress-nginx annotations for HTTPS redirection and security headers
+func securityAnnotations(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	security := mt.Spec.Ingress.Security
+	annotations := map[string]string{}
+
+	if security.SSLRedirect != nil {
+		annotations[nginxAnnotationPrefix+"ssl-redirect"] = strconv.FormatBool(*security.SSLRedirect)
+	}
+
+	snippet := []string{}
+	if security.HSTS != nil {
+		hsts := fmt.Sprintf("max-age=%d", security.HSTS.MaxAge)
+		if security.HSTS.IncludeSubDomains {
+			hsts += "; includeSubDomains"
+		}
+		if security.HSTS.Preload {
+			hsts += "; preload"
+		}
+		snippet = append(snippet, fmt.Sprintf(`more_set_headers "Strict-Transport-Security: %s";`, hsts))
+	}
+	if security.Headers {
+		snippet = append(snippet,
+			`more_set_headers "X-Content-Type-Options: nosniff";`,
+			`more_set_headers "Referrer-Policy: strict-origin-when-cross-origin";`)
+		if len(security.FrameAncestors) == 0 {
+			snippet = append(snippet, `more_set_headers "X-Frame-Options: SAMEORIGIN";`)
+		}
+	}
+	// X-Frame-Options cannot list origins, so embedding is allowed through CSP instead
+	if len(security.FrameAncestors) > 0 {
+		snippet = append(snippet,
+			`more_clear_headers "X-Frame-Options";`,
+			fmt.Sprintf(`more_set_headers "Content-Security-Policy: frame-ancestors 'self' %s";`, strings.Join(security.FrameAncestors, " ")))
+	}
+	if len(snippet) > 0 {
+		annotations[nginxAnnotationPrefix+"configuration-snippet"] = strings.Join(snippet, "\n") + "\n"
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// proxyAnnotations returns the ingress-nginx proxy limits. They follow the PHP settings so
+// that the Ingress never rejects an upload or times out a request PHP would accept.
+func proxyAnnotations(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	proxy := mt.Spec.Ingress.Proxy
+
+	bodySize := phpUploadMaxFilesize(mt)
+	if proxy.BodySize != "" {
+		bodySize = proxy.BodySize
+	}
+
+	timeout := strconv.Itoa(proxyReadTimeout(mt))
+
+	return map[string]string{
+		nginxAnnotationPrefix + "proxy-body-size":    bodySize,
+		nginxAnnotationPrefix + "proxy-read-timeout": timeout,
+		nginxAnnotationPrefix + "proxy-send-timeout": timeout,
+	}
+}
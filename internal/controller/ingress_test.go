@@ -0,0 +1,74 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Ingress", func() {
+	var (
+		reconciler *MoodleTenantReconciler
+		mt         *moodlev1alpha1.MoodleTenant
+	)
+
+	BeforeEach(func() {
+		reconciler = &MoodleTenantReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		mt = &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "biology.bsu.by",
+				Ingress: moodlev1alpha1.IngressSpec{
+					Security: moodlev1alpha1.IngressSecuritySpec{Headers: true},
+					Admin:    &moodlev1alpha1.AdminIngressSpec{Hostname: "admin.biology.bsu.by"},
+				},
+				TLS:         moodlev1alpha1.TLSSpec{IssuerRef: &moodlev1alpha1.IssuerRefSpec{Name: "letsencrypt", Kind: "ClusterIssuer"}},
+				ExternalDNS: &moodlev1alpha1.ExternalDNSSpec{Mode: externalDNSModeDNSEndpoint, Targets: []string{"192.0.2.10"}},
+			},
+		}
+	})
+
+	It("should only set snippet annotations when the operator allows them", func() {
+		Expect(reconciler.ingressForMoodle(mt, "tenant-biology").Annotations).NotTo(HaveKey(nginxAnnotationPrefix + "configuration-snippet"))
+		Expect(reconciler.ingressForMoodle(mt, "tenant-biology").Annotations).NotTo(HaveKey(nginxAnnotationPrefix + "server-snippet"))
+		Expect(reconciler.adminIngressForMoodle(mt, "tenant-biology").Annotations).NotTo(HaveKey(nginxAnnotationPrefix + "configuration-snippet"))
+
+		reconciler.AllowSnippetAnnotations = true
+		Expect(reconciler.ingressForMoodle(mt, "tenant-biology").Annotations).To(HaveKey(nginxAnnotationPrefix + "configuration-snippet"))
+		Expect(reconciler.ingressForMoodle(mt, "tenant-biology").Annotations).To(HaveKey(nginxAnnotationPrefix + "server-snippet"))
+		Expect(reconciler.adminIngressForMoodle(mt, "tenant-biology").Annotations).To(HaveKey(nginxAnnotationPrefix + "configuration-snippet"))
+	})
+
+	It("should issue the certificate and publish the record of the admin hostname", func() {
+		dnsNames, _, _ := unstructured.NestedStringSlice(reconciler.certificateForMoodle(mt, "tenant-biology").Object, "spec", "dnsNames")
+		Expect(dnsNames).To(ConsistOf("biology.bsu.by", "admin.biology.bsu.by"))
+
+		endpoints, _, _ := unstructured.NestedSlice(reconciler.dnsEndpointForMoodle(mt, "tenant-biology").Object, "spec", "endpoints")
+		Expect(endpoints).To(HaveLen(2))
+		Expect(endpoints[1]).To(HaveKeyWithValue("dnsName", "admin.biology.bsu.by"))
+
+		mt.Spec.TLS.Mode = tlsModeIngressAnnotations
+		admin := reconciler.adminIngressForMoodle(mt, "tenant-biology")
+		Expect(admin.Annotations).To(HaveKeyWithValue("cert-manager.io/cluster-issuer", "letsencrypt"))
+		Expect(admin.Spec.TLS[0].SecretName).To(Equal("biology-admin-tls"))
+	})
+})
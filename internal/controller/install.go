@@ -0,0 +1,227 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// installScript installs Moodle into the database. A database that already holds the
+// tables of the site, e.g. a restored one, counts as installed.
+const installScript = `if output=$(php /var/www/html/admin/cli/install_database.php --agree-license \
+    --lang="$INSTALL_LANG" --adminuser="$INSTALL_ADMIN_USER" --adminpass="$INSTALL_ADMIN_PASSWORD" \
+    --adminemail="$INSTALL_ADMIN_EMAIL" --fullname="$INSTALL_SITE_NAME" --shortname="$INSTALL_SHORT_NAME" \
+    --summary="$INSTALL_SUMMARY" --supportemail="$INSTALL_SUPPORT_EMAIL" 2>&1); then
+  echo "$output"
+  exit 0
+fi
+echo "$output"
+case "$output" in
+  *"tables already present"*) exit 0 ;;
+esac
+exit 1
+`
+
+// installAdminSecretName returns the name of the Secret with the administrator password
+// in the tenant namespace
+func installAdminSecretName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-admin"
+}
+
+// reconcileInstall runs the install Job of spec.install once the database is ready and
+// restored, and reports whether Moodle may start. The Installed condition records a
+// finished installation, which is never repeated.
+func (r *MoodleTenantReconciler) reconcileInstall(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string, databaseRestored bool) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	install := mt.Spec.Install
+	if install == nil || meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionInstalled) {
+		return true, nil
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionInstalled,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "WaitingForDatabase",
+		Message:            "Waiting for the database before installing Moodle",
+		ObservedGeneration: mt.Generation,
+	}
+	if !databaseReady(mt) || !databaseRestored {
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return false, nil
+	}
+
+	if err := r.reconcileInstallAdminSecret(ctx, mt, namespace); err != nil {
+		return false, err
+	}
+
+	job, err := r.installJobForMoodle(mt, namespace)
+	if err != nil {
+		return false, fmt.Errorf("failed to build the install Job: %w", err)
+	}
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new install Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new install Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return false, err
+		}
+		found = job
+	} else if err != nil {
+		logger.Error(err, "Failed to get install Job")
+		return false, err
+	}
+
+	condition.Reason = "Installing"
+	condition.Message = fmt.Sprintf("Job %s is installing Moodle", found.Name)
+	switch {
+	case found.Status.Succeeded > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Installed"
+		condition.Message = fmt.Sprintf("Moodle is installed as %s", install.SiteName)
+	case jobFailed(found):
+		// The failed Job is kept for its logs; deleting it retries the installation
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "InstallFailed"
+		condition.Message = fmt.Sprintf("Job %s failed, see its logs and delete it to retry", found.Name)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	return condition.Status == metav1.ConditionTrue, nil
+}
+
+// generateAdminPassword returns a random password that also satisfies the default
+// password policy of Moodle: a digit, a lower and an upper case letter and a symbol
+func generateAdminPassword() (string, error) {
+	password, err := generatePassword()
+	if err != nil {
+		return "", err
+	}
+	return password + "#Aa1", nil
+}
+
+// reconcileInstallAdminSecret copies the administrator password of
+// adminPasswordSecretRef into the tenant namespace, or generates one that is kept for the
+// lifetime of the Secret, and records the Secret in the status. The password never
+// leaves the Secret, so that it is not passed around in chat messages.
+func (r *MoodleTenantReconciler) reconcileInstallAdminSecret(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	mt.Status.AdminCredentialsSecret = installAdminSecretName(mt)
+	if ref := mt.Spec.Install.AdminPasswordSecretRef; ref != nil {
+		source := types.NamespacedName{Name: ref.Name, Namespace: mt.Namespace}
+		return r.reconcileCopiedSecret(ctx, mt, source, namespace, installAdminSecretName(mt))
+	}
+
+	found := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: installAdminSecretName(mt), Namespace: namespace}, found)
+	if err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get administrator Secret")
+		return err
+	}
+	password, err := generateAdminPassword()
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      installAdminSecretName(mt),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+		},
+		Data: map[string][]byte{
+			"username": []byte(installAdminUser(mt)),
+			"password": []byte(password),
+			"email":    []byte(mt.Spec.Install.AdminEmail),
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	logger.Info("Creating a new Secret", "Secret.Namespace", namespace, "Secret.Name", secret.Name)
+	return r.Create(ctx, secret)
+}
+
+// installAdminUser returns the username of the administrator account
+func installAdminUser(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.Install.AdminUser != "" {
+		return mt.Spec.Install.AdminUser
+	}
+	return "admin"
+}
+
+// installJobForMoodle returns the Job installing Moodle. Like the upgrade Job it runs the
+// Moodle container of the Deployment, with its database settings and moodledata.
+func (r *MoodleTenantReconciler) installJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) (*batchv1.Job, error) {
+	install := mt.Spec.Install
+	lang := install.Lang
+	if lang == "" {
+		lang = "en"
+	}
+	supportEmail := install.SupportEmail
+	if supportEmail == "" {
+		supportEmail = install.AdminEmail
+	}
+
+	job, err := r.cliJobForMoodle(mt, namespace, mt.Name+"-install", "install", []string{"sh", "-c", installScript})
+	if err != nil {
+		return nil, err
+	}
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "INSTALL_LANG", Value: lang},
+		corev1.EnvVar{Name: "INSTALL_ADMIN_USER", Value: installAdminUser(mt)},
+		corev1.EnvVar{
+			Name: "INSTALL_ADMIN_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: installAdminSecretName(mt)},
+					Key:                  "password",
+				},
+			},
+		},
+		corev1.EnvVar{Name: "INSTALL_ADMIN_EMAIL", Value: install.AdminEmail},
+		corev1.EnvVar{Name: "INSTALL_SITE_NAME", Value: install.SiteName},
+		corev1.EnvVar{Name: "INSTALL_SHORT_NAME", Value: install.ShortName},
+		corev1.EnvVar{Name: "INSTALL_SUMMARY", Value: install.Summary},
+		corev1.EnvVar{Name: "INSTALL_SUPPORT_EMAIL", Value: supportEmail},
+	)
+	job.Spec.BackoffLimit = ptr.To[int32](0)
+
+	return job, nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// InventoryPath is the path the fleet inventory is served on
+const InventoryPath = "/inventory"
+
+// tierLabel is the MoodleTenant label reported as the tenant tier
+const tierLabel = "moodle.bsu.by/tier"
+
+// TenantInventory is the machine-readable inventory record of a MoodleTenant. LastBackup
+// is when the last successful MoodleDatabaseDump of the tenant finished.
+type TenantInventory struct {
+	Name          string             `json:"name"`
+	Namespace     string             `json:"namespace"`
+	Hostname      string             `json:"hostname"`
+	Image         string             `json:"image"`
+	Version       string             `json:"version,omitempty"`
+	Tier          string             `json:"tier,omitempty"`
+	DatabaseHost  string             `json:"databaseHost"`
+	Storage       StorageInventory   `json:"storage"`
+	Replicas      int32              `json:"replicas"`
+	ReadyReplicas int32              `json:"readyReplicas"`
+	LastBackup    *metav1.Time       `json:"lastBackup,omitempty"`
+	Conditions    []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// StorageInventory describes the moodledata volume of a MoodleTenant
+type StorageInventory struct {
+	StorageClass string `json:"storageClass,omitempty"`
+	Requested    string `json:"requested"`
+	Capacity     string `json:"capacity,omitempty"`
+	Phase        string `json:"phase,omitempty"`
+}
+
+// CollectInventory builds the fleet inventory from the given reader. The manager
+// client is backed by the informer caches the controller already maintains, so
+// collecting the inventory does not hit the API server.
+func CollectInventory(ctx context.Context, c client.Reader) ([]TenantInventory, error) {
+	tenants := &moodlev1alpha1.MoodleTenantList{}
+	if err := c.List(ctx, tenants); err != nil {
+		return nil, err
+	}
+
+	dumps := &moodlev1alpha1.MoodleDatabaseDumpList{}
+	if err := c.List(ctx, dumps); err != nil {
+		return nil, err
+	}
+	lastBackups := map[types.NamespacedName]*metav1.Time{}
+	for _, dump := range dumps.Items {
+		completion := dump.Status.CompletionTime
+		if dump.Status.Phase != moodlev1alpha1.DumpPhaseSucceeded || completion == nil {
+			continue
+		}
+		tenant := types.NamespacedName{Name: dump.Spec.TenantRef.Name, Namespace: dump.Namespace}
+		if last := lastBackups[tenant]; last == nil || last.Before(completion) {
+			lastBackups[tenant] = completion
+		}
+	}
+
+	inventory := make([]TenantInventory, 0, len(tenants.Items))
+	for _, mt := range tenants.Items {
+		// The storage class may come from the class of the tenant
+		if err := withTenantClass(ctx, c, &mt); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+		namespace := "tenant-" + mt.Name
+		item := TenantInventory{
+			Name:         mt.Name,
+			Namespace:    mt.Namespace,
+			Hostname:     mt.Spec.Hostname,
+			Image:        mt.Spec.Image,
+			Version:      imageTag(mt.Spec.Image),
+			Tier:         mt.Labels[tierLabel],
+			DatabaseHost: mt.Spec.DatabaseRef.Host,
+			Storage: StorageInventory{
+				StorageClass: mt.Spec.Storage.StorageClass,
+				Requested:    mt.Spec.Storage.Size.String(),
+			},
+			LastBackup: lastBackups[types.NamespacedName{Name: mt.Name, Namespace: mt.Namespace}],
+			Conditions: mt.Status.Conditions,
+		}
+
+		// The class of a tenant is its tier, unless it is labelled otherwise
+		if item.Tier == "" && mt.Spec.ClassRef != nil {
+			item.Tier = mt.Spec.ClassRef.Name
+		}
+
+		deployment := &appsv1.Deployment{}
+		err := c.Get(ctx, types.NamespacedName{Name: activeDeploymentName(&mt), Namespace: namespace}, deployment)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		} else if err == nil {
+			item.Replicas = deployment.Status.Replicas
+			item.ReadyReplicas = deployment.Status.ReadyReplicas
+		}
+
+		pvc := &corev1.PersistentVolumeClaim{}
+		err = c.Get(ctx, types.NamespacedName{Name: mt.Name + "-data", Namespace: namespace}, pvc)
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		} else if err == nil {
+			if capacity, ok := pvc.Status.Capacity[corev1.ResourceStorage]; ok {
+				item.Storage.Capacity = capacity.String()
+			}
+			item.Storage.Phase = string(pvc.Status.Phase)
+		}
+
+		inventory = append(inventory, item)
+	}
+
+	return inventory, nil
+}
+
+// InventoryHandler serves the fleet inventory as JSON
+func InventoryHandler(c client.Reader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		logger := log.FromContext(req.Context())
+
+		inventory, err := CollectInventory(req.Context(), c)
+		if err != nil {
+			logger.Error(err, "Failed to collect inventory")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(inventory); err != nil {
+			logger.Error(err, "Failed to write inventory")
+		}
+	})
+}
+
+// imageTag returns the tag of a container image reference, if any
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
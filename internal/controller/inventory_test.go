@@ -0,0 +1,98 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Fleet inventory", func() {
+	It("should report tenants with their deployment and storage state", func() {
+		tenant := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "biology-dept",
+				Namespace: "default",
+				Labels:    map[string]string{tierLabel: "gold"},
+			},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "biology.bsu.by",
+				Image:    "ghcr.io/pkasila/moodle:4.5-fpm",
+				Storage: moodlev1alpha1.StorageSpec{
+					Size: resource.MustParse("10Gi"),
+				},
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Host: "postgres-cluster.db-tier.svc",
+				},
+			},
+			Status: moodlev1alpha1.MoodleTenantStatus{
+				Conditions: []metav1.Condition{{
+					Type:   moodlev1alpha1.ConditionDatabaseReady,
+					Status: metav1.ConditionTrue,
+					Reason: "Connected",
+				}},
+			},
+		}
+		lastBackup := metav1.NewTime(time.Date(2025, 9, 1, 3, 0, 0, 0, time.UTC))
+		dump := func(name, phase string, completion metav1.Time) *moodlev1alpha1.MoodleDatabaseDump {
+			return &moodlev1alpha1.MoodleDatabaseDump{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Spec:       moodlev1alpha1.MoodleDatabaseDumpSpec{TenantRef: corev1.LocalObjectReference{Name: "biology-dept"}},
+				Status:     moodlev1alpha1.MoodleDatabaseDumpStatus{Phase: phase, CompletionTime: &completion},
+			}
+		}
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-dept-deployment", Namespace: "tenant-biology-dept"},
+			Status:     appsv1.DeploymentStatus{Replicas: 2, ReadyReplicas: 1},
+		}
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-dept-data", Namespace: "tenant-biology-dept"},
+			Status: corev1.PersistentVolumeClaimStatus{
+				Phase:    corev1.ClaimBound,
+				Capacity: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).WithObjects(tenant, deployment, pvc,
+			dump("biology-dept-nightly-1", moodlev1alpha1.DumpPhaseSucceeded, metav1.NewTime(lastBackup.Add(-24*time.Hour))),
+			dump("biology-dept-nightly-2", moodlev1alpha1.DumpPhaseSucceeded, lastBackup),
+			dump("biology-dept-nightly-3", moodlev1alpha1.DumpPhaseFailed, metav1.NewTime(lastBackup.Add(24*time.Hour))),
+		).Build()
+
+		inventory, err := CollectInventory(context.Background(), c)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inventory).To(HaveLen(1))
+		Expect(inventory[0].Hostname).To(Equal("biology.bsu.by"))
+		Expect(inventory[0].Version).To(Equal("4.5-fpm"))
+		Expect(inventory[0].Tier).To(Equal("gold"))
+		Expect(inventory[0].DatabaseHost).To(Equal("postgres-cluster.db-tier.svc"))
+		Expect(inventory[0].ReadyReplicas).To(Equal(int32(1)))
+		Expect(inventory[0].Storage.Capacity).To(Equal("10Gi"))
+		Expect(inventory[0].Storage.Phase).To(Equal("Bound"))
+		Expect(inventory[0].LastBackup.Time).To(BeTemporally("==", lastBackup.Time))
+		Expect(inventory[0].Conditions).To(ConsistOf(HaveField("Type", moodlev1alpha1.ConditionDatabaseReady)))
+	})
+})
@@ -0,0 +1,61 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// localCacheDir is the mount path of the local cache emptyDir
+const localCacheDir = "/var/cache/moodle"
+
+// localCacheEnabled reports whether the local cache directory is kept off moodledata
+func localCacheEnabled(mt *moodlev1alpha1.MoodleTenant) bool {
+	enabled := mt.Spec.Storage.LocalCache.Enabled
+	return enabled == nil || *enabled
+}
+
+// applyLocalCache mounts an emptyDir as the local cache directory of the Moodle container,
+// the first container of podSpec, and points config.php at it. The local cache only holds
+// files Moodle rebuilds from the database and moodledata, such as compiled templates and
+// language strings, so it does not need to survive the pod.
+func applyLocalCache(mt *moodlev1alpha1.MoodleTenant, podSpec *corev1.PodSpec) {
+	if !localCacheEnabled(mt) {
+		return
+	}
+
+	sizeLimit := resource.MustParse("1Gi")
+	if mt.Spec.Storage.LocalCache.SizeLimit != nil {
+		sizeLimit = *mt.Spec.Storage.LocalCache.SizeLimit
+	}
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "local-cache",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{SizeLimit: &sizeLimit},
+		},
+	})
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "local-cache",
+		MountPath: localCacheDir,
+	})
+	container.Env = append(container.Env, corev1.EnvVar{Name: "MOODLE_LOCALCACHE_DIR", Value: localCacheDir})
+}
@@ -0,0 +1,435 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// maintenancePageHTML is the page shipped with the operator and served while Moodle is unavailable
+//
+//go:embed maintenance.html
+var maintenancePageHTML string
+
+// suspendedPageHTML is the page served instead while the tenant is suspended
+//
+//go:embed suspended.html
+var suspendedPageHTML string
+
+// hibernatedPageHTML is the page served while a hibernated tenant is woken by the requests
+//
+//go:embed hibernated.html
+var hibernatedPageHTML string
+
+// maintenanceNginxConfig answers every request with the maintenance page and a 503 status
+const maintenanceNginxConfig = `server {
+    listen 8080;
+    root /usr/share/nginx/html;
+
+    error_page 503 /index.html;
+    location = /index.html {
+        internal;
+        add_header Retry-After 120 always;
+        add_header Cache-Control no-store always;
+    }
+    location / {
+        return 503;
+    }
+}
+`
+
+// hibernatedNginxConfig passes every request to the activator, which wakes the tenant,
+// and answers it with the page and a 503 status whatever the activator answers
+const hibernatedNginxConfig = `server {
+    listen 8080;
+    root /usr/share/nginx/html;
+
+    error_page 500 502 503 504 =503 /index.html;
+    location = /index.html {
+        internal;
+        add_header Retry-After 30 always;
+        add_header Cache-Control no-store always;
+    }
+    location / {
+        rewrite ^ %s break;
+        proxy_pass %s;
+        proxy_method POST;
+        proxy_pass_request_body off;
+        proxy_set_header Content-Length "";
+        proxy_connect_timeout 2s;
+        proxy_read_timeout 5s;
+        proxy_intercept_errors on;
+    }
+}
+`
+
+// defaultMaintenanceImage serves the maintenance page unless overridden by the operator flag
+const defaultMaintenanceImage = "nginxinc/nginx-unprivileged:stable-alpine"
+
+// maintenancePageAnnotation records on the maintenance page pods which page they serve
+const maintenancePageAnnotation = "moodle.bsu.by/page"
+
+// maintenancePageKind returns the page the maintenance page serves: "hibernated" for a
+// hibernated tenant woken by requests, "suspended" for other parked tenants, and
+// "maintenance" otherwise
+func (r *MoodleTenantReconciler) maintenancePageKind(mt *moodlev1alpha1.MoodleTenant) string {
+	switch {
+	case !parked(mt):
+		return "maintenance"
+	case !mt.Spec.Suspended && wakeOnRequest(mt) && r.ActivatorURL != "":
+		return "hibernated"
+	default:
+		return "suspended"
+	}
+}
+
+// maintenancePageData returns the page served by the maintenance page and its nginx configuration
+func (r *MoodleTenantReconciler) maintenancePageData(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	switch r.maintenancePageKind(mt) {
+	case "hibernated":
+		config := fmt.Sprintf(hibernatedNginxConfig, ActivatorPath+mt.Namespace+"/"+mt.Name, strings.TrimSuffix(r.ActivatorURL, "/"))
+		return map[string]string{"index.html": hibernatedPageHTML, "default.conf": config}
+	case "suspended":
+		return map[string]string{"index.html": suspendedPageHTML, "default.conf": maintenanceNginxConfig}
+	default:
+		return map[string]string{"index.html": maintenancePageHTML, "default.conf": maintenanceNginxConfig}
+	}
+}
+
+// maintenanceName returns the name shared by the maintenance page resources
+func maintenanceName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-maintenance"
+}
+
+// reconcileMaintenancePage serves the maintenance page while the tenant Deployment has no
+// ready replicas or an upgrade Job runs, and removes it afterwards. The outcome is
+// reported in the MaintenancePage condition, which selects the backend of the Ingress,
+// the HTTPRoute and the VirtualService.
+func (r *MoodleTenantReconciler) reconcileMaintenancePage(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	// A suspended or hibernated tenant is parked behind the page whatever maintenancePage says
+	if parked(mt) {
+		if err := r.serveMaintenancePage(ctx, mt, namespace); err != nil {
+			return err
+		}
+		condition := metav1.Condition{
+			Type:               moodlev1alpha1.ConditionMaintenancePage,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Suspended",
+			Message:            "The tenant is suspended, the temporarily unavailable page is served",
+			ObservedGeneration: mt.Generation,
+		}
+		if !mt.Spec.Suspended {
+			condition.Reason = "Hibernated"
+			condition.Message = "The tenant is hibernated, the temporarily unavailable page is served"
+			if r.maintenancePageKind(mt) == "hibernated" {
+				condition.Message = "The tenant is hibernated, the page served wakes it on the first request"
+			}
+		}
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	// The maintenance mode may ask for the page while Moodle is ready
+	if mode := mt.Spec.MaintenanceMode; mode != nil && mode.StaticPage {
+		if err := r.serveMaintenancePage(ctx, mt, namespace); err != nil {
+			return err
+		}
+		meta.SetStatusCondition(&mt.Status.Conditions, metav1.Condition{
+			Type:               moodlev1alpha1.ConditionMaintenancePage,
+			Status:             metav1.ConditionTrue,
+			Reason:             "MaintenanceMode",
+			Message:            "The site is in maintenance mode, the maintenance page is served",
+			ObservedGeneration: mt.Generation,
+		})
+		return nil
+	}
+
+	if enabled := mt.Spec.MaintenancePage.Enabled; enabled != nil && !*enabled {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionMaintenancePage)
+		return r.deleteMaintenancePage(ctx, mt, namespace)
+	}
+
+	// The upgrade and rollback Jobs put Moodle into maintenance mode while the old pods
+	// keep running, so the page is served for as long as they run
+	if upgradeRunning(mt) {
+		if err := r.serveMaintenancePage(ctx, mt, namespace); err != nil {
+			return err
+		}
+		meta.SetStatusCondition(&mt.Status.Conditions, metav1.Condition{
+			Type:               moodlev1alpha1.ConditionMaintenancePage,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Upgrading",
+			Message:            "Moodle is being upgraded, the maintenance page is served",
+			ObservedGeneration: mt.Generation,
+		})
+		return nil
+	}
+
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: activeDeploymentName(mt), Namespace: namespace}, deployment)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get Deployment")
+		return err
+	}
+
+	if err == nil && deployment.Status.ReadyReplicas > 0 {
+		meta.SetStatusCondition(&mt.Status.Conditions, metav1.Condition{
+			Type:               moodlev1alpha1.ConditionMaintenancePage,
+			Status:             metav1.ConditionFalse,
+			Reason:             "MoodleReady",
+			Message:            "Moodle is serving requests",
+			ObservedGeneration: mt.Generation,
+		})
+		return r.deleteMaintenancePage(ctx, mt, namespace)
+	}
+
+	if err := r.serveMaintenancePage(ctx, mt, namespace); err != nil {
+		return err
+	}
+
+	meta.SetStatusCondition(&mt.Status.Conditions, metav1.Condition{
+		Type:               moodlev1alpha1.ConditionMaintenancePage,
+		Status:             metav1.ConditionTrue,
+		Reason:             "NoReadyReplicas",
+		Message:            "No Moodle pod is ready, the maintenance page is served",
+		ObservedGeneration: mt.Generation,
+	})
+	return nil
+}
+
+// setSuspendedCondition reports spec.suspended in the Suspended condition
+func setSuspendedCondition(mt *moodlev1alpha1.MoodleTenant) {
+	if !mt.Spec.Suspended {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionSuspended)
+		return
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, metav1.Condition{
+		Type:               moodlev1alpha1.ConditionSuspended,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Suspended",
+		Message:            "Moodle and cron are scaled to zero, the data volume and the database are kept",
+		ObservedGeneration: mt.Generation,
+	})
+}
+
+// serveMaintenancePage creates or updates the maintenance page resources
+func (r *MoodleTenantReconciler) serveMaintenancePage(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	if err := r.reconcileObject(ctx, mt, r.maintenanceConfigMapForMoodle(mt, namespace), &corev1.ConfigMap{}); err != nil {
+		return err
+	}
+	if err := r.reconcileObject(ctx, mt, r.maintenanceDeploymentForMoodle(mt, namespace), &appsv1.Deployment{}); err != nil {
+		return err
+	}
+	return r.reconcileObject(ctx, mt, r.maintenanceServiceForMoodle(mt, namespace), &corev1.Service{})
+}
+
+// deleteMaintenancePage removes the maintenance page resources if they exist
+func (r *MoodleTenantReconciler) deleteMaintenancePage(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	objectMeta := metav1.ObjectMeta{Name: maintenanceName(mt), Namespace: namespace}
+	for _, obj := range []client.Object{
+		&corev1.Service{ObjectMeta: objectMeta},
+		&appsv1.Deployment{ObjectMeta: objectMeta},
+		&corev1.ConfigMap{ObjectMeta: objectMeta},
+	} {
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete maintenance page resource", "Namespace", namespace, "Name", obj.GetName())
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeRunning reports whether an upgrade or rollback Job of the tenant runs
+func upgradeRunning(mt *moodlev1alpha1.MoodleTenant) bool {
+	condition := meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionDegraded)
+	return condition != nil && (condition.Reason == "Upgrading" || condition.Reason == "RollingBack")
+}
+
+// ingressBackendService returns the Service external traffic is routed to: the maintenance
+// page while it is active, Moodle otherwise
+func ingressBackendService(mt *moodlev1alpha1.MoodleTenant) string {
+	if meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionMaintenancePage) {
+		return maintenanceName(mt)
+	}
+	return mt.Name + "-service"
+}
+
+// maintenanceLabels returns the labels of the maintenance page pods. They must not match
+// the selector of the Moodle Service.
+func maintenanceLabels(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	return map[string]string{
+		"app":                  "moodle-maintenance",
+		"moodle.bsu.by/tenant": mt.Name,
+	}
+}
+
+// maintenanceConfigMapForMoodle returns the ConfigMap with the maintenance page and its nginx configuration
+func (r *MoodleTenantReconciler) maintenanceConfigMapForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      maintenanceName(mt),
+			Namespace: namespace,
+			Labels:    maintenanceLabels(mt),
+		},
+		Data: r.maintenancePageData(mt),
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, configMap, r.Scheme); err != nil {
+		return nil
+	}
+
+	return configMap
+}
+
+// maintenanceDeploymentForMoodle returns the Deployment serving the maintenance page
+func (r *MoodleTenantReconciler) maintenanceDeploymentForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *appsv1.Deployment {
+	labels := maintenanceLabels(mt)
+
+	image := defaultMaintenanceImage
+	if r.MaintenanceImage != "" {
+		image = r.MaintenanceImage
+	}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      maintenanceName(mt),
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					// The page is mounted with subPath, which is not updated in running pods
+					Annotations: map[string]string{maintenancePageAnnotation: r.maintenancePageKind(mt)},
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot: ptr.To(true),
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "nginx",
+							Image: image,
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "http",
+									ContainerPort: 8080,
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("10m"),
+									corev1.ResourceMemory: resource.MustParse("16Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("32Mi"),
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "page",
+									MountPath: "/usr/share/nginx/html/index.html",
+									SubPath:   "index.html",
+								},
+								{
+									Name:      "page",
+									MountPath: "/etc/nginx/conf.d/default.conf",
+									SubPath:   "default.conf",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "page",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: maintenanceName(mt)},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, deployment, r.Scheme); err != nil {
+		return nil
+	}
+
+	return deployment
+}
+
+// maintenanceServiceForMoodle returns the Service the Ingress routes to while the maintenance page is active
+func (r *MoodleTenantReconciler) maintenanceServiceForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      maintenanceName(mt),
+			Namespace: namespace,
+			Labels:    maintenanceLabels(mt),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: maintenanceLabels(mt),
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       80,
+					TargetPort: intstr.FromInt(8080),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, service, r.Scheme); err != nil {
+		return nil
+	}
+
+	return service
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Maintenance page routing", func() {
+	It("should route every entry point to the page while an upgrade runs", func() {
+		reconciler := &MoodleTenantReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "biology.bsu.by",
+				Routing:  moodlev1alpha1.RoutingSpec{GatewayRef: &moodlev1alpha1.GatewayRefSpec{Name: "public"}},
+				Mesh:     &moodlev1alpha1.MeshSpec{Gateway: "istio-system/public"},
+			},
+		}
+		meta.SetStatusCondition(&mt.Status.Conditions, metav1.Condition{
+			Type:   moodlev1alpha1.ConditionDegraded,
+			Status: metav1.ConditionFalse,
+			Reason: "Upgrading",
+		})
+		Expect(upgradeRunning(mt)).To(BeTrue())
+		meta.SetStatusCondition(&mt.Status.Conditions, metav1.Condition{
+			Type:   moodlev1alpha1.ConditionMaintenancePage,
+			Status: metav1.ConditionTrue,
+			Reason: "Upgrading",
+		})
+
+		Expect(reconciler.ingressForMoodle(mt, "tenant-biology").Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name).To(Equal("biology-maintenance"))
+
+		backend, _, _ := unstructured.NestedSlice(reconciler.httpRouteForMoodle(mt, "tenant-biology").Object, "spec", "rules")
+		Expect(backend[0].(map[string]interface{})["backendRefs"].([]interface{})[0]).To(HaveKeyWithValue("name", "biology-maintenance"))
+
+		routes, _, _ := unstructured.NestedSlice(reconciler.virtualServiceForMoodle(mt, "tenant-biology").Object, "spec", "http")
+		route := routes[0].(map[string]interface{})["route"].([]interface{})[0].(map[string]interface{})
+		Expect(route["destination"]).To(HaveKeyWithValue("host", "biology-maintenance.tenant-biology.svc.cluster.local"))
+	})
+})
@@ -0,0 +1,179 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// maintenanceModeEnableScript enables the CLI maintenance mode and replaces the default
+// message of climaintenance.html with MAINTENANCE_MESSAGE when set
+const maintenanceModeEnableScript = `set -e
+php /var/www/html/admin/cli/maintenance.php --enable
+if [ -n "$MAINTENANCE_MESSAGE" ]; then
+  printf '%s\n' "$MAINTENANCE_MESSAGE" > /var/www/moodledata/climaintenance.html
+fi
+`
+
+// maintenanceModeDisableScript disables the CLI maintenance mode
+const maintenanceModeDisableScript = `php /var/www/html/admin/cli/maintenance.php --disable
+`
+
+// maintenanceModeJobName returns the name of the Job bringing the maintenance mode to
+// its desired state. A new generation or image, whose upgrade ends the maintenance
+// mode, gets a new Job.
+func maintenanceModeJobName(mt *moodlev1alpha1.MoodleTenant) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(fmt.Sprintf("%d/%s", mt.Generation, moodleImage(mt))))
+	if mode := mt.Spec.MaintenanceMode; mode != nil {
+		hash.Write([]byte("/" + mode.Message))
+		return fmt.Sprintf("%s-maintenance-on-%08x", mt.Name, hash.Sum32())
+	}
+	return fmt.Sprintf("%s-maintenance-off-%08x", mt.Name, hash.Sum32())
+}
+
+// reconcileMaintenanceMode runs a Job enabling or disabling the maintenance mode of
+// Moodle whenever spec.maintenanceMode changes, one at a time, and reports the mode in
+// the MaintenanceMode condition. A failed change is retried when the MoodleTenant changes.
+func (r *MoodleTenantReconciler) reconcileMaintenanceMode(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	mode := mt.Status.MaintenanceMode
+	if mode == nil && mt.Spec.MaintenanceMode == nil {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionMaintenanceMode)
+		return nil
+	}
+
+	// The change in progress finishes first
+	if mode != nil && mode.CompletionTime == nil {
+		found := &batchv1.Job{}
+		err := r.Get(ctx, types.NamespacedName{Name: mode.JobName, Namespace: namespace}, found)
+		if err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to get maintenance mode Job")
+			return err
+		}
+		if err == nil && found.Status.Succeeded == 0 && !jobFailed(found) {
+			return nil
+		}
+		mode.CompletionTime = ptr.To(metav1.Now())
+		setMaintenanceModeCondition(mt, mode, err == nil && found.Status.Succeeded > 0)
+	}
+
+	enabled := mt.Spec.MaintenanceMode != nil
+	name := maintenanceModeJobName(mt)
+	if mode != nil && mode.Enabled == enabled && (!enabled || mode.Message == mt.Spec.MaintenanceMode.Message) {
+		condition := meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionMaintenanceMode)
+		succeeded := condition != nil && (condition.Reason == "Enabled" || condition.Reason == "Disabled")
+		if succeeded || mode.JobName == name {
+			return nil
+		}
+	}
+
+	job, err := r.maintenanceModeJobForMoodle(mt, namespace, name)
+	if err != nil {
+		return fmt.Errorf("failed to build the maintenance mode Job: %w", err)
+	}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, &batchv1.Job{})
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new maintenance mode Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name, "Enabled", enabled)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new maintenance mode Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return err
+		}
+	} else if err != nil {
+		logger.Error(err, "Failed to get maintenance mode Job")
+		return err
+	}
+
+	mode = &moodlev1alpha1.MaintenanceModeStatus{Enabled: enabled, JobName: job.Name}
+	if enabled {
+		mode.Message = mt.Spec.MaintenanceMode.Message
+	}
+	mt.Status.MaintenanceMode = mode
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionMaintenanceMode,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "Disabling",
+		Message:            fmt.Sprintf("Maintenance mode Job %s is disabling the maintenance mode", job.Name),
+		ObservedGeneration: mt.Generation,
+	}
+	if enabled {
+		condition.Reason = "Enabling"
+		condition.Message = fmt.Sprintf("Maintenance mode Job %s is enabling the maintenance mode", job.Name)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	return nil
+}
+
+// setMaintenanceModeCondition sets the MaintenanceMode condition for a finished change
+func setMaintenanceModeCondition(mt *moodlev1alpha1.MoodleTenant, mode *moodlev1alpha1.MaintenanceModeStatus, succeeded bool) {
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionMaintenanceMode,
+		ObservedGeneration: mt.Generation,
+	}
+	switch {
+	case mode.Enabled && succeeded:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Enabled"
+		condition.Message = "The site is in maintenance mode"
+	case mode.Enabled:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "EnableFailed"
+		condition.Message = fmt.Sprintf("Maintenance mode Job %s failed to enable the maintenance mode; see its logs", mode.JobName)
+	case succeeded:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Disabled"
+		condition.Message = "The site is not in maintenance mode"
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "DisableFailed"
+		condition.Message = fmt.Sprintf("Maintenance mode Job %s failed to disable the maintenance mode; see its logs", mode.JobName)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+}
+
+// maintenanceModeJobForMoodle returns the Job enabling or disabling the maintenance mode.
+// Like the upgrade Job it runs the Moodle container of the Deployment, with moodledata.
+func (r *MoodleTenantReconciler) maintenanceModeJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace, name string) (*batchv1.Job, error) {
+	script := maintenanceModeDisableScript
+	if mt.Spec.MaintenanceMode != nil {
+		script = maintenanceModeEnableScript
+	}
+	job, err := r.cliJobForMoodle(mt, namespace, name, "maintenance-mode", []string{"sh", "-c", script})
+	if err != nil {
+		return nil, err
+	}
+	if mode := mt.Spec.MaintenanceMode; mode != nil {
+		container := &job.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, corev1.EnvVar{Name: "MAINTENANCE_MESSAGE", Value: mode.Message})
+	}
+
+	return job, nil
+}
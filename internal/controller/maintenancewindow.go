@@ -0,0 +1,233 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// maintenanceWindowLookahead bounds the search for the next window. A schedule opening
+// less often is reevaluated when the lookahead has passed.
+const maintenanceWindowLookahead = 8 * 24 * time.Hour
+
+// cronSchedule is a parsed schedule of minute, hour, day, month and day of week
+type cronSchedule struct {
+	minute, hour, day, month, weekday []bool
+	// Cron matches either the day or the day of week when both are restricted
+	anyDay, anyWeekday bool
+}
+
+// parseCronField returns the values from min to max matched by a field of a schedule:
+// *, a value, a range, each with an optional /step, or a comma-separated list of them
+func parseCronField(field string, lowest, highest int) ([]bool, error) {
+	values := make([]bool, highest+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+		first, last := lowest, highest
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if first, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value in %q", part)
+			}
+			last = first
+			if len(bounds) == 2 {
+				if last, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if step > 1 {
+				last = highest
+			}
+		}
+		if first < lowest || last > highest || first > last {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, lowest, highest)
+		}
+		for v := first; v <= last; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+// parseCronSchedule parses a schedule in the five-field cron format
+func parseCronSchedule(schedule string) (*cronSchedule, error) {
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q does not have five fields", schedule)
+	}
+	c := &cronSchedule{anyDay: fields[2] == "*", anyWeekday: fields[4] == "*"}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.day, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	// 7 is Sunday as well as 0
+	if c.weekday, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	c.weekday[0] = c.weekday[0] || c.weekday[7]
+	return c, nil
+}
+
+// matches reports whether the schedule fires in the minute of t
+func (c *cronSchedule) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	day, weekday := c.day[t.Day()], c.weekday[int(t.Weekday())]
+	if c.anyDay || c.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// maintenanceWindowDuration returns how long each maintenance window stays open
+func maintenanceWindowDuration(mw *moodlev1alpha1.MaintenanceWindowSpec) time.Duration {
+	minutes := mw.DurationMinutes
+	if minutes == 0 {
+		minutes = 120
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// maintenanceWindowState returns whether a maintenance window is Open, Closed or Frozen
+// at now, when that next changes, and the reason of a freeze. A closed window that does
+// not open within the lookahead changes at its end instead.
+func maintenanceWindowState(mw *moodlev1alpha1.MaintenanceWindowSpec, now time.Time) (string, time.Time, string, error) {
+	location := time.UTC
+	if mw.TimeZone != nil {
+		var err error
+		if location, err = time.LoadLocation(*mw.TimeZone); err != nil {
+			return "", time.Time{}, "", fmt.Errorf("invalid maintenance window time zone: %w", err)
+		}
+	}
+	schedule, err := parseCronSchedule(mw.Schedule)
+	if err != nil {
+		return "", time.Time{}, "", fmt.Errorf("invalid maintenance window schedule: %w", err)
+	}
+
+	for _, freeze := range mw.Freezes {
+		if !now.Before(freeze.Start.Time) && now.Before(freeze.End.Time) {
+			return "Frozen", freeze.End.Time, freeze.Reason, nil
+		}
+	}
+	now = now.In(location).Truncate(time.Minute)
+	duration := maintenanceWindowDuration(mw)
+	for start := now; start.After(now.Add(-duration)); start = start.Add(-time.Minute) {
+		if schedule.matches(start) {
+			// The next freeze closes the window early
+			end := start.Add(duration)
+			for _, freeze := range mw.Freezes {
+				if freeze.Start.After(now) && freeze.Start.Time.Before(end) {
+					end = freeze.Start.Time
+				}
+			}
+			return "Open", end, "", nil
+		}
+	}
+	lookahead := now.Add(maintenanceWindowLookahead)
+	for start := now.Add(time.Minute); start.Before(lookahead); start = start.Add(time.Minute) {
+		if schedule.matches(start) {
+			return "Closed", start, "", nil
+		}
+	}
+	return "Closed", lookahead, "", nil
+}
+
+// reconcileMaintenanceWindow sets the MaintenanceWindow condition, which the disruptive
+// actions check through maintenanceAllowed
+func (r *MoodleTenantReconciler) reconcileMaintenanceWindow(mt *moodlev1alpha1.MoodleTenant) error {
+	mw := mt.Spec.MaintenanceWindow
+	if mw == nil {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionMaintenanceWindow)
+		return nil
+	}
+	state, next, reason, err := maintenanceWindowState(mw, time.Now())
+	if err != nil {
+		return err
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionMaintenanceWindow,
+		Status:             metav1.ConditionFalse,
+		Reason:             state,
+		ObservedGeneration: mt.Generation,
+	}
+	until := next.UTC().Format(time.RFC3339)
+	switch state {
+	case "Open":
+		condition.Status = metav1.ConditionTrue
+		condition.Message = fmt.Sprintf("Open until %s", until)
+	case "Frozen":
+		condition.Message = fmt.Sprintf("Frozen until %s", until)
+		if reason != "" {
+			condition.Message += ": " + reason
+		}
+	default:
+		condition.Message = fmt.Sprintf("Closed until %s", until)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	return nil
+}
+
+// maintenanceAllowed reports whether disruptive actions may run now
+func maintenanceAllowed(mt *moodlev1alpha1.MoodleTenant) bool {
+	return mt.Spec.MaintenanceWindow == nil || meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionMaintenanceWindow)
+}
+
+// upgradeWaitingForWindow reports whether the pending upgrade waits for the maintenance
+// window
+func upgradeWaitingForWindow(mt *moodlev1alpha1.MoodleTenant) bool {
+	degraded := meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionDegraded)
+	return degraded != nil && degraded.Reason == "WaitingForMaintenanceWindow"
+}
+
+// maintenanceWindowRequeue returns when the maintenance window next opens or closes, to
+// run the actions waiting for it, or 0 without a window
+func maintenanceWindowRequeue(mt *moodlev1alpha1.MoodleTenant) time.Duration {
+	if mt.Spec.MaintenanceWindow == nil {
+		return 0
+	}
+	_, next, _, err := maintenanceWindowState(mt.Spec.MaintenanceWindow, time.Now())
+	if err != nil {
+		return 0
+	}
+	return max(time.Until(next), 0) + time.Second
+}
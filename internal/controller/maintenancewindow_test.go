@@ -0,0 +1,97 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Maintenance window", func() {
+	It("should open on schedule and stay closed during freezes", func() {
+		mw := &moodlev1alpha1.MaintenanceWindowSpec{
+			Schedule:        "0 2 * * 6,0",
+			DurationMinutes: 180,
+			TimeZone:        ptr.To("Europe/Minsk"),
+		}
+		minsk, err := time.LoadLocation("Europe/Minsk")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Saturday 3 am in Minsk is inside the window, until 5 am
+		state, next, _, err := maintenanceWindowState(mw, time.Date(2026, 1, 17, 3, 0, 0, 0, minsk))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal("Open"))
+		Expect(next).To(BeTemporally("==", time.Date(2026, 1, 17, 5, 0, 0, 0, minsk)))
+
+		// Monday waits for the next Saturday
+		state, next, _, err = maintenanceWindowState(mw, time.Date(2026, 1, 19, 3, 0, 0, 0, minsk))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal("Closed"))
+		Expect(next).To(BeTemporally("==", time.Date(2026, 1, 24, 2, 0, 0, 0, minsk)))
+
+		mw.Freezes = []moodlev1alpha1.FreezePeriod{{
+			Start:  metav1.NewTime(time.Date(2026, 1, 10, 0, 0, 0, 0, minsk)),
+			End:    metav1.NewTime(time.Date(2026, 1, 20, 0, 0, 0, 0, minsk)),
+			Reason: "winter exams",
+		}}
+		state, next, reason, err := maintenanceWindowState(mw, time.Date(2026, 1, 17, 3, 0, 0, 0, minsk))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state).To(Equal("Frozen"))
+		Expect(reason).To(Equal("winter exams"))
+		Expect(next).To(BeTemporally("==", time.Date(2026, 1, 20, 0, 0, 0, 0, minsk)))
+
+		mw.Schedule = "0 25 * * *"
+		_, _, _, err = maintenanceWindowState(mw, time.Now())
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should hold a pending upgrade back while the window is closed", func() {
+		ctx := context.Background()
+
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology", UID: "biology-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Image:             "moodle:4.5.3",
+				MaintenanceWindow: &moodlev1alpha1.MaintenanceWindowSpec{Schedule: "0 2 1 1 *", DurationMinutes: 1},
+			},
+			Status: moodlev1alpha1.MoodleTenantStatus{UpgradedImage: "moodle:4.5.2"},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		Expect(reconciler.reconcileMaintenanceWindow(mt)).To(Succeed())
+		if maintenanceAllowed(mt) {
+			Skip("the maintenance window happens to be open")
+		}
+
+		Expect(reconciler.reconcileUpgrade(ctx, mt, "tenant-biology")).To(Succeed())
+		Expect(upgradeWaitingForWindow(mt)).To(BeTrue())
+		Expect(cronSuspendedReason(mt)).To(BeEmpty())
+		Expect(maintenanceWindowRequeue(mt)).To(BeNumerically(">", 0))
+		jobs := &batchv1.JobList{}
+		Expect(c.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+	})
+})
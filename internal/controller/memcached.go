@@ -0,0 +1,450 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+
+// memcachedModeShared runs Memcached next to the Moodle pods instead of inside them
+const memcachedModeShared = "shared"
+
+// defaultMemcachedImage is the image of Memcached unless the spec names another
+const defaultMemcachedImage = "memcached:alpine"
+
+// memcachedPort is the port of Memcached
+const memcachedPort = 11211
+
+// memcachedSASLUser is the SASL user of generated Memcached credentials
+const memcachedSASLUser = "moodle"
+
+// memcachedSASLDir holds the SASL configuration and password file of Memcached
+const memcachedSASLDir = "/etc/memcached-sasl"
+
+// memcachedShared reports whether the tenant runs shared Memcached instances of its own
+func memcachedShared(mt *moodlev1alpha1.MoodleTenant) bool {
+	return mt.Spec.Cache.ClusterRef == nil && !redisEnabled(mt) && mt.Spec.Memcached.Mode == memcachedModeShared
+}
+
+// memcachedAuthenticated reports whether the Memcached instances of the tenant require
+// SASL authentication, with the credentials in the <name>-memcached-auth Secret of the
+// tenant namespace
+func memcachedAuthenticated(mt *moodlev1alpha1.MoodleTenant) bool {
+	if cc := cacheCluster(mt); cc != nil {
+		return cc.Type != cacheTypeRedis && cc.PasswordSecret != ""
+	}
+	return memcachedShared(mt) && mt.Spec.Memcached.Auth != nil
+}
+
+// memcachedAuthName returns the name of the Secret with the Memcached credentials
+func memcachedAuthName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-memcached-auth"
+}
+
+// memcachedMemoryMB returns the memory of a Memcached instance in megabytes
+func memcachedMemoryMB(mt *moodlev1alpha1.MoodleTenant) int {
+	if mt.Spec.Memcached.MemoryMB != 0 {
+		return mt.Spec.Memcached.MemoryMB
+	}
+	return 128
+}
+
+// memcachedImage returns the image of the Memcached containers of the tenant
+func memcachedImage(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.Memcached.Image != "" {
+		return mt.Spec.Memcached.Image
+	}
+	return defaultMemcachedImage
+}
+
+// applyMemcachedResources replaces the requests and limits of a Memcached container by
+// those given in the spec
+func applyMemcachedResources(mt *moodlev1alpha1.MoodleTenant, container *corev1.Container) {
+	applyResources(container, mt.Spec.Memcached.Resources)
+}
+
+// applyResources replaces the requests and limits of a container by those given, one
+// resource at a time
+func applyResources(container *corev1.Container, resources *corev1.ResourceRequirements) {
+	if resources == nil {
+		return
+	}
+	for name, quantity := range resources.Requests {
+		if container.Resources.Requests == nil {
+			container.Resources.Requests = corev1.ResourceList{}
+		}
+		container.Resources.Requests[name] = quantity
+	}
+	for name, quantity := range resources.Limits {
+		if container.Resources.Limits == nil {
+			container.Resources.Limits = corev1.ResourceList{}
+		}
+		container.Resources.Limits[name] = quantity
+	}
+}
+
+// memcachedName returns the name shared by the Memcached resources
+func memcachedName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-memcached"
+}
+
+// memcachedLabels returns the labels of the shared Memcached pods
+func memcachedLabels(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	return map[string]string{
+		"app":                  "moodle-memcached",
+		"moodle.bsu.by/tenant": mt.Name,
+	}
+}
+
+// memcachedReplicas returns the number of shared Memcached instances
+func memcachedReplicas(mt *moodlev1alpha1.MoodleTenant) int32 {
+	if mt.Spec.Memcached.Replicas != 0 {
+		return mt.Spec.Memcached.Replicas
+	}
+	return 2
+}
+
+// memcachedServers returns the comma-separated Memcached instances of the MUC store.
+// Moodle hashes keys over the list, so every instance needs a stable name of its own,
+// which the StatefulSet pods get through the headless Service.
+func memcachedServers(mt *moodlev1alpha1.MoodleTenant) string {
+	servers := make([]string, 0, memcachedReplicas(mt))
+	for i := int32(0); i < memcachedReplicas(mt); i++ {
+		servers = append(servers, fmt.Sprintf("%s-%d.%s:%d", memcachedName(mt), i, memcachedName(mt), memcachedPort))
+	}
+	return strings.Join(servers, ",")
+}
+
+// reconcileMemcached creates or removes the shared Memcached instances
+func (r *MoodleTenantReconciler) reconcileMemcached(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if err := r.reconcileMemcachedAuth(ctx, mt, namespace); err != nil {
+		return err
+	}
+
+	if !memcachedShared(mt) {
+		objectMeta := metav1.ObjectMeta{Name: memcachedName(mt), Namespace: namespace}
+		for _, obj := range []client.Object{
+			&corev1.Service{ObjectMeta: objectMeta},
+			&appsv1.StatefulSet{ObjectMeta: objectMeta},
+			&policyv1.PodDisruptionBudget{ObjectMeta: objectMeta},
+		} {
+			if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "Failed to delete Memcached resource", "Namespace", namespace, "Name", obj.GetName())
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := r.reconcileObject(ctx, mt, r.memcachedServiceForMoodle(mt, namespace), &corev1.Service{}); err != nil {
+		return err
+	}
+	if err := r.reconcileObject(ctx, mt, r.memcachedStatefulSetForMoodle(mt, namespace), &appsv1.StatefulSet{}); err != nil {
+		return err
+	}
+	return r.reconcileObject(ctx, mt, r.memcachedPDBForMoodle(mt, namespace), &policyv1.PodDisruptionBudget{})
+}
+
+// memcachedStatefulSetForMoodle returns the StatefulSet of the shared Memcached instances
+func (r *MoodleTenantReconciler) memcachedStatefulSetForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *appsv1.StatefulSet {
+	statefulSet := memcachedStatefulSet(memcachedName(mt), namespace, memcachedLabels(mt), memcachedImage(mt), memcachedReplicas(mt), memcachedMemoryMB(mt))
+	applyMemcachedResources(mt, &statefulSet.Spec.Template.Spec.Containers[0])
+	if memcachedAuthenticated(mt) {
+		applyMemcachedSASL(statefulSet, memcachedAuthName(mt))
+	}
+	applyCacheExporter(mt, &statefulSet.Spec.Template)
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, statefulSet, r.Scheme); err != nil {
+		return nil
+	}
+
+	return statefulSet
+}
+
+// reconcileMemcachedAuth keeps the Memcached credentials of the tenant in its namespace:
+// copied from the cache cluster or from auth.secretRef, or generated once. They are
+// removed when Memcached no longer requires authentication.
+func (r *MoodleTenantReconciler) reconcileMemcachedAuth(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if !memcachedAuthenticated(mt) {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: memcachedAuthName(mt), Namespace: namespace}}
+		if err := r.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete Memcached Secret", "Namespace", namespace, "Name", secret.Name)
+			return err
+		}
+		return nil
+	}
+
+	if cc := cacheCluster(mt); cc != nil {
+		source := types.NamespacedName{Name: cc.PasswordSecret, Namespace: cc.Namespace}
+		return r.reconcileCopiedSecret(ctx, mt, source, namespace, memcachedAuthName(mt))
+	}
+	if ref := mt.Spec.Memcached.Auth.SecretRef; ref != nil {
+		source := types.NamespacedName{Name: ref.Name, Namespace: mt.Namespace}
+		return r.reconcileCopiedSecret(ctx, mt, source, namespace, memcachedAuthName(mt))
+	}
+
+	found := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: memcachedAuthName(mt), Namespace: namespace}, found)
+	if err == nil && len(found.Data["password"]) > 0 {
+		return nil
+	} else if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get Memcached Secret")
+		return err
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      memcachedAuthName(mt),
+			Namespace: namespace,
+			Labels:    memcachedLabels(mt),
+		},
+		Data: map[string][]byte{
+			"username": []byte(memcachedSASLUser),
+			"password": []byte(password),
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	return r.reconcileSecretData(ctx, secret)
+}
+
+// applyMemcachedSASL makes the Memcached instances require SASL authentication with the
+// credentials of the named Secret. Memcached checks them against a password file, which
+// is written on startup next to a SASL configuration allowing plain authentication.
+// SASL requires the binary protocol, so the text protocol is turned off.
+func applyMemcachedSASL(statefulSet *appsv1.StatefulSet, secretName string) {
+	podSpec := &statefulSet.Spec.Template.Spec
+	container := &podSpec.Containers[0]
+
+	container.Command = []string{
+		"/bin/sh", "-c",
+		`printf '%s:%s\n' "$MEMCACHED_USERNAME" "$MEMCACHED_PASSWORD" > ` + memcachedSASLDir + `/pwdb && ` +
+			`echo 'mech_list: plain' > ` + memcachedSASLDir + `/memcached.conf && ` +
+			`exec ` + strings.Join(container.Command, " ") + ` -S`,
+	}
+	container.Env = append(container.Env,
+		corev1.EnvVar{
+			Name: "MEMCACHED_USERNAME",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+					Key:                  "username",
+				},
+			},
+		},
+		corev1.EnvVar{
+			Name: "MEMCACHED_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+					Key:                  "password",
+				},
+			},
+		},
+		corev1.EnvVar{Name: "SASL_CONF_PATH", Value: memcachedSASLDir},
+		corev1.EnvVar{Name: "MEMCACHED_SASL_PWDB", Value: memcachedSASLDir + "/pwdb"},
+	)
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "sasl",
+		MountPath: memcachedSASLDir,
+	})
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "sasl",
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+		},
+	})
+}
+
+// memcachedStatefulSet returns a StatefulSet of Memcached instances named by the headless
+// Service of the same name
+func memcachedStatefulSet(name, namespace string, labels map[string]string, image string, replicas int32, memoryMB int) *appsv1.StatefulSet {
+	return &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    ptr.To(replicas),
+			ServiceName: name,
+			// The instances are independent, so they start and stop together
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					SecurityContext: &corev1.PodSecurityContext{
+						RunAsNonRoot: ptr.To(true),
+						RunAsUser:    ptr.To[int64](11211), // memcache
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "memcached",
+							Image: image,
+							Command: []string{
+								"memcached",
+								"-m", fmt.Sprintf("%d", memoryMB),
+								"-I", "2m",
+							},
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "memcached",
+									ContainerPort: memcachedPort,
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									TCPSocket: &corev1.TCPSocketAction{
+										Port: intstr.FromInt(memcachedPort),
+									},
+								},
+								PeriodSeconds: 5,
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("10m"),
+									corev1.ResourceMemory: resource.MustParse(fmt.Sprintf("%dMi", memoryMB)),
+								},
+								Limits: corev1.ResourceList{
+									// Headroom for connections and the hash table above the item memory
+									corev1.ResourceMemory: resource.MustParse(fmt.Sprintf("%dMi", memoryMB+32)),
+								},
+							},
+						},
+					},
+					TopologySpreadConstraints: []corev1.TopologySpreadConstraint{
+						{
+							MaxSkew:           1,
+							TopologyKey:       "kubernetes.io/hostname",
+							WhenUnsatisfiable: corev1.ScheduleAnyway,
+							LabelSelector: &metav1.LabelSelector{
+								MatchLabels: labels,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// memcachedServiceForMoodle returns the headless Service of the shared Memcached instances
+func (r *MoodleTenantReconciler) memcachedServiceForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.Service {
+	service := memcachedService(memcachedName(mt), namespace, memcachedLabels(mt))
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, service, r.Scheme); err != nil {
+		return nil
+	}
+
+	return service
+}
+
+// memcachedService returns the headless Service giving every Memcached instance its own
+// DNS name
+func memcachedService(name, namespace string, labels map[string]string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  labels,
+			// Moodle lists every instance, ready or not, and skips unreachable ones
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "memcached",
+					Port:       memcachedPort,
+					TargetPort: intstr.FromInt(memcachedPort),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+}
+
+// memcachedPDBForMoodle returns the PodDisruptionBudget of the shared Memcached instances
+func (r *MoodleTenantReconciler) memcachedPDBForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *policyv1.PodDisruptionBudget {
+	pdb := memcachedPDB(memcachedName(mt), namespace, memcachedLabels(mt))
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, pdb, r.Scheme); err != nil {
+		return nil
+	}
+
+	return pdb
+}
+
+// memcachedPDB returns a PodDisruptionBudget draining Memcached instances one at a time,
+// so that node maintenance never empties the whole cache at once
+func memcachedPDB(name, namespace string, labels map[string]string) *policyv1.PodDisruptionBudget {
+	maxUnavailable := intstr.FromInt(1)
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+		},
+	}
+}
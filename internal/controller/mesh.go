@@ -0,0 +1,199 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=networking.istio.io,resources=virtualservices;destinationrules,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=security.istio.io,resources=peerauthentications,verbs=get;list;watch;create;update;patch;delete
+
+// Istio kinds, handled as unstructured objects
+var (
+	virtualServiceGVK     = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1", Kind: "VirtualService"}
+	destinationRuleGVK    = schema.GroupVersionKind{Group: "networking.istio.io", Version: "v1", Kind: "DestinationRule"}
+	peerAuthenticationGVK = schema.GroupVersionKind{Group: "security.istio.io", Version: "v1", Kind: "PeerAuthentication"}
+)
+
+// meshControlPlaneNamespace returns the namespace of istiod and the Istio gateways
+func meshControlPlaneNamespace(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.Mesh.ControlPlaneNamespace != "" {
+		return mt.Spec.Mesh.ControlPlaneNamespace
+	}
+	return "istio-system"
+}
+
+// setSidecarInjection labels the pods of template for Istio to inject its sidecar or not
+// in mesh mode. The label is matched by the object selector of the injection webhook, so
+// the tenant namespace needs no istio-injection label. Jobs are never injected, since a
+// sidecar would keep them from ever completing.
+func setSidecarInjection(mt *moodlev1alpha1.MoodleTenant, template *corev1.PodTemplateSpec, inject bool) {
+	if mt.Spec.Mesh == nil {
+		return
+	}
+	template.Labels = mergeStringMaps(template.Labels, map[string]string{
+		"sidecar.istio.io/inject": strconv.FormatBool(inject),
+	})
+}
+
+// reconcileMesh creates or updates the Istio resources of the tenant and removes them
+// when the mesh integration is disabled
+func (r *MoodleTenantReconciler) reconcileMesh(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	if mt.Spec.Mesh == nil {
+		for _, gvk := range []schema.GroupVersionKind{virtualServiceGVK, destinationRuleGVK, peerAuthenticationGVK} {
+			if err := r.deleteUnstructured(ctx, gvk, namespace, mt.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	desired := []*unstructured.Unstructured{
+		r.destinationRuleForMoodle(mt, namespace),
+		r.peerAuthenticationForMoodle(mt, namespace),
+	}
+	if mt.Spec.Mesh.Gateway != "" {
+		desired = append(desired, r.virtualServiceForMoodle(mt, namespace))
+	} else if err := r.deleteUnstructured(ctx, virtualServiceGVK, namespace, mt.Name); err != nil {
+		return err
+	}
+
+	for _, obj := range desired {
+		if _, err := r.reconcileUnstructured(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// virtualServiceForMoodle returns a VirtualService routing the tenant hostnames from the Istio Gateway
+func (r *MoodleTenantReconciler) virtualServiceForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	hosts := []interface{}{}
+	for _, hostname := range tenantHostnames(mt) {
+		hosts = append(hosts, hostname)
+	}
+
+	route := map[string]interface{}{
+		"route": []interface{}{
+			map[string]interface{}{
+				"destination": map[string]interface{}{
+					"host": fmt.Sprintf("%s.%s.svc.cluster.local", ingressBackendService(mt), namespace),
+					"port": map[string]interface{}{
+						"number": int64(80),
+					},
+				},
+			},
+		},
+	}
+
+	// Serve the tenant under its path prefix, which is passed on to Moodle
+	if prefix := mt.Spec.Routing.PathPrefix; prefix != "" {
+		route["match"] = []interface{}{
+			map[string]interface{}{
+				"uri": map[string]interface{}{
+					"prefix": prefix,
+				},
+			},
+		}
+	}
+
+	return r.meshObjectForMoodle(mt, namespace, virtualServiceGVK, map[string]interface{}{
+		"hosts":    hosts,
+		"gateways": []interface{}{mt.Spec.Mesh.Gateway},
+		"http":     []interface{}{route},
+	})
+}
+
+// destinationRuleForMoodle returns a DestinationRule using Istio mutual TLS towards the tenant Service
+func (r *MoodleTenantReconciler) destinationRuleForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	return r.meshObjectForMoodle(mt, namespace, destinationRuleGVK, map[string]interface{}{
+		"host": serviceFQDN(mt, namespace),
+		"trafficPolicy": map[string]interface{}{
+			"tls": map[string]interface{}{
+				"mode": "ISTIO_MUTUAL",
+			},
+		},
+	})
+}
+
+// meshMTLSMode returns the mutual TLS mode of the Moodle pods. Without an Istio Gateway
+// external traffic arrives from an Ingress controller outside the mesh, which STRICT
+// would reject, so the mode defaults to PERMISSIVE then.
+func meshMTLSMode(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.Mesh.MTLSMode != "" {
+		return mt.Spec.Mesh.MTLSMode
+	}
+	if mt.Spec.Mesh.Gateway != "" {
+		return "STRICT"
+	}
+	return "PERMISSIVE"
+}
+
+// peerAuthenticationForMoodle returns a PeerAuthentication enforcing the mTLS mode on the Moodle pods
+func (r *MoodleTenantReconciler) peerAuthenticationForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	mtlsMode := meshMTLSMode(mt)
+
+	return r.meshObjectForMoodle(mt, namespace, peerAuthenticationGVK, map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{
+				"app":                  "moodle",
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+		},
+		"mtls": map[string]interface{}{
+			"mode": mtlsMode,
+		},
+	})
+}
+
+// meshObjectForMoodle returns an Istio object of the given kind named after the tenant
+func (r *MoodleTenantReconciler) meshObjectForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string, gvk schema.GroupVersionKind, spec map[string]interface{}) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": spec,
+		},
+	}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetName(mt.Name)
+	obj.SetNamespace(namespace)
+	obj.SetLabels(map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, obj, r.Scheme); err != nil {
+		return nil
+	}
+
+	return obj
+}
+
+// serviceFQDN returns the cluster-local DNS name of the tenant Service
+func serviceFQDN(mt *moodlev1alpha1.MoodleTenant, namespace string) string {
+	return fmt.Sprintf("%s-service.%s.svc.cluster.local", mt.Name, namespace)
+}
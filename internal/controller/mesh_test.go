@@ -0,0 +1,68 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Mesh", func() {
+	var (
+		reconciler *MoodleTenantReconciler
+		mt         *moodlev1alpha1.MoodleTenant
+	)
+
+	BeforeEach(func() {
+		reconciler = &MoodleTenantReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		mt = &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "biology.bsu.by",
+				Mesh:     &moodlev1alpha1.MeshSpec{},
+			},
+		}
+	})
+
+	mtlsMode := func() string {
+		mode, _, _ := unstructured.NestedString(reconciler.peerAuthenticationForMoodle(mt, "tenant-biology").Object, "spec", "mtls", "mode")
+		return mode
+	}
+
+	It("should only enforce mutual TLS by default behind an Istio Gateway", func() {
+		Expect(mtlsMode()).To(Equal("PERMISSIVE"))
+
+		mt.Spec.Mesh.Gateway = "istio-system/public"
+		Expect(mtlsMode()).To(Equal("STRICT"))
+
+		mt.Spec.Mesh.MTLSMode = "PERMISSIVE"
+		Expect(mtlsMode()).To(Equal("PERMISSIVE"))
+	})
+
+	It("should label the web pods for injection and the Job pods against it", func() {
+		deployment := reconciler.deploymentForMoodle(mt, "tenant-biology")
+		Expect(deployment.Spec.Template.Labels).To(HaveKeyWithValue("sidecar.istio.io/inject", "true"))
+		Expect(deployment.Spec.Selector.MatchLabels).NotTo(HaveKey("sidecar.istio.io/inject"))
+
+		cronJob := reconciler.cronJobForMoodle(mt, "tenant-biology")
+		Expect(cronJob.Spec.JobTemplate.Spec.Template.Labels).To(HaveKeyWithValue("sidecar.istio.io/inject", "false"))
+	})
+})
@@ -0,0 +1,425 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// defaultCacheClusterNamespace is the namespace of cache clusters that predate defaulting
+const defaultCacheClusterNamespace = "moodle-cache"
+
+// cacheClusterLabel links the cache instances to their MoodleCacheCluster
+const cacheClusterLabel = "moodle.bsu.by/cache-cluster"
+
+// MoodleCacheClusterReconciler reconciles a MoodleCacheCluster object
+type MoodleCacheClusterReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodlecacheclusters,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodlecacheclusters/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodlecacheclusters/finalizers,verbs=update
+
+// cacheClusterNamespace returns the namespace the cache instances run in
+func cacheClusterNamespace(cc *moodlev1alpha1.MoodleCacheCluster) string {
+	if cc.Spec.Namespace != "" {
+		return cc.Spec.Namespace
+	}
+	return defaultCacheClusterNamespace
+}
+
+// cacheClusterName returns the name shared by the resources of the cache cluster, which
+// is also the name of the Secret with its credentials
+func cacheClusterName(name, cacheType string) string {
+	if cacheType == cacheTypeRedis {
+		return name + "-redis"
+	}
+	return name + "-memcached"
+}
+
+// cacheClusterLabels returns the labels of the cache instances
+func cacheClusterLabels(cc *moodlev1alpha1.MoodleCacheCluster) map[string]string {
+	return map[string]string{
+		"app":             "moodle-" + cc.Spec.Type,
+		cacheClusterLabel: cc.Name,
+	}
+}
+
+// cacheClusterReplicas returns the number of cache instances
+func cacheClusterReplicas(cc *moodlev1alpha1.MoodleCacheCluster) int32 {
+	if cc.Spec.Type == cacheTypeRedis || cc.Spec.Replicas == 0 {
+		return 1
+	}
+	return cc.Spec.Replicas
+}
+
+// cacheClusterMemoryMB returns the memory of a cache instance in megabytes
+func cacheClusterMemoryMB(cc *moodlev1alpha1.MoodleCacheCluster) int {
+	if cc.Spec.MemoryMB != 0 {
+		return cc.Spec.MemoryMB
+	}
+	return 1024
+}
+
+// cacheClusterPort returns the port of the cache instances
+func cacheClusterPort(cacheType string) int {
+	if cacheType == cacheTypeRedis {
+		return redisPort
+	}
+	return memcachedPort
+}
+
+// cacheClusterServers returns the host:port addresses of the cache instances, through
+// the Service of Redis or one by one through the headless Service of Memcached
+func cacheClusterServers(cc *moodlev1alpha1.MoodleCacheCluster) []string {
+	name := cacheClusterName(cc.Name, cc.Spec.Type)
+	namespace := cacheClusterNamespace(cc)
+	if cc.Spec.Type == cacheTypeRedis {
+		return []string{fmt.Sprintf("%s.%s.svc:%d", name, namespace, redisPort)}
+	}
+	servers := []string{}
+	for i := int32(0); i < cacheClusterReplicas(cc); i++ {
+		servers = append(servers, fmt.Sprintf("%s-%d.%s.%s.svc:%d", name, i, name, namespace, memcachedPort))
+	}
+	return servers
+}
+
+// Reconcile runs the Redis server or Memcached instances of a MoodleCacheCluster in its
+// namespace and publishes their addresses in the status, from which the MoodleTenants
+// referencing the cache cluster configure Moodle
+func (r *MoodleCacheClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	cc := &moodlev1alpha1.MoodleCacheCluster{}
+	if err := r.Get(ctx, req.NamespacedName, cc); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get MoodleCacheCluster")
+		return ctrl.Result{}, err
+	}
+	if !cc.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	namespace := cacheClusterNamespace(cc)
+	if err := r.reconcileNamespace(ctx, namespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Switching the type removes the instances of the other one
+	for _, cacheType := range []string{cacheTypeRedis, "memcached"} {
+		if cacheType == cc.Spec.Type {
+			continue
+		}
+		objectMeta := metav1.ObjectMeta{Name: cacheClusterName(cc.Name, cacheType), Namespace: namespace}
+		for _, obj := range []client.Object{
+			&corev1.Service{ObjectMeta: objectMeta},
+			&appsv1.Deployment{ObjectMeta: objectMeta},
+			&appsv1.StatefulSet{ObjectMeta: objectMeta},
+			&policyv1.PodDisruptionBudget{ObjectMeta: objectMeta},
+			&corev1.Secret{ObjectMeta: objectMeta},
+		} {
+			if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "Failed to delete cache resource", "Namespace", namespace, "Name", obj.GetName())
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	originalStatus := cc.Status.DeepCopy()
+	name := cacheClusterName(cc.Name, cc.Spec.Type)
+	labels := cacheClusterLabels(cc)
+	image := cc.Spec.Image
+
+	var readyReplicas int32
+	if cc.Spec.Type == cacheTypeRedis {
+		if image == "" {
+			image = "redis:7-alpine"
+		}
+		if err := r.reconcilePassword(ctx, cc, name, namespace); err != nil {
+			return ctrl.Result{}, err
+		}
+		deployment := redisDeployment(name, namespace, labels, image, cacheClusterMemoryMB(cc))
+		found := &appsv1.Deployment{}
+		if err := r.reconcileObject(ctx, cc, deployment, found); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.reconcileObject(ctx, cc, redisService(name, namespace, labels), &corev1.Service{}); err != nil {
+			return ctrl.Result{}, err
+		}
+		readyReplicas = found.Status.ReadyReplicas
+		cc.Status.PasswordSecret = name
+	} else {
+		if image == "" {
+			image = defaultMemcachedImage
+		}
+		statefulSet := memcachedStatefulSet(name, namespace, labels, image, cacheClusterReplicas(cc), cacheClusterMemoryMB(cc))
+		cc.Status.PasswordSecret = ""
+		if cc.Spec.Auth {
+			if err := r.reconcilePassword(ctx, cc, name, namespace); err != nil {
+				return ctrl.Result{}, err
+			}
+			applyMemcachedSASL(statefulSet, name)
+			cc.Status.PasswordSecret = name
+		} else if err := r.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete Memcached Secret", "Namespace", namespace, "Name", name)
+			return ctrl.Result{}, err
+		}
+		found := &appsv1.StatefulSet{}
+		if err := r.reconcileObject(ctx, cc, statefulSet, found); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.reconcileObject(ctx, cc, memcachedService(name, namespace, labels), &corev1.Service{}); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.reconcileObject(ctx, cc, memcachedPDB(name, namespace, labels), &policyv1.PodDisruptionBudget{}); err != nil {
+			return ctrl.Result{}, err
+		}
+		readyReplicas = found.Status.ReadyReplicas
+	}
+
+	if err := r.reconcileObject(ctx, cc, r.networkPolicyForCacheCluster(cc, namespace), &networkingv1.NetworkPolicy{}); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	tenants := &moodlev1alpha1.MoodleTenantList{}
+	if err := r.List(ctx, tenants); err != nil {
+		logger.Error(err, "Failed to list MoodleTenants")
+		return ctrl.Result{}, err
+	}
+	cc.Status.Tenants = 0
+	for _, mt := range tenants.Items {
+		if ref := mt.Spec.Cache.ClusterRef; ref != nil && ref.Name == cc.Name {
+			cc.Status.Tenants++
+		}
+	}
+
+	cc.Status.Servers = cacheClusterServers(cc)
+	cc.Status.ReadyReplicas = readyReplicas
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionCacheClusterReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Ready",
+		Message:            fmt.Sprintf("All %d instances are ready", cacheClusterReplicas(cc)),
+		ObservedGeneration: cc.Generation,
+	}
+	if readyReplicas < cacheClusterReplicas(cc) {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NotReady"
+		condition.Message = fmt.Sprintf("%d of %d instances are ready", readyReplicas, cacheClusterReplicas(cc))
+	}
+	meta.SetStatusCondition(&cc.Status.Conditions, condition)
+
+	if !equality.Semantic.DeepEqual(originalStatus, &cc.Status) {
+		if err := r.Status().Update(ctx, cc); err != nil {
+			logger.Error(err, "Failed to update MoodleCacheCluster status")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// reconcileNamespace creates the namespace of the cache instances. It may be shared by
+// several cache clusters, so it is never deleted.
+func (r *MoodleCacheClusterReconciler) reconcileNamespace(ctx context.Context, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	err := r.Get(ctx, types.NamespacedName{Name: namespace}, &corev1.Namespace{})
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new Namespace", "Namespace.Name", namespace)
+		if err := r.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}); err != nil {
+			logger.Error(err, "Failed to create new Namespace", "Namespace.Name", namespace)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get Namespace")
+		return err
+	}
+	return nil
+}
+
+// reconcilePassword generates the password of the Redis server, or the SASL credentials
+// of the Memcached instances, once
+func (r *MoodleCacheClusterReconciler) reconcilePassword(ctx context.Context, cc *moodlev1alpha1.MoodleCacheCluster, name, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	found := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, found)
+	if err == nil && len(found.Data["password"]) > 0 {
+		return nil
+	} else if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get cache Secret")
+		return err
+	}
+	exists := err == nil
+
+	password, err := generatePassword()
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    cacheClusterLabels(cc),
+		},
+		Data: map[string][]byte{
+			"password": []byte(password),
+		},
+	}
+	if cc.Spec.Type != cacheTypeRedis {
+		secret.Data["username"] = []byte(memcachedSASLUser)
+	}
+
+	// Set MoodleCacheCluster instance as the owner
+	if err := ctrl.SetControllerReference(cc, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	if !exists {
+		logger.Info("Creating a new Secret", "Secret.Namespace", namespace, "Secret.Name", name)
+		return r.Create(ctx, secret)
+	}
+	found.Data = secret.Data
+	logger.Info("Updating Secret", "Secret.Namespace", namespace, "Secret.Name", name)
+	return r.Update(ctx, found)
+}
+
+// reconcileObject sets the MoodleCacheCluster as the owner of desired, creates it if it
+// does not exist and corrects drift otherwise. found must be an empty object of the same
+// type as desired and holds the live object afterwards.
+func (r *MoodleCacheClusterReconciler) reconcileObject(ctx context.Context, cc *moodlev1alpha1.MoodleCacheCluster, desired, found client.Object) error {
+	logger := log.FromContext(ctx)
+	kind := reflect.TypeOf(desired).Elem().Name()
+
+	// Set MoodleCacheCluster instance as the owner
+	if err := ctrl.SetControllerReference(cc, desired, r.Scheme); err != nil {
+		return err
+	}
+
+	err := r.Get(ctx, types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new "+kind, "Namespace", desired.GetNamespace(), "Name", desired.GetName())
+		applied, err := lastAppliedFor(fieldPaths(defaultDriftIgnoredFields, kind), desired)
+		if err != nil {
+			return err
+		}
+		if err := setLastApplied(desired, applied); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, desired); err != nil {
+			logger.Error(err, "Failed to create new "+kind, "Namespace", desired.GetNamespace(), "Name", desired.GetName())
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get "+kind)
+		return err
+	}
+
+	return correctObjectDrift(ctx, r.Client, fieldPaths(defaultDriftIgnoredFields, kind), desired, found)
+}
+
+// networkPolicyForCacheCluster returns the NetworkPolicy admitting the pods of tenant
+// namespaces, and nothing else, to the cache instances. Tenants are only separated by
+// their key prefix, so the cache must not be reachable from other workloads.
+func (r *MoodleCacheClusterReconciler) networkPolicyForCacheCluster(cc *moodlev1alpha1.MoodleCacheCluster, namespace string) *networkingv1.NetworkPolicy {
+	protocolTCP := corev1.ProtocolTCP
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cc.Name,
+			Namespace: namespace,
+			Labels:    cacheClusterLabels(cc),
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{cacheClusterLabel: cc.Name},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{
+						{
+							NamespaceSelector: &metav1.LabelSelector{
+								MatchExpressions: []metav1.LabelSelectorRequirement{
+									{Key: tenantNamespaceLabel, Operator: metav1.LabelSelectorOpExists},
+								},
+							},
+						},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						{
+							Protocol: &protocolTCP,
+							Port:     ptr.To(intstr.FromInt(cacheClusterPort(cc.Spec.Type))),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// cacheClusterForTenant maps a MoodleTenant to the MoodleCacheCluster it references, which
+// counts its tenants
+func cacheClusterForTenant(_ context.Context, obj client.Object) []reconcile.Request {
+	mt, ok := obj.(*moodlev1alpha1.MoodleTenant)
+	if !ok || mt.Spec.Cache.ClusterRef == nil {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: mt.Spec.Cache.ClusterRef.Name}}}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MoodleCacheClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&moodlev1alpha1.MoodleCacheCluster{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.Secret{}).
+		Owns(&networkingv1.NetworkPolicy{}).
+		Owns(&policyv1.PodDisruptionBudget{}).
+		Watches(&moodlev1alpha1.MoodleTenant{}, handler.EnqueueRequestsFromMapFunc(cacheClusterForTenant)).
+		Named("moodlecachecluster").
+		Complete(r)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("MoodleCacheCluster Controller", func() {
+	It("should run the shared Redis server and point its tenants at it", func() {
+		ctx := context.Background()
+
+		cc := &moodlev1alpha1.MoodleCacheCluster{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared", UID: "shared-uid"},
+			Spec:       moodlev1alpha1.MoodleCacheClusterSpec{Type: "redis", Namespace: "moodle-cache"},
+		}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-dept", UID: "biology-dept-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Cache: moodlev1alpha1.CacheSpec{
+					Type:       "memcached",
+					ClusterRef: &corev1.LocalObjectReference{Name: "shared"},
+				},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithObjects(cc, mt).
+			WithStatusSubresource(cc).
+			Build()
+
+		// Until the cache cluster has servers Moodle keeps its default file cache
+		tenantReconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		Expect(tenantReconciler.resolveCacheCluster(ctx, mt)).To(Succeed())
+		Expect(meta.IsStatusConditionFalse(mt.Status.Conditions, moodlev1alpha1.ConditionCacheClusterResolved)).To(BeTrue())
+		Expect(cacheType(mt)).To(BeEmpty())
+
+		reconciler := &MoodleCacheClusterReconciler{Client: c, Scheme: c.Scheme()}
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "shared"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, types.NamespacedName{Name: "moodle-cache"}, &corev1.Namespace{})).To(Succeed())
+		Expect(c.Get(ctx, types.NamespacedName{Name: "shared-redis", Namespace: "moodle-cache"}, &appsv1.Deployment{})).To(Succeed())
+		Expect(c.Get(ctx, types.NamespacedName{Name: "shared-redis", Namespace: "moodle-cache"}, &corev1.Secret{})).To(Succeed())
+		Expect(c.Get(ctx, types.NamespacedName{Name: "shared"}, cc)).To(Succeed())
+		Expect(cc.Status.Servers).To(Equal([]string{"shared-redis.moodle-cache.svc:6379"}))
+		Expect(cc.Status.Tenants).To(Equal(int32(1)))
+
+		Expect(tenantReconciler.reconcileCache(ctx, mt, "tenant-biology-dept")).To(Succeed())
+		Expect(meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionCacheClusterResolved)).To(BeTrue())
+		Expect(sessionStore(mt)).To(Equal(sessionStoreRedis))
+		Expect(c.Get(ctx, types.NamespacedName{Name: "biology-dept-redis", Namespace: "tenant-biology-dept"}, &corev1.Secret{})).To(Succeed())
+		Expect(cacheEnv(mt)).To(ContainElements(
+			corev1.EnvVar{Name: "REDIS_HOST", Value: "shared-redis.moodle-cache.svc"},
+			corev1.EnvVar{Name: "REDIS_PORT", Value: "6379"},
+			corev1.EnvVar{Name: "REDIS_PREFIX", Value: "biology-dept_"},
+			corev1.EnvVar{Name: "MUC_APPLICATION_STORE", Value: "redis"},
+			corev1.EnvVar{Name: "MUC_SESSION_STORE", Value: "redis"},
+		))
+	})
+})
@@ -0,0 +1,459 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// dumpFinalizer removes the dump Job and copied credentials, which live in the tenant
+// namespace and cannot be owned by the MoodleDatabaseDump
+const dumpFinalizer = "moodle.bsu.by/dump-cleanup"
+
+// Labels linking the dump Job and copied credentials to their MoodleDatabaseDump
+const (
+	dumpNameLabel      = "moodle.bsu.by/dump"
+	dumpNamespaceLabel = "moodle.bsu.by/dump-namespace"
+)
+
+// MoodleDatabaseDumpReconciler reconciles a MoodleDatabaseDump object
+type MoodleDatabaseDumpReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodledatabasedumps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodledatabasedumps/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodledatabasedumps/finalizers,verbs=update
+
+// Reconcile runs the dump Job of a MoodleDatabaseDump in the tenant namespace, where the
+// database credentials are, and records its outcome and the artifact location in the status
+func (r *MoodleDatabaseDumpReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	dump := &moodlev1alpha1.MoodleDatabaseDump{}
+	if err := r.Get(ctx, req.NamespacedName, dump); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get MoodleDatabaseDump")
+		return ctrl.Result{}, err
+	}
+
+	tenantNamespace := "tenant-" + dump.Spec.TenantRef.Name
+
+	if !dump.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(dump, dumpFinalizer) {
+			if err := r.cleanupDump(ctx, dump, tenantNamespace, true); err != nil {
+				return ctrl.Result{}, err
+			}
+			controllerutil.RemoveFinalizer(dump, dumpFinalizer)
+			if err := r.Update(ctx, dump); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// A dump runs once
+	if dump.Status.Phase == moodlev1alpha1.DumpPhaseSucceeded || dump.Status.Phase == moodlev1alpha1.DumpPhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(dump, dumpFinalizer) {
+		controllerutil.AddFinalizer(dump, dumpFinalizer)
+		if err := r.Update(ctx, dump); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	originalStatus := dump.Status.DeepCopy()
+	result, err := r.reconcileDump(ctx, dump, tenantNamespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !equality.Semantic.DeepEqual(originalStatus, &dump.Status) {
+		if err := r.Status().Update(ctx, dump); err != nil {
+			logger.Error(err, "Failed to update MoodleDatabaseDump status")
+			return ctrl.Result{}, err
+		}
+	}
+	return result, nil
+}
+
+// reconcileDump creates the dump Job and mirrors its state into the status
+func (r *MoodleDatabaseDumpReconciler) reconcileDump(ctx context.Context, dump *moodlev1alpha1.MoodleDatabaseDump, namespace string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	mt := &moodlev1alpha1.MoodleTenant{}
+	if err := r.Get(ctx, types.NamespacedName{Name: dump.Spec.TenantRef.Name, Namespace: dump.Namespace}, mt); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		setDumpPending(dump, "TenantNotFound", fmt.Sprintf("MoodleTenant %s not found", dump.Spec.TenantRef.Name))
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	if mt.Spec.DatabaseRef.IAM != nil {
+		return ctrl.Result{}, r.failDump(ctx, dump, namespace, "Unsupported", "Dumps of databases with IAM authentication are not supported")
+	}
+	if dump.Spec.Format == "custom" && databaseType(mt) != "pgsql" {
+		return ctrl.Result{}, r.failDump(ctx, dump, namespace, "Unsupported", "The custom format requires a PostgreSQL database")
+	}
+
+	if s3 := dump.Spec.Destination.S3; s3 != nil {
+		if err := r.reconcileDumpCredentials(ctx, dump, namespace); err != nil {
+			if errors.IsNotFound(err) {
+				setDumpPending(dump, "CredentialsNotFound", fmt.Sprintf("Secret %s not found", s3.CredentialsSecretRef.Name))
+				return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+			}
+			return ctrl.Result{}, err
+		}
+	}
+
+	job := r.dumpJobForMoodle(dump, mt, namespace)
+
+	found := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new database dump Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new database dump Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return ctrl.Result{}, err
+		}
+		found = job
+		dump.Status.StartTime = ptr.To(metav1.Now())
+	} else if err != nil {
+		logger.Error(err, "Failed to get database dump Job")
+		return ctrl.Result{}, err
+	}
+	dump.Status.JobName = found.Name
+
+	switch {
+	case found.Status.Succeeded > 0:
+		dump.Status.Phase = moodlev1alpha1.DumpPhaseSucceeded
+		dump.Status.Artifact = dumpArtifact(dump, mt, namespace)
+		dump.Status.CompletionTime = ptr.To(metav1.Now())
+		meta.SetStatusCondition(&dump.Status.Conditions, metav1.Condition{
+			Type:               moodlev1alpha1.ConditionDumpComplete,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Succeeded",
+			Message:            fmt.Sprintf("Dump written to %s", dump.Status.Artifact),
+			ObservedGeneration: dump.Generation,
+		})
+		return ctrl.Result{}, r.cleanupDump(ctx, dump, namespace, false)
+	case jobFailed(found):
+		return ctrl.Result{}, r.failDump(ctx, dump, namespace, "JobFailed", fmt.Sprintf("Job %s/%s failed, see its logs", found.Namespace, found.Name))
+	}
+
+	dump.Status.Phase = moodlev1alpha1.DumpPhaseRunning
+	meta.SetStatusCondition(&dump.Status.Conditions, metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDumpComplete,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Running",
+		Message:            fmt.Sprintf("Job %s/%s is dumping the database", found.Namespace, found.Name),
+		ObservedGeneration: dump.Generation,
+	})
+	return ctrl.Result{}, nil
+}
+
+// setDumpPending records why the dump cannot start yet
+func setDumpPending(dump *moodlev1alpha1.MoodleDatabaseDump, reason, message string) {
+	dump.Status.Phase = moodlev1alpha1.DumpPhasePending
+	meta.SetStatusCondition(&dump.Status.Conditions, metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDumpComplete,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: dump.Generation,
+	})
+}
+
+// failDump finishes the dump unsuccessfully
+func (r *MoodleDatabaseDumpReconciler) failDump(ctx context.Context, dump *moodlev1alpha1.MoodleDatabaseDump, namespace, reason, message string) error {
+	dump.Status.Phase = moodlev1alpha1.DumpPhaseFailed
+	dump.Status.CompletionTime = ptr.To(metav1.Now())
+	meta.SetStatusCondition(&dump.Status.Conditions, metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDumpComplete,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: dump.Generation,
+	})
+	return r.cleanupDump(ctx, dump, namespace, false)
+}
+
+// dumpCredentialsSecretName returns the name of the object store credentials copied
+// into the tenant namespace
+func dumpCredentialsSecretName(dump *moodlev1alpha1.MoodleDatabaseDump) string {
+	return dump.Name + "-dump-s3"
+}
+
+// reconcileDumpCredentials copies the object store credentials into the tenant namespace
+func (r *MoodleDatabaseDumpReconciler) reconcileDumpCredentials(ctx context.Context, dump *moodlev1alpha1.MoodleDatabaseDump, namespace string) error {
+	source := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: dump.Spec.Destination.S3.CredentialsSecretRef.Name, Namespace: dump.Namespace}, source); err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dumpCredentialsSecretName(dump),
+			Namespace: namespace,
+			Labels:    dumpLabels(dump),
+		},
+		Data: source.Data,
+	}
+	if err := r.Create(ctx, secret); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// cleanupDump deletes the copied credentials once the dump has finished, and the Job as
+// well when the MoodleDatabaseDump is deleted
+func (r *MoodleDatabaseDumpReconciler) cleanupDump(ctx context.Context, dump *moodlev1alpha1.MoodleDatabaseDump, namespace string, deleteJob bool) error {
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: dumpCredentialsSecretName(dump), Namespace: namespace}}
+	if err := r.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	if deleteJob {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: dumpJobName(dump), Namespace: namespace}}
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpLabels returns the labels linking an object in the tenant namespace to the dump
+func dumpLabels(dump *moodlev1alpha1.MoodleDatabaseDump) map[string]string {
+	return map[string]string{
+		"moodle.bsu.by/tenant": dump.Spec.TenantRef.Name,
+		dumpNameLabel:          dump.Name,
+		dumpNamespaceLabel:     dump.Namespace,
+	}
+}
+
+// dumpJobName returns the name of the dump Job in the tenant namespace
+func dumpJobName(dump *moodlev1alpha1.MoodleDatabaseDump) string {
+	return dump.Name + "-dump"
+}
+
+// dumpFileName returns the name of the dump file
+func dumpFileName(dump *moodlev1alpha1.MoodleDatabaseDump) string {
+	if dump.Spec.Format == "custom" {
+		return dump.Name + ".dump"
+	}
+	return dump.Name + ".sql.gz"
+}
+
+// dumpArtifact returns the location of the dump file
+func dumpArtifact(dump *moodlev1alpha1.MoodleDatabaseDump, mt *moodlev1alpha1.MoodleTenant, namespace string) string {
+	if s3 := dump.Spec.Destination.S3; s3 != nil {
+		return "s3://" + s3.Bucket + "/" + dumpObjectKey(dump, mt)
+	}
+	return "pvc://" + namespace + "/" + dump.Spec.Destination.PVC.ClaimName + "/" + dumpFilePath(dump, mt)
+}
+
+// dumpFilePath returns the path of the dump file inside the destination volume
+func dumpFilePath(dump *moodlev1alpha1.MoodleDatabaseDump, mt *moodlev1alpha1.MoodleTenant) string {
+	dir := "dumps"
+	if dump.Spec.Destination.PVC.Path != "" {
+		dir = dump.Spec.Destination.PVC.Path
+	}
+	return path.Join(dir, mt.Name, dumpFileName(dump))
+}
+
+// dumpObjectKey returns the object key of the dump file
+func dumpObjectKey(dump *moodlev1alpha1.MoodleDatabaseDump, mt *moodlev1alpha1.MoodleTenant) string {
+	return path.Join(dump.Spec.Destination.S3.Prefix, mt.Name, dumpFileName(dump))
+}
+
+// dumpScript returns the script writing the dump to $DUMP_FILE. Plain dumps are compressed
+// after writing, so that a failing dump client fails the Job without relying on pipefail.
+func dumpScript(dump *moodlev1alpha1.MoodleDatabaseDump, mt *moodlev1alpha1.MoodleTenant) string {
+	switch {
+	case databaseType(mt) != "pgsql":
+		return `set -e
+mkdir -p "$(dirname "$DUMP_FILE")"
+mariadb-dump --single-transaction --routines --host="$DB_HOST" --port="$DB_PORT" --user="$DB_USER" --result-file="${DUMP_FILE%.gz}" "$DB_NAME"
+gzip -f "${DUMP_FILE%.gz}"
+`
+	case dump.Spec.Format == "custom":
+		return `set -e
+mkdir -p "$(dirname "$DUMP_FILE")"
+pg_dump --no-owner --no-privileges ${DB_SCHEMA:+--schema=$DB_SCHEMA} --format=custom --file="$DUMP_FILE"
+`
+	}
+	return `set -e
+mkdir -p "$(dirname "$DUMP_FILE")"
+pg_dump --no-owner --no-privileges ${DB_SCHEMA:+--schema=$DB_SCHEMA} --file="${DUMP_FILE%.gz}"
+gzip -f "${DUMP_FILE%.gz}"
+`
+}
+
+// dumpJobForMoodle returns the Job dumping the tenant database with the credentials of
+// the database Secret
+func (r *MoodleDatabaseDumpReconciler) dumpJobForMoodle(dump *moodlev1alpha1.MoodleDatabaseDump, mt *moodlev1alpha1.MoodleTenant, namespace string) *batchv1.Job {
+	postgres := databaseType(mt) == "pgsql"
+
+	image := "mariadb:11"
+	if postgres {
+		image = "postgres:17-alpine"
+	}
+	if dump.Spec.Image != "" {
+		image = dump.Spec.Image
+	}
+
+	env := databaseClientEnv(mt)
+
+	dumpDir := "/dump"
+	dumpFile := path.Join(dumpDir, dumpFileName(dump))
+	volume := corev1.Volume{
+		Name:         "dump",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}
+	if pvc := dump.Spec.Destination.PVC; pvc != nil {
+		dumpFile = path.Join(dumpDir, dumpFilePath(dump, mt))
+		volume.VolumeSource = corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvc.ClaimName},
+		}
+	}
+
+	dumpContainer := corev1.Container{
+		Name:         "dump",
+		Image:        image,
+		Command:      []string{"sh", "-c", dumpScript(dump, mt)},
+		Env:          append(env, corev1.EnvVar{Name: "DUMP_FILE", Value: dumpFile}),
+		VolumeMounts: []corev1.VolumeMount{{Name: "dump", MountPath: dumpDir}},
+	}
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		SecurityContext: &corev1.PodSecurityContext{
+			FSGroup: ptr.To[int64](33), // www-data, so that Moodle can read dumps in moodledata
+		},
+		Containers: []corev1.Container{dumpContainer},
+		Volumes:    []corev1.Volume{volume},
+	}
+
+	// Object store dumps are written to an emptyDir first and uploaded by the AWS CLI
+	if s3 := dump.Spec.Destination.S3; s3 != nil {
+		upload := `aws s3 cp "$DUMP_FILE" "s3://$S3_BUCKET/$S3_KEY"`
+		if s3.EndpointURL != "" {
+			upload += ` --endpoint-url "$S3_ENDPOINT_URL"`
+		}
+		uploadEnv := []corev1.EnvVar{
+			{Name: "DUMP_FILE", Value: dumpFile},
+			{Name: "S3_BUCKET", Value: s3.Bucket},
+			{Name: "S3_KEY", Value: dumpObjectKey(dump, mt)},
+			{Name: "S3_ENDPOINT_URL", Value: s3.EndpointURL},
+		}
+		if s3.Region != "" {
+			uploadEnv = append(uploadEnv, corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: s3.Region})
+		}
+
+		podSpec.InitContainers = []corev1.Container{dumpContainer}
+		podSpec.Containers = []corev1.Container{
+			{
+				Name:    "upload",
+				Image:   "amazon/aws-cli:2.22.0",
+				Command: []string{"sh", "-c", upload},
+				Env:     uploadEnv,
+				EnvFrom: []corev1.EnvFromSource{
+					{
+						SecretRef: &corev1.SecretEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: dumpCredentialsSecretName(dump)},
+						},
+					},
+				},
+				VolumeMounts: []corev1.VolumeMount{{Name: "dump", MountPath: dumpDir}},
+			},
+		}
+	}
+
+	// The dump connects with the same TLS settings as Moodle
+	if postgres {
+		applyDatabaseTLS(mt, &podSpec, true)
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dumpJobName(dump),
+			Namespace: namespace,
+			Labels:    mergeStringMaps(dumpLabels(dump), map[string]string{"moodle.bsu.by/job": "database-dump"}),
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: ptr.To[int32](1),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"moodle.bsu.by/tenant": mt.Name,
+					},
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+
+	// A sidecar would keep the Job from ever completing
+	setSidecarInjection(mt, &job.Spec.Template, false)
+
+	return job
+}
+
+// dumpForJob maps a dump Job in a tenant namespace to its MoodleDatabaseDump
+func dumpForJob(_ context.Context, obj client.Object) []reconcile.Request {
+	name, namespace := obj.GetLabels()[dumpNameLabel], obj.GetLabels()[dumpNamespaceLabel]
+	if name == "" || namespace == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MoodleDatabaseDumpReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&moodlev1alpha1.MoodleDatabaseDump{}).
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(dumpForJob)).
+		Named("moodledatabasedump").
+		Complete(r)
+}
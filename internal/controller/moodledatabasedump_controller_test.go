@@ -0,0 +1,86 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("MoodleDatabaseDump Controller", func() {
+	It("should run the dump Job and record the artifact", func() {
+		ctx := context.Background()
+
+		tenant := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-dept", Namespace: "default"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "biology.bsu.by",
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Host:        "postgres-cluster.db-tier.svc",
+					AdminSecret: "biology-dept-db",
+				},
+			},
+		}
+		dump := &moodlev1alpha1.MoodleDatabaseDump{
+			ObjectMeta: metav1.ObjectMeta{Name: "before-import", Namespace: "default"},
+			Spec: moodlev1alpha1.MoodleDatabaseDumpSpec{
+				TenantRef: corev1.LocalObjectReference{Name: "biology-dept"},
+				Destination: moodlev1alpha1.DumpDestinationSpec{
+					PVC: &moodlev1alpha1.DumpPVCDestination{ClaimName: "biology-dept-data"},
+				},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithObjects(tenant, dump).
+			WithStatusSubresource(dump).
+			Build()
+		reconciler := &MoodleDatabaseDumpReconciler{Client: c, Scheme: c.Scheme()}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "before-import", Namespace: "default"}}
+
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "before-import-dump", Namespace: "tenant-biology-dept"}, job)).To(Succeed())
+		Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal("postgres:17-alpine"))
+		Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+			Name: "DUMP_FILE", Value: "/dump/dumps/biology-dept/before-import.sql.gz",
+		}))
+
+		Expect(c.Get(ctx, request.NamespacedName, dump)).To(Succeed())
+		Expect(dump.Status.Phase).To(Equal(moodlev1alpha1.DumpPhaseRunning))
+
+		job.Status.Succeeded = 1
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, request.NamespacedName, dump)).To(Succeed())
+		Expect(dump.Status.Phase).To(Equal(moodlev1alpha1.DumpPhaseSucceeded))
+		Expect(dump.Status.Artifact).To(Equal("pvc://tenant-biology-dept/biology-dept-data/dumps/biology-dept/before-import.sql.gz"))
+	})
+})
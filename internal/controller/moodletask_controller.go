@@ -0,0 +1,318 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// taskFinalizer removes the task Job, which lives in the tenant namespace and cannot be
+// owned by the MoodleTask
+const taskFinalizer = "moodle.bsu.by/task-cleanup"
+
+// Labels linking the task Job to its MoodleTask
+const (
+	taskNameLabel      = "moodle.bsu.by/task"
+	taskNamespaceLabel = "moodle.bsu.by/task-namespace"
+)
+
+// DefaultTaskAllowedScripts are the scripts MoodleTasks may run unless configured
+// otherwise: Moodle's own CLI scripts and those of admin tools
+var DefaultTaskAllowedScripts = []string{"admin/cli/*.php", "admin/tool/*/cli/*.php"}
+
+// MoodleTaskReconciler reconciles a MoodleTask object
+type MoodleTaskReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+
+	// APIReader reads the pods of task Jobs uncached, so that the operator does not
+	// cache every pod of the cluster. Exit codes and pod names are not recorded when nil.
+	APIReader client.Reader
+
+	// AllowedScripts are path.Match patterns of the scripts MoodleTasks may run,
+	// relative to the Moodle root. Defaults to DefaultTaskAllowedScripts.
+	AllowedScripts []string
+}
+
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletasks,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletasks/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletasks/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list
+
+// Reconcile runs the Job of a MoodleTask in the tenant namespace, with the environment
+// of the cron pods, and records its outcome, exit code and pod in the status
+func (r *MoodleTaskReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	task := &moodlev1alpha1.MoodleTask{}
+	if err := r.Get(ctx, req.NamespacedName, task); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get MoodleTask")
+		return ctrl.Result{}, err
+	}
+
+	tenantNamespace := "tenant-" + task.Spec.TenantRef.Name
+
+	if !task.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(task, taskFinalizer) {
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: taskJobName(task), Namespace: tenantNamespace}}
+			if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+			controllerutil.RemoveFinalizer(task, taskFinalizer)
+			if err := r.Update(ctx, task); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// A task runs once
+	if task.Status.Phase == moodlev1alpha1.TaskPhaseSucceeded || task.Status.Phase == moodlev1alpha1.TaskPhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	if !controllerutil.ContainsFinalizer(task, taskFinalizer) {
+		controllerutil.AddFinalizer(task, taskFinalizer)
+		if err := r.Update(ctx, task); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	originalStatus := task.Status.DeepCopy()
+	result, err := r.reconcileTask(ctx, task, tenantNamespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !equality.Semantic.DeepEqual(originalStatus, &task.Status) {
+		if err := r.Status().Update(ctx, task); err != nil {
+			logger.Error(err, "Failed to update MoodleTask status")
+			return ctrl.Result{}, err
+		}
+	}
+	return result, nil
+}
+
+// reconcileTask creates the task Job and mirrors its state into the status
+func (r *MoodleTaskReconciler) reconcileTask(ctx context.Context, task *moodlev1alpha1.MoodleTask, namespace string) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	if !r.scriptAllowed(task.Spec.Script) {
+		finishTask(task, moodlev1alpha1.TaskPhaseFailed, "ScriptNotAllowed", fmt.Sprintf("%s is not allowed by the operator", task.Spec.Script))
+		return ctrl.Result{}, nil
+	}
+
+	mt := &moodlev1alpha1.MoodleTenant{}
+	if err := r.Get(ctx, types.NamespacedName{Name: task.Spec.TenantRef.Name, Namespace: task.Namespace}, mt); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		setTaskCondition(task, moodlev1alpha1.TaskPhasePending, metav1.ConditionFalse, "TenantNotFound", fmt.Sprintf("MoodleTenant %s not found", task.Spec.TenantRef.Name))
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+	// The task pod is set up like the cron pods, with the presets of the class
+	if err := withTenantClass(ctx, r.Client, mt); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		setTaskCondition(task, moodlev1alpha1.TaskPhasePending, metav1.ConditionFalse, "ClassNotFound", fmt.Sprintf("MoodleTenantClass %s of MoodleTenant %s not found", mt.Spec.ClassRef.Name, mt.Name))
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	job := taskJobForMoodle(task, mt, namespace)
+
+	found := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new task Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new task Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return ctrl.Result{}, err
+		}
+		found = job
+		task.Status.StartTime = ptr.To(metav1.Now())
+	} else if err != nil {
+		logger.Error(err, "Failed to get task Job")
+		return ctrl.Result{}, err
+	}
+	task.Status.JobName = found.Name
+
+	if err := r.recordTaskPod(ctx, task, found); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	switch {
+	case found.Status.Succeeded > 0:
+		finishTask(task, moodlev1alpha1.TaskPhaseSucceeded, "Succeeded", fmt.Sprintf("%s finished", task.Spec.Script))
+	case jobFailed(found):
+		message := fmt.Sprintf("%s failed, see the logs of Job %s/%s", task.Spec.Script, found.Namespace, found.Name)
+		if task.Status.ExitCode != nil {
+			message = fmt.Sprintf("%s exited with code %d, see the logs of pod %s/%s", task.Spec.Script, *task.Status.ExitCode, found.Namespace, task.Status.PodName)
+		}
+		finishTask(task, moodlev1alpha1.TaskPhaseFailed, "Failed", message)
+	default:
+		setTaskCondition(task, moodlev1alpha1.TaskPhaseRunning, metav1.ConditionFalse, "Running", fmt.Sprintf("Job %s/%s is running %s", found.Namespace, found.Name, task.Spec.Script))
+	}
+	return ctrl.Result{}, nil
+}
+
+// scriptAllowed reports whether the operator may run a script for a MoodleTask
+func (r *MoodleTaskReconciler) scriptAllowed(script string) bool {
+	patterns := r.AllowedScripts
+	if len(patterns) == 0 {
+		patterns = DefaultTaskAllowedScripts
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, script); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// recordTaskPod records the latest pod of the task Job and the exit code of the script
+// once it has terminated
+func (r *MoodleTaskReconciler) recordTaskPod(ctx context.Context, task *moodlev1alpha1.MoodleTask, job *batchv1.Job) error {
+	if r.APIReader == nil {
+		return nil
+	}
+
+	pods := &corev1.PodList{}
+	if err := r.APIReader.List(ctx, pods, client.InNamespace(job.Namespace), client.MatchingLabels{"batch.kubernetes.io/job-name": job.Name}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list task pods")
+		return err
+	}
+
+	var latest *corev1.Pod
+	for i := range pods.Items {
+		if latest == nil || latest.CreationTimestamp.Before(&pods.Items[i].CreationTimestamp) {
+			latest = &pods.Items[i]
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	task.Status.PodName = latest.Name
+	for _, status := range latest.Status.ContainerStatuses {
+		if status.Name == "moodle-task" && status.State.Terminated != nil {
+			task.Status.ExitCode = ptr.To(status.State.Terminated.ExitCode)
+		}
+	}
+	return nil
+}
+
+// setTaskCondition records the phase of an unfinished task
+func setTaskCondition(task *moodlev1alpha1.MoodleTask, phase string, status metav1.ConditionStatus, reason, message string) {
+	task.Status.Phase = phase
+	meta.SetStatusCondition(&task.Status.Conditions, metav1.Condition{
+		Type:               moodlev1alpha1.ConditionTaskComplete,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: task.Generation,
+	})
+}
+
+// finishTask records the outcome of a finished task
+func finishTask(task *moodlev1alpha1.MoodleTask, phase, reason, message string) {
+	setTaskCondition(task, phase, metav1.ConditionTrue, reason, message)
+	task.Status.CompletionTime = ptr.To(metav1.Now())
+}
+
+// taskJobName returns the name of the task Job in the tenant namespace
+func taskJobName(task *moodlev1alpha1.MoodleTask) string {
+	return task.Name + "-task"
+}
+
+// taskJobForMoodle returns the Job running the script of a task. It runs the cron pod of
+// the tenant, with its environment and volumes, and is not retried: CLI scripts change
+// the site and are not safe to repeat.
+func taskJobForMoodle(task *moodlev1alpha1.MoodleTask, mt *moodlev1alpha1.MoodleTenant, namespace string) *batchv1.Job {
+	template := moodleCronJob(mt, namespace).Spec.JobTemplate.Spec.Template
+	template.Labels = mergeStringMaps(template.Labels, map[string]string{"moodle.bsu.by/tenant": mt.Name})
+	template.Spec.RestartPolicy = corev1.RestartPolicyNever
+
+	container := &template.Spec.Containers[0]
+	container.Name = "moodle-task"
+	container.Command = []string{"/usr/local/bin/php", path.Join("/var/www/html", task.Spec.Script)}
+	container.Args = task.Spec.Args
+
+	timeout := task.Spec.TimeoutSeconds
+	if timeout == 0 {
+		timeout = 3600
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      taskJobName(task),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"moodle.bsu.by/tenant": mt.Name,
+				"moodle.bsu.by/job":    "task",
+				taskNameLabel:          task.Name,
+				taskNamespaceLabel:     task.Namespace,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          ptr.To[int32](0),
+			ActiveDeadlineSeconds: ptr.To(timeout),
+			Template:              template,
+		},
+	}
+}
+
+// taskForJob maps a task Job in a tenant namespace to its MoodleTask
+func taskForJob(_ context.Context, obj client.Object) []reconcile.Request {
+	name, namespace := obj.GetLabels()[taskNameLabel], obj.GetLabels()[taskNamespaceLabel]
+	if name == "" || namespace == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MoodleTaskReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&moodlev1alpha1.MoodleTask{}).
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(taskForJob)).
+		Named("moodletask").
+		Complete(r)
+}
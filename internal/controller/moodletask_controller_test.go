@@ -0,0 +1,124 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("MoodleTask Controller", func() {
+	It("should run the script and record its exit code", func() {
+		ctx := context.Background()
+
+		tenant := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-dept", Namespace: "default"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "biology.bsu.by",
+				Image:    "moodle:4.5",
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Host:        "postgres-cluster.db-tier.svc",
+					AdminSecret: "biology-dept-db",
+				},
+			},
+		}
+		task := &moodlev1alpha1.MoodleTask{
+			ObjectMeta: metav1.ObjectMeta{Name: "reset-admin", Namespace: "default"},
+			Spec: moodlev1alpha1.MoodleTaskSpec{
+				TenantRef: corev1.LocalObjectReference{Name: "biology-dept"},
+				Script:    "admin/cli/reset_password.php",
+				Args:      []string{"--username=admin"},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithObjects(tenant, task).
+			WithStatusSubresource(task).
+			Build()
+		reconciler := &MoodleTaskReconciler{Client: c, Scheme: c.Scheme(), APIReader: c}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "reset-admin", Namespace: "default"}}
+
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "reset-admin-task", Namespace: "tenant-biology-dept"}, job)).To(Succeed())
+		container := job.Spec.Template.Spec.Containers[0]
+		Expect(container.Command).To(Equal([]string{"/usr/local/bin/php", "/var/www/html/admin/cli/reset_password.php"}))
+		Expect(container.Args).To(Equal([]string{"--username=admin"}))
+		Expect(*job.Spec.ActiveDeadlineSeconds).To(Equal(int64(3600)))
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "reset-admin-task-x7k2p",
+				Namespace: "tenant-biology-dept",
+				Labels:    map[string]string{"batch.kubernetes.io/job-name": "reset-admin-task"},
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  "moodle-task",
+					State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 2}},
+				}},
+			},
+		}
+		Expect(c.Create(ctx, pod)).To(Succeed())
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, request.NamespacedName, task)).To(Succeed())
+		Expect(task.Status.Phase).To(Equal(moodlev1alpha1.TaskPhaseFailed))
+		Expect(task.Status.PodName).To(Equal("reset-admin-task-x7k2p"))
+		Expect(*task.Status.ExitCode).To(Equal(int32(2)))
+	})
+
+	It("should refuse scripts outside the allowed patterns", func() {
+		ctx := context.Background()
+
+		task := &moodlev1alpha1.MoodleTask{
+			ObjectMeta: metav1.ObjectMeta{Name: "plugin-cli", Namespace: "default"},
+			Spec: moodlev1alpha1.MoodleTaskSpec{
+				TenantRef: corev1.LocalObjectReference{Name: "biology-dept"},
+				Script:    "local/custom/cli/run.php",
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithObjects(task).
+			WithStatusSubresource(task).
+			Build()
+		reconciler := &MoodleTaskReconciler{Client: c, Scheme: c.Scheme()}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "plugin-cli", Namespace: "default"}}
+
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, request.NamespacedName, task)).To(Succeed())
+		Expect(task.Status.Phase).To(Equal(moodlev1alpha1.TaskPhaseFailed))
+		Expect(meta.FindStatusCondition(task.Status.Conditions, moodlev1alpha1.ConditionTaskComplete).Reason).To(Equal("ScriptNotAllowed"))
+	})
+})
@@ -18,7 +18,16 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv2 "k8s.io/api/autoscaling/v2"
@@ -26,15 +35,19 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
@@ -44,6 +57,47 @@ import (
 type MoodleTenantReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// DriftIgnoredFields are additional "<Kind>:<path>" fields excluded from drift
+	// correction, e.g. "Deployment:spec.template.metadata.annotations"
+	DriftIgnoredFields []string
+
+	// NetworkPolicyTemplate replaces the built-in baseline rules of the tenant NetworkPolicy.
+	// Rules derived from the tenant spec are still appended to it.
+	NetworkPolicyTemplate *networkingv1.NetworkPolicySpec
+
+	// IngressControllerNamespace is the namespace of the ingress controller allowed to
+	// reach the Moodle pods. Defaults to ingress-nginx.
+	IngressControllerNamespace string
+
+	// IngressControllerPodSelector restricts the allowed ingress controller pods
+	IngressControllerPodSelector *metav1.LabelSelector
+
+	// MaintenanceImage serves the maintenance page. Defaults to nginx-unprivileged.
+	MaintenanceImage string
+
+	// DatabaseDialer checks that tenant databases accept connections before their
+	// Deployments are created or rolled. The check is skipped when nil.
+	DatabaseDialer func(ctx context.Context, network, address string) (net.Conn, error)
+
+	// DatabaseCheckInterval is how often the database check is repeated for tenants
+	// whose database answers. Zero disables periodic checks.
+	DatabaseCheckInterval time.Duration
+
+	// Recorder emits events on the MoodleTenants. Events are dropped when nil.
+	Recorder record.EventRecorder
+
+	// APIReader reads the pods of Jobs reporting results, which are not cached. The
+	// cached client is used when nil.
+	APIReader client.Reader
+
+	// ActivatorURL is the URL of the activator, through which requests to a hibernated
+	// tenant wake it. Requests do not wake tenants when empty.
+	ActivatorURL string
+
+	// AllowSnippetAnnotations lets the operator set ingress-nginx snippet annotations, which
+	// the controller rejects unless it runs with allow-snippet-annotations
+	AllowSnippetAnnotations bool
 }
 
 // +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletenants,verbs=get;list;watch;create;update;patch;delete
@@ -59,9 +113,13 @@ type MoodleTenantReconciler struct {
 // +kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 const moodleTenantFinalizer = "moodle.bsu.by/finalizer"
 
+// tenantNamespaceLabel marks a namespace as owned by a MoodleTenant
+const tenantNamespaceLabel = "moodle.bsu.by/tenant"
+
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
 func (r *MoodleTenantReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -78,6 +136,7 @@ func (r *MoodleTenantReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		logger.Error(err, "Failed to get MoodleTenant")
 		return ctrl.Result{}, err
 	}
+	originalStatus := moodleTenant.Status.DeepCopy()
 
 	// Examine DeletionTimestamp to determine if object is under deletion
 	if moodleTenant.DeletionTimestamp.IsZero() {
@@ -91,11 +150,35 @@ func (r *MoodleTenantReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	} else {
 		// The object is being deleted
 		if containsString(moodleTenant.GetFinalizers(), moodleTenantFinalizer) {
+			// The archive of spec.decommission is taken before anything is removed
+			archived, err := r.reconcileDecommission(ctx, moodleTenant)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !equality.Semantic.DeepEqual(originalStatus, &moodleTenant.Status) {
+				if err := r.Status().Update(ctx, moodleTenant); err != nil {
+					logger.Error(err, "Failed to update MoodleTenant status")
+					return ctrl.Result{}, err
+				}
+			}
+			if !archived {
+				return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+			}
+
 			// Our finalizer is present, so lets handle any external dependency
 			if err := r.finalizeMoodleTenant(ctx, moodleTenant); err != nil {
 				return ctrl.Result{}, err
 			}
 
+			// The database is dropped after the namespace so that Moodle no longer connects to it
+			released, err := r.finalizeDatabase(ctx, moodleTenant)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if !released {
+				return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+			}
+
 			// Remove our finalizer from the list and update it
 			moodleTenant.SetFinalizers(removeString(moodleTenant.GetFinalizers(), moodleTenantFinalizer))
 			if err := r.Update(ctx, moodleTenant); err != nil {
@@ -107,6 +190,21 @@ func (r *MoodleTenantReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, nil
 	}
 
+	// The presets of the class are applied in memory only, the spec is not updated below
+	resolved, err := r.resolveTenantClass(ctx, moodleTenant)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !resolved {
+		if !equality.Semantic.DeepEqual(originalStatus, &moodleTenant.Status) {
+			if err := r.Status().Update(ctx, moodleTenant); err != nil {
+				logger.Error(err, "Failed to update MoodleTenant status")
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
 	// Get the tenant namespace name
 	tenantNamespace := fmt.Sprintf("tenant-%s", moodleTenant.Name)
 
@@ -114,6 +212,9 @@ func (r *MoodleTenantReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	namespace := &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: tenantNamespace,
+			Labels: map[string]string{
+				tenantNamespaceLabel: moodleTenant.Name,
+			},
 		},
 	}
 
@@ -133,12 +234,156 @@ func (r *MoodleTenantReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, err
 	}
 
-	if err := r.reconcileSecret(ctx, moodleTenant, tenantNamespace); err != nil {
+	// Namespaces created before tenant labelling was introduced are labelled here so
+	// that NetworkPolicies can select tenant namespaces across the cluster
+	if foundNamespace.Labels[tenantNamespaceLabel] != moodleTenant.Name {
+		if foundNamespace.Labels == nil {
+			foundNamespace.Labels = map[string]string{}
+		}
+		foundNamespace.Labels[tenantNamespaceLabel] = moodleTenant.Name
+		logger.Info("Labelling Namespace", "Namespace.Name", foundNamespace.Name)
+		if err := r.Update(ctx, foundNamespace); err != nil {
+			logger.Error(err, "Failed to update Namespace labels", "Namespace.Name", foundNamespace.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// In cnpg and zalando modes the database Secret is filled from the credentials
+	// generated by the database operator, with an externalSecretRef from the Secret
+	// materialized by the External Secrets Operator
+	databaseSecretReady := true
+	switch moodleTenant.Spec.DatabaseRef.Mode {
+	case databaseModeCNPG:
+		if err := r.reconcileCNPGCluster(ctx, moodleTenant, tenantNamespace); err != nil {
+			return ctrl.Result{}, err
+		}
+	case databaseModeZalando:
+		if err := r.reconcileZalando(ctx, moodleTenant, tenantNamespace); err != nil {
+			return ctrl.Result{}, err
+		}
+	default:
+		if moodleTenant.Spec.DatabaseRef.ExternalSecretRef != nil {
+			if databaseSecretReady, err = r.reconcileExternalDatabaseSecret(ctx, moodleTenant, tenantNamespace); err != nil {
+				return ctrl.Result{}, err
+			}
+		} else if err := r.reconcileSecret(ctx, moodleTenant, tenantNamespace); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if databaseSecretReady {
+		r.checkDatabase(ctx, moodleTenant, tenantNamespace)
+	}
+	if err := r.recordDatabaseSecretHash(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcilePlagiarismSecret(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileMailSecret(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileDatabaseTLSSecrets(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileDatabaseIAM(ctx, moodleTenant, tenantNamespace); err != nil {
 		return ctrl.Result{}, err
 	}
 
 	// Namespace exists, now reconcile all resources
-	if err := r.reconcileDeployment(ctx, moodleTenant, tenantNamespace); err != nil {
+	if err := r.reconcileDatabaseProvisioning(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	databaseRestored, err := r.reconcileDatabaseRestore(ctx, moodleTenant, tenantNamespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	installed, err := r.reconcileInstall(ctx, moodleTenant, tenantNamespace, databaseRestored)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileDatabaseService(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileProxySQL(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileExporter(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileCache(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileMemcached(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileCacheExporter(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileBackendTLS(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileServerConfig(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileMaintenanceWindow(moodleTenant); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileScaling(moodleTenant); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileHibernation(ctx, moodleTenant, tenantNamespace, databaseReady(moodleTenant) && databaseRestored && installed); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Moodle crash-loops without its database, so the Deployment is neither created nor
+	// rolled until the database answers, nor would it find a restored dump in a fresh one,
+	// or the installation in an empty one
+	if databaseReady(moodleTenant) && databaseRestored && installed {
+		if err := r.reconcileUpgrade(ctx, moodleTenant, tenantNamespace); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if err := r.reconcileDeployment(ctx, moodleTenant, tenantNamespace); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if err := r.reconcileCacheWarmup(ctx, moodleTenant, tenantNamespace); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if err := r.reconcileCachePurge(ctx, moodleTenant, tenantNamespace); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if err := r.reconcileMaintenanceMode(ctx, moodleTenant, tenantNamespace); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if err := r.reconcileURLRewrite(ctx, moodleTenant, tenantNamespace); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	setSuspendedCondition(moodleTenant)
+
+	if err := r.reconcileMaintenancePage(ctx, moodleTenant, tenantNamespace); err != nil {
 		return ctrl.Result{}, err
 	}
 
@@ -146,18 +391,54 @@ func (r *MoodleTenantReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, err
 	}
 
+	if err := r.reconcileScratchPVC(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if err := r.reconcileService(ctx, moodleTenant, tenantNamespace); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if err := r.reconcileInternalService(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if err := r.reconcileIngress(ctx, moodleTenant, tenantNamespace); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if err := r.reconcileMesh(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileAdminIngress(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileHTTPRoute(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileTLSSecret(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileCertificate(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileDNSEndpoint(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if err := r.reconcileNetworkPolicy(ctx, moodleTenant, tenantNamespace); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if err := r.reconcileCiliumNetworkPolicy(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if err := r.reconcileHPA(ctx, moodleTenant, tenantNamespace); err != nil {
 		return ctrl.Result{}, err
 	}
@@ -166,12 +447,87 @@ func (r *MoodleTenantReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, err
 	}
 
+	if err := r.reconcileCronFreshness(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileCronFailures(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileExtraCronJobs(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileHousekeeping(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
 	if err := r.reconcilePDB(ctx, moodleTenant, tenantNamespace); err != nil {
 		return ctrl.Result{}, err
 	}
 
+	if err := r.reconcileDataScan(ctx, moodleTenant, tenantNamespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Update status if it changed during reconciliation
+	if !equality.Semantic.DeepEqual(originalStatus, &moodleTenant.Status) {
+		if err := r.Status().Update(ctx, moodleTenant); err != nil {
+			logger.Error(err, "Failed to update MoodleTenant status")
+			return ctrl.Result{}, err
+		}
+	}
+
 	logger.Info("Successfully reconciled MoodleTenant", "Name", moodleTenant.Name)
 
+	// Certificate readiness is not watched, so poll until it is issued
+	if mt := moodleTenant; mt.Spec.TLS.IssuerRef != nil && !meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionCertificateReady) {
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	// Nor are the backups taken before an upgrade
+	if degraded := meta.FindStatusCondition(moodleTenant.Status.Conditions, moodlev1alpha1.ConditionDegraded); degraded != nil && degraded.Reason == "BackingUp" {
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	// The rollout of an upgrade is rolled back at its deadline
+	if deadline := moodleTenant.Status.UpgradeRolloutDeadline; deadline != nil {
+		return ctrl.Result{RequeueAfter: max(time.Until(deadline.Time), 0) + time.Second}, nil
+	}
+
+	// Nor is the previous Deployment of the BlueGreen strategy scaled down
+	if bg := moodleTenant.Status.BlueGreen; bg != nil && bg.ScaleDownTime != nil {
+		return ctrl.Result{RequeueAfter: max(time.Until(bg.ScaleDownTime.Time), 0) + time.Second}, nil
+	}
+
+	// Database readiness is not watched either
+	if !databaseReady(moodleTenant) || !databaseRestored || !installed {
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	// Actions waiting for the maintenance window run when it opens, the last access of an
+	// awake tenant with hibernation is checked periodically, and scaling schedules fire
+	scheduled := maintenanceWindowRequeue(moodleTenant)
+	for _, next := range []time.Duration{hibernationRequeue(moodleTenant), scalingRequeue(moodleTenant)} {
+		if next > 0 && (scheduled == 0 || next < scheduled) {
+			scheduled = next
+		}
+	}
+
+	// Keep the DatabaseReachable condition current
+	if r.DatabaseDialer != nil && r.DatabaseCheckInterval > 0 {
+		requeue := r.DatabaseCheckInterval
+		if scheduled > 0 {
+			requeue = min(requeue, scheduled)
+		}
+		return ctrl.Result{RequeueAfter: requeue}, nil
+	}
+
+	if scheduled > 0 {
+		return ctrl.Result{RequeueAfter: scheduled}, nil
+	}
+
 	return ctrl.Result{}, nil
 }
 
@@ -208,6 +564,13 @@ func (r *MoodleTenantReconciler) finalizeMoodleTenant(ctx context.Context, mt *m
 func (r *MoodleTenantReconciler) reconcileDeployment(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
 	logger := log.FromContext(ctx)
 
+	if blueGreen(mt) {
+		return r.reconcileBlueGreen(ctx, mt, namespace)
+	}
+	if err := r.deleteBlueGreen(ctx, mt, namespace); err != nil {
+		return err
+	}
+
 	deployment := r.deploymentForMoodle(mt, namespace)
 
 	// Check if the Deployment already exists
@@ -215,6 +578,9 @@ func (r *MoodleTenantReconciler) reconcileDeployment(ctx context.Context, mt *mo
 	err := r.Get(ctx, types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, found)
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a new Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
+		if err := r.markApplied(mt, deployment); err != nil {
+			return err
+		}
 		err = r.Create(ctx, deployment)
 		if err != nil {
 			logger.Error(err, "Failed to create new Deployment", "Deployment.Namespace", deployment.Namespace, "Deployment.Name", deployment.Name)
@@ -226,9 +592,8 @@ func (r *MoodleTenantReconciler) reconcileDeployment(ctx context.Context, mt *mo
 		return err
 	}
 
-	// Deployment exists, could implement update logic here
-	logger.Info("Deployment already exists", "Deployment.Namespace", found.Namespace, "Deployment.Name", found.Name)
-	return nil
+	// Deployment exists, correct any drift from the desired state
+	return r.correctDrift(ctx, mt, deployment, found)
 }
 
 // reconcilePVC creates or updates the PersistentVolumeClaim
@@ -253,8 +618,22 @@ func (r *MoodleTenantReconciler) reconcilePVC(ctx context.Context, mt *moodlev1a
 		return err
 	}
 
-	logger.Info("PVC already exists", "PVC.Namespace", found.Namespace, "PVC.Name", found.Name)
-	return nil
+	// Volumes can only grow, and the resize may remount them in the maintenance window
+	size := mt.Spec.Storage.Size
+	current := found.Spec.Resources.Requests[corev1.ResourceStorage]
+	if size.Cmp(current) <= 0 {
+		return nil
+	}
+	if !maintenanceAllowed(mt) {
+		logger.Info("PVC resize waits for the maintenance window", "PVC.Namespace", found.Namespace, "PVC.Name", found.Name, "Size", size.String())
+		return nil
+	}
+	if found.Spec.Resources.Requests == nil {
+		found.Spec.Resources.Requests = corev1.ResourceList{}
+	}
+	found.Spec.Resources.Requests[corev1.ResourceStorage] = size
+	logger.Info("Resizing PVC", "PVC.Namespace", found.Namespace, "PVC.Name", found.Name, "Size", size.String())
+	return r.Update(ctx, found)
 }
 
 // reconcileService creates or updates the Service
@@ -268,6 +647,9 @@ func (r *MoodleTenantReconciler) reconcileService(ctx context.Context, mt *moodl
 	err := r.Get(ctx, types.NamespacedName{Name: service.Name, Namespace: service.Namespace}, found)
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a new Service", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
+		if err := r.markApplied(mt, service); err != nil {
+			return err
+		}
 		err = r.Create(ctx, service)
 		if err != nil {
 			logger.Error(err, "Failed to create new Service", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
@@ -279,8 +661,40 @@ func (r *MoodleTenantReconciler) reconcileService(ctx context.Context, mt *moodl
 		return err
 	}
 
-	logger.Info("Service already exists", "Service.Namespace", found.Namespace, "Service.Name", found.Name)
-	return nil
+	return r.correctDrift(ctx, mt, service, found)
+}
+
+// reconcileInternalService creates or updates the internal Service used for tenant-to-tenant access
+func (r *MoodleTenantReconciler) reconcileInternalService(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	// Only create the internal Service if an internal hostname is requested
+	if mt.Spec.Exposure.InternalHostname == "" {
+		return nil
+	}
+
+	service := r.internalServiceForMoodle(mt, namespace)
+
+	// Check if the Service already exists
+	found := &corev1.Service{}
+	err := r.Get(ctx, types.NamespacedName{Name: service.Name, Namespace: service.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new internal Service", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
+		if err := r.markApplied(mt, service); err != nil {
+			return err
+		}
+		err = r.Create(ctx, service)
+		if err != nil {
+			logger.Error(err, "Failed to create new internal Service", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get internal Service")
+		return err
+	}
+
+	return r.correctDrift(ctx, mt, service, found)
 }
 
 // reconcileIngress creates or updates the Ingress
@@ -289,11 +703,23 @@ func (r *MoodleTenantReconciler) reconcileIngress(ctx context.Context, mt *moodl
 
 	ingress := r.ingressForMoodle(mt, namespace)
 
+	// In gateway mode the HTTPRoute, and with an Istio Gateway the VirtualService, replaces the Ingress
+	if mt.Spec.Routing.Mode == routingModeGateway || (mt.Spec.Mesh != nil && mt.Spec.Mesh.Gateway != "") {
+		if err := r.Delete(ctx, ingress); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete Ingress", "Ingress.Namespace", ingress.Namespace, "Ingress.Name", ingress.Name)
+			return err
+		}
+		return nil
+	}
+
 	// Check if the Ingress already exists
 	found := &networkingv1.Ingress{}
 	err := r.Get(ctx, types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}, found)
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a new Ingress", "Ingress.Namespace", ingress.Namespace, "Ingress.Name", ingress.Name)
+		if err := r.markApplied(mt, ingress); err != nil {
+			return err
+		}
 		err = r.Create(ctx, ingress)
 		if err != nil {
 			logger.Error(err, "Failed to create new Ingress", "Ingress.Namespace", ingress.Namespace, "Ingress.Name", ingress.Name)
@@ -305,8 +731,7 @@ func (r *MoodleTenantReconciler) reconcileIngress(ctx context.Context, mt *moodl
 		return err
 	}
 
-	logger.Info("Ingress already exists", "Ingress.Namespace", found.Namespace, "Ingress.Name", found.Name)
-	return nil
+	return r.correctDrift(ctx, mt, ingress, found)
 }
 
 // reconcileNetworkPolicy creates or updates the NetworkPolicy
@@ -315,11 +740,22 @@ func (r *MoodleTenantReconciler) reconcileNetworkPolicy(ctx context.Context, mt
 
 	networkPolicy := r.networkPolicyForMoodle(mt, namespace)
 
+	if enabled := mt.Spec.NetworkPolicy.Enabled; enabled != nil && !*enabled {
+		if err := r.Delete(ctx, networkPolicy); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete NetworkPolicy", "NetworkPolicy.Namespace", networkPolicy.Namespace, "NetworkPolicy.Name", networkPolicy.Name)
+			return err
+		}
+		return nil
+	}
+
 	// Check if the NetworkPolicy already exists
 	found := &networkingv1.NetworkPolicy{}
 	err := r.Get(ctx, types.NamespacedName{Name: networkPolicy.Name, Namespace: networkPolicy.Namespace}, found)
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a new NetworkPolicy", "NetworkPolicy.Namespace", networkPolicy.Namespace, "NetworkPolicy.Name", networkPolicy.Name)
+		if err := r.markApplied(mt, networkPolicy); err != nil {
+			return err
+		}
 		err = r.Create(ctx, networkPolicy)
 		if err != nil {
 			logger.Error(err, "Failed to create new NetworkPolicy", "NetworkPolicy.Namespace", networkPolicy.Namespace, "NetworkPolicy.Name", networkPolicy.Name)
@@ -331,13 +767,22 @@ func (r *MoodleTenantReconciler) reconcileNetworkPolicy(ctx context.Context, mt
 		return err
 	}
 
-	logger.Info("NetworkPolicy already exists", "NetworkPolicy.Namespace", found.Namespace, "NetworkPolicy.Name", found.Name)
-	return nil
+	return r.correctDrift(ctx, mt, networkPolicy, found)
 }
 
 func (r *MoodleTenantReconciler) reconcileHPA(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
 	logger := log.FromContext(ctx)
 
+	// The HPA would scale a suspended or hibernated tenant up again
+	if parked(mt) {
+		hpa := &autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: mt.Name + "-hpa", Namespace: namespace}}
+		if err := r.Delete(ctx, hpa); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete HPA", "HPA.Namespace", namespace, "HPA.Name", hpa.Name)
+			return err
+		}
+		return nil
+	}
+
 	// Only create HPA if enabled
 	if !mt.Spec.HPA.Enabled {
 		logger.Info("HPA is disabled, skipping")
@@ -350,6 +795,9 @@ func (r *MoodleTenantReconciler) reconcileHPA(ctx context.Context, mt *moodlev1a
 	err := r.Get(ctx, types.NamespacedName{Name: hpa.Name, Namespace: hpa.Namespace}, foundHPA)
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a new HPA", "HPA.Namespace", hpa.Namespace, "HPA.Name", hpa.Name)
+		if err := r.markApplied(mt, hpa); err != nil {
+			return err
+		}
 		err = r.Create(ctx, hpa)
 		if err != nil {
 			logger.Error(err, "Failed to create new HPA", "HPA.Namespace", hpa.Namespace, "HPA.Name", hpa.Name)
@@ -361,20 +809,30 @@ func (r *MoodleTenantReconciler) reconcileHPA(ctx context.Context, mt *moodlev1a
 		return err
 	}
 
-	// HPA exists, update if needed
-	logger.Info("HPA already exists", "HPA.Namespace", foundHPA.Namespace, "HPA.Name", foundHPA.Name)
-	return nil
+	// HPA exists, correct any drift from the desired state
+	return r.correctDrift(ctx, mt, hpa, foundHPA)
 }
 
 func (r *MoodleTenantReconciler) reconcileCronJob(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
 	logger := log.FromContext(ctx)
 
+	if err := r.reconcileCronRunner(ctx, mt, namespace); err != nil {
+		return err
+	}
+	// The cron runner Deployment replaces the CronJob
+	if mt.Spec.Cron.Mode == cronModeDeployment {
+		return nil
+	}
+
 	cronJob := r.cronJobForMoodle(mt, namespace)
 
 	foundCronJob := &batchv1.CronJob{}
 	err := r.Get(ctx, types.NamespacedName{Name: cronJob.Name, Namespace: cronJob.Namespace}, foundCronJob)
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a new CronJob", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
+		if err := r.markApplied(mt, cronJob); err != nil {
+			return err
+		}
 		err = r.Create(ctx, cronJob)
 		if err != nil {
 			logger.Error(err, "Failed to create new CronJob", "CronJob.Namespace", cronJob.Namespace, "CronJob.Name", cronJob.Name)
@@ -386,9 +844,8 @@ func (r *MoodleTenantReconciler) reconcileCronJob(ctx context.Context, mt *moodl
 		return err
 	}
 
-	// CronJob exists, update if needed
-	logger.Info("CronJob already exists", "CronJob.Namespace", foundCronJob.Namespace, "CronJob.Name", foundCronJob.Name)
-	return nil
+	// CronJob exists, correct any drift from the desired state
+	return r.correctDrift(ctx, mt, cronJob, foundCronJob)
 }
 
 func (r *MoodleTenantReconciler) reconcilePDB(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
@@ -406,6 +863,9 @@ func (r *MoodleTenantReconciler) reconcilePDB(ctx context.Context, mt *moodlev1a
 	err := r.Get(ctx, types.NamespacedName{Name: pdb.Name, Namespace: pdb.Namespace}, foundPDB)
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a new PDB", "PDB.Namespace", pdb.Namespace, "PDB.Name", pdb.Name)
+		if err := r.markApplied(mt, pdb); err != nil {
+			return err
+		}
 		err = r.Create(ctx, pdb)
 		if err != nil {
 			logger.Error(err, "Failed to create new PDB", "PDB.Namespace", pdb.Namespace, "PDB.Name", pdb.Name)
@@ -417,24 +877,133 @@ func (r *MoodleTenantReconciler) reconcilePDB(ctx context.Context, mt *moodlev1a
 		return err
 	}
 
-	// PDB exists, update if needed
-	logger.Info("PDB already exists", "PDB.Namespace", foundPDB.Namespace, "PDB.Name", foundPDB.Name)
-	return nil
+	// PDB exists, correct any drift from the desired state
+	return r.correctDrift(ctx, mt, pdb, foundPDB)
 }
 
-// reconcileSecret creates or updates the database Secret
+// reconcileSecret creates or updates the database Secret, so that changes to
+// databaseRef reach Moodle
 func (r *MoodleTenantReconciler) reconcileSecret(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
 	logger := log.FromContext(ctx)
 
 	secret := r.secretForMoodle(mt, namespace)
+	if secret == nil {
+		return fmt.Errorf("failed to build database Secret for %s", mt.Name)
+	}
+
+	found := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, found); err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get Secret")
+		return err
+	}
+
+	// A generated password is kept for the lifetime of the Secret
+	if databasePasswordGenerated(mt) {
+		if len(found.Data["password"]) > 0 {
+			secret.Data["password"] = found.Data["password"]
+		} else {
+			password, err := generatePassword()
+			if err != nil {
+				return err
+			}
+			secret.Data["password"] = []byte(password)
+		}
+	}
+
+	// The new host reaches the pods through the rollout triggered by the Secret checksum
+	if oldHost := string(found.Data["host"]); oldHost != "" && oldHost != mt.Spec.DatabaseRef.Host {
+		logger.Info("Database host changed", "From", oldHost, "To", mt.Spec.DatabaseRef.Host)
+	}
+
+	return r.reconcileSecretData(ctx, secret)
+}
+
+// recordDatabaseSecretHash stores the checksum of the database Secret in the status. It
+// is set as a pod template annotation, so that credential changes roll the Deployment.
+func (r *MoodleTenantReconciler) recordDatabaseSecretHash(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: mt.Spec.DatabaseRef.AdminSecret, Namespace: namespace}, secret)
+	if err != nil && errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := fnv.New32a()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write(secret.Data[key])
+		hash.Write([]byte{0})
+	}
+	mt.Status.DatabaseSecretHash = fmt.Sprintf("%08x", hash.Sum32())
+	return nil
+}
+
+// reconcilePlagiarismSecret copies the plagiarism service credentials into the tenant namespace
+func (r *MoodleTenantReconciler) reconcilePlagiarismSecret(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	if mt.Spec.Integrations.Plagiarism == nil {
+		return nil
+	}
+
+	source := types.NamespacedName{Name: mt.Spec.Integrations.Plagiarism.CredentialsSecretRef.Name, Namespace: mt.Namespace}
+	return r.reconcileCopiedSecret(ctx, mt, source, namespace, mt.Name+"-plagiarism")
+}
+
+// reconcileMailSecret copies the SMTP relay credentials into the tenant namespace
+func (r *MoodleTenantReconciler) reconcileMailSecret(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	if mt.Spec.Mail == nil || mt.Spec.Mail.CredentialsSecretRef == nil {
+		return nil
+	}
+
+	source := types.NamespacedName{Name: mt.Spec.Mail.CredentialsSecretRef.Name, Namespace: mt.Namespace}
+	return r.reconcileCopiedSecret(ctx, mt, source, namespace, mt.Name+"-smtp")
+}
+
+// reconcileCopiedSecret keeps a copy of a Secret from another namespace in the tenant namespace
+func (r *MoodleTenantReconciler) reconcileCopiedSecret(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, source types.NamespacedName, namespace, name string) error {
+	logger := log.FromContext(ctx)
+
+	sourceSecret := &corev1.Secret{}
+	if err := r.Get(ctx, source, sourceSecret); err != nil {
+		logger.Error(err, "Failed to get source Secret", "Secret.Namespace", source.Namespace, "Secret.Name", source.Name)
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Type: sourceSecret.Type,
+		Data: sourceSecret.Data,
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	return r.reconcileSecretData(ctx, secret)
+}
+
+// reconcileSecretData creates secret if it does not exist and keeps its data in sync
+// otherwise, e.g. after credential rotation. secret is left with the resource version of
+// the live Secret.
+func (r *MoodleTenantReconciler) reconcileSecretData(ctx context.Context, secret *corev1.Secret) error {
+	logger := log.FromContext(ctx)
 
-	// Check if the Secret already exists
 	found := &corev1.Secret{}
 	err := r.Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, found)
 	if err != nil && errors.IsNotFound(err) {
 		logger.Info("Creating a new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
-		err = r.Create(ctx, secret)
-		if err != nil {
+		if err := r.Create(ctx, secret); err != nil {
 			logger.Error(err, "Failed to create new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
 			return err
 		}
@@ -444,7 +1013,16 @@ func (r *MoodleTenantReconciler) reconcileSecret(ctx context.Context, mt *moodle
 		return err
 	}
 
-	logger.Info("Secret already exists", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+	if !reflect.DeepEqual(found.Data, secret.Data) {
+		found.Data = secret.Data
+		logger.Info("Updating Secret", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+		if err := r.Update(ctx, found); err != nil {
+			logger.Error(err, "Failed to update Secret", "Secret.Namespace", found.Namespace, "Secret.Name", found.Name)
+			return err
+		}
+	}
+	secret.ResourceVersion = found.ResourceVersion
+
 	return nil
 }
 
@@ -455,11 +1033,11 @@ func (r *MoodleTenantReconciler) secretForMoodle(mt *moodlev1alpha1.MoodleTenant
 			Name:      mt.Spec.DatabaseRef.AdminSecret,
 			Namespace: namespace,
 		},
-		StringData: map[string]string{
-			"host":     mt.Spec.DatabaseRef.Host,
-			"database": mt.Spec.DatabaseRef.Name,
-			"username": mt.Spec.DatabaseRef.User,
-			"password": mt.Spec.DatabaseRef.Password,
+		Data: map[string][]byte{
+			"host":     []byte(mt.Spec.DatabaseRef.Host),
+			"database": []byte(mt.Spec.DatabaseRef.Name),
+			"username": []byte(mt.Spec.DatabaseRef.User),
+			"password": []byte(mt.Spec.DatabaseRef.Password),
 		},
 	}
 
@@ -482,22 +1060,14 @@ func (r *MoodleTenantReconciler) deploymentForMoodle(mt *moodlev1alpha1.MoodleTe
 	if mt.Spec.HPA.Enabled && mt.Spec.HPA.MinReplicas != nil {
 		replicas = *mt.Spec.HPA.MinReplicas
 	}
-
-	// Default values for PHP settings
-	maxExecTime := 60
-	if mt.Spec.PHPSettings.MaxExecutionTime != 0 {
-		maxExecTime = mt.Spec.PHPSettings.MaxExecutionTime
+	if scaling := scheduledScaling(mt); scaling != nil {
+		replicas = scaling.MinReplicas
 	}
-
-	memoryLimit := "512M"
-	if mt.Spec.PHPSettings.MemoryLimit != "" {
-		memoryLimit = mt.Spec.PHPSettings.MemoryLimit
+	if parked(mt) {
+		replicas = 0
 	}
 
-	memcachedMemory := 128
-	if mt.Spec.Memcached.MemoryMB != 0 {
-		memcachedMemory = mt.Spec.Memcached.MemoryMB
-	}
+	memcachedMemory := memcachedMemoryMB(mt)
 
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -518,7 +1088,7 @@ func (r *MoodleTenantReconciler) deploymentForMoodle(mt *moodlev1alpha1.MoodleTe
 					Containers: []corev1.Container{
 						{
 							Name:  "moodle-php",
-							Image: mt.Spec.Image,
+							Image: moodleImage(mt),
 							Ports: []corev1.ContainerPort{
 								{
 									Name:          "http",
@@ -527,61 +1097,9 @@ func (r *MoodleTenantReconciler) deploymentForMoodle(mt *moodlev1alpha1.MoodleTe
 								},
 							},
 							Env: []corev1.EnvVar{
-								{
-									Name:  "PHP_MAX_EXECUTION_TIME",
-									Value: fmt.Sprintf("%d", maxExecTime),
-								},
-								{
-									Name:  "PHP_MEMORY_LIMIT",
-									Value: memoryLimit,
-								},
 								{
 									Name:  "MOODLE_URL",
-									Value: fmt.Sprintf("https://%s", mt.Spec.Hostname),
-								},
-								{
-									Name: "DB_HOST",
-									ValueFrom: &corev1.EnvVarSource{
-										SecretKeyRef: &corev1.SecretKeySelector{
-											LocalObjectReference: corev1.LocalObjectReference{
-												Name: mt.Spec.DatabaseRef.AdminSecret,
-											},
-											Key: "host",
-										},
-									},
-								},
-								{
-									Name: "DB_NAME",
-									ValueFrom: &corev1.EnvVarSource{
-										SecretKeyRef: &corev1.SecretKeySelector{
-											LocalObjectReference: corev1.LocalObjectReference{
-												Name: mt.Spec.DatabaseRef.AdminSecret,
-											},
-											Key: "database",
-										},
-									},
-								},
-								{
-									Name: "DB_USER",
-									ValueFrom: &corev1.EnvVarSource{
-										SecretKeyRef: &corev1.SecretKeySelector{
-											LocalObjectReference: corev1.LocalObjectReference{
-												Name: mt.Spec.DatabaseRef.AdminSecret,
-											},
-											Key: "username",
-										},
-									},
-								},
-								{
-									Name: "DB_PASS",
-									ValueFrom: &corev1.EnvVarSource{
-										SecretKeyRef: &corev1.SecretKeySelector{
-											LocalObjectReference: corev1.LocalObjectReference{
-												Name: mt.Spec.DatabaseRef.AdminSecret,
-											},
-											Key: "password",
-										},
-									},
+									Value: moodleURL(mt),
 								},
 							},
 							Resources: mt.Spec.Resources,
@@ -616,7 +1134,7 @@ func (r *MoodleTenantReconciler) deploymentForMoodle(mt *moodlev1alpha1.MoodleTe
 						},
 						{
 							Name:  "memcached",
-							Image: "memcached:alpine",
+							Image: memcachedImage(mt),
 							Command: []string{
 								"memcached",
 								"-m", fmt.Sprintf("%d", memcachedMemory),
@@ -679,6 +1197,52 @@ func (r *MoodleTenantReconciler) deploymentForMoodle(mt *moodlev1alpha1.MoodleTe
 		},
 	}
 
+	applyMemcachedResources(mt, &deployment.Spec.Template.Spec.Containers[1])
+
+	// Redis, the shared Memcached instances and cache clusters replace the Memcached sidecar
+	if redisEnabled(mt) || memcachedShared(mt) || mt.Spec.Cache.ClusterRef != nil {
+		containers := deployment.Spec.Template.Spec.Containers[:0]
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			if container.Name != "memcached" {
+				containers = append(containers, container)
+			}
+		}
+		deployment.Spec.Template.Spec.Containers = containers
+	} else {
+		applyCacheExporter(mt, &deployment.Spec.Template)
+	}
+
+	// Istio injects its sidecar into the Moodle pods in mesh mode
+	setSidecarInjection(mt, &deployment.Spec.Template, true)
+
+	// Environment variables from Secrets are only read when a container starts
+	if mt.Status.DatabaseSecretHash != "" {
+		deployment.Spec.Template.Annotations = mergeStringMaps(deployment.Spec.Template.Annotations, map[string]string{
+			"moodle.bsu.by/database-secret-hash": mt.Status.DatabaseSecretHash,
+		})
+	}
+
+	deployment.Spec.Template.Spec.DNSPolicy = mt.Spec.DNSPolicy
+	deployment.Spec.Template.Spec.DNSConfig = mt.Spec.DNSConfig
+
+	// PHP and nginx read their settings from the server config ConfigMap
+	applyServerConfig(mt, &deployment.Spec.Template)
+
+	// nginx additionally terminates TLS when backend TLS is enabled
+	applyBackendTLS(mt, &deployment.Spec.Template.Spec)
+
+	// The database driver and port follow the database type
+	deployment.Spec.Template.Spec.Containers[0].Env = append(deployment.Spec.Template.Spec.Containers[0].Env, moodleDatabaseEnv(mt)...)
+	applyDatabaseTLS(mt, &deployment.Spec.Template.Spec, true)
+	applyDatabaseIAM(mt, &deployment.Spec.Template.Spec, moodleDatabasePasswordFileEnv)
+
+	// Site configuration is injected as environment and read by config.php
+	deployment.Spec.Template.Spec.Containers[0].Env = append(deployment.Spec.Template.Spec.Containers[0].Env, configEnvForMoodle(mt)...)
+	deployment.Spec.Template.Spec.Containers[0].Env = append(deployment.Spec.Template.Spec.Containers[0].Env, cacheEnv(mt)...)
+	applyRedisTLS(mt, &deployment.Spec.Template.Spec)
+	applyLocalCache(mt, &deployment.Spec.Template.Spec)
+	applyStorageLayout(mt, &deployment.Spec.Template.Spec)
+
 	// Set MoodleTenant instance as the owner
 	if err := ctrl.SetControllerReference(mt, deployment, r.Scheme); err != nil {
 		return nil
@@ -687,6 +1251,20 @@ func (r *MoodleTenantReconciler) deploymentForMoodle(mt *moodlev1alpha1.MoodleTe
 	return deployment
 }
 
+// dataAccessMode returns the access mode of the moodledata volume, based on the storage
+// class: CephFS and NFS support ReadWriteMany, local-path only supports ReadWriteOnce
+func dataAccessMode(mt *moodlev1alpha1.MoodleTenant) corev1.PersistentVolumeAccessMode {
+	return storageClassAccessMode(mt.Spec.Storage.StorageClass)
+}
+
+// storageClassAccessMode returns the access mode of volumes of the storage class
+func storageClassAccessMode(storageClass string) corev1.PersistentVolumeAccessMode {
+	if storageClass == "local-path" || storageClass == "hostpath" {
+		return corev1.ReadWriteOnce
+	}
+	return corev1.ReadWriteMany
+}
+
 // pvcForMoodle returns a PersistentVolumeClaim object for the MoodleTenant
 func (r *MoodleTenantReconciler) pvcForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.PersistentVolumeClaim {
 	storageClass := "csi-cephfs-sc"
@@ -694,12 +1272,7 @@ func (r *MoodleTenantReconciler) pvcForMoodle(mt *moodlev1alpha1.MoodleTenant, n
 		storageClass = mt.Spec.Storage.StorageClass
 	}
 
-	// Determine access mode based on storage class
-	// CephFS and NFS support ReadWriteMany, local-path only supports ReadWriteOnce
-	accessMode := corev1.ReadWriteMany
-	if storageClass == "local-path" || storageClass == "hostpath" {
-		accessMode = corev1.ReadWriteOnce
-	}
+	accessMode := dataAccessMode(mt)
 
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
@@ -741,7 +1314,7 @@ func (r *MoodleTenantReconciler) serviceForMoodle(mt *moodlev1alpha1.MoodleTenan
 			Labels:    labels,
 		},
 		Spec: corev1.ServiceSpec{
-			Selector: labels,
+			Selector: colorSelector(mt, labels),
 			Type:     corev1.ServiceTypeClusterIP,
 			Ports: []corev1.ServicePort{
 				{
@@ -754,6 +1327,17 @@ func (r *MoodleTenantReconciler) serviceForMoodle(mt *moodlev1alpha1.MoodleTenan
 		},
 	}
 
+	if mt.Spec.BackendTLS != nil {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name:       "https",
+			Protocol:   corev1.ProtocolTCP,
+			Port:       443,
+			TargetPort: intstr.FromInt(backendTLSPort),
+		})
+	}
+
+	applyServiceTopology(mt, service)
+
 	// Set MoodleTenant instance as the owner
 	if err := ctrl.SetControllerReference(mt, service, r.Scheme); err != nil {
 		return nil
@@ -762,6 +1346,58 @@ func (r *MoodleTenantReconciler) serviceForMoodle(mt *moodlev1alpha1.MoodleTenan
 	return service
 }
 
+// internalServiceForMoodle returns the Service that exposes the MoodleTenant to other tenants
+// under a predictable name: <internalHostname>.<namespace>.svc
+func (r *MoodleTenantReconciler) internalServiceForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.Service {
+	labels := map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	}
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mt.Spec.Exposure.InternalHostname,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":                    "moodle",
+				"moodle.bsu.by/tenant":   mt.Name,
+				"moodle.bsu.by/exposure": "internal",
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: colorSelector(mt, labels),
+			Type:     corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Protocol:   corev1.ProtocolTCP,
+					Port:       80,
+					TargetPort: intstr.FromInt(8080),
+				},
+			},
+		},
+	}
+
+	applyServiceTopology(mt, service)
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, service, r.Scheme); err != nil {
+		return nil
+	}
+
+	return service
+}
+
+// applyServiceTopology applies the topology-aware routing settings to a tenant Service
+func applyServiceTopology(mt *moodlev1alpha1.MoodleTenant, service *corev1.Service) {
+	service.Spec.TrafficDistribution = mt.Spec.Service.TrafficDistribution
+	if mt.Spec.Service.TopologyAwareHints {
+		service.Annotations = mergeStringMaps(service.Annotations, map[string]string{
+			corev1.AnnotationTopologyMode: "Auto",
+		})
+	}
+}
+
 // ingressForMoodle returns an Ingress object for the MoodleTenant
 func (r *MoodleTenantReconciler) ingressForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *networkingv1.Ingress {
 	labels := map[string]string{
@@ -769,49 +1405,40 @@ func (r *MoodleTenantReconciler) ingressForMoodle(mt *moodlev1alpha1.MoodleTenan
 		"moodle.bsu.by/tenant": mt.Name,
 	}
 
-	pathType := networkingv1.PathTypePrefix
+	// User annotations take precedence over the ones set by the operator
+	annotations := mergeStringMaps(certificateAnnotations(mt), externalDNSAnnotations(mt))
+	annotations = mergeStringMaps(annotations, protectionAnnotations(mt))
+	annotations = mergeStringMaps(annotations, securityAnnotations(mt))
+	annotations = mergeStringMaps(annotations, proxyAnnotations(mt))
+	annotations = mergeStringMaps(annotations, adminRestrictionAnnotations(mt))
+	annotations = mergeStringMaps(annotations, backendTLSAnnotations(mt, namespace))
+	annotations = r.withoutSnippets(mt, annotations)
+	annotations = mergeStringMaps(annotations, mt.Spec.Ingress.Annotations)
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
 
 	ingress := &networkingv1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        mt.Name + "-ingress",
 			Namespace:   namespace,
 			Labels:      labels,
-			Annotations: map[string]string{},
+			Annotations: annotations,
 		},
 		Spec: networkingv1.IngressSpec{
 			IngressClassName: ptr.To("nginx"),
 			TLS: []networkingv1.IngressTLS{
 				{
-					Hosts:      []string{mt.Spec.Hostname},
-					SecretName: fmt.Sprintf("%s-tls", mt.Name),
-				},
-			},
-			Rules: []networkingv1.IngressRule{
-				{
-					Host: mt.Spec.Hostname,
-					IngressRuleValue: networkingv1.IngressRuleValue{
-						HTTP: &networkingv1.HTTPIngressRuleValue{
-							Paths: []networkingv1.HTTPIngressPath{
-								{
-									Path:     "/",
-									PathType: &pathType,
-									Backend: networkingv1.IngressBackend{
-										Service: &networkingv1.IngressServiceBackend{
-											Name: mt.Name + "-service",
-											Port: networkingv1.ServiceBackendPort{
-												Number: 80,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
+					Hosts:      tenantHostnames(mt),
+					SecretName: tlsSecretName(mt),
 				},
 			},
 		},
 	}
 
+	// Alias hostnames are served by the same backend; Moodle redirects them to the canonical wwwroot
+	ingress.Spec.Rules = ingressRulesForMoodle(mt, tenantHostnames(mt))
+
 	// Set MoodleTenant instance as the owner
 	if err := ctrl.SetControllerReference(mt, ingress, r.Scheme); err != nil {
 		return nil
@@ -831,6 +1458,21 @@ func (r *MoodleTenantReconciler) networkPolicyForMoodle(mt *moodlev1alpha1.Moodl
 	protocolTCP := corev1.ProtocolTCP
 	protocolUDP := corev1.ProtocolUDP
 
+	// Ingress from outside the tenant is limited to the Moodle HTTP port so that the
+	// memcached sidecar is never reachable from other namespaces
+	httpPort := []networkingv1.NetworkPolicyPort{
+		{
+			Protocol: &protocolTCP,
+			Port:     ptr.To(intstr.FromInt(8080)),
+		},
+	}
+	if mt.Spec.BackendTLS != nil {
+		httpPort = append(httpPort, networkingv1.NetworkPolicyPort{
+			Protocol: &protocolTCP,
+			Port:     ptr.To(intstr.FromInt(backendTLSPort)),
+		})
+	}
+
 	networkPolicy := &networkingv1.NetworkPolicy{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "tenant-isolation",
@@ -846,20 +1488,29 @@ func (r *MoodleTenantReconciler) networkPolicyForMoodle(mt *moodlev1alpha1.Moodl
 			Ingress: []networkingv1.NetworkPolicyIngressRule{
 				{
 					// Allow ingress from Ingress Controller
+					From:  []networkingv1.NetworkPolicyPeer{r.ingressControllerPeer(mt)},
+					Ports: httpPort,
+				},
+				{
+					// Allow memcached only from the tenant's own pods
 					From: []networkingv1.NetworkPolicyPeer{
 						{
-							NamespaceSelector: &metav1.LabelSelector{
-								MatchLabels: map[string]string{
-									"kubernetes.io/metadata.name": "ingress-nginx",
-								},
+							PodSelector: &metav1.LabelSelector{
+								MatchLabels: labels,
 							},
 						},
 					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						{
+							Protocol: &protocolTCP,
+							Port:     ptr.To(intstr.FromInt(11211)),
+						},
+					},
 				},
 			},
 			Egress: []networkingv1.NetworkPolicyEgressRule{
 				{
-					// Allow egress to PostgreSQL database
+					// Allow egress to the database
 					To: []networkingv1.NetworkPolicyPeer{
 						{
 							// This would need to be configured based on actual DB location
@@ -874,7 +1525,7 @@ func (r *MoodleTenantReconciler) networkPolicyForMoodle(mt *moodlev1alpha1.Moodl
 					Ports: []networkingv1.NetworkPolicyPort{
 						{
 							Protocol: &protocolTCP,
-							Port:     ptr.To(intstr.FromInt(5432)),
+							Port:     ptr.To(intstr.FromInt32(databasePort(mt))),
 						},
 					},
 				},
@@ -900,23 +1551,484 @@ func (r *MoodleTenantReconciler) networkPolicyForMoodle(mt *moodlev1alpha1.Moodl
 						},
 					},
 				},
+			},
+		},
+	}
+
+	// Allow HTTP/HTTPS egress for Moodle updates and external integrations, unless
+	// the CiliumNetworkPolicy restricts it to FQDNs
+	if len(mt.Spec.NetworkPolicy.FQDNEgress) == 0 {
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: egressPeers(mt),
+			Ports: []networkingv1.NetworkPolicyPort{
 				{
-					// Allow HTTP/HTTPS egress for Moodle updates and external integrations
-					Ports: []networkingv1.NetworkPolicyPort{
-						{
-							Protocol: &protocolTCP,
-							Port:     ptr.To(intstr.FromInt(80)),
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt(80)),
+				},
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt(443)),
+				},
+			},
+		})
+	}
+
+	// The operator-level template replaces the baseline, e.g. on Cilium clusters with a security team baseline
+	if r.NetworkPolicyTemplate != nil {
+		networkPolicy.Spec = *r.NetworkPolicyTemplate.DeepCopy()
+	}
+
+	// The hibernated page passes requests on to the activator of the operator
+	if port := activatorPort(r.ActivatorURL); mt.Spec.Hibernation != nil && port != 0 {
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{},
+				},
+			},
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt32(port)),
+				},
+			},
+		})
+	}
+
+	// Allow ingress from the Gateway namespace when routing through Gateway API
+	if mt.Spec.Routing.Mode == routingModeGateway && mt.Spec.Routing.GatewayRef.Namespace != "" {
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"kubernetes.io/metadata.name": mt.Spec.Routing.GatewayRef.Namespace,
 						},
+					},
+				},
+			},
+			Ports: httpPort,
+		})
+	}
+
+	// Allow ingress from the internal ingress controller serving the admin hostname
+	if admin := mt.Spec.Ingress.Admin; admin != nil && admin.ControllerNamespace != "" {
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"kubernetes.io/metadata.name": admin.ControllerNamespace,
+						},
+					},
+				},
+			},
+			Ports: httpPort,
+		})
+	}
+
+	// Allow the Istio gateways in and the sidecars out to istiod in mesh mode
+	if mt.Spec.Mesh != nil {
+		controlPlane := []networkingv1.NetworkPolicyPeer{
+			{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"kubernetes.io/metadata.name": meshControlPlaneNamespace(mt),
+					},
+				},
+			},
+		}
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From:  controlPlane,
+			Ports: httpPort,
+		})
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: controlPlane,
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					// xDS and certificate signing
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt(15012)),
+				},
+			},
+		})
+	}
+
+	// Allow the tenant pods to reach the shared Memcached instances
+	if memcachedShared(mt) {
+		tenantPods := []networkingv1.NetworkPolicyPeer{
+			{
+				PodSelector: &metav1.LabelSelector{},
+			},
+		}
+		memcachedPorts := []networkingv1.NetworkPolicyPort{
+			{
+				Protocol: &protocolTCP,
+				Port:     ptr.To(intstr.FromInt(memcachedPort)),
+			},
+		}
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From:  tenantPods,
+			Ports: memcachedPorts,
+		})
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To:    tenantPods,
+			Ports: memcachedPorts,
+		})
+	}
+
+	// Allow the tenant pods to reach the deployed Redis server, or Moodle to reach the
+	// cache cluster or referenced Redis server
+	if redisDeployed(mt) {
+		tenantPods := []networkingv1.NetworkPolicyPeer{
+			{
+				PodSelector: &metav1.LabelSelector{},
+			},
+		}
+		redisPorts := []networkingv1.NetworkPolicyPort{
+			{
+				Protocol: &protocolTCP,
+				Port:     ptr.To(intstr.FromInt(redisPort)),
+			},
+		}
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From:  tenantPods,
+			Ports: redisPorts,
+		})
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To:    tenantPods,
+			Ports: redisPorts,
+		})
+	} else if cc := cacheCluster(mt); cc != nil {
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"kubernetes.io/metadata.name": cc.Namespace,
+						},
+					},
+					PodSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{cacheClusterLabel: cc.Name},
+					},
+				},
+			},
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt(cacheClusterPort(cc.Type))),
+				},
+			},
+		})
+	} else if redisEnabled(mt) {
+		// Sentinels and cluster nodes may announce other addresses than the ones given,
+		// so egress is opened by port
+		ports := []networkingv1.NetworkPolicyPort{}
+		for _, port := range redisExternalPorts(mt) {
+			ports = append(ports, networkingv1.NetworkPolicyPort{
+				Protocol: &protocolTCP,
+				Port:     ptr.To(intstr.FromInt32(port)),
+			})
+		}
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To:    egressPeers(mt),
+			Ports: ports,
+		})
+	}
+
+	// Allow egress to a database given by address, directly or through the database
+	// Service, so that the policy follows the database to a new address
+	if net.ParseIP(mt.Spec.DatabaseRef.Host) != nil {
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{
+				{
+					IPBlock: &networkingv1.IPBlock{CIDR: hostCIDR(mt.Spec.DatabaseRef.Host)},
+				},
+			},
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt32(databasePort(mt))),
+				},
+			},
+		})
+	}
+
+	// Allow Moodle to reach database instances run by a database operator in the tenant
+	// namespace, the instances to replicate from each other and to reach the API server,
+	// and the database operator to poll them
+	if statusPort, operatorNamespace, ok := managedDatabase(mt); ok {
+		tenantPods := []networkingv1.NetworkPolicyPeer{
+			{
+				PodSelector: &metav1.LabelSelector{},
+			},
+		}
+		postgresPort := []networkingv1.NetworkPolicyPort{
+			{
+				Protocol: &protocolTCP,
+				Port:     ptr.To(intstr.FromInt32(databasePort(mt))),
+			},
+		}
+		statusPorts := []networkingv1.NetworkPolicyPort{
+			{
+				Protocol: &protocolTCP,
+				Port:     ptr.To(intstr.FromInt(statusPort)),
+			},
+		}
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress,
+			networkingv1.NetworkPolicyIngressRule{
+				From:  tenantPods,
+				Ports: append(postgresPort, statusPorts...),
+			},
+			networkingv1.NetworkPolicyIngressRule{
+				From: []networkingv1.NetworkPolicyPeer{
+					{
+						NamespaceSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{
+								"kubernetes.io/metadata.name": operatorNamespace,
+							},
+						},
+					},
+				},
+				Ports: statusPorts,
+			},
+		)
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress,
+			networkingv1.NetworkPolicyEgressRule{
+				To:    tenantPods,
+				Ports: append(postgresPort, statusPorts...),
+			},
+			networkingv1.NetworkPolicyEgressRule{
+				To: egressPeers(mt),
+				Ports: []networkingv1.NetworkPolicyPort{
+					{
+						Protocol: &protocolTCP,
+						Port:     ptr.To(intstr.FromInt(443)),
+					},
+					{
+						Protocol: &protocolTCP,
+						Port:     ptr.To(intstr.FromInt(6443)),
+					},
+				},
+			},
+		)
+	}
+
+	// Allow the Cloud SQL Auth Proxy to reach Cloud SQL instances
+	if cloudSQLProxyEnabled(mt) {
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: egressPeers(mt),
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt(3307)),
+				},
+			},
+		})
+	}
+
+	// Allow egress to a referenced Zalando cluster in another namespace
+	if ref := mt.Spec.DatabaseRef.Zalando.ClusterRef; mt.Spec.DatabaseRef.Mode == databaseModeZalando && ref != nil {
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"kubernetes.io/metadata.name": ref.Namespace,
+						},
+					},
+				},
+			},
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt32(databasePort(mt))),
+				},
+			},
+		})
+	}
+
+	// Allow egress to the read replicas, by address where known
+	if len(mt.Spec.DatabaseRef.ReadReplicas) > 0 {
+		replicaPeers := []networkingv1.NetworkPolicyPeer{}
+		byName := false
+		for _, replica := range mt.Spec.DatabaseRef.ReadReplicas {
+			if net.ParseIP(replica) == nil {
+				byName = true
+				continue
+			}
+			replicaPeers = append(replicaPeers, networkingv1.NetworkPolicyPeer{
+				IPBlock: &networkingv1.IPBlock{CIDR: hostCIDR(replica)},
+			})
+		}
+		if byName {
+			replicaPeers = egressPeers(mt)
+		}
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: replicaPeers,
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt32(databasePort(mt))),
+				},
+			},
+		})
+	}
+
+	// Allow Moodle to reach the ProxySQL pooler
+	if mt.Spec.DatabaseRef.Pooler != nil {
+		tenantPods := []networkingv1.NetworkPolicyPeer{
+			{
+				PodSelector: &metav1.LabelSelector{},
+			},
+		}
+		proxySQLPorts := []networkingv1.NetworkPolicyPort{
+			{
+				Protocol: &protocolTCP,
+				Port:     ptr.To(intstr.FromInt(proxySQLPort)),
+			},
+		}
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From:  tenantPods,
+			Ports: proxySQLPorts,
+		})
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To:    tenantPods,
+			Ports: proxySQLPorts,
+		})
+	}
+
+	// Allow Prometheus to scrape the database exporter
+	if mt.Spec.DatabaseRef.Exporter != nil {
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"kubernetes.io/metadata.name": exporterPrometheusNamespace(mt),
+						},
+					},
+				},
+			},
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt(exporterPort)),
+				},
+			},
+		})
+	}
+
+	// Allow Prometheus to scrape the cache exporter
+	if cacheExported(mt) {
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From: []networkingv1.NetworkPolicyPeer{
+				{
+					NamespaceSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"kubernetes.io/metadata.name": cacheExporterPrometheusNamespace(mt),
+						},
+					},
+				},
+			},
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt(cacheExporterPort(mt))),
+				},
+			},
+		})
+	}
+
+	// Allow DNS queries to custom nameservers outside the cluster
+	if mt.Spec.DNSConfig != nil && len(mt.Spec.DNSConfig.Nameservers) > 0 {
+		peers := []networkingv1.NetworkPolicyPeer{}
+		for _, nameserver := range mt.Spec.DNSConfig.Nameservers {
+			peers = append(peers, networkingv1.NetworkPolicyPeer{
+				IPBlock: &networkingv1.IPBlock{CIDR: hostCIDR(nameserver)},
+			})
+		}
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: peers,
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolUDP,
+					Port:     ptr.To(intstr.FromInt(53)),
+				},
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt(53)),
+				},
+			},
+		})
+	}
+
+	// Allow egress to the plagiarism service when it listens on a non-standard port
+	if plagiarism := mt.Spec.Integrations.Plagiarism; plagiarism != nil {
+		if endpoint, err := url.Parse(plagiarism.APIEndpoint); err == nil && endpoint.Port() != "" && endpoint.Port() != "80" && endpoint.Port() != "443" {
+			networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+				To: egressPeers(mt),
+				Ports: []networkingv1.NetworkPolicyPort{
+					{
+						Protocol: &protocolTCP,
+						Port:     ptr.To(intstr.Parse(endpoint.Port())),
+					},
+				},
+			})
+		}
+	}
+
+	// Allow egress to the SMTP relay only on its configured port
+	if mt.Spec.Mail != nil {
+		smtpPeers := egressPeers(mt)
+		if net.ParseIP(mt.Spec.Mail.SMTPHost) != nil {
+			smtpPeers = []networkingv1.NetworkPolicyPeer{
+				{
+					IPBlock: &networkingv1.IPBlock{CIDR: hostCIDR(mt.Spec.Mail.SMTPHost)},
+				},
+			}
+		}
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To: smtpPeers,
+			Ports: []networkingv1.NetworkPolicyPort{
+				{
+					Protocol: &protocolTCP,
+					Port:     ptr.To(intstr.FromInt32(smtpPort(mt))),
+				},
+			},
+		})
+	}
+
+	// Allow tenant-to-tenant traffic (MNet, LTI) when the tenant is exposed internally
+	if mt.Spec.Exposure.InternalHostname != "" {
+		tenantNamespaces := []networkingv1.NetworkPolicyPeer{
+			{
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
 						{
-							Protocol: &protocolTCP,
-							Port:     ptr.To(intstr.FromInt(443)),
+							Key:      tenantNamespaceLabel,
+							Operator: metav1.LabelSelectorOpExists,
 						},
 					},
 				},
 			},
-		},
+		}
+		networkPolicy.Spec.Ingress = append(networkPolicy.Spec.Ingress, networkingv1.NetworkPolicyIngressRule{
+			From:  tenantNamespaces,
+			Ports: httpPort,
+		})
+		networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, networkingv1.NetworkPolicyEgressRule{
+			To:    tenantNamespaces,
+			Ports: httpPort,
+		})
 	}
 
+	// Allow egress declared in the tenant spec
+	networkPolicy.Spec.Egress = append(networkPolicy.Spec.Egress, mt.Spec.NetworkPolicy.ExtraEgress...)
+
+	// Neither the template nor the extra egress may reopen the blocked ranges
+	networkPolicy.Spec.Egress = blockEgress(mt, networkPolicy.Spec.Egress)
+
 	// Set MoodleTenant instance as the owner
 	if err := ctrl.SetControllerReference(mt, networkPolicy, r.Scheme); err != nil {
 		return nil
@@ -931,6 +2043,10 @@ func (r *MoodleTenantReconciler) hpaForMoodle(mt *moodlev1alpha1.MoodleTenant, n
 	if mt.Spec.HPA.MinReplicas != nil {
 		minReplicas = *mt.Spec.HPA.MinReplicas
 	}
+	maxReplicas := mt.Spec.HPA.MaxReplicas
+	if scaling := scheduledScaling(mt); scaling != nil {
+		minReplicas, maxReplicas = scaling.MinReplicas, scaling.MaxReplicas
+	}
 
 	targetCPU := int32(75)
 	if mt.Spec.HPA.TargetCPU != nil {
@@ -946,10 +2062,10 @@ func (r *MoodleTenantReconciler) hpaForMoodle(mt *moodlev1alpha1.MoodleTenant, n
 			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
 				APIVersion: "apps/v1",
 				Kind:       "Deployment",
-				Name:       "moodle",
+				Name:       activeDeploymentName(mt),
 			},
 			MinReplicas: &minReplicas,
-			MaxReplicas: mt.Spec.HPA.MaxReplicas,
+			MaxReplicas: maxReplicas,
 			Metrics: []autoscalingv2.MetricSpec{
 				{
 					Type: autoscalingv2.ResourceMetricSourceType,
@@ -974,16 +2090,51 @@ func (r *MoodleTenantReconciler) hpaForMoodle(mt *moodlev1alpha1.MoodleTenant, n
 }
 
 func (r *MoodleTenantReconciler) cronJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *batchv1.CronJob {
-	// Run Moodle's cron.php every 5 minutes (standard Moodle recommendation)
+	cronJob := moodleCronJob(mt, namespace)
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, cronJob, r.Scheme); err != nil {
+		return nil
+	}
+
+	return cronJob
+}
+
+// moodleCronJob returns the CronJob running cron.php without an owner. Its pod template
+// is the template of every pod running Moodle CLI scripts.
+func moodleCronJob(mt *moodlev1alpha1.MoodleTenant, namespace string) *batchv1.CronJob {
+	// Run Moodle's cron.php every 5 minutes (standard Moodle recommendation) unless
+	// spec.cron says otherwise
+	cron := mt.Spec.Cron
+	schedule := "*/5 * * * *"
+	if cron.Schedule != "" {
+		schedule = cron.Schedule
+	}
+	concurrencyPolicy := batchv1.ForbidConcurrent
+	if cron.ConcurrencyPolicy != "" {
+		concurrencyPolicy = batchv1.ConcurrencyPolicy(cron.ConcurrencyPolicy)
+	}
+
 	cronJob := &batchv1.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      mt.Name + "-cron",
 			Namespace: namespace,
+			Labels: map[string]string{
+				"moodle.bsu.by/tenant": mt.Name,
+			},
 		},
 		Spec: batchv1.CronJobSpec{
-			Schedule: "*/5 * * * *", // Every 5 minutes
+			Schedule:                   schedule,
+			TimeZone:                   cron.TimeZone,
+			Suspend:                    ptr.To(cronSuspendedReason(mt) != ""),
+			ConcurrencyPolicy:          concurrencyPolicy,
+			StartingDeadlineSeconds:    cron.StartingDeadlineSeconds,
+			SuccessfulJobsHistoryLimit: ptr.To(ptr.Deref(cron.SuccessfulJobsHistoryLimit, 3)),
+			FailedJobsHistoryLimit:     ptr.To(ptr.Deref(cron.FailedJobsHistoryLimit, 1)),
 			JobTemplate: batchv1.JobTemplateSpec{
 				Spec: batchv1.JobSpec{
+					ActiveDeadlineSeconds: cron.ActiveDeadlineSeconds,
+					BackoffLimit:          cron.BackoffLimit,
 					Template: corev1.PodTemplateSpec{
 						Spec: corev1.PodSpec{
 							RestartPolicy: corev1.RestartPolicyOnFailure,
@@ -995,55 +2146,15 @@ func (r *MoodleTenantReconciler) cronJobForMoodle(mt *moodlev1alpha1.MoodleTenan
 							Containers: []corev1.Container{
 								{
 									Name:  "moodle-cron",
-									Image: mt.Spec.Image,
+									Image: moodleImage(mt),
 									Command: []string{
 										"/usr/local/bin/php",
 										"/var/www/html/admin/cli/cron.php",
 									},
 									Env: []corev1.EnvVar{
 										{
-											Name: "MOODLE_DATABASE_HOST",
-											ValueFrom: &corev1.EnvVarSource{
-												SecretKeyRef: &corev1.SecretKeySelector{
-													LocalObjectReference: corev1.LocalObjectReference{
-														Name: mt.Spec.DatabaseRef.AdminSecret,
-													},
-													Key: "host",
-												},
-											},
-										},
-										{
-											Name: "MOODLE_DATABASE_NAME",
-											ValueFrom: &corev1.EnvVarSource{
-												SecretKeyRef: &corev1.SecretKeySelector{
-													LocalObjectReference: corev1.LocalObjectReference{
-														Name: mt.Spec.DatabaseRef.AdminSecret,
-													},
-													Key: "database",
-												},
-											},
-										},
-										{
-											Name: "MOODLE_DATABASE_USER",
-											ValueFrom: &corev1.EnvVarSource{
-												SecretKeyRef: &corev1.SecretKeySelector{
-													LocalObjectReference: corev1.LocalObjectReference{
-														Name: mt.Spec.DatabaseRef.AdminSecret,
-													},
-													Key: "username",
-												},
-											},
-										},
-										{
-											Name: "MOODLE_DATABASE_PASSWORD",
-											ValueFrom: &corev1.EnvVarSource{
-												SecretKeyRef: &corev1.SecretKeySelector{
-													LocalObjectReference: corev1.LocalObjectReference{
-														Name: mt.Spec.DatabaseRef.AdminSecret,
-													},
-													Key: "password",
-												},
-											},
+											Name:  "MOODLE_URL",
+											Value: moodleURL(mt),
 										},
 									},
 									VolumeMounts: []corev1.VolumeMount{
@@ -1081,14 +2192,53 @@ func (r *MoodleTenantReconciler) cronJobForMoodle(mt *moodlev1alpha1.MoodleTenan
 		},
 	}
 
-	// Set MoodleTenant instance as the owner
-	if err := ctrl.SetControllerReference(mt, cronJob, r.Scheme); err != nil {
-		return nil
+	// A sidecar would keep cron Jobs from ever completing
+	setSidecarInjection(mt, &cronJob.Spec.JobTemplate.Spec.Template, false)
+
+	// cron.php runs with the PHP settings of the web pods
+	applyServerConfig(mt, &cronJob.Spec.JobTemplate.Spec.Template)
+
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.DNSPolicy = mt.Spec.DNSPolicy
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.DNSConfig = mt.Spec.DNSConfig
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.NodeSelector = cron.NodeSelector
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.Tolerations = cron.Tolerations
+	cronJob.Spec.JobTemplate.Spec.Template.Spec.Affinity = cron.Affinity
+
+	// Cron runs with the same site configuration as the web pods
+	cronContainer := &cronJob.Spec.JobTemplate.Spec.Template.Spec.Containers[0]
+	applyResources(cronContainer, cron.Resources)
+	cronContainer.Env = append(cronContainer.Env, moodleDatabaseEnv(mt)...)
+	cronContainer.Env = append(cronContainer.Env, configEnvForMoodle(mt)...)
+	cronContainer.Env = append(cronContainer.Env, cacheEnv(mt)...)
+	applyRedisTLS(mt, &cronJob.Spec.JobTemplate.Spec.Template.Spec)
+	// Several processes of a run share the task queue until the keep-alive runs out
+	if parallelism := cron.Parallelism; parallelism > 1 {
+		cronJob.Spec.JobTemplate.Spec.Parallelism = ptr.To(parallelism)
+		cronJob.Spec.JobTemplate.Spec.Completions = ptr.To(parallelism)
+		cronContainer.Command = append(cronContainer.Command, fmt.Sprintf("--keep-alive=%d", cronKeepAlive(mt)))
+	}
+	if cronConfiguresMUC(mt) {
+		cronContainer.Command = []string{
+			"/bin/sh", "-c",
+			"/usr/local/bin/php /usr/local/share/moodle/configure-muc.php && exec " + strings.Join(cronContainer.Command, " "),
+		}
 	}
+	applyLocalCache(mt, &cronJob.Spec.JobTemplate.Spec.Template.Spec)
+	applyStorageLayout(mt, &cronJob.Spec.JobTemplate.Spec.Template.Spec)
+	applyDatabaseTLS(mt, &cronJob.Spec.JobTemplate.Spec.Template.Spec, true)
+	applyDatabaseIAM(mt, &cronJob.Spec.JobTemplate.Spec.Template.Spec, moodleDatabasePasswordFileEnv)
 
 	return cronJob
 }
 
+// cronConfiguresMUC reports whether the MUC stores are set up before every cron run. They
+// keep the Redis address in moodledata, so behind Sentinel they are pointed at the current
+// master.
+func cronConfiguresMUC(mt *moodlev1alpha1.MoodleTenant) bool {
+	redis := mt.Spec.Cache.Redis
+	return redisEnabled(mt) && redis != nil && redis.Sentinel != nil && mt.Spec.Cache.MUC != mucManual
+}
+
 func (r *MoodleTenantReconciler) pdbForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *policyv1.PodDisruptionBudget {
 	labels := map[string]string{
 		"app":                  "moodle",
@@ -1119,7 +2269,347 @@ func (r *MoodleTenantReconciler) pdbForMoodle(mt *moodlev1alpha1.MoodleTenant, n
 	return pdb
 }
 
+// logCleanupTasks are the scheduled tasks deleting expired log entries
+var logCleanupTasks = []string{
+	`\logstore_standard\task\cleanup_task`,
+	`\core\task\task_log_cleanup_task`,
+}
+
+// scheduledTaskOverrides returns the JSON of Moodle's $CFG->scheduled_tasks for
+// cron.scheduledTasks and dataRetention.logCleanupSchedule, or "" for none
+func scheduledTaskOverrides(mt *moodlev1alpha1.MoodleTenant) string {
+	overrides := map[string]map[string]interface{}{}
+	if schedule := mt.Spec.DataRetention.LogCleanupSchedule; schedule != "" {
+		for _, task := range logCleanupTasks {
+			overrides[task] = map[string]interface{}{"schedule": schedule}
+		}
+	}
+	if len(overrides) == 0 && len(mt.Spec.Cron.ScheduledTasks) == 0 {
+		return ""
+	}
+	for _, task := range mt.Spec.Cron.ScheduledTasks {
+		override := map[string]interface{}{}
+		if task.Schedule != "" {
+			override["schedule"] = task.Schedule
+		}
+		if task.Disabled != nil {
+			override["disabled"] = 0
+			if *task.Disabled {
+				override["disabled"] = 1
+			}
+		}
+		overrides[task.Task] = override
+	}
+	// Map keys are sorted, so the pods only roll when the overrides change
+	data, _ := json.Marshal(overrides)
+	return string(data)
+}
+
+// configEnvForMoodle returns the environment variables carrying site configuration
+// from the MoodleTenant spec to config.php
+func configEnvForMoodle(mt *moodlev1alpha1.MoodleTenant) []corev1.EnvVar {
+	env := []corev1.EnvVar{}
+
+	if mt.Spec.DatabaseRef.TablePrefix != "" {
+		env = append(env, corev1.EnvVar{Name: "DB_PREFIX", Value: mt.Spec.DatabaseRef.TablePrefix})
+	}
+	if mt.Spec.DatabaseRef.Collation != "" && databaseType(mt) != "pgsql" {
+		env = append(env, corev1.EnvVar{Name: "DB_COLLATION", Value: mt.Spec.DatabaseRef.Collation})
+	}
+	if mt.Spec.DatabaseRef.Options.Persistent {
+		env = append(env, corev1.EnvVar{Name: "DB_PERSIST", Value: "1"})
+	}
+	if timeout := mt.Spec.DatabaseRef.Options.ConnectTimeoutSeconds; timeout != nil {
+		env = append(env, corev1.EnvVar{Name: "DB_CONNECT_TIMEOUT", Value: fmt.Sprintf("%d", *timeout)})
+	}
+
+	if mt.Spec.Ingress.Admin != nil {
+		env = append(env, corev1.EnvVar{Name: "MOODLE_ADMIN_URL", Value: adminURL(mt)})
+	}
+
+	if mt.Spec.Locale.Language != "" {
+		env = append(env, corev1.EnvVar{Name: "MOODLE_LANG", Value: mt.Spec.Locale.Language})
+	}
+	if mt.Spec.Locale.Timezone != "" {
+		env = append(env,
+			corev1.EnvVar{Name: "MOODLE_TIMEZONE", Value: mt.Spec.Locale.Timezone},
+			// TZ keeps container logs and PHP's default timezone aligned with the site
+			corev1.EnvVar{Name: "TZ", Value: mt.Spec.Locale.Timezone},
+		)
+	}
+
+	retention := mt.Spec.DataRetention
+	for _, setting := range []struct {
+		name  string
+		value *int32
+	}{
+		{"MOODLE_LOG_LIFETIME_DAYS", retention.LogLifetimeDays},
+		{"MOODLE_UNCONFIRMED_USER_PURGE_HOURS", retention.UnconfirmedUserPurgeHours},
+		{"MOODLE_INCOMPLETE_USER_PURGE_DAYS", retention.IncompleteUserPurgeDays},
+		{"MOODLE_BACKUP_MAX_KEPT", retention.BackupMaxKept},
+		{"MOODLE_BACKUP_DELETE_DAYS", retention.BackupDeleteDays},
+		{"MOODLE_TASK_LOG_RETENTION_DAYS", retention.TaskLogRetentionDays},
+		{"MOODLE_TASK_LOG_RETAIN_RUNS", retention.TaskLogRetainRuns},
+	} {
+		if setting.value != nil {
+			env = append(env, corev1.EnvVar{Name: setting.name, Value: fmt.Sprintf("%d", *setting.value)})
+		}
+	}
+
+	if logGuests := retention.LogGuests; logGuests != nil {
+		value := "0"
+		if *logGuests {
+			value = "1"
+		}
+		env = append(env, corev1.EnvVar{Name: "MOODLE_LOG_GUESTS", Value: value})
+	}
+
+	if overrides := scheduledTaskOverrides(mt); overrides != "" {
+		env = append(env, corev1.EnvVar{Name: "MOODLE_SCHEDULED_TASKS", Value: overrides})
+	}
+	cron := mt.Spec.Cron
+	for _, setting := range []struct {
+		name  string
+		value *int32
+	}{
+		{"MOODLE_TASK_SCHEDULED_CONCURRENCY_LIMIT", cron.ScheduledConcurrencyLimit},
+		{"MOODLE_TASK_ADHOC_CONCURRENCY_LIMIT", cron.AdhocConcurrencyLimit},
+		{"MOODLE_TASK_SCHEDULED_MAX_RUNTIME", cron.ScheduledMaxRuntimeSeconds},
+		{"MOODLE_TASK_ADHOC_MAX_RUNTIME", cron.AdhocMaxRuntimeSeconds},
+	} {
+		if setting.value != nil {
+			env = append(env, corev1.EnvVar{Name: setting.name, Value: fmt.Sprintf("%d", *setting.value)})
+		}
+	}
+
+	if plagiarism := mt.Spec.Integrations.Plagiarism; plagiarism != nil {
+		env = append(env,
+			corev1.EnvVar{Name: "MOODLE_PLAGIARISM_PROVIDER", Value: plagiarism.Provider},
+			corev1.EnvVar{Name: "MOODLE_PLAGIARISM_API_URL", Value: plagiarism.APIEndpoint},
+			corev1.EnvVar{
+				Name: "MOODLE_PLAGIARISM_ACCOUNT_ID",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: mt.Name + "-plagiarism"},
+						Key:                  "accountId",
+					},
+				},
+			},
+			corev1.EnvVar{
+				Name: "MOODLE_PLAGIARISM_API_KEY",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: mt.Name + "-plagiarism"},
+						Key:                  "apiKey",
+					},
+				},
+			},
+		)
+	}
+
+	if mail := mt.Spec.Mail; mail != nil {
+		security := mail.Security
+		if security == "" {
+			security = "tls"
+		}
+		env = append(env,
+			corev1.EnvVar{Name: "MOODLE_SMTP_HOSTS", Value: fmt.Sprintf("%s:%d", mail.SMTPHost, smtpPort(mt))},
+			corev1.EnvVar{Name: "MOODLE_SMTP_SECURE", Value: security},
+		)
+		if mail.NoReplyAddress != "" {
+			env = append(env, corev1.EnvVar{Name: "MOODLE_NOREPLY_ADDRESS", Value: mail.NoReplyAddress})
+		}
+		if mail.CredentialsSecretRef != nil {
+			env = append(env,
+				corev1.EnvVar{
+					Name: "MOODLE_SMTP_USER",
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: mt.Name + "-smtp"},
+							Key:                  "username",
+						},
+					},
+				},
+				corev1.EnvVar{
+					Name: "MOODLE_SMTP_PASS",
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: mt.Name + "-smtp"},
+							Key:                  "password",
+						},
+					},
+				},
+			)
+		}
+	}
+
+	return env
+}
+
+// smtpPort returns the port of the SMTP relay of the tenant
+func smtpPort(mt *moodlev1alpha1.MoodleTenant) int32 {
+	if mt.Spec.Mail.Port != 0 {
+		return mt.Spec.Mail.Port
+	}
+	return 587
+}
+
+// moodleURL returns the wwwroot of the tenant
+func moodleURL(mt *moodlev1alpha1.MoodleTenant) string {
+	return fmt.Sprintf("https://%s%s", mt.Spec.Hostname, mt.Spec.Routing.PathPrefix)
+}
+
+// adminURL returns the wwwroot of the tenant on its admin hostname
+func adminURL(mt *moodlev1alpha1.MoodleTenant) string {
+	return fmt.Sprintf("https://%s%s", mt.Spec.Ingress.Admin.Hostname, mt.Spec.Routing.PathPrefix)
+}
+
+// tenantHostnames returns all hostnames the tenant is served on, the canonical one first
+func tenantHostnames(mt *moodlev1alpha1.MoodleTenant) []string {
+	return append([]string{mt.Spec.Hostname}, mt.Spec.AdditionalHostnames...)
+}
+
+// publishedHostnames returns the tenant hostnames and the admin hostname, which shares their
+// certificate and needs a DNS record as well
+func publishedHostnames(mt *moodlev1alpha1.MoodleTenant) []string {
+	hostnames := tenantHostnames(mt)
+	if mt.Spec.Ingress.Admin != nil {
+		hostnames = append(hostnames, mt.Spec.Ingress.Admin.Hostname)
+	}
+	return hostnames
+}
+
+// ingressControllerPeer returns the ingress controller pods allowed to reach the Moodle pods.
+// The tenant spec overrides the operator-wide settings.
+func (r *MoodleTenantReconciler) ingressControllerPeer(mt *moodlev1alpha1.MoodleTenant) networkingv1.NetworkPolicyPeer {
+	namespace := "ingress-nginx"
+	if mt.Spec.NetworkPolicy.IngressControllerNamespace != "" {
+		namespace = mt.Spec.NetworkPolicy.IngressControllerNamespace
+	} else if r.IngressControllerNamespace != "" {
+		namespace = r.IngressControllerNamespace
+	}
+
+	podSelector := r.IngressControllerPodSelector
+	if mt.Spec.NetworkPolicy.IngressControllerPodSelector != nil {
+		podSelector = mt.Spec.NetworkPolicy.IngressControllerPodSelector
+	}
+
+	peer := networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"kubernetes.io/metadata.name": namespace,
+			},
+		},
+	}
+	if podSelector != nil {
+		peer.PodSelector = podSelector.DeepCopy()
+	}
+	return peer
+}
+
+// defaultBlockedEgressCIDRs are the cloud metadata endpoints, a common target of SSRF
+// through plugins uploaded by site administrators
+var defaultBlockedEgressCIDRs = []string{
+	"169.254.169.254/32",
+	"fd00:ec2::254/128",
+}
+
+// blockedEgressCIDRs returns the ranges no egress rule of the tenant may reach
+func blockedEgressCIDRs(mt *moodlev1alpha1.MoodleTenant) []string {
+	return append(append([]string{}, defaultBlockedEgressCIDRs...), mt.Spec.NetworkPolicy.BlockedEgressCIDRs...)
+}
+
+// egressPeers returns the destinations of the generated internet egress rules: any
+// address except the blocked ranges, and any pod in the cluster
+func egressPeers(mt *moodlev1alpha1.MoodleTenant) []networkingv1.NetworkPolicyPeer {
+	ipv4 := &networkingv1.IPBlock{CIDR: "0.0.0.0/0"}
+	ipv6 := &networkingv1.IPBlock{CIDR: "::/0"}
+	for _, cidr := range blockedEgressCIDRs(mt) {
+		if strings.Contains(cidr, ":") {
+			ipv6.Except = append(ipv6.Except, cidr)
+		} else {
+			ipv4.Except = append(ipv4.Except, cidr)
+		}
+	}
+
+	return []networkingv1.NetworkPolicyPeer{
+		{IPBlock: ipv4},
+		{IPBlock: ipv6},
+		{
+			// Pod IPs may not be matched by ipBlock, depending on the CNI
+			NamespaceSelector: &metav1.LabelSelector{},
+		},
+	}
+}
+
+// blockEgress returns rules without a way to the blocked ranges. A rule without
+// destinations is limited to egressPeers, the blocked ranges are excepted from the
+// ipBlock peers containing them, and peers within a blocked range are dropped, along with
+// the rules left without destinations.
+func blockEgress(mt *moodlev1alpha1.MoodleTenant, rules []networkingv1.NetworkPolicyEgressRule) []networkingv1.NetworkPolicyEgressRule {
+	blocked := []netip.Prefix{}
+	for _, cidr := range blockedEgressCIDRs(mt) {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			blocked = append(blocked, prefix.Masked())
+		}
+	}
+
+	result := []networkingv1.NetworkPolicyEgressRule{}
+	for _, rule := range rules {
+		rule = *rule.DeepCopy()
+		if len(rule.To) == 0 {
+			rule.To = egressPeers(mt)
+			result = append(result, rule)
+			continue
+		}
+
+		peers := []networkingv1.NetworkPolicyPeer{}
+		for _, peer := range rule.To {
+			if peer.IPBlock == nil {
+				peers = append(peers, peer)
+				continue
+			}
+			prefix, err := netip.ParsePrefix(peer.IPBlock.CIDR)
+			if err != nil {
+				peers = append(peers, peer)
+				continue
+			}
+			prefix = prefix.Masked()
+
+			reachesBlocked := false
+			for _, block := range blocked {
+				switch {
+				case prefixContains(block, prefix):
+					reachesBlocked = true
+				case prefixContains(prefix, block) && !containsString(peer.IPBlock.Except, block.String()):
+					peer.IPBlock.Except = append(peer.IPBlock.Except, block.String())
+				}
+			}
+			if !reachesBlocked {
+				peers = append(peers, peer)
+			}
+		}
+		if len(peers) > 0 {
+			rule.To = peers
+			result = append(result, rule)
+		}
+	}
+	return result
+}
+
+// prefixContains reports whether inner lies within outer
+func prefixContains(outer, inner netip.Prefix) bool {
+	return outer.Addr().Is4() == inner.Addr().Is4() && outer.Bits() <= inner.Bits() && outer.Contains(inner.Addr())
+}
+
 // Helper functions
+func hostCIDR(ip string) string {
+	if strings.Contains(ip, ":") {
+		return ip + "/128"
+	}
+	return ip + "/32"
+}
+
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
 		if item == s {
@@ -1147,11 +2637,16 @@ func (r *MoodleTenantReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
 		Owns(&networkingv1.Ingress{}).
 		Owns(&networkingv1.NetworkPolicy{}).
 		Owns(&autoscalingv2.HorizontalPodAutoscaler{}).
 		Owns(&batchv1.CronJob{}).
+		Owns(&batchv1.Job{}).
 		Owns(&policyv1.PodDisruptionBudget{}).
+		Watches(&moodlev1alpha1.MoodleCacheCluster{}, handler.EnqueueRequestsFromMapFunc(r.tenantsForCacheCluster)).
+		Watches(&moodlev1alpha1.MoodleVersionCatalog{}, handler.EnqueueRequestsFromMapFunc(r.tenantsForVersionCatalog)).
+		Watches(&moodlev1alpha1.MoodleTenantClass{}, handler.EnqueueRequestsFromMapFunc(r.tenantsForClass)).
 		Named("moodletenant").
 		Complete(r)
 }
@@ -0,0 +1,541 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// cloneLabel links the copy of a tenant, and the objects provisioned for it in the
+// tenant namespaces, to its MoodleTenantClone
+const cloneLabel = "moodle.bsu.by/clone"
+
+// volumeSnapshotContentGVK is the cluster-scoped CSI VolumeSnapshotContent, which is not
+// part of the operator's scheme
+var volumeSnapshotContentGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshotContent"}
+
+// MoodleTenantCloneReconciler reconciles a MoodleTenantClone object
+type MoodleTenantCloneReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletenantclones,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletenantclones/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletenantclones/finalizers,verbs=update
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshotcontents,verbs=get;list;watch;create
+
+// Reconcile provisions the copy of a MoodleTenant step by step: it dumps the database of
+// the source into its moodledata, snapshots moodledata, restores the snapshot into the
+// namespace of a new MoodleTenant, which restores the dump into its own database, and
+// finally replaces the URL of the source in the copied database.
+func (r *MoodleTenantCloneReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	clone := &moodlev1alpha1.MoodleTenantClone{}
+	if err := r.Get(ctx, req.NamespacedName, clone); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get MoodleTenantClone")
+		return ctrl.Result{}, err
+	}
+
+	// A clone is provisioned once
+	if clone.Status.Phase == moodlev1alpha1.ClonePhaseReady || clone.Status.Phase == moodlev1alpha1.ClonePhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	originalStatus := clone.Status.DeepCopy()
+	result, err := r.reconcileClone(ctx, clone)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !equality.Semantic.DeepEqual(originalStatus, &clone.Status) {
+		if err := r.Status().Update(ctx, clone); err != nil {
+			logger.Error(err, "Failed to update MoodleTenantClone status")
+			return ctrl.Result{}, err
+		}
+	}
+	return result, nil
+}
+
+// reconcileClone advances the clone by one step and records it in the status
+func (r *MoodleTenantCloneReconciler) reconcileClone(ctx context.Context, clone *moodlev1alpha1.MoodleTenantClone) (ctrl.Result, error) {
+	source := &moodlev1alpha1.MoodleTenant{}
+	if err := r.Get(ctx, types.NamespacedName{Name: clone.Spec.SourceRef.Name, Namespace: clone.Namespace}, source); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		setClonePhase(clone, moodlev1alpha1.ClonePhasePending, "TenantNotFound", fmt.Sprintf("MoodleTenant %s not found", clone.Spec.SourceRef.Name))
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+	// The copy gets the spec the source runs with, so that it does not follow the class
+	if err := withTenantClass(ctx, r.Client, source); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		setClonePhase(clone, moodlev1alpha1.ClonePhasePending, "ClassNotFound", fmt.Sprintf("MoodleTenantClass %s of MoodleTenant %s not found", source.Spec.ClassRef.Name, source.Name))
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	target := &moodlev1alpha1.MoodleTenant{}
+	err := r.Get(ctx, types.NamespacedName{Name: clone.Spec.TargetName, Namespace: clone.Namespace}, target)
+	if err != nil && !errors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	if err == nil {
+		if target.Labels[cloneLabel] != clone.Name {
+			failClone(clone, "TargetExists", fmt.Sprintf("MoodleTenant %s already exists and is not a copy made by this clone", clone.Spec.TargetName))
+			return ctrl.Result{}, nil
+		}
+		return r.reconcileCloneTarget(ctx, clone, source, target)
+	}
+
+	// The dump is written into moodledata, so that the snapshot carries it to the copy
+	dump, err := r.reconcileCloneDump(ctx, clone, source)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	switch dump.Status.Phase {
+	case moodlev1alpha1.DumpPhaseSucceeded:
+	case moodlev1alpha1.DumpPhaseFailed:
+		failClone(clone, "DumpFailed", fmt.Sprintf("MoodleDatabaseDump %s failed", dump.Name))
+		return ctrl.Result{}, nil
+	default:
+		setClonePhase(clone, moodlev1alpha1.ClonePhaseDumping, "Dumping", fmt.Sprintf("MoodleDatabaseDump %s is dumping the database of %s", dump.Name, source.Name))
+		return ctrl.Result{}, nil
+	}
+
+	ready, failure, err := r.reconcileCloneSnapshot(ctx, clone, source)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if failure != "" {
+		failClone(clone, "SnapshotFailed", fmt.Sprintf("VolumeSnapshot %s of moodledata failed: %s", clone.Status.VolumeSnapshotName, failure))
+		return ctrl.Result{}, nil
+	}
+	if !ready {
+		setClonePhase(clone, moodlev1alpha1.ClonePhaseSnapshotting, "Snapshotting", fmt.Sprintf("Waiting for VolumeSnapshot %s of moodledata", clone.Status.VolumeSnapshotName))
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	if err := r.reconcileCloneVolume(ctx, clone, source); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	target = r.cloneTenant(clone, source, dump)
+	log.FromContext(ctx).Info("Creating the copy of a MoodleTenant", "MoodleTenant.Source", source.Name, "MoodleTenant.Name", target.Name)
+	if err := r.Create(ctx, target); err != nil {
+		return ctrl.Result{}, err
+	}
+	setClonePhase(clone, moodlev1alpha1.ClonePhaseRestoring, "Restoring", fmt.Sprintf("MoodleTenant %s is restoring the dump of %s", target.Name, source.Name))
+	return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+}
+
+// reconcileCloneTarget waits for the copy to restore the dump and then replaces the URL
+// of the source in its database
+func (r *MoodleTenantCloneReconciler) reconcileCloneTarget(ctx context.Context, clone *moodlev1alpha1.MoodleTenantClone, source, target *moodlev1alpha1.MoodleTenant) (ctrl.Result, error) {
+	restored := meta.FindStatusCondition(target.Status.Conditions, moodlev1alpha1.ConditionDatabaseRestored)
+	if restored == nil || restored.Status != metav1.ConditionTrue {
+		message := fmt.Sprintf("MoodleTenant %s is restoring the dump of %s", target.Name, source.Name)
+		if restored != nil {
+			message = fmt.Sprintf("MoodleTenant %s: %s", target.Name, restored.Message)
+		}
+		setClonePhase(clone, moodlev1alpha1.ClonePhaseRestoring, "Restoring", message)
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	task := &moodlev1alpha1.MoodleTask{}
+	err := r.Get(ctx, types.NamespacedName{Name: cloneTaskName(clone), Namespace: clone.Namespace}, task)
+	if err != nil && errors.IsNotFound(err) {
+		task = &moodlev1alpha1.MoodleTask{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      cloneTaskName(clone),
+				Namespace: clone.Namespace,
+				Labels:    map[string]string{cloneLabel: clone.Name},
+			},
+			Spec: moodlev1alpha1.MoodleTaskSpec{
+				TenantRef: corev1.LocalObjectReference{Name: target.Name},
+				Script:    "admin/tool/replace/cli/replace.php",
+				Args: []string{
+					"--search=" + moodleURL(source),
+					"--replace=" + moodleURL(target),
+					"--non-interactive",
+				},
+			},
+		}
+		if err := ctrl.SetControllerReference(clone, task, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+		log.FromContext(ctx).Info("Creating a new MoodleTask", "MoodleTask.Namespace", task.Namespace, "MoodleTask.Name", task.Name)
+		if err := r.Create(ctx, task); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+	clone.Status.TaskName = task.Name
+
+	switch task.Status.Phase {
+	case moodlev1alpha1.TaskPhaseSucceeded:
+	case moodlev1alpha1.TaskPhaseFailed:
+		failClone(clone, "RewriteFailed", fmt.Sprintf("MoodleTask %s failed; the copy keeps the URL of %s in its content", task.Name, source.Name))
+		return ctrl.Result{}, nil
+	default:
+		setClonePhase(clone, moodlev1alpha1.ClonePhaseRewriting, "Rewriting", fmt.Sprintf("MoodleTask %s is replacing %s with %s", task.Name, moodleURL(source), moodleURL(target)))
+		return ctrl.Result{}, nil
+	}
+
+	if clone.Spec.Anonymize != nil {
+		done, failure, err := r.reconcileCloneAnonymization(ctx, clone, target)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if failure != "" {
+			failClone(clone, "AnonymizationFailed", failure+"; the copy stays suspended")
+			return ctrl.Result{}, nil
+		}
+		if !done {
+			setClonePhase(clone, moodlev1alpha1.ClonePhaseAnonymizing, "Anonymizing", fmt.Sprintf("Job %s is anonymizing MoodleTenant %s", clone.Status.AnonymizeJobName, target.Name))
+			return ctrl.Result{}, nil
+		}
+
+		// The copy goes live once anonymized
+		if target.Spec.Suspended {
+			target.Spec.Suspended = false
+			if err := r.Update(ctx, target); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	clone.Status.Phase = moodlev1alpha1.ClonePhaseReady
+	clone.Status.CompletionTime = ptr.To(metav1.Now())
+	meta.SetStatusCondition(&clone.Status.Conditions, metav1.Condition{
+		Type:               moodlev1alpha1.ConditionCloneReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Ready",
+		Message:            fmt.Sprintf("MoodleTenant %s is a copy of %s at %s", target.Name, source.Name, moodleURL(target)),
+		ObservedGeneration: clone.Generation,
+	})
+	return ctrl.Result{}, nil
+}
+
+// reconcileCloneDump creates the MoodleDatabaseDump of the source database
+func (r *MoodleTenantCloneReconciler) reconcileCloneDump(ctx context.Context, clone *moodlev1alpha1.MoodleTenantClone, source *moodlev1alpha1.MoodleTenant) (*moodlev1alpha1.MoodleDatabaseDump, error) {
+	name := cloneResourceName(clone)
+	clone.Status.DumpName = name
+
+	dump := &moodlev1alpha1.MoodleDatabaseDump{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: clone.Namespace}, dump)
+	if err == nil || !errors.IsNotFound(err) {
+		return dump, err
+	}
+
+	dump = &moodlev1alpha1.MoodleDatabaseDump{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: clone.Namespace,
+			Labels:    map[string]string{cloneLabel: clone.Name},
+		},
+		Spec: moodlev1alpha1.MoodleDatabaseDumpSpec{
+			TenantRef: corev1.LocalObjectReference{Name: source.Name},
+			Destination: moodlev1alpha1.DumpDestinationSpec{
+				PVC: &moodlev1alpha1.DumpPVCDestination{
+					ClaimName: source.Name + "-data",
+					Path:      "clones/" + clone.Name,
+				},
+			},
+			Format: "plain",
+		},
+	}
+	if err := ctrl.SetControllerReference(clone, dump, r.Scheme); err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).Info("Creating a new MoodleDatabaseDump", "MoodleDatabaseDump.Namespace", dump.Namespace, "MoodleDatabaseDump.Name", dump.Name)
+	if err := r.Create(ctx, dump); err != nil {
+		return nil, err
+	}
+	return dump, nil
+}
+
+// reconcileCloneSnapshot takes the VolumeSnapshot of the source moodledata, dump
+// included, and reports whether it is ready to use, or why it failed
+func (r *MoodleTenantCloneReconciler) reconcileCloneSnapshot(ctx context.Context, clone *moodlev1alpha1.MoodleTenantClone, source *moodlev1alpha1.MoodleTenant) (bool, string, error) {
+	name := cloneResourceName(clone)
+	namespace := "tenant-" + source.Name
+	clone.Status.VolumeSnapshotName = name
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, snapshot)
+	if meta.IsNoMatchError(err) {
+		return false, "the VolumeSnapshot CRD is not installed", nil
+	}
+	if err != nil && errors.IsNotFound(err) {
+		spec := map[string]interface{}{
+			"source": map[string]interface{}{
+				"persistentVolumeClaimName": source.Name + "-data",
+			},
+		}
+		if class := clone.Spec.VolumeSnapshotClassName; class != "" {
+			spec["volumeSnapshotClassName"] = class
+		}
+		snapshot = &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+		snapshot.SetName(name)
+		snapshot.SetNamespace(namespace)
+		snapshot.SetLabels(map[string]string{
+			"moodle.bsu.by/tenant": source.Name,
+			cloneLabel:             clone.Name,
+		})
+		log.FromContext(ctx).Info("Creating a new VolumeSnapshot", "VolumeSnapshot.Namespace", namespace, "VolumeSnapshot.Name", name)
+		return false, "", r.Create(ctx, snapshot)
+	} else if err != nil {
+		return false, "", err
+	}
+
+	if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+		return false, message, nil
+	}
+	ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+	return ready, "", nil
+}
+
+// reconcileCloneVolume provisions the moodledata of the copy from the snapshot of the
+// source. VolumeSnapshots cannot be used across namespaces, so the snapshot is
+// pre-provisioned in the tenant namespace of the copy from a second, retained
+// VolumeSnapshotContent with the handle of the first.
+func (r *MoodleTenantCloneReconciler) reconcileCloneVolume(ctx context.Context, clone *moodlev1alpha1.MoodleTenantClone, source *moodlev1alpha1.MoodleTenant) error {
+	logger := log.FromContext(ctx)
+	name := cloneResourceName(clone)
+	sourceNamespace := "tenant-" + source.Name
+	namespace := "tenant-" + clone.Spec.TargetName
+	labels := map[string]string{
+		"moodle.bsu.by/tenant": clone.Spec.TargetName,
+		cloneLabel:             clone.Name,
+	}
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: sourceNamespace}, snapshot); err != nil {
+		return err
+	}
+	boundContent, _, _ := unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+	sourceContent := &unstructured.Unstructured{}
+	sourceContent.SetGroupVersionKind(volumeSnapshotContentGVK)
+	if err := r.Get(ctx, types.NamespacedName{Name: boundContent}, sourceContent); err != nil {
+		return err
+	}
+	handle, _, _ := unstructured.NestedString(sourceContent.Object, "status", "snapshotHandle")
+	driver, _, _ := unstructured.NestedString(sourceContent.Object, "spec", "driver")
+
+	content := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"deletionPolicy": "Retain",
+			"driver":         driver,
+			"source": map[string]interface{}{
+				"snapshotHandle": handle,
+			},
+			"volumeSnapshotRef": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+			},
+		},
+	}}
+	content.SetGroupVersionKind(volumeSnapshotContentGVK)
+	content.SetName(namespace + "-" + name)
+	content.SetLabels(labels)
+	if class, found, _ := unstructured.NestedString(sourceContent.Object, "spec", "volumeSnapshotClassName"); found {
+		_ = unstructured.SetNestedField(content.Object, class, "spec", "volumeSnapshotClassName")
+	}
+	if err := r.createIfNotFound(ctx, content); err != nil {
+		return err
+	}
+
+	// The MoodleTenant controller adopts the namespace once the copy exists
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   namespace,
+		Labels: map[string]string{tenantNamespaceLabel: clone.Spec.TargetName},
+	}}
+	if err := r.createIfNotFound(ctx, ns); err != nil {
+		return err
+	}
+
+	targetSnapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"source": map[string]interface{}{
+				"volumeSnapshotContentName": content.GetName(),
+			},
+		},
+	}}
+	targetSnapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	targetSnapshot.SetName(name)
+	targetSnapshot.SetNamespace(namespace)
+	targetSnapshot.SetLabels(labels)
+	if err := r.createIfNotFound(ctx, targetSnapshot); err != nil {
+		return err
+	}
+
+	sourcePVC := &corev1.PersistentVolumeClaim{}
+	if err := r.Get(ctx, types.NamespacedName{Name: source.Name + "-data", Namespace: sourceNamespace}, sourcePVC); err != nil {
+		return err
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clone.Spec.TargetName + "-data",
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      sourcePVC.Spec.AccessModes,
+			StorageClassName: sourcePVC.Spec.StorageClassName,
+			Resources:        sourcePVC.Spec.Resources,
+			DataSource: &corev1.TypedLocalObjectReference{
+				APIGroup: ptr.To(volumeSnapshotGVK.Group),
+				Kind:     volumeSnapshotGVK.Kind,
+				Name:     name,
+			},
+		},
+	}
+	logger.V(1).Info("Provisioning the moodledata of the copy", "PVC.Namespace", pvc.Namespace, "PVC.Name", pvc.Name)
+	return r.createIfNotFound(ctx, pvc)
+}
+
+// createIfNotFound creates an object unless it already exists
+func (r *MoodleTenantCloneReconciler) createIfNotFound(ctx context.Context, obj client.Object) error {
+	if err := r.Create(ctx, obj); err != nil && !errors.IsAlreadyExists(err) {
+		log.FromContext(ctx).Error(err, "Failed to create object for the clone", "Object.Namespace", obj.GetNamespace(), "Object.Name", obj.GetName())
+		return err
+	}
+	return nil
+}
+
+// cloneTenant returns the copy of the source MoodleTenant. It restores the dump of the
+// source into its own database and serves the clone hostname only. Schedules, upgrades
+// and outgoing mail are left out, so that a staging copy neither acts on its own nor
+// reaches the users of the source. A copy that is anonymized stays suspended until then.
+// The copy is not owned by the clone and outlives it.
+func (r *MoodleTenantCloneReconciler) cloneTenant(clone *moodlev1alpha1.MoodleTenantClone, source *moodlev1alpha1.MoodleTenant, dump *moodlev1alpha1.MoodleDatabaseDump) *moodlev1alpha1.MoodleTenant {
+	spec := *source.Spec.DeepCopy()
+	spec.Hostname = clone.Spec.Hostname
+	spec.ClassRef = nil
+	spec.AdditionalHostnames = nil
+	spec.Ingress.Admin = nil
+	spec.DatabaseRef = *clone.Spec.DatabaseRef.DeepCopy()
+	spec.DatabaseRef.RestoreFrom = &moodlev1alpha1.DatabaseRestoreSpec{
+		PVC: &moodlev1alpha1.RestorePVCSource{
+			ClaimName: clone.Spec.TargetName + "-data",
+			Path:      dumpFilePath(dump, source),
+		},
+	}
+	spec.Install = nil
+	spec.Upgrade = moodlev1alpha1.UpgradeSpec{}
+	spec.MaintenanceWindow = nil
+	spec.MaintenanceMode = nil
+	spec.Scaling = nil
+	spec.Hibernation = nil
+	spec.Notifications = nil
+	spec.Mail = nil
+	spec.ExtraCronJobs = nil
+	spec.HPA = moodlev1alpha1.HPASpec{}
+	spec.Suspended = clone.Spec.Anonymize != nil
+	if clone.Spec.DataScan != nil {
+		spec.DataScan = clone.Spec.DataScan.DeepCopy()
+	}
+
+	return &moodlev1alpha1.MoodleTenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clone.Spec.TargetName,
+			Namespace: clone.Namespace,
+			Labels:    map[string]string{cloneLabel: clone.Name},
+		},
+		Spec: spec,
+	}
+}
+
+// setClonePhase records the phase of an unfinished clone
+func setClonePhase(clone *moodlev1alpha1.MoodleTenantClone, phase, reason, message string) {
+	clone.Status.Phase = phase
+	meta.SetStatusCondition(&clone.Status.Conditions, metav1.Condition{
+		Type:               moodlev1alpha1.ConditionCloneReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: clone.Generation,
+	})
+}
+
+// failClone finishes the clone unsuccessfully
+func failClone(clone *moodlev1alpha1.MoodleTenantClone, reason, message string) {
+	setClonePhase(clone, moodlev1alpha1.ClonePhaseFailed, reason, message)
+	clone.Status.CompletionTime = ptr.To(metav1.Now())
+}
+
+// cloneResourceName returns the name of the dump and snapshots of a clone
+func cloneResourceName(clone *moodlev1alpha1.MoodleTenantClone) string {
+	return clone.Name + "-clone"
+}
+
+// cloneTaskName returns the name of the MoodleTask replacing the URL in the copy
+func cloneTaskName(clone *moodlev1alpha1.MoodleTenantClone) string {
+	return clone.Name + "-rewrite"
+}
+
+// cloneForTenant maps the copy of a tenant to its MoodleTenantClone
+func cloneForTenant(_ context.Context, obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()[cloneLabel]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: obj.GetNamespace()}}}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MoodleTenantCloneReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&moodlev1alpha1.MoodleTenantClone{}).
+		Owns(&moodlev1alpha1.MoodleDatabaseDump{}).
+		Owns(&moodlev1alpha1.MoodleTask{}).
+		Watches(&moodlev1alpha1.MoodleTenant{}, handler.EnqueueRequestsFromMapFunc(cloneForTenant)).
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(cloneForJob)).
+		Named("moodletenantclone").
+		Complete(r)
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("MoodleTenantClone Controller", func() {
+	var (
+		ctx    context.Context
+		source *moodlev1alpha1.MoodleTenant
+		clone  *moodlev1alpha1.MoodleTenantClone
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		source = &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-dept", Namespace: "default"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname:            "biology.bsu.by",
+				AdditionalHostnames: []string{"bio.bsu.by"},
+				Image:               "moodle:4.5",
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Host:        "postgres-cluster.db-tier.svc",
+					AdminSecret: "biology-dept-db",
+				},
+				Mail: &moodlev1alpha1.MailSpec{SMTPHost: "smtp.bsu.by"},
+			},
+		}
+		clone = &moodlev1alpha1.MoodleTenantClone{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-staging", Namespace: "default"},
+			Spec: moodlev1alpha1.MoodleTenantCloneSpec{
+				SourceRef:  corev1.LocalObjectReference{Name: "biology-dept"},
+				TargetName: "biology-staging",
+				Hostname:   "biology-staging.bsu.by",
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Host:        "postgres-staging.db-tier.svc",
+					AdminSecret: "biology-staging-db",
+				},
+			},
+		}
+	})
+
+	It("should provision the copy from a dump and a snapshot and rewrite its URL", func() {
+		snapshotContent := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec":   map[string]interface{}{"driver": "cephfs.csi.ceph.com"},
+			"status": map[string]interface{}{"snapshotHandle": "0001-snap"},
+		}}
+		snapshotContent.SetGroupVersionKind(volumeSnapshotContentGVK)
+		snapshotContent.SetName("snapcontent-1")
+		sourcePVC := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-dept-data", Namespace: "tenant-biology-dept"},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("20Gi")},
+				},
+			},
+		}
+
+		mapper := meta.NewDefaultRESTMapper(nil)
+		mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+		mapper.Add(volumeSnapshotContentGVK, meta.RESTScopeRoot)
+		mapper.Add(volumeSnapshotGVK, meta.RESTScopeNamespace)
+		for gvk := range k8sClient.Scheme().AllKnownTypes() {
+			mapper.Add(gvk, meta.RESTScopeNamespace)
+		}
+
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithRESTMapper(mapper).
+			WithObjects(source, clone, sourcePVC, snapshotContent).
+			WithStatusSubresource(clone, &moodlev1alpha1.MoodleDatabaseDump{}, &moodlev1alpha1.MoodleTask{}, &moodlev1alpha1.MoodleTenant{}).
+			Build()
+		reconciler := &MoodleTenantCloneReconciler{Client: c, Scheme: c.Scheme()}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "biology-staging", Namespace: "default"}}
+
+		By("dumping the source database into its moodledata")
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		dump := &moodlev1alpha1.MoodleDatabaseDump{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "biology-staging-clone", Namespace: "default"}, dump)).To(Succeed())
+		Expect(dump.Spec.Destination.PVC.ClaimName).To(Equal("biology-dept-data"))
+		Expect(c.Get(ctx, request.NamespacedName, clone)).To(Succeed())
+		Expect(clone.Status.Phase).To(Equal(moodlev1alpha1.ClonePhaseDumping))
+
+		By("snapshotting moodledata once the dump succeeded")
+		dump.Status.Phase = moodlev1alpha1.DumpPhaseSucceeded
+		Expect(c.Status().Update(ctx, dump)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		snapshot := &unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+		Expect(c.Get(ctx, types.NamespacedName{Name: "biology-staging-clone", Namespace: "tenant-biology-dept"}, snapshot)).To(Succeed())
+		Expect(c.Get(ctx, request.NamespacedName, clone)).To(Succeed())
+		Expect(clone.Status.Phase).To(Equal(moodlev1alpha1.ClonePhaseSnapshotting))
+
+		By("restoring the snapshot into the copy")
+		Expect(unstructured.SetNestedField(snapshot.Object, true, "status", "readyToUse")).To(Succeed())
+		Expect(unstructured.SetNestedField(snapshot.Object, "snapcontent-1", "status", "boundVolumeSnapshotContentName")).To(Succeed())
+		Expect(c.Update(ctx, snapshot)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+
+		content := &unstructured.Unstructured{}
+		content.SetGroupVersionKind(volumeSnapshotContentGVK)
+		Expect(c.Get(ctx, types.NamespacedName{Name: "tenant-biology-staging-biology-staging-clone"}, content)).To(Succeed())
+		handle, _, _ := unstructured.NestedString(content.Object, "spec", "source", "snapshotHandle")
+		Expect(handle).To(Equal("0001-snap"))
+		pvc := &corev1.PersistentVolumeClaim{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "biology-staging-data", Namespace: "tenant-biology-staging"}, pvc)).To(Succeed())
+		Expect(pvc.Spec.DataSource.Name).To(Equal("biology-staging-clone"))
+		Expect(pvc.Spec.Resources.Requests[corev1.ResourceStorage]).To(Equal(resource.MustParse("20Gi")))
+
+		target := &moodlev1alpha1.MoodleTenant{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "biology-staging", Namespace: "default"}, target)).To(Succeed())
+		Expect(target.Labels[cloneLabel]).To(Equal("biology-staging"))
+		Expect(target.Spec.Hostname).To(Equal("biology-staging.bsu.by"))
+		Expect(target.Spec.AdditionalHostnames).To(BeEmpty())
+		Expect(target.Spec.Mail).To(BeNil())
+		Expect(target.Spec.DatabaseRef.Host).To(Equal("postgres-staging.db-tier.svc"))
+		Expect(target.Spec.DatabaseRef.RestoreFrom.PVC.ClaimName).To(Equal("biology-staging-data"))
+		Expect(target.Spec.DatabaseRef.RestoreFrom.PVC.Path).To(Equal("clones/biology-staging/biology-dept/biology-staging-clone.sql.gz"))
+		Expect(c.Get(ctx, request.NamespacedName, clone)).To(Succeed())
+		Expect(clone.Status.Phase).To(Equal(moodlev1alpha1.ClonePhaseRestoring))
+
+		By("replacing the URL of the source once the dump is restored")
+		meta.SetStatusCondition(&target.Status.Conditions, metav1.Condition{
+			Type:   moodlev1alpha1.ConditionDatabaseRestored,
+			Status: metav1.ConditionTrue,
+			Reason: "Restored",
+		})
+		Expect(c.Status().Update(ctx, target)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		task := &moodlev1alpha1.MoodleTask{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "biology-staging-rewrite", Namespace: "default"}, task)).To(Succeed())
+		Expect(task.Spec.TenantRef.Name).To(Equal("biology-staging"))
+		Expect(task.Spec.Args).To(ContainElements("--search=https://biology.bsu.by", "--replace=https://biology-staging.bsu.by"))
+
+		task.Status.Phase = moodlev1alpha1.TaskPhaseSucceeded
+		Expect(c.Status().Update(ctx, task)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, request.NamespacedName, clone)).To(Succeed())
+		Expect(clone.Status.Phase).To(Equal(moodlev1alpha1.ClonePhaseReady))
+		Expect(meta.IsStatusConditionTrue(clone.Status.Conditions, moodlev1alpha1.ConditionCloneReady)).To(BeTrue())
+	})
+
+	It("should keep the copy suspended until it is anonymized", func() {
+		clone.Spec.Anonymize = &moodlev1alpha1.CloneAnonymizeSpec{KeepUsers: []string{"admin", "dev"}}
+		dump := &moodlev1alpha1.MoodleDatabaseDump{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-staging-clone"},
+			Spec: moodlev1alpha1.MoodleDatabaseDumpSpec{
+				Destination: moodlev1alpha1.DumpDestinationSpec{
+					PVC: &moodlev1alpha1.DumpPVCDestination{ClaimName: "biology-dept-data", Path: "clones/biology-staging"},
+				},
+			},
+		}
+		reconciler := &MoodleTenantCloneReconciler{}
+		target := reconciler.cloneTenant(clone, source, dump)
+		Expect(target.Spec.Suspended).To(BeTrue())
+
+		target.Status.Conditions = []metav1.Condition{{
+			Type:   moodlev1alpha1.ConditionDatabaseRestored,
+			Status: metav1.ConditionTrue,
+			Reason: "Restored",
+		}}
+		task := &moodlev1alpha1.MoodleTask{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-staging-rewrite", Namespace: "default"},
+			Status:     moodlev1alpha1.MoodleTaskStatus{Phase: moodlev1alpha1.TaskPhaseSucceeded},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithObjects(source, target, clone, task).
+			WithStatusSubresource(clone, target, task).
+			Build()
+		reconciler = &MoodleTenantCloneReconciler{Client: c, Scheme: c.Scheme()}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "biology-staging", Namespace: "default"}}
+
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "biology-staging-anonymize", Namespace: "tenant-biology-staging"}, job)).To(Succeed())
+		Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElements(
+			corev1.EnvVar{Name: "ANONYMIZE_EMAIL_DOMAIN", Value: "example.invalid"},
+			corev1.EnvVar{Name: "ANONYMIZE_KEEP_USERS", Value: "admin,dev"},
+			corev1.EnvVar{Name: "ANONYMIZE_STRIP_SUBMISSIONS", Value: "true"},
+		))
+		Expect(c.Get(ctx, request.NamespacedName, clone)).To(Succeed())
+		Expect(clone.Status.Phase).To(Equal(moodlev1alpha1.ClonePhaseAnonymizing))
+
+		job.Status.Succeeded = 1
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(ctx, types.NamespacedName{Name: "biology-staging", Namespace: "default"}, target)).To(Succeed())
+		Expect(target.Spec.Suspended).To(BeFalse())
+		Expect(c.Get(ctx, request.NamespacedName, clone)).To(Succeed())
+		Expect(clone.Status.Phase).To(Equal(moodlev1alpha1.ClonePhaseReady))
+	})
+
+	It("should not overwrite an existing tenant", func() {
+		existing := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology-staging", Namespace: "default"},
+			Spec:       source.Spec,
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithObjects(source, existing, clone).
+			WithStatusSubresource(clone).
+			Build()
+		reconciler := &MoodleTenantCloneReconciler{Client: c, Scheme: c.Scheme()}
+		request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "biology-staging", Namespace: "default"}}
+
+		_, err := reconciler.Reconcile(ctx, request)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(c.Get(ctx, request.NamespacedName, clone)).To(Succeed())
+		Expect(clone.Status.Phase).To(Equal(moodlev1alpha1.ClonePhaseFailed))
+		Expect(meta.FindStatusCondition(clone.Status.Conditions, moodlev1alpha1.ConditionCloneReady).Reason).To(Equal("TargetExists"))
+	})
+})
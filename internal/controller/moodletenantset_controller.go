@@ -0,0 +1,286 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+const (
+	// tenantSetLabel records on a MoodleTenant the MoodleTenantSet it belongs to
+	tenantSetLabel = "moodle.bsu.by/tenant-set"
+
+	// tenantSetHashAnnotation records on a MoodleTenant the hash of the template it was
+	// last rendered from
+	tenantSetHashAnnotation = "moodle.bsu.by/tenant-set-hash"
+)
+
+// MoodleTenantSetReconciler reconciles a MoodleTenantSet object
+type MoodleTenantSetReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletenantsets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletenantsets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletenantsets/finalizers,verbs=update
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletenants,verbs=get;list;watch;create;update;patch;delete
+
+// renderTenantSetMember returns the tenant of a member of a set, with the placeholders
+// of the template replaced by the name and parameters of the member. The template is
+// rendered as JSON, so that every string of the spec can hold placeholders.
+func renderTenantSetMember(set *moodlev1alpha1.MoodleTenantSet, member moodlev1alpha1.TenantSetMember) (*moodlev1alpha1.MoodleTenant, error) {
+	replacements := []string{"{{name}}", member.Name}
+	jsonReplacements := []string{"{{name}}", member.Name}
+	for key, value := range member.Parameters {
+		escaped, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		replacements = append(replacements, "{{"+key+"}}", value)
+		jsonReplacements = append(jsonReplacements, "{{"+key+"}}", strings.Trim(string(escaped), `"`))
+	}
+	replacer := strings.NewReplacer(replacements...)
+	render := func(field, value string) (string, error) {
+		rendered := replacer.Replace(value)
+		if strings.Contains(rendered, "{{") {
+			return "", fmt.Errorf("%s has a placeholder member %s has no parameter for: %s", field, member.Name, rendered)
+		}
+		return rendered, nil
+	}
+
+	pattern := set.Spec.NamePattern
+	if pattern == "" {
+		pattern = "{{name}}"
+	}
+	name, err := render("namePattern", pattern)
+	if err != nil {
+		return nil, err
+	}
+	// The tenant namespace is named after the tenant
+	if errs := validation.IsDNS1123Label("tenant-" + name); len(errs) > 0 {
+		return nil, fmt.Errorf("tenant %s of member %s: %s", name, member.Name, strings.Join(errs, ", "))
+	}
+
+	template, err := json.Marshal(set.Spec.Template.Spec)
+	if err != nil {
+		return nil, err
+	}
+	rendered := strings.NewReplacer(jsonReplacements...).Replace(string(template))
+	if strings.Contains(rendered, "{{") {
+		return nil, fmt.Errorf("the template has a placeholder member %s has no parameter for", member.Name)
+	}
+	mt := &moodlev1alpha1.MoodleTenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   set.Namespace,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+	}
+	if err := json.Unmarshal([]byte(rendered), &mt.Spec); err != nil {
+		return nil, fmt.Errorf("the rendered template of member %s is invalid: %w", member.Name, err)
+	}
+	for key, value := range set.Spec.Template.Labels {
+		if mt.Labels[key], err = render("label "+key, value); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range set.Spec.Template.Annotations {
+		if mt.Annotations[key], err = render("annotation "+key, value); err != nil {
+			return nil, err
+		}
+	}
+	mt.Labels[tenantSetLabel] = set.Name
+	mt.Annotations[tenantSetHashAnnotation] = tenantSetHash(mt)
+	return mt, nil
+}
+
+// tenantSetHash returns the hash of a rendered tenant, which tells whether a tenant
+// follows the current template
+func tenantSetHash(mt *moodlev1alpha1.MoodleTenant) string {
+	hash := fnv.New32a()
+	// Maps are marshalled with sorted keys
+	data, _ := json.Marshal([]any{mt.Labels, mt.Annotations, mt.Spec})
+	hash.Write(data)
+	return fmt.Sprintf("%08x", hash.Sum32())
+}
+
+// tenantReady reports whether the database of a tenant is ready and its rollouts are
+// not blocked by a failed upgrade
+func tenantReady(mt *moodlev1alpha1.MoodleTenant) bool {
+	return meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseReady) &&
+		!meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionDegraded)
+}
+
+// Reconcile creates a MoodleTenant for every member of a MoodleTenantSet and deletes the
+// tenants of removed members. A tenant is updated only when the template or the
+// parameters of its member change, so that changes of its own, e.g. the image set by a
+// MoodleUpgradePlan, last until the next change of the template.
+func (r *MoodleTenantSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	set := &moodlev1alpha1.MoodleTenantSet{}
+	if err := r.Get(ctx, req.NamespacedName, set); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get MoodleTenantSet")
+		return ctrl.Result{}, err
+	}
+	// The tenants are deleted by the garbage collector
+	if !set.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	originalStatus := set.Status.DeepCopy()
+	set.Status.Tenants = 0
+	set.Status.UpdatedTenants = 0
+	set.Status.ReadyTenants = 0
+	problems := []string{}
+	reason := "Synced"
+	invalid := false
+	members := map[string]bool{}
+	for _, member := range set.Spec.Members {
+		desired, err := renderTenantSetMember(set, member)
+		if err != nil {
+			problems = append(problems, err.Error())
+			reason = "InvalidMember"
+			invalid = true
+			continue
+		}
+		members[desired.Name] = true
+
+		found := &moodlev1alpha1.MoodleTenant{}
+		err = r.Get(ctx, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, found)
+		if err != nil && errors.IsNotFound(err) {
+			if err := ctrl.SetControllerReference(set, desired, r.Scheme); err != nil {
+				logger.Error(err, "Failed to set owner reference on MoodleTenant", "MoodleTenant.Name", desired.Name)
+				return ctrl.Result{}, err
+			}
+			logger.Info("Creating a new MoodleTenant", "MoodleTenant.Namespace", desired.Namespace, "MoodleTenant.Name", desired.Name, "Member", member.Name)
+			if err := r.Create(ctx, desired); err != nil {
+				logger.Error(err, "Failed to create new MoodleTenant", "MoodleTenant.Namespace", desired.Namespace, "MoodleTenant.Name", desired.Name)
+				return ctrl.Result{}, err
+			}
+			set.Status.Tenants++
+			set.Status.UpdatedTenants++
+			continue
+		} else if err != nil {
+			logger.Error(err, "Failed to get MoodleTenant")
+			return ctrl.Result{}, err
+		}
+
+		// A tenant of the same name created otherwise is not taken over
+		if !metav1.IsControlledBy(found, set) {
+			problems = append(problems, fmt.Sprintf("MoodleTenant %s of member %s exists and does not belong to the set", found.Name, member.Name))
+			reason = "TenantNotOwned"
+			continue
+		}
+		set.Status.Tenants++
+		if found.Annotations[tenantSetHashAnnotation] != desired.Annotations[tenantSetHashAnnotation] {
+			if found.Labels == nil {
+				found.Labels = map[string]string{}
+			}
+			if found.Annotations == nil {
+				found.Annotations = map[string]string{}
+			}
+			for key, value := range desired.Labels {
+				found.Labels[key] = value
+			}
+			for key, value := range desired.Annotations {
+				found.Annotations[key] = value
+			}
+			found.Spec = desired.Spec
+			logger.Info("Updating MoodleTenant from the template", "MoodleTenant.Namespace", found.Namespace, "MoodleTenant.Name", found.Name, "Member", member.Name)
+			if err := r.Update(ctx, found); err != nil {
+				logger.Error(err, "Failed to update MoodleTenant", "MoodleTenant.Namespace", found.Namespace, "MoodleTenant.Name", found.Name)
+				return ctrl.Result{}, err
+			}
+		}
+		set.Status.UpdatedTenants++
+		if tenantReady(found) {
+			set.Status.ReadyTenants++
+		}
+	}
+
+	// The tenants of removed members are deleted. The tenant of an invalid member is not
+	// known, so nothing is deleted until all members are valid.
+	tenants := &moodlev1alpha1.MoodleTenantList{}
+	if err := r.List(ctx, tenants, client.InNamespace(set.Namespace), client.MatchingLabels{tenantSetLabel: set.Name}); err != nil {
+		logger.Error(err, "Failed to list MoodleTenants of the set")
+		return ctrl.Result{}, err
+	}
+	for i := range tenants.Items {
+		mt := &tenants.Items[i]
+		if invalid || members[mt.Name] || !metav1.IsControlledBy(mt, set) || !mt.DeletionTimestamp.IsZero() {
+			continue
+		}
+		logger.Info("Deleting MoodleTenant of a removed member", "MoodleTenant.Namespace", mt.Namespace, "MoodleTenant.Name", mt.Name)
+		if err := r.Delete(ctx, mt); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete MoodleTenant", "MoodleTenant.Namespace", mt.Namespace, "MoodleTenant.Name", mt.Name)
+			return ctrl.Result{}, err
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionTenantSetSynced,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            fmt.Sprintf("%d tenants follow the template", set.Status.UpdatedTenants),
+		ObservedGeneration: set.Generation,
+	}
+	if len(problems) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Message = strings.Join(problems, "; ")
+	}
+	meta.SetStatusCondition(&set.Status.Conditions, condition)
+
+	if !equality.Semantic.DeepEqual(originalStatus, &set.Status) {
+		if err := r.Status().Update(ctx, set); err != nil {
+			logger.Error(err, "Failed to update MoodleTenantSet status")
+			return ctrl.Result{}, err
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MoodleTenantSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&moodlev1alpha1.MoodleTenantSet{}).
+		Owns(&moodlev1alpha1.MoodleTenant{}).
+		Named("moodletenantset").
+		Complete(r)
+}
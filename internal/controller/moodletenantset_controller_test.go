@@ -0,0 +1,113 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("MoodleTenantSet Controller", func() {
+	It("should stamp out a tenant per member", func() {
+		ctx := context.Background()
+
+		set := &moodlev1alpha1.MoodleTenantSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "faculties", Namespace: "default", UID: "faculties-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSetSpec{
+				NamePattern: "{{name}}-dept",
+				Template: moodlev1alpha1.MoodleTenantTemplate{
+					Labels: map[string]string{"moodle.bsu.by/tier": "faculty"},
+					Spec: moodlev1alpha1.MoodleTenantSpec{
+						Hostname: "{{name}}.lms.bsu.by",
+						Image:    "moodle:4.5",
+						DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+							Host:        "postgres-cluster.db-tier.svc",
+							AdminSecret: "{{name}}-db",
+						},
+						PHPSettings: moodlev1alpha1.PHPSettingsSpec{MemoryLimit: "{{memoryLimit}}"},
+					},
+				},
+				Members: []moodlev1alpha1.TenantSetMember{
+					{Name: "biology", Parameters: map[string]string{"memoryLimit": "1G"}},
+					{Name: "physics", Parameters: map[string]string{"memoryLimit": "512M"}},
+				},
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithObjects(set).
+			WithStatusSubresource(set).
+			Build()
+		reconciler := &MoodleTenantSetReconciler{Client: c, Scheme: c.Scheme()}
+		reconcileSet := func() {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: set.Name, Namespace: set.Namespace}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, types.NamespacedName{Name: set.Name, Namespace: set.Namespace}, set)).To(Succeed())
+		}
+		tenant := func(name string) *moodlev1alpha1.MoodleTenant {
+			mt := &moodlev1alpha1.MoodleTenant{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, mt)).To(Succeed())
+			return mt
+		}
+
+		reconcileSet()
+		Expect(set.Status.Tenants).To(Equal(int32(2)))
+		Expect(meta.IsStatusConditionTrue(set.Status.Conditions, moodlev1alpha1.ConditionTenantSetSynced)).To(BeTrue())
+		biology := tenant("biology-dept")
+		Expect(biology.Spec.Hostname).To(Equal("biology.lms.bsu.by"))
+		Expect(biology.Spec.DatabaseRef.AdminSecret).To(Equal("biology-db"))
+		Expect(biology.Spec.PHPSettings.MemoryLimit).To(Equal("1G"))
+		Expect(biology.Labels).To(HaveKeyWithValue("moodle.bsu.by/tier", "faculty"))
+		Expect(metav1.IsControlledBy(biology, set)).To(BeTrue())
+		Expect(tenant("physics-dept").Spec.PHPSettings.MemoryLimit).To(Equal("512M"))
+
+		By("keeping the changes of a tenant until the template changes")
+		biology.Spec.Image = "moodle:4.5.3"
+		Expect(c.Update(ctx, biology)).To(Succeed())
+		reconcileSet()
+		Expect(tenant("biology-dept").Spec.Image).To(Equal("moodle:4.5.3"))
+		set.Spec.Template.Spec.Image = "moodle:5.0"
+		Expect(c.Update(ctx, set)).To(Succeed())
+		reconcileSet()
+		Expect(tenant("biology-dept").Spec.Image).To(Equal("moodle:5.0"))
+		Expect(tenant("physics-dept").Spec.Image).To(Equal("moodle:5.0"))
+
+		By("keeping all tenants while a member is invalid")
+		set.Spec.Members = []moodlev1alpha1.TenantSetMember{{Name: "biology", Parameters: map[string]string{"memoryLimit": "1G"}}, {Name: "history"}}
+		Expect(c.Update(ctx, set)).To(Succeed())
+		reconcileSet()
+		Expect(meta.FindStatusCondition(set.Status.Conditions, moodlev1alpha1.ConditionTenantSetSynced).Reason).To(Equal("InvalidMember"))
+		tenant("physics-dept")
+
+		By("deleting the tenant of a removed member")
+		set.Spec.Members = set.Spec.Members[:1]
+		Expect(c.Update(ctx, set)).To(Succeed())
+		reconcileSet()
+		Expect(set.Status.Tenants).To(Equal(int32(1)))
+		err := c.Get(ctx, types.NamespacedName{Name: "physics-dept", Namespace: "default"}, &moodlev1alpha1.MoodleTenant{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
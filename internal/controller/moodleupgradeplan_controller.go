@@ -0,0 +1,327 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// upgradePlanAnnotation records on a MoodleTenant the MoodleUpgradePlan that set its image
+const upgradePlanAnnotation = "moodle.bsu.by/upgrade-plan"
+
+// States of a tenant in a MoodleUpgradePlan
+const (
+	planTenantPending   = "Pending"
+	planTenantUpgrading = "Upgrading"
+	planTenantUpgraded  = "Upgraded"
+	planTenantFailed    = "Failed"
+)
+
+// MoodleUpgradePlanReconciler reconciles a MoodleUpgradePlan object
+type MoodleUpgradePlanReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodleupgradeplans,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodleupgradeplans/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodleupgradeplans/finalizers,verbs=update
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletenants,verbs=get;list;watch;patch
+
+// planTenantState returns the state of the upgrade of a tenant to the image of a plan.
+// The upgrade has failed when it was rolled back or is blocked, and has succeeded once
+// the upgraded image has rolled out.
+func planTenantState(mt *moodlev1alpha1.MoodleTenant, image string) string {
+	if mt.Spec.Image != image {
+		return planTenantPending
+	}
+	if rollbackStarted(mt) || meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionDegraded) {
+		return planTenantFailed
+	}
+	if mt.Status.UpgradedImage == image && mt.Status.UpgradeRolloutDeadline == nil {
+		return planTenantUpgraded
+	}
+	return planTenantUpgrading
+}
+
+// upgradeStageMaxParallel returns the number of tenants of a stage upgraded at once
+func upgradeStageMaxParallel(stage moodlev1alpha1.UpgradeStage) int32 {
+	if stage.MaxParallel != 0 {
+		return stage.MaxParallel
+	}
+	return 5
+}
+
+// upgradeStageSoak returns how long the plan waits after a stage
+func upgradeStageSoak(stage moodlev1alpha1.UpgradeStage) time.Duration {
+	if stage.SoakMinutes != nil {
+		return time.Duration(*stage.SoakMinutes) * time.Minute
+	}
+	return time.Hour
+}
+
+// planStages assigns the tenants of a plan to its stages, in the order of the stages
+func planStages(plan *moodlev1alpha1.MoodleUpgradePlan, tenants []moodlev1alpha1.MoodleTenant) ([][]*moodlev1alpha1.MoodleTenant, error) {
+	selector := labels.Everything()
+	if plan.Spec.Selector != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(plan.Spec.Selector); err != nil {
+			return nil, err
+		}
+	}
+	stageSelectors := make([]labels.Selector, len(plan.Spec.Stages))
+	for i, stage := range plan.Spec.Stages {
+		stageSelectors[i] = labels.Everything()
+		if stage.Selector != nil {
+			var err error
+			if stageSelectors[i], err = metav1.LabelSelectorAsSelector(stage.Selector); err != nil {
+				return nil, fmt.Errorf("stage %s: %w", stage.Name, err)
+			}
+		}
+	}
+
+	stages := make([][]*moodlev1alpha1.MoodleTenant, len(plan.Spec.Stages))
+	for i := range tenants {
+		mt := &tenants[i]
+		if !selector.Matches(labels.Set(mt.Labels)) {
+			continue
+		}
+		for j := range stageSelectors {
+			if stageSelectors[j].Matches(labels.Set(mt.Labels)) {
+				stages[j] = append(stages[j], mt)
+				break
+			}
+		}
+	}
+	return stages, nil
+}
+
+// Reconcile upgrades the MoodleTenants of a MoodleUpgradePlan stage by stage, by setting
+// their spec.image at most maxParallel at a time. A stage starts once the previous one
+// has finished and soaked, and no upgrade is started once more than maxFailures failed.
+func (r *MoodleUpgradePlanReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	plan := &moodlev1alpha1.MoodleUpgradePlan{}
+	if err := r.Get(ctx, req.NamespacedName, plan); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get MoodleUpgradePlan")
+		return ctrl.Result{}, err
+	}
+	if !plan.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	tenants := &moodlev1alpha1.MoodleTenantList{}
+	if err := r.List(ctx, tenants); err != nil {
+		logger.Error(err, "Failed to list MoodleTenants")
+		return ctrl.Result{}, err
+	}
+	sort.Slice(tenants.Items, func(i, j int) bool {
+		a, b := tenants.Items[i], tenants.Items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	stages, err := planStages(plan, tenants.Items)
+	if err != nil {
+		logger.Error(err, "Invalid MoodleUpgradePlan selector")
+		return ctrl.Result{}, err
+	}
+
+	originalStatus := plan.Status.DeepCopy()
+	previous := map[string]moodlev1alpha1.UpgradeStageStatus{}
+	for _, stage := range plan.Status.Stages {
+		previous[stage.Name] = stage
+	}
+	plan.Status.Stages = nil
+	plan.Status.FailedTenants = nil
+	pending := make([][]*moodlev1alpha1.MoodleTenant, len(stages))
+	for i, stage := range plan.Spec.Stages {
+		status := moodlev1alpha1.UpgradeStageStatus{Name: stage.Name, Tenants: int32(len(stages[i]))}
+		for _, mt := range stages[i] {
+			switch planTenantState(mt, plan.Spec.Image) {
+			case planTenantPending:
+				pending[i] = append(pending[i], mt)
+			case planTenantUpgrading:
+				status.Upgrading++
+			case planTenantUpgraded:
+				status.Upgraded++
+			case planTenantFailed:
+				status.Failed++
+				plan.Status.FailedTenants = append(plan.Status.FailedTenants, mt.Namespace+"/"+mt.Name)
+			}
+		}
+		if status.Upgraded+status.Failed == status.Tenants {
+			status.CompletionTime = previous[stage.Name].CompletionTime
+			if status.CompletionTime == nil {
+				status.CompletionTime = ptr.To(metav1.Now())
+			}
+		}
+		plan.Status.Stages = append(plan.Status.Stages, status)
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionPlanComplete,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: plan.Generation,
+	}
+	result := ctrl.Result{}
+	plan.Status.Phase = moodlev1alpha1.PlanPhaseCompleted
+	plan.Status.CurrentStage = ""
+	plan.Status.SoakUntil = nil
+	for i, stage := range plan.Spec.Stages {
+		status := plan.Status.Stages[i]
+		plan.Status.CurrentStage = stage.Name
+		if status.CompletionTime == nil {
+			if plan.Spec.Paused {
+				plan.Status.Phase = moodlev1alpha1.PlanPhasePaused
+				break
+			}
+			if err := r.startUpgrades(ctx, plan, stage, pending[i], status.Upgrading); err != nil {
+				return ctrl.Result{}, err
+			}
+			plan.Status.Phase = moodlev1alpha1.PlanPhaseProgressing
+			break
+		}
+		// Empty stages and the last one are not soaked
+		if status.Tenants == 0 || i == len(plan.Spec.Stages)-1 {
+			break
+		}
+		soakUntil := status.CompletionTime.Add(upgradeStageSoak(stage))
+		if remaining := time.Until(soakUntil); remaining > 0 {
+			plan.Status.Phase = moodlev1alpha1.PlanPhaseSoaking
+			plan.Status.SoakUntil = ptr.To(metav1.NewTime(soakUntil))
+			result.RequeueAfter = remaining
+			break
+		}
+	}
+
+	// Upgrades already started finish, the failures of the halted plan are listed
+	if failed := int32(len(plan.Status.FailedTenants)); failed > plan.Spec.MaxFailures && plan.Status.Phase != moodlev1alpha1.PlanPhaseCompleted {
+		plan.Status.Phase = moodlev1alpha1.PlanPhaseHalted
+		plan.Status.SoakUntil = nil
+		result = ctrl.Result{}
+	}
+
+	switch plan.Status.Phase {
+	case moodlev1alpha1.PlanPhaseCompleted:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Completed"
+		condition.Message = fmt.Sprintf("All stages were upgraded to %s, %d tenants failed", plan.Spec.Image, len(plan.Status.FailedTenants))
+		plan.Status.CurrentStage = ""
+	case moodlev1alpha1.PlanPhaseHalted:
+		condition.Reason = "Halted"
+		condition.Message = fmt.Sprintf("%d tenant upgrades failed, more than the %d tolerated: %s", len(plan.Status.FailedTenants), plan.Spec.MaxFailures, strings.Join(plan.Status.FailedTenants, ", "))
+	case moodlev1alpha1.PlanPhaseSoaking:
+		condition.Reason = "Soaking"
+		condition.Message = fmt.Sprintf("Stage %s soaks until %s", plan.Status.CurrentStage, plan.Status.SoakUntil.UTC().Format(time.RFC3339))
+	case moodlev1alpha1.PlanPhasePaused:
+		condition.Reason = "Paused"
+		condition.Message = fmt.Sprintf("Paused in stage %s", plan.Status.CurrentStage)
+	default:
+		condition.Reason = "Progressing"
+		condition.Message = fmt.Sprintf("Upgrading stage %s to %s", plan.Status.CurrentStage, plan.Spec.Image)
+	}
+	meta.SetStatusCondition(&plan.Status.Conditions, condition)
+
+	if !equality.Semantic.DeepEqual(originalStatus, &plan.Status) {
+		if err := r.Status().Update(ctx, plan); err != nil {
+			logger.Error(err, "Failed to update MoodleUpgradePlan status")
+			return ctrl.Result{}, err
+		}
+	}
+	return result, nil
+}
+
+// startUpgrades sets the image of the plan on pending tenants of a stage, as long as
+// fewer than maxParallel are upgrading. The tenants upgrade themselves and report back
+// through their status.
+func (r *MoodleUpgradePlanReconciler) startUpgrades(ctx context.Context, plan *moodlev1alpha1.MoodleUpgradePlan, stage moodlev1alpha1.UpgradeStage, pending []*moodlev1alpha1.MoodleTenant, upgrading int32) error {
+	logger := log.FromContext(ctx)
+
+	// A halted plan starts no upgrade
+	failed := int32(len(plan.Status.FailedTenants))
+	if failed > plan.Spec.MaxFailures {
+		return nil
+	}
+	for _, mt := range pending {
+		if upgrading >= upgradeStageMaxParallel(stage) {
+			return nil
+		}
+		patch := client.MergeFrom(mt.DeepCopy())
+		mt.Spec.Image = plan.Spec.Image
+		if mt.Annotations == nil {
+			mt.Annotations = map[string]string{}
+		}
+		mt.Annotations[upgradePlanAnnotation] = plan.Name
+		logger.Info("Upgrading MoodleTenant", "Namespace", mt.Namespace, "Name", mt.Name, "Stage", stage.Name, "Image", plan.Spec.Image)
+		if err := r.Patch(ctx, mt, patch); err != nil {
+			logger.Error(err, "Failed to patch MoodleTenant", "Namespace", mt.Namespace, "Name", mt.Name)
+			return err
+		}
+		upgrading++
+	}
+	return nil
+}
+
+// upgradePlansForTenant maps a MoodleTenant to all MoodleUpgradePlans, which follow the
+// upgrades of their tenants
+func (r *MoodleUpgradePlanReconciler) upgradePlansForTenant(ctx context.Context, _ client.Object) []reconcile.Request {
+	plans := &moodlev1alpha1.MoodleUpgradePlanList{}
+	if err := r.List(ctx, plans); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MoodleUpgradePlans")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, plan := range plans.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: plan.Name}})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *MoodleUpgradePlanReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&moodlev1alpha1.MoodleUpgradePlan{}).
+		Watches(&moodlev1alpha1.MoodleTenant{}, handler.EnqueueRequestsFromMapFunc(r.upgradePlansForTenant)).
+		Named("moodleupgradeplan").
+		Complete(r)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("MoodleUpgradePlan Controller", func() {
+	It("should upgrade the pilot stage first and halt on a failed upgrade", func() {
+		ctx := context.Background()
+
+		tenant := func(name, tier string) *moodlev1alpha1.MoodleTenant {
+			return &moodlev1alpha1.MoodleTenant{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"moodle.bsu.by/tier": tier}},
+				Spec:       moodlev1alpha1.MoodleTenantSpec{Image: "moodle:4.5.2"},
+				Status:     moodlev1alpha1.MoodleTenantStatus{UpgradedImage: "moodle:4.5.2"},
+			}
+		}
+		plan := &moodlev1alpha1.MoodleUpgradePlan{
+			ObjectMeta: metav1.ObjectMeta{Name: "moodle-4-5-3"},
+			Spec: moodlev1alpha1.MoodleUpgradePlanSpec{
+				Image: "moodle:4.5.3",
+				Stages: []moodlev1alpha1.UpgradeStage{
+					{
+						Name:        "pilot",
+						Selector:    &metav1.LabelSelector{MatchLabels: map[string]string{"moodle.bsu.by/tier": "pilot"}},
+						MaxParallel: 1,
+						SoakMinutes: ptr.To[int32](0),
+					},
+					{Name: "fleet"},
+				},
+			},
+		}
+		objects := []client.Object{plan, tenant("biology", "pilot"), tenant("chemistry", "pilot"), tenant("history", "fleet"), tenant("physics", "fleet")}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithObjects(objects...).
+			WithStatusSubresource(objects...).
+			Build()
+		reconciler := &MoodleUpgradePlanReconciler{Client: c, Scheme: c.Scheme()}
+		reconcilePlan := func() {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: plan.Name}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(c.Get(ctx, types.NamespacedName{Name: plan.Name}, plan)).To(Succeed())
+		}
+		image := func(name string) string {
+			mt := &moodlev1alpha1.MoodleTenant{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, mt)).To(Succeed())
+			return mt.Spec.Image
+		}
+		setStatus := func(name string, status moodlev1alpha1.MoodleTenantStatus) {
+			mt := &moodlev1alpha1.MoodleTenant{}
+			Expect(c.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, mt)).To(Succeed())
+			mt.Status = status
+			Expect(c.Status().Update(ctx, mt)).To(Succeed())
+		}
+		upgraded := moodlev1alpha1.MoodleTenantStatus{UpgradedImage: "moodle:4.5.3"}
+
+		// One pilot tenant at a time, the fleet waits
+		reconcilePlan()
+		Expect(plan.Status.Phase).To(Equal(moodlev1alpha1.PlanPhaseProgressing))
+		Expect(plan.Status.CurrentStage).To(Equal("pilot"))
+		Expect(image("biology")).To(Equal("moodle:4.5.3"))
+		Expect(image("chemistry")).To(Equal("moodle:4.5.2"))
+		Expect(image("history")).To(Equal("moodle:4.5.2"))
+
+		setStatus("biology", upgraded)
+		reconcilePlan()
+		Expect(image("chemistry")).To(Equal("moodle:4.5.3"))
+		Expect(image("history")).To(Equal("moodle:4.5.2"))
+
+		// The pilot stage has finished, the fleet starts without soaking
+		setStatus("chemistry", upgraded)
+		reconcilePlan()
+		Expect(plan.Status.Stages[0].Upgraded).To(Equal(int32(2)))
+		Expect(plan.Status.Stages[0].CompletionTime).NotTo(BeNil())
+		Expect(plan.Status.CurrentStage).To(Equal("fleet"))
+		Expect(image("history")).To(Equal("moodle:4.5.3"))
+		Expect(image("physics")).To(Equal("moodle:4.5.3"))
+
+		// A failed upgrade halts the plan
+		setStatus("history", moodlev1alpha1.MoodleTenantStatus{
+			UpgradedImage: "moodle:4.5.2",
+			Conditions: []metav1.Condition{{
+				Type:               moodlev1alpha1.ConditionDegraded,
+				Status:             metav1.ConditionTrue,
+				Reason:             "UpgradeFailed",
+				LastTransitionTime: metav1.Now(),
+			}},
+		})
+		reconcilePlan()
+		Expect(plan.Status.Phase).To(Equal(moodlev1alpha1.PlanPhaseHalted))
+		Expect(plan.Status.FailedTenants).To(Equal([]string{"default/history"}))
+		Expect(meta.IsStatusConditionFalse(plan.Status.Conditions, moodlev1alpha1.ConditionPlanComplete)).To(BeTrue())
+
+		// Tolerating it lets the plan complete
+		plan.Spec.MaxFailures = 1
+		Expect(c.Update(ctx, plan)).To(Succeed())
+		setStatus("physics", upgraded)
+		reconcilePlan()
+		Expect(plan.Status.Phase).To(Equal(moodlev1alpha1.PlanPhaseCompleted))
+		Expect(meta.IsStatusConditionTrue(plan.Status.Conditions, moodlev1alpha1.ConditionPlanComplete)).To(BeTrue())
+	})
+
+	It("should soak a finished stage before the next one", func() {
+		ctx := context.Background()
+
+		plan := &moodlev1alpha1.MoodleUpgradePlan{
+			ObjectMeta: metav1.ObjectMeta{Name: "moodle-4-5-3"},
+			Spec: moodlev1alpha1.MoodleUpgradePlanSpec{
+				Image: "moodle:4.5.3",
+				Stages: []moodlev1alpha1.UpgradeStage{
+					{Name: "pilot", Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"moodle.bsu.by/tier": "pilot"}}},
+					{Name: "fleet"},
+				},
+			},
+		}
+		pilot := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology", Namespace: "default", Labels: map[string]string{"moodle.bsu.by/tier": "pilot"}},
+			Spec:       moodlev1alpha1.MoodleTenantSpec{Image: "moodle:4.5.3"},
+			Status:     moodlev1alpha1.MoodleTenantStatus{UpgradedImage: "moodle:4.5.3"},
+		}
+		fleet := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "history", Namespace: "default"},
+			Spec:       moodlev1alpha1.MoodleTenantSpec{Image: "moodle:4.5.2"},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).
+			WithObjects(plan, pilot, fleet).
+			WithStatusSubresource(plan, pilot, fleet).
+			Build()
+		reconciler := &MoodleUpgradePlanReconciler{Client: c, Scheme: c.Scheme()}
+
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: plan.Name}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(c.Get(ctx, types.NamespacedName{Name: plan.Name}, plan)).To(Succeed())
+		Expect(plan.Status.Phase).To(Equal(moodlev1alpha1.PlanPhaseSoaking))
+		Expect(plan.Status.SoakUntil).NotTo(BeNil())
+		Expect(c.Get(ctx, types.NamespacedName{Name: "history", Namespace: "default"}, fleet)).To(Succeed())
+		Expect(fleet.Spec.Image).To(Equal("moodle:4.5.2"))
+	})
+})
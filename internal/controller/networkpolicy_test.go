@@ -0,0 +1,99 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("NetworkPolicy egress", func() {
+	var (
+		reconciler *MoodleTenantReconciler
+		mt         *moodlev1alpha1.MoodleTenant
+	)
+
+	BeforeEach(func() {
+		reconciler = &MoodleTenantReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+		mt = &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology"},
+			Spec:       moodlev1alpha1.MoodleTenantSpec{Hostname: "biology.bsu.by"},
+		}
+	})
+
+	// expectMetadataBlocked checks that no egress rule reaches the cloud metadata endpoints
+	expectMetadataBlocked := func(rules []networkingv1.NetworkPolicyEgressRule) {
+		for _, rule := range rules {
+			Expect(rule.To).NotTo(BeEmpty())
+			for _, peer := range rule.To {
+				if peer.IPBlock == nil {
+					continue
+				}
+				switch peer.IPBlock.CIDR {
+				case "0.0.0.0/0", "169.254.0.0/16":
+					Expect(peer.IPBlock.Except).To(ContainElement("169.254.169.254/32"))
+				case "::/0":
+					Expect(peer.IPBlock.Except).To(ContainElement("fd00:ec2::254/128"))
+				}
+				Expect(peer.IPBlock.CIDR).NotTo(Equal("169.254.169.254/32"))
+			}
+		}
+	}
+
+	It("should keep extra egress away from the metadata endpoints", func() {
+		mt.Spec.NetworkPolicy.ExtraEgress = []networkingv1.NetworkPolicyEgressRule{
+			{To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "0.0.0.0/0"}}}},
+			{To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "::/0"}}}},
+			{To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "169.254.0.0/16", Except: []string{"169.254.1.0/24"}}}}},
+			{To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "169.254.169.254/32"}}}},
+			{},
+		}
+
+		egress := reconciler.networkPolicyForMoodle(mt, "tenant-biology").Spec.Egress
+		expectMetadataBlocked(egress)
+
+		// The metadata endpoint is excepted next to the ranges excepted already
+		for _, rule := range egress {
+			for _, peer := range rule.To {
+				if peer.IPBlock != nil && peer.IPBlock.CIDR == "169.254.0.0/16" {
+					Expect(peer.IPBlock.Except).To(ConsistOf("169.254.1.0/24", "169.254.169.254/32"))
+				}
+			}
+		}
+	})
+
+	It("should keep the operator template away from the metadata endpoints", func() {
+		reconciler.NetworkPolicyTemplate = &networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{},
+				{To: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "0.0.0.0/0"}}}},
+			},
+		}
+
+		egress := reconciler.networkPolicyForMoodle(mt, "tenant-biology").Spec.Egress
+		Expect(egress).To(HaveLen(2))
+		expectMetadataBlocked(egress)
+
+		// The template itself is left untouched
+		Expect(reconciler.NetworkPolicyTemplate.Egress[1].To[0].IPBlock.Except).To(BeEmpty())
+	})
+})
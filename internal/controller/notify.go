@@ -0,0 +1,94 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// notificationClient posts notifications. A webhook that does not answer in time is
+// retried on a later reconcile.
+var notificationClient = &http.Client{Timeout: 10 * time.Second}
+
+// notification is the JSON posted to the notification webhook. Chat webhooks show text.
+type notification struct {
+	Text      string `json:"text"`
+	Tenant    string `json:"tenant"`
+	Namespace string `json:"namespace"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+}
+
+// warn emits a Warning event on the MoodleTenant
+func (r *MoodleTenantReconciler) warn(mt *moodlev1alpha1.MoodleTenant, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(mt, corev1.EventTypeWarning, reason, message)
+	}
+}
+
+// notify posts a notification to the webhook of spec.notifications. It does nothing
+// without notifications.
+func (r *MoodleTenantReconciler) notify(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, reason, message string) error {
+	if mt.Spec.Notifications == nil {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	secretName := mt.Spec.Notifications.WebhookSecretRef.Name
+	if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: mt.Namespace}, secret); err != nil {
+		return fmt.Errorf("failed to get the notification webhook secret %s: %w", secretName, err)
+	}
+	url := string(secret.Data["url"])
+	if url == "" {
+		return fmt.Errorf("the notification webhook secret %s has no url", secretName)
+	}
+
+	body, err := json.Marshal(notification{
+		Text:      fmt.Sprintf("Moodle %s (%s): %s", mt.Name, mt.Spec.Hostname, message),
+		Tenant:    mt.Name,
+		Namespace: mt.Namespace,
+		Reason:    reason,
+		Message:   message,
+	})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid notification webhook URL in %s: %w", secretName, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := notificationClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to call the notification webhook: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("the notification webhook answered %s", response.Status)
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// proxySQLPort is the MySQL protocol port of ProxySQL
+const proxySQLPort = 6033
+
+// ProxySQL hostgroups of the primary and the reader hosts
+const (
+	proxySQLWriterHostgroup = 10
+	proxySQLReaderHostgroup = 20
+)
+
+// proxySQLName returns the name shared by the ProxySQL resources
+func proxySQLName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-proxysql"
+}
+
+// proxySQLLabels returns the labels of the ProxySQL pods
+func proxySQLLabels(mt *moodlev1alpha1.MoodleTenant) map[string]string {
+	return map[string]string{
+		"app":                  "moodle-proxysql",
+		"moodle.bsu.by/tenant": mt.Name,
+	}
+}
+
+// reconcileProxySQL runs ProxySQL in front of the tenant database while the pooler is
+// enabled and removes it otherwise
+func (r *MoodleTenantReconciler) reconcileProxySQL(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Spec.DatabaseRef.Pooler == nil {
+		objectMeta := metav1.ObjectMeta{Name: proxySQLName(mt), Namespace: namespace}
+		for _, obj := range []client.Object{
+			&corev1.Service{ObjectMeta: objectMeta},
+			&appsv1.Deployment{ObjectMeta: objectMeta},
+			&corev1.Secret{ObjectMeta: objectMeta},
+		} {
+			if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "Failed to delete ProxySQL resource", "Namespace", namespace, "Name", obj.GetName())
+				return err
+			}
+		}
+		return nil
+	}
+
+	config := proxySQLConfig(mt)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      proxySQLName(mt),
+			Namespace: namespace,
+			Labels:    proxySQLLabels(mt),
+		},
+		Data: map[string][]byte{
+			"proxysql.cnf": []byte(config),
+		},
+	}
+	if err := ctrl.SetControllerReference(mt, secret, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.reconcileSecretData(ctx, secret); err != nil {
+		return err
+	}
+
+	if err := r.reconcileObject(ctx, mt, r.proxySQLDeploymentForMoodle(mt, namespace, config), &appsv1.Deployment{}); err != nil {
+		return err
+	}
+	return r.reconcileObject(ctx, mt, r.proxySQLServiceForMoodle(mt, namespace), &corev1.Service{})
+}
+
+// proxySQLConfig returns the ProxySQL configuration. Reads outside transactions go to the
+// reader hostgroup; everything else, including SELECT ... FOR UPDATE, to the primary.
+func proxySQLConfig(mt *moodlev1alpha1.MoodleTenant) string {
+	pooler := mt.Spec.DatabaseRef.Pooler
+	user := strconv.Quote(mt.Spec.DatabaseRef.User)
+	password := strconv.Quote(mt.Spec.DatabaseRef.Password)
+
+	maxConnections := int32(100)
+	if pooler.MaxConnections > 0 {
+		maxConnections = pooler.MaxConnections
+	}
+
+	host := mt.Spec.DatabaseRef.Host
+	if mt.Spec.DatabaseRef.PublishService {
+		host = databaseServiceName(mt)
+	}
+
+	servers := []string{
+		fmt.Sprintf("    { address=%s, port=%d, hostgroup=%d, max_connections=%d }",
+			strconv.Quote(host), databasePort(mt), proxySQLWriterHostgroup, maxConnections),
+	}
+	for _, reader := range pooler.ReaderHosts {
+		servers = append(servers, fmt.Sprintf("    { address=%s, port=%d, hostgroup=%d, max_connections=%d }",
+			strconv.Quote(reader), databasePort(mt), proxySQLReaderHostgroup, maxConnections))
+	}
+
+	queryRules := ""
+	if len(pooler.ReaderHosts) > 0 {
+		queryRules = fmt.Sprintf(`
+mysql_query_rules=
+(
+    { rule_id=1, active=1, match_digest="^SELECT.*FOR UPDATE", destination_hostgroup=%d, apply=1 },
+    { rule_id=2, active=1, match_digest="^SELECT", destination_hostgroup=%d, apply=1 }
+)
+`, proxySQLWriterHostgroup, proxySQLReaderHostgroup)
+	}
+
+	return fmt.Sprintf(`datadir="/var/lib/proxysql"
+
+admin_variables=
+{
+    mysql_ifaces="127.0.0.1:6032"
+}
+
+mysql_variables=
+{
+    interfaces="0.0.0.0:%d"
+    monitor_username=%s
+    monitor_password=%s
+}
+
+mysql_servers=
+(
+%s
+)
+
+mysql_users=
+(
+    { username=%s, password=%s, default_hostgroup=%d, transaction_persistent=1 }
+)
+%s`, proxySQLPort, user, password, strings.Join(servers, ",\n"), user, password, proxySQLWriterHostgroup, queryRules)
+}
+
+// proxySQLDeploymentForMoodle returns the ProxySQL Deployment. The configuration hash in
+// the pod template restarts ProxySQL when the configuration changes, since it reads the
+// file only on start.
+func (r *MoodleTenantReconciler) proxySQLDeploymentForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace, config string) *appsv1.Deployment {
+	pooler := mt.Spec.DatabaseRef.Pooler
+	labels := proxySQLLabels(mt)
+
+	replicas := int32(2)
+	if pooler.Replicas > 0 {
+		replicas = pooler.Replicas
+	}
+	image := "proxysql/proxysql:2.7.1"
+	if pooler.Image != "" {
+		image = pooler.Image
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(config))
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      proxySQLName(mt),
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To(replicas),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+					Annotations: map[string]string{
+						"moodle.bsu.by/config-hash": fmt.Sprintf("%08x", hash.Sum32()),
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  "proxysql",
+							Image: image,
+							Args:  []string{"--initial", "-f", "-c", "/etc/proxysql/proxysql.cnf"},
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "mysql",
+									ContainerPort: proxySQLPort,
+									Protocol:      corev1.ProtocolTCP,
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								ProbeHandler: corev1.ProbeHandler{
+									TCPSocket: &corev1.TCPSocketAction{
+										Port: intstr.FromInt(proxySQLPort),
+									},
+								},
+								PeriodSeconds: 5,
+							},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{
+									corev1.ResourceCPU:    resource.MustParse("100m"),
+									corev1.ResourceMemory: resource.MustParse("128Mi"),
+								},
+								Limits: corev1.ResourceList{
+									corev1.ResourceMemory: resource.MustParse("512Mi"),
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "config",
+									MountPath: "/etc/proxysql",
+									ReadOnly:  true,
+								},
+								{
+									Name:      "data",
+									MountPath: "/var/lib/proxysql",
+								},
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "config",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: proxySQLName(mt),
+								},
+							},
+						},
+						{
+							Name: "data",
+							VolumeSource: corev1.VolumeSource{
+								EmptyDir: &corev1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, deployment, r.Scheme); err != nil {
+		return nil
+	}
+
+	return deployment
+}
+
+// proxySQLServiceForMoodle returns the Service Moodle connects to instead of the database
+func (r *MoodleTenantReconciler) proxySQLServiceForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      proxySQLName(mt),
+			Namespace: namespace,
+			Labels:    proxySQLLabels(mt),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: proxySQLLabels(mt),
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "mysql",
+					Port:       proxySQLPort,
+					TargetPort: intstr.FromInt(proxySQLPort),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, service, r.Scheme); err != nil {
+		return nil
+	}
+
+	return service
+}
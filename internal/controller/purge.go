@@ -0,0 +1,122 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// purgeCachesAnnotation requests a cache purge of the MoodleTenant whenever its value
+// changes, e.g. kubectl annotate moodletenant <name> moodle.bsu.by/purge-caches="$(date +%s)" --overwrite
+const purgeCachesAnnotation = "moodle.bsu.by/purge-caches"
+
+// reconcileCachePurge runs the cache purge Job for the value of the purge-caches
+// annotation and records its outcome in the status and the CachesPurged condition. The
+// last purge stays recorded when the annotation is removed.
+func (r *MoodleTenantReconciler) reconcileCachePurge(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	trigger := mt.Annotations[purgeCachesAnnotation]
+	if trigger == "" {
+		return nil
+	}
+
+	job, err := r.cachePurgeJobForMoodle(mt, namespace, trigger)
+	if err != nil {
+		return fmt.Errorf("failed to build the cache purge Job: %w", err)
+	}
+
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		// A finished purge is not repeated after its Job was deleted
+		if purge := mt.Status.CachePurge; purge != nil && purge.Trigger == trigger && purge.CompletionTime != nil {
+			return nil
+		}
+		logger.Info("Creating a new cache purge Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new cache purge Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return err
+		}
+		found = job
+	} else if err != nil {
+		logger.Error(err, "Failed to get cache purge Job")
+		return err
+	}
+
+	purge := mt.Status.CachePurge
+	if purge == nil || purge.Trigger != trigger {
+		purge = &moodlev1alpha1.CachePurgeStatus{Trigger: trigger, JobName: found.Name}
+		mt.Status.CachePurge = purge
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionCachesPurged,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "Purging",
+		Message:            fmt.Sprintf("Cache purge Job %s is running", found.Name),
+		ObservedGeneration: mt.Generation,
+	}
+	switch {
+	case found.Status.Succeeded > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Purged"
+		condition.Message = fmt.Sprintf("Caches purged for %s=%s", purgeCachesAnnotation, trigger)
+	case jobFailed(found):
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "PurgeFailed"
+		condition.Message = fmt.Sprintf("Cache purge Job %s failed; see its logs", found.Name)
+	}
+	if condition.Status != metav1.ConditionUnknown && purge.CompletionTime == nil {
+		purge.CompletionTime = ptr.To(metav1.Now())
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	return nil
+}
+
+// cachePurgeJobForMoodle returns the Job running purge_caches.php for a trigger. Like the
+// upgrade Job it runs the Moodle container of the Deployment. The Memcached sidecar
+// belongs to its pod and is not purged.
+func (r *MoodleTenantReconciler) cachePurgeJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace, trigger string) (*batchv1.Job, error) {
+	// Each trigger value gets its own Job
+	hash := fnv.New32a()
+	hash.Write([]byte(trigger))
+	name := fmt.Sprintf("%s-purge-%08x", mt.Name, hash.Sum32())
+
+	job, err := r.cliJobForMoodle(mt, namespace, name, "purge-caches", []string{"/usr/local/bin/php", "/var/www/html/admin/cli/purge_caches.php"})
+	if err != nil {
+		return nil, err
+	}
+	job.Annotations = map[string]string{
+		"moodle.bsu.by/trigger": trigger,
+	}
+
+	return job, nil
+}
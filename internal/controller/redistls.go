@@ -0,0 +1,92 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// redisTLSPath is where the Redis CA is mounted
+const redisTLSPath = "/etc/moodle/redis-tls"
+
+// redisTLS returns the TLS settings of an existing Redis server, or nil
+func redisTLS(mt *moodlev1alpha1.MoodleTenant) *moodlev1alpha1.RedisTLSSpec {
+	if !redisEnabled(mt) || redisDeployed(mt) || mt.Spec.Cache.ClusterRef != nil {
+		return nil
+	}
+	return mt.Spec.Cache.Redis.TLS
+}
+
+// redisCAName returns the name of the copy of the Redis CA in the tenant namespace
+func redisCAName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-redis-ca"
+}
+
+// reconcileRedisTLSSecret copies the Redis CA into the tenant namespace, or removes the
+// copy when it is no longer referenced
+func (r *MoodleTenantReconciler) reconcileRedisTLSSecret(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	if tls := redisTLS(mt); tls != nil && tls.CASecretRef != nil {
+		source := types.NamespacedName{Name: tls.CASecretRef.Name, Namespace: mt.Namespace}
+		return r.reconcileCopiedSecret(ctx, mt, source, namespace, redisCAName(mt))
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: redisCAName(mt), Namespace: namespace}}
+	if err := r.Delete(ctx, secret); err != nil && !errors.IsNotFound(err) {
+		log.FromContext(ctx).Error(err, "Failed to delete Redis CA Secret", "Namespace", namespace, "Name", secret.Name)
+		return err
+	}
+	return nil
+}
+
+// applyRedisTLS turns on TLS for Redis in the first container of the pod and mounts the
+// copied Redis CA into it
+func applyRedisTLS(mt *moodlev1alpha1.MoodleTenant, podSpec *corev1.PodSpec) {
+	tls := redisTLS(mt)
+	if tls == nil {
+		return
+	}
+
+	container := &podSpec.Containers[0]
+	container.Env = append(container.Env, corev1.EnvVar{Name: "REDIS_TLS", Value: "1"})
+	if tls.CASecretRef == nil {
+		return
+	}
+
+	container.Env = append(container.Env, corev1.EnvVar{Name: "REDIS_CA_FILE", Value: redisTLSPath + "/ca.crt"})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "redis-tls",
+		MountPath: redisTLSPath,
+		ReadOnly:  true,
+	})
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "redis-tls",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: redisCAName(mt),
+				Items:      []corev1.KeyToPath{{Key: "ca.crt", Path: "ca.crt"}},
+			},
+		},
+	})
+}
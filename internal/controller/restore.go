@@ -0,0 +1,294 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// restoreScript replays $DUMP_FILE into the tenant database, picking the client by the
+// file name. Compressed dumps are unpacked first, so that a truncated file fails the Job
+// without relying on pipefail.
+const restoreScript = `set -e
+file="$DUMP_FILE"
+case "$file" in
+*.gz)
+  gunzip -c "$file" > /work/restore.sql
+  file=/work/restore.sql
+  ;;
+esac
+case "$DB_TYPE:$file" in
+pgsql:*.dump)
+  pg_restore --no-owner --no-privileges --exit-on-error --single-transaction --dbname="$PGDATABASE" "$file"
+  ;;
+pgsql:*)
+  psql -v ON_ERROR_STOP=1 --single-transaction --file="$file"
+  ;;
+*:*.dump)
+  echo "pg_restore dumps cannot be restored into $DB_TYPE" >&2
+  exit 1
+  ;;
+*)
+  mariadb --host="$DB_HOST" --port="$DB_PORT" --user="$DB_USER" "$DB_NAME" < "$file"
+  ;;
+esac
+`
+
+// restoreJobName returns the name of the restore Job. A tenant is restored only once, so
+// the name is fixed.
+func restoreJobName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-db-restore"
+}
+
+// restoreCredentialsSecretName returns the name of the object store credentials copied
+// into the tenant namespace
+func restoreCredentialsSecretName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-db-restore-s3"
+}
+
+// reconcileDatabaseRestore runs the restore Job of databaseRef.restoreFrom once the
+// database is ready and provisioned, and reports whether Moodle may start. The
+// DatabaseRestored condition records a finished restore, which is never repeated.
+func (r *MoodleTenantReconciler) reconcileDatabaseRestore(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) (bool, error) {
+	logger := log.FromContext(ctx)
+
+	restore := mt.Spec.DatabaseRef.RestoreFrom
+	if restore == nil || meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseRestored) {
+		if err := r.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: restoreCredentialsSecretName(mt), Namespace: namespace}}); err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+		return true, nil
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDatabaseRestored,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "WaitingForDatabase",
+		Message:            "Waiting for the database before restoring the dump",
+		ObservedGeneration: mt.Generation,
+	}
+	provisioned := mt.Spec.DatabaseRef.Provisioning == nil || meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseProvisioned)
+	if !databaseReady(mt) || !provisioned {
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return false, nil
+	}
+
+	if s3 := restore.S3; s3 != nil {
+		source := types.NamespacedName{Name: s3.CredentialsSecretRef.Name, Namespace: mt.Namespace}
+		if err := r.reconcileCopiedSecret(ctx, mt, source, namespace, restoreCredentialsSecretName(mt)); err != nil {
+			return false, err
+		}
+	}
+
+	job, err := r.restoreJobForMoodle(mt, namespace)
+	if err != nil {
+		return false, fmt.Errorf("failed to build the database restore Job: %w", err)
+	}
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new database restore Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new database restore Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return false, err
+		}
+		found = job
+	} else if err != nil {
+		logger.Error(err, "Failed to get database restore Job")
+		return false, err
+	}
+
+	condition.Reason = "Restoring"
+	condition.Message = fmt.Sprintf("Job %s is restoring %s", found.Name, restoreSource(mt))
+	switch {
+	case found.Status.Succeeded > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Restored"
+		condition.Message = fmt.Sprintf("Restored %s", restoreSource(mt))
+	case jobFailed(found):
+		// The failed Job is kept for its logs; deleting it retries the restore
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "RestoreFailed"
+		condition.Message = fmt.Sprintf("Job %s failed, see its logs and delete it to retry", found.Name)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	return condition.Status == metav1.ConditionTrue, nil
+}
+
+// restoreSource returns the location of the restored dump
+func restoreSource(mt *moodlev1alpha1.MoodleTenant) string {
+	restore := mt.Spec.DatabaseRef.RestoreFrom
+	if restore.S3 != nil {
+		return restore.S3.URL
+	}
+	return "pvc://" + restore.PVC.ClaimName + "/" + restore.PVC.Path
+}
+
+// restoreJobForMoodle returns the Job restoring the dump into the tenant database with
+// the credentials of the database Secret
+func (r *MoodleTenantReconciler) restoreJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) (*batchv1.Job, error) {
+	job := databaseRestoreJob(mt, namespace, restoreJobName(mt), mt.Spec.DatabaseRef.RestoreFrom, restoreCredentialsSecretName(mt), restoreScript)
+	job.Labels["moodle.bsu.by/job"] = "database-restore"
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, job, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// databaseRestoreJob returns a Job named name that runs script with $DUMP_FILE, the dump
+// of restore, and the credentials of the database Secret. Object store dumps are
+// downloaded with the credentials copied to credentialsSecret.
+func databaseRestoreJob(mt *moodlev1alpha1.MoodleTenant, namespace, name string, restore *moodlev1alpha1.DatabaseRestoreSpec, credentialsSecret, script string) *batchv1.Job {
+	postgres := databaseType(mt) == "pgsql"
+
+	image := "mariadb:11"
+	if postgres {
+		image = "postgres:17-alpine"
+	}
+	if restore.Image != "" {
+		image = restore.Image
+	}
+
+	dumpDir := "/dump"
+	volumes := []corev1.Volume{
+		{Name: "work", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	var dumpFile string
+	if pvc := restore.PVC; pvc != nil {
+		dumpFile = path.Join(dumpDir, pvc.Path)
+		volumes = append(volumes, corev1.Volume{
+			Name: "dump",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: pvc.ClaimName, ReadOnly: true},
+			},
+		})
+	} else {
+		dumpFile = path.Join(dumpDir, path.Base(restore.S3.URL))
+		volumes = append(volumes, corev1.Volume{
+			Name:         "dump",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+	}
+
+	env := append(databaseClientEnv(mt),
+		corev1.EnvVar{Name: "DB_TYPE", Value: databaseType(mt)},
+		corev1.EnvVar{Name: "DUMP_FILE", Value: dumpFile},
+	)
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		SecurityContext: &corev1.PodSecurityContext{
+			FSGroup: ptr.To[int64](33), // www-data, the owner of dumps in moodledata
+		},
+		Containers: []corev1.Container{
+			{
+				Name:    "restore",
+				Image:   image,
+				Command: []string{"sh", "-c", script},
+				Env:     env,
+				VolumeMounts: []corev1.VolumeMount{
+					{Name: "dump", MountPath: dumpDir, ReadOnly: restore.PVC != nil},
+					{Name: "work", MountPath: "/work"},
+				},
+			},
+		},
+		Volumes: volumes,
+	}
+
+	// Object store dumps are downloaded by the AWS CLI first
+	if s3 := restore.S3; s3 != nil {
+		download := `aws s3 cp "$S3_URL" "$DUMP_FILE"`
+		if s3.EndpointURL != "" {
+			download += ` --endpoint-url "$S3_ENDPOINT_URL"`
+		}
+		downloadEnv := []corev1.EnvVar{
+			{Name: "DUMP_FILE", Value: dumpFile},
+			{Name: "S3_URL", Value: s3.URL},
+			{Name: "S3_ENDPOINT_URL", Value: s3.EndpointURL},
+		}
+		if s3.Region != "" {
+			downloadEnv = append(downloadEnv, corev1.EnvVar{Name: "AWS_DEFAULT_REGION", Value: s3.Region})
+		}
+
+		podSpec.InitContainers = []corev1.Container{
+			{
+				Name:    "download",
+				Image:   "amazon/aws-cli:2.22.0",
+				Command: []string{"sh", "-c", download},
+				Env:     downloadEnv,
+				EnvFrom: []corev1.EnvFromSource{
+					{
+						SecretRef: &corev1.SecretEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: credentialsSecret},
+						},
+					},
+				},
+				VolumeMounts: []corev1.VolumeMount{{Name: "dump", MountPath: dumpDir}},
+			},
+		}
+	}
+
+	// The restore connects with the same TLS settings as Moodle
+	if postgres {
+		applyDatabaseTLS(mt, &podSpec, true)
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			// A partly replayed dump cannot simply be replayed again
+			BackoffLimit: ptr.To[int32](0),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"moodle.bsu.by/tenant": mt.Name,
+					},
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+
+	// A sidecar would keep the Job from ever completing
+	setSidecarInjection(mt, &job.Spec.Template, false)
+
+	return job
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Database restore", func() {
+	It("should hold Moodle back until the dump is restored, once", func() {
+		ctx := context.Background()
+
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "legacy", UID: "legacy-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Host:        "postgres-cluster.db-tier.svc",
+					AdminSecret: "legacy-db",
+					RestoreFrom: &moodlev1alpha1.DatabaseRestoreSpec{
+						PVC: &moodlev1alpha1.RestorePVCSource{ClaimName: "legacy-data", Path: "import/moodle.sql.gz"},
+					},
+				},
+			},
+		}
+
+		restored, err := reconciler.reconcileDatabaseRestore(ctx, mt, "tenant-legacy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored).To(BeFalse())
+
+		job := &batchv1.Job{}
+		Expect(c.Get(ctx, types.NamespacedName{Name: "legacy-db-restore", Namespace: "tenant-legacy"}, job)).To(Succeed())
+		Expect(job.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+			Name: "DUMP_FILE", Value: "/dump/import/moodle.sql.gz",
+		}))
+
+		job.Status.Succeeded = 1
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+		restored, err = reconciler.reconcileDatabaseRestore(ctx, mt, "tenant-legacy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionDatabaseRestored)).To(BeTrue())
+
+		// A finished restore is not repeated when its Job is cleaned up
+		Expect(c.Delete(ctx, job)).To(Succeed())
+		restored, err = reconciler.reconcileDatabaseRestore(ctx, mt, "tenant-legacy")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored).To(BeTrue())
+		Expect(c.Get(ctx, types.NamespacedName{Name: "legacy-db-restore", Namespace: "tenant-legacy"}, job)).NotTo(Succeed())
+	})
+})
@@ -0,0 +1,275 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// rollbackDropScript drops the tables of the tenant prefix before the dump is replayed,
+// including those the failed upgrade added. Tenants sharing the database keep theirs.
+const rollbackDropScript = `set -e
+like=$(printf '%s' "$DB_PREFIX" | sed 's/_/\\_/g')
+case "$DB_TYPE" in
+pgsql)
+  psql -v ON_ERROR_STOP=1 -At -c "SELECT format('DROP TABLE IF EXISTS %I.%I CASCADE;', schemaname, tablename) FROM pg_tables WHERE schemaname = current_schema() AND tablename LIKE '${like}%'" > /work/drop.sql
+  psql -v ON_ERROR_STOP=1 --single-transaction --file=/work/drop.sql
+  ;;
+*)
+  mariadb --host="$DB_HOST" --port="$DB_PORT" --user="$DB_USER" -N -e "SELECT CONCAT('DROP TABLE IF EXISTS ', CHAR(96), table_name, CHAR(96), ';') FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name LIKE '${like}%'" "$DB_NAME" > /work/drop.sql
+  mariadb --host="$DB_HOST" --port="$DB_PORT" --user="$DB_USER" "$DB_NAME" < /work/drop.sql
+  ;;
+esac
+`
+
+// rollbackMaintenanceScript removes the CLI maintenance mode the upgrade Job enabled in
+// moodledata
+const rollbackMaintenanceScript = `rm -f /var/www/moodledata/climaintenance.html
+`
+
+// rollbackJobName returns the name of the Job rolling back the upgrade to spec.image
+func rollbackJobName(mt *moodlev1alpha1.MoodleTenant) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(mt.Spec.Image))
+	return fmt.Sprintf("%s-rollback-%08x", mt.Name, hash.Sum32())
+}
+
+// rollbackCredentialsSecretName returns the name of the object store credentials of the
+// dump copied into the tenant namespace
+func rollbackCredentialsSecretName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-rollback-s3"
+}
+
+// rollbackPossible reports whether the upgrade to spec.image can be rolled back: rollback
+// is enabled and the dump was taken before the upgrade
+func rollbackPossible(mt *moodlev1alpha1.MoodleTenant) bool {
+	backup := mt.Status.UpgradeBackup
+	return mt.Spec.Upgrade.Rollback != nil && backup != nil && backup.Image == mt.Spec.Image &&
+		backup.DatabaseDump != "" && backup.FromImage != ""
+}
+
+// rollbackStarted reports whether a rollback of the upgrade to spec.image has started
+func rollbackStarted(mt *moodlev1alpha1.MoodleTenant) bool {
+	rollback := mt.Status.Rollback
+	return rollback != nil && rollback.Image == mt.Spec.Image
+}
+
+// rolledBack reports whether the upgrade to spec.image was rolled back successfully
+func rolledBack(mt *moodlev1alpha1.MoodleTenant) bool {
+	degraded := meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionDegraded)
+	return rollbackStarted(mt) && mt.Status.Rollback.CompletionTime != nil && degraded != nil && degraded.Reason == "RolledBack"
+}
+
+// startRollback moves the workloads back to the image the backups were taken of. The
+// database is restored by reconcileRollback.
+func (r *MoodleTenantReconciler) startRollback(mt *moodlev1alpha1.MoodleTenant, reason, message string) {
+	backup := mt.Status.UpgradeBackup
+	mt.Status.Rollback = &moodlev1alpha1.RollbackStatus{
+		Image:   mt.Spec.Image,
+		ToImage: backup.FromImage,
+		Reason:  reason,
+	}
+	mt.Status.UpgradedImage = backup.FromImage
+	mt.Status.UpgradeRolloutDeadline = nil
+	r.warn(mt, "UpgradeRollback", fmt.Sprintf("%s, rolling back to %s", message, backup.FromImage))
+}
+
+// reconcileUpgradeRollout waits for the rollout of the upgraded image and rolls the
+// upgrade back when it has not completed by status.upgradeRolloutDeadline
+func (r *MoodleTenantReconciler) reconcileUpgradeRollout(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string, condition metav1.Condition) error {
+	logger := log.FromContext(ctx)
+
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: activeDeploymentName(mt), Namespace: namespace}, deployment)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get Deployment")
+		return err
+	}
+	if err == nil && rolloutComplete(deployment, mt.Spec.Image) {
+		mt.Status.UpgradeRolloutDeadline = nil
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	deadline := mt.Status.UpgradeRolloutDeadline
+	if time.Now().Before(deadline.Time) {
+		condition.Reason = "RollingOut"
+		condition.Message = fmt.Sprintf("Waiting until %s for the rollout of %s", deadline.UTC().Format(time.RFC3339), mt.Spec.Image)
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	r.startRollback(mt, "RolloutFailed", fmt.Sprintf("%s did not become available in time", mt.Spec.Image))
+	return r.reconcileRollback(ctx, mt, namespace, condition)
+}
+
+// reconcileRollback restores the database from the dump taken before the upgrade to
+// spec.image, once cron has stopped, and reports the rollback in the Degraded condition.
+// It stays Degraded until spec.image is changed again.
+func (r *MoodleTenantReconciler) reconcileRollback(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string, condition metav1.Condition) error {
+	logger := log.FromContext(ctx)
+
+	rollback := mt.Status.Rollback
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = "RollingBack"
+
+	if rollback.CompletionTime != nil {
+		if err := r.Delete(ctx, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: rollbackCredentialsSecretName(mt), Namespace: namespace}}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if previous := meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionDegraded); previous != nil {
+			condition.Reason = previous.Reason
+			condition.Message = previous.Message
+		}
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	dump := &moodlev1alpha1.MoodleDatabaseDump{}
+	if err := r.Get(ctx, types.NamespacedName{Name: mt.Status.UpgradeBackup.DatabaseDump, Namespace: mt.Namespace}, dump); err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to get MoodleDatabaseDump")
+			return err
+		}
+		return r.finishRollback(mt, condition, "RollbackFailed",
+			fmt.Sprintf("The upgrade to %s failed and was not rolled back: its MoodleDatabaseDump %s is gone", rollback.Image, mt.Status.UpgradeBackup.DatabaseDump))
+	}
+
+	job, err := r.rollbackJobForMoodle(mt, namespace, dump)
+	if err != nil {
+		return fmt.Errorf("failed to build the rollback Job: %w", err)
+	}
+	rollback.JobName = job.Name
+
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		// A cron run would write to the database while it is replaced
+		running, err := r.cronRunning(ctx, mt, namespace)
+		if err != nil {
+			return err
+		}
+		if running {
+			condition.Message = fmt.Sprintf("The upgrade to %s failed; waiting for cron to stop before restoring the database", rollback.Image)
+			meta.SetStatusCondition(&mt.Status.Conditions, condition)
+			return nil
+		}
+
+		if s3 := dump.Spec.Destination.S3; s3 != nil {
+			source := types.NamespacedName{Name: s3.CredentialsSecretRef.Name, Namespace: dump.Namespace}
+			if err := r.reconcileCopiedSecret(ctx, mt, source, namespace, rollbackCredentialsSecretName(mt)); err != nil {
+				return err
+			}
+		}
+
+		logger.Info("Creating a new rollback Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name, "Image", rollback.ToImage)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new rollback Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return err
+		}
+		found = job
+	} else if err != nil {
+		logger.Error(err, "Failed to get rollback Job")
+		return err
+	}
+
+	switch {
+	case found.Status.Succeeded > 0:
+		message := fmt.Sprintf("The upgrade to %s failed (%s) and was rolled back to %s with the database of %s", rollback.Image, rollback.Reason, rollback.ToImage, dump.Status.Artifact)
+		if snapshot := mt.Status.UpgradeBackup.VolumeSnapshot; snapshot != "" {
+			message += fmt.Sprintf("; moodledata was not restored from VolumeSnapshot %s", snapshot)
+		}
+		return r.finishRollback(mt, condition, "RolledBack", message)
+	case jobFailed(found):
+		return r.finishRollback(mt, condition, "RollbackFailed",
+			fmt.Sprintf("The upgrade to %s failed and the rollback Job %s failed too; see its logs", rollback.Image, found.Name))
+	}
+	condition.Message = fmt.Sprintf("The upgrade to %s failed (%s); Job %s is restoring the database from %s", rollback.Image, rollback.Reason, found.Name, dump.Status.Artifact)
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	return nil
+}
+
+// finishRollback records the outcome of a rollback
+func (r *MoodleTenantReconciler) finishRollback(mt *moodlev1alpha1.MoodleTenant, condition metav1.Condition, reason, message string) error {
+	mt.Status.Rollback.CompletionTime = ptr.To(metav1.Now())
+	// The rollback lifted the maintenance mode, spec.maintenanceMode enables it again
+	if mt.Spec.MaintenanceMode != nil {
+		mt.Status.MaintenanceMode = nil
+	}
+	condition.Reason = reason
+	condition.Message = message
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	r.warn(mt, reason, message)
+	return nil
+}
+
+// rollbackJobForMoodle returns the Job replacing the tables of the tenant with those of
+// the dump and lifting the maintenance mode of the failed upgrade
+func (r *MoodleTenantReconciler) rollbackJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string, dump *moodlev1alpha1.MoodleDatabaseDump) (*batchv1.Job, error) {
+	source := &moodlev1alpha1.DatabaseRestoreSpec{Image: dump.Spec.Image}
+	if s3 := dump.Spec.Destination.S3; s3 != nil {
+		source.S3 = &moodlev1alpha1.RestoreS3Source{
+			URL:         "s3://" + s3.Bucket + "/" + dumpObjectKey(dump, mt),
+			EndpointURL: s3.EndpointURL,
+			Region:      s3.Region,
+		}
+	} else {
+		source.PVC = &moodlev1alpha1.RestorePVCSource{
+			ClaimName: dump.Spec.Destination.PVC.ClaimName,
+			Path:      dumpFilePath(dump, mt),
+		}
+	}
+
+	job := databaseRestoreJob(mt, namespace, rollbackJobName(mt), source, rollbackCredentialsSecretName(mt),
+		rollbackDropScript+restoreScript+rollbackMaintenanceScript)
+	job.Labels["moodle.bsu.by/job"] = "upgrade-rollback"
+	job.Annotations = map[string]string{"moodle.bsu.by/image": mt.Spec.Image}
+
+	podSpec := &job.Spec.Template.Spec
+	container := &podSpec.Containers[0]
+	container.Env = append(container.Env, corev1.EnvVar{Name: "DB_PREFIX", Value: tablePrefix(mt)})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "moodledata", MountPath: "/var/www/moodledata"})
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "moodledata",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: mt.Name + "-data"},
+		},
+	})
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, job, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
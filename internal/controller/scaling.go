@@ -0,0 +1,113 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// scalingScheduleLookback bounds the search for the schedule in effect. Schedules firing
+// less often than that do not apply between their runs.
+const scalingScheduleLookback = 8 * 24 * time.Hour
+
+// scalingState returns the schedule that fired last before now, if any in the lookback,
+// and when the next schedule fires, or the end of the lookahead
+func scalingState(scaling *moodlev1alpha1.ScalingSpec, now time.Time) (*moodlev1alpha1.ScalingSchedule, time.Time, error) {
+	location := time.UTC
+	if scaling.TimeZone != nil {
+		var err error
+		if location, err = time.LoadLocation(*scaling.TimeZone); err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid scaling time zone: %w", err)
+		}
+	}
+	schedules := make([]*cronSchedule, len(scaling.Schedules))
+	for i := range scaling.Schedules {
+		var err error
+		if schedules[i], err = parseCronSchedule(scaling.Schedules[i].Schedule); err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid scaling schedule %s: %w", scaling.Schedules[i].Name, err)
+		}
+	}
+	// The schedule listed first wins when several fire in the same minute
+	match := func(t time.Time) int {
+		for i, schedule := range schedules {
+			if schedule.matches(t) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	now = now.In(location).Truncate(time.Minute)
+	var active *moodlev1alpha1.ScalingSchedule
+	for t := now; t.After(now.Add(-scalingScheduleLookback)); t = t.Add(-time.Minute) {
+		if i := match(t); i >= 0 {
+			active = &scaling.Schedules[i]
+			break
+		}
+	}
+	lookahead := now.Add(scalingScheduleLookback)
+	for t := now.Add(time.Minute); t.Before(lookahead); t = t.Add(time.Minute) {
+		if match(t) >= 0 {
+			return active, t, nil
+		}
+	}
+	return active, lookahead, nil
+}
+
+// reconcileScaling records the schedule of spec.scaling in effect in status.scaling,
+// which the Deployment and the HPA take their replicas from
+func (r *MoodleTenantReconciler) reconcileScaling(mt *moodlev1alpha1.MoodleTenant) error {
+	if mt.Spec.Scaling == nil {
+		mt.Status.Scaling = nil
+		return nil
+	}
+	active, next, err := scalingState(mt.Spec.Scaling, time.Now())
+	if err != nil {
+		return err
+	}
+
+	status := &moodlev1alpha1.ScalingStatus{NextChange: ptr.To(metav1.NewTime(next))}
+	if active != nil {
+		status.Schedule = active.Name
+		status.MinReplicas = active.MinReplicas
+		status.MaxReplicas = max(ptr.Deref(active.MaxReplicas, mt.Spec.HPA.MaxReplicas), active.MinReplicas)
+	}
+	mt.Status.Scaling = status
+	return nil
+}
+
+// scheduledScaling returns the scaling in effect, or nil without a schedule in effect
+func scheduledScaling(mt *moodlev1alpha1.MoodleTenant) *moodlev1alpha1.ScalingStatus {
+	if mt.Spec.Scaling == nil || mt.Status.Scaling == nil || mt.Status.Scaling.Schedule == "" {
+		return nil
+	}
+	return mt.Status.Scaling
+}
+
+// scalingRequeue returns when the next schedule fires, or zero without scheduled scaling
+func scalingRequeue(mt *moodlev1alpha1.MoodleTenant) time.Duration {
+	if mt.Spec.Scaling == nil || mt.Status.Scaling == nil || mt.Status.Scaling.NextChange == nil {
+		return 0
+	}
+	return max(time.Until(mt.Status.Scaling.NextChange.Time), 0) + time.Second
+}
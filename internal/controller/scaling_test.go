@@ -0,0 +1,81 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Scheduled scaling", func() {
+	It("should apply the schedule that fired last to the Deployment and the HPA", func() {
+		scaling := &moodlev1alpha1.ScalingSpec{
+			TimeZone: ptr.To("Europe/Minsk"),
+			Schedules: []moodlev1alpha1.ScalingSchedule{
+				{Name: "lectures", Schedule: "30 7 * * 1-5", MinReplicas: 8, MaxReplicas: ptr.To[int32](20)},
+				{Name: "night", Schedule: "0 20 * * *", MinReplicas: 2},
+			},
+		}
+		minsk, err := time.LoadLocation("Europe/Minsk")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Monday 10 am runs lectures until the evening
+		active, next, err := scalingState(scaling, time.Date(2026, 1, 19, 10, 0, 0, 0, minsk))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(active.Name).To(Equal("lectures"))
+		Expect(next).To(BeTemporally("==", time.Date(2026, 1, 19, 20, 0, 0, 0, minsk)))
+
+		// Saturday noon still runs the night schedule of Friday
+		active, next, err = scalingState(scaling, time.Date(2026, 1, 24, 12, 0, 0, 0, minsk))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(active.Name).To(Equal("night"))
+		Expect(next).To(BeTemporally("==", time.Date(2026, 1, 24, 20, 0, 0, 0, minsk)))
+
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "physics", UID: "physics-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Image:   "moodle:4.5.2",
+				HPA:     moodlev1alpha1.HPASpec{Enabled: true, MinReplicas: ptr.To[int32](2), MaxReplicas: 10},
+				Scaling: scaling,
+			},
+			Status: moodlev1alpha1.MoodleTenantStatus{
+				Scaling: &moodlev1alpha1.ScalingStatus{Schedule: "lectures", MinReplicas: 8, MaxReplicas: 20},
+			},
+		}
+		reconciler := &MoodleTenantReconciler{Scheme: k8sClient.Scheme()}
+		Expect(*reconciler.deploymentForMoodle(mt, "tenant-physics").Spec.Replicas).To(Equal(int32(8)))
+		hpa := reconciler.hpaForMoodle(mt, "tenant-physics")
+		Expect(*hpa.Spec.MinReplicas).To(Equal(int32(8)))
+		Expect(hpa.Spec.MaxReplicas).To(Equal(int32(20)))
+		Expect(hpa.Spec.ScaleTargetRef.Name).To(Equal("physics-deployment"))
+
+		// Without the HPA the schedule sets the replicas, which needs shared caches
+		mt.Spec.HPA = moodlev1alpha1.HPASpec{}
+		Expect(*reconciler.deploymentForMoodle(mt, "tenant-physics").Spec.Replicas).To(Equal(int32(8)))
+		Expect(multipleReplicas(mt)).To(BeTrue())
+
+		scaling.Schedules[0].Schedule = "30 7 * *"
+		_, _, err = scalingState(scaling, time.Now())
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,202 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+
+// PHP and nginx read the tenant settings from files of the serverConfigName ConfigMap. The
+// image ships defaults at the same paths, so that it also runs without the operator.
+const (
+	serverConfigIniPath   = "/usr/local/etc/php/conf.d/zz-moodle-operator.ini"
+	serverConfigNginxPath = "/etc/nginx/snippets/moodle-tenant.conf"
+)
+
+// serverConfigName returns the name of the ConfigMap with the PHP and nginx settings
+func serverConfigName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-server-config"
+}
+
+// phpMaxExecutionTime returns the PHP max_execution_time of the tenant in seconds
+func phpMaxExecutionTime(mt *moodlev1alpha1.MoodleTenant) int {
+	if mt.Spec.PHPSettings.MaxExecutionTime != 0 {
+		return mt.Spec.PHPSettings.MaxExecutionTime
+	}
+	return 60
+}
+
+// phpMemoryLimit returns the PHP memory_limit of the tenant
+func phpMemoryLimit(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.PHPSettings.MemoryLimit != "" {
+		return mt.Spec.PHPSettings.MemoryLimit
+	}
+	return "512M"
+}
+
+// phpUploadMaxFilesize returns the PHP upload_max_filesize of the tenant
+func phpUploadMaxFilesize(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Spec.PHPSettings.UploadMaxFilesize != "" {
+		return mt.Spec.PHPSettings.UploadMaxFilesize
+	}
+	return "100M"
+}
+
+// proxyReadTimeout returns how many seconds the proxies in front of PHP wait for a
+// response. It follows max_execution_time unless the Ingress sets its own timeout.
+func proxyReadTimeout(mt *moodlev1alpha1.MoodleTenant) int {
+	if timeout := mt.Spec.Ingress.Proxy.ReadTimeoutSeconds; timeout != nil {
+		return int(*timeout)
+	}
+	return phpMaxExecutionTime(mt)
+}
+
+// phpPostMaxSize returns the PHP post_max_size of the tenant in bytes. The request body
+// holds the other form fields besides the upload, so it is 1M above upload_max_filesize.
+func phpPostMaxSize(mt *moodlev1alpha1.MoodleTenant) int64 {
+	upload := phpUploadMaxFilesize(mt)
+	multiplier := int64(1)
+	switch upload[len(upload)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	}
+	size, _ := strconv.ParseInt(strings.TrimRight(upload, "KMG"), 10, 64)
+	return size*multiplier + 1<<20
+}
+
+// phpIniForMoodle returns the php.ini fragment with the PHP settings of the tenant
+func phpIniForMoodle(mt *moodlev1alpha1.MoodleTenant) string {
+	return fmt.Sprintf(`max_execution_time = %d
+memory_limit = %s
+upload_max_filesize = %s
+post_max_size = %d
+`, phpMaxExecutionTime(mt), phpMemoryLimit(mt), phpUploadMaxFilesize(mt), phpPostMaxSize(mt))
+}
+
+// nginxConfigForMoodle returns the nginx directives of the tenant, included by the server
+// blocks of the image: the limits of requests to PHP and, with a path prefix, the
+// location serving Moodle under it. Requests keep the prefix all the way to PHP, where
+// Moodle expects it in REQUEST_URI and SCRIPT_NAME to match its wwwroot.
+func nginxConfigForMoodle(mt *moodlev1alpha1.MoodleTenant) string {
+	config := fmt.Sprintf(`client_max_body_size %d;
+fastcgi_read_timeout %ds;
+`, phpPostMaxSize(mt), proxyReadTimeout(mt))
+
+	if prefix := mt.Spec.Routing.PathPrefix; prefix != "" {
+		// Redirects are relative, since the Host and port nginx sees are not the public ones
+		config += strings.ReplaceAll(`absolute_redirect off;
+
+location = PREFIX {
+    return 301 PREFIX/$is_args$args;
+}
+
+location ^~ PREFIX/ {
+    alias /var/www/html/public/;
+    index index.php index.html;
+    try_files $uri $uri/ PREFIX/index.php?$query_string;
+
+    location ~ [^/]\.php(/|$) {
+        fastcgi_split_path_info ^PREFIX(.+?\.php)(/.*)?$;
+        set $moodle_path_info $fastcgi_path_info;
+        if (!-f $document_root$fastcgi_script_name) {
+            return 404;
+        }
+        fastcgi_pass 127.0.0.1:9000;
+        fastcgi_index index.php;
+        include fastcgi_params;
+        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;
+        fastcgi_param SCRIPT_NAME PREFIX$fastcgi_script_name;
+        fastcgi_param PATH_INFO $moodle_path_info;
+    }
+}
+`, "PREFIX", prefix)
+	}
+
+	return config
+}
+
+// reconcileServerConfig creates or updates the ConfigMap with the PHP and nginx settings
+func (r *MoodleTenantReconciler) reconcileServerConfig(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	return r.reconcileObject(ctx, mt, r.serverConfigMapForMoodle(mt, namespace), &corev1.ConfigMap{})
+}
+
+// serverConfigMapForMoodle returns the ConfigMap with the PHP and nginx settings
+func (r *MoodleTenantReconciler) serverConfigMapForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      serverConfigName(mt),
+			Namespace: namespace,
+			Labels: map[string]string{
+				"app":                  "moodle",
+				"moodle.bsu.by/tenant": mt.Name,
+			},
+		},
+		Data: map[string]string{
+			"php.ini":    phpIniForMoodle(mt),
+			"nginx.conf": nginxConfigForMoodle(mt),
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, configMap, r.Scheme); err != nil {
+		return nil
+	}
+
+	return configMap
+}
+
+// applyServerConfig mounts the PHP and nginx settings into the Moodle container of the
+// pods. Files mounted by subPath are not updated in running pods, so template is annotated
+// with their checksum to roll the pods when the settings change.
+func applyServerConfig(mt *moodlev1alpha1.MoodleTenant, template *corev1.PodTemplateSpec) {
+	hash := fnv.New32a()
+	hash.Write([]byte(phpIniForMoodle(mt) + nginxConfigForMoodle(mt)))
+	template.Annotations = mergeStringMaps(template.Annotations, map[string]string{
+		"moodle.bsu.by/server-config-hash": strconv.FormatUint(uint64(hash.Sum32()), 16),
+	})
+
+	podSpec := &template.Spec
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts,
+		corev1.VolumeMount{Name: "server-config", MountPath: serverConfigIniPath, SubPath: "php.ini", ReadOnly: true},
+		corev1.VolumeMount{Name: "server-config", MountPath: serverConfigNginxPath, SubPath: "nginx.conf", ReadOnly: true},
+	)
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: "server-config",
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: serverConfigName(mt)},
+			},
+		},
+	})
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/ptr"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Server configuration", func() {
+	var reconciler *MoodleTenantReconciler
+
+	BeforeEach(func() {
+		reconciler = &MoodleTenantReconciler{Client: k8sClient, Scheme: k8sClient.Scheme()}
+	})
+
+	It("should render the limits of the spec for PHP and nginx", func() {
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "biology.bsu.by",
+				PHPSettings: moodlev1alpha1.PHPSettingsSpec{
+					MaxExecutionTime:  120,
+					MemoryLimit:       "1G",
+					UploadMaxFilesize: "512M",
+				},
+			},
+		}
+
+		configMap := reconciler.serverConfigMapForMoodle(mt, "tenant-biology")
+		Expect(configMap.Data["php.ini"]).To(Equal(`max_execution_time = 120
+memory_limit = 1G
+upload_max_filesize = 512M
+post_max_size = 537919488
+`))
+		Expect(configMap.Data["nginx.conf"]).To(Equal(`client_max_body_size 537919488;
+fastcgi_read_timeout 120s;
+`))
+
+		// An Ingress read timeout also applies to nginx in the pod
+		mt.Spec.Ingress.Proxy.ReadTimeoutSeconds = ptr.To[int32](600)
+		Expect(nginxConfigForMoodle(mt)).To(ContainSubstring("fastcgi_read_timeout 600s;"))
+	})
+
+	It("should serve Moodle under the path prefix without stripping it", func() {
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "physics"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "lms.bsu.by",
+				Routing:  moodlev1alpha1.RoutingSpec{PathPrefix: "/physics"},
+			},
+		}
+
+		config := nginxConfigForMoodle(mt)
+		Expect(config).To(ContainSubstring("location ^~ /physics/ {\n    alias /var/www/html/public/;"))
+		Expect(config).To(ContainSubstring("fastcgi_split_path_info ^/physics(.+?\\.php)(/.*)?$;"))
+		Expect(config).To(ContainSubstring("fastcgi_param SCRIPT_NAME /physics$fastcgi_script_name;"))
+
+		ingress := reconciler.ingressForMoodle(mt, "tenant-physics")
+		Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Path).To(Equal("/physics"))
+		Expect(ingress.Annotations).NotTo(HaveKey(nginxAnnotationPrefix + "rewrite-target"))
+
+		mt.Spec.Routing.GatewayRef = &moodlev1alpha1.GatewayRefSpec{Name: "public"}
+		rules, _, _ := unstructured.NestedSlice(reconciler.httpRouteForMoodle(mt, "tenant-physics").Object, "spec", "rules")
+		Expect(rules[0]).NotTo(HaveKey("filters"))
+	})
+
+	It("should mount the limits into the web and cron pods", func() {
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology"},
+			Spec:       moodlev1alpha1.MoodleTenantSpec{Hostname: "biology.bsu.by"},
+		}
+
+		for _, template := range []corev1.PodTemplateSpec{
+			reconciler.deploymentForMoodle(mt, "tenant-biology").Spec.Template,
+			reconciler.cronJobForMoodle(mt, "tenant-biology").Spec.JobTemplate.Spec.Template,
+		} {
+			mounts := map[string]string{}
+			for _, mount := range template.Spec.Containers[0].VolumeMounts {
+				if mount.Name == "server-config" {
+					mounts[mount.MountPath] = mount.SubPath
+				}
+			}
+			Expect(mounts).To(Equal(map[string]string{serverConfigIniPath: "php.ini", serverConfigNginxPath: "nginx.conf"}))
+			Expect(template.Annotations).To(HaveKey("moodle.bsu.by/server-config-hash"))
+		}
+	})
+})
@@ -0,0 +1,157 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"path"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// scratchDir is the mount path of the volume of the storage layout
+const scratchDir = "/var/www/moodlescratch"
+
+// scratchEnv maps the directories of the storage layout to the environment variables
+// config.php sets their $CFG paths from
+var scratchEnv = map[string]string{
+	"temp":  "MOODLE_TEMP_DIR",
+	"cache": "MOODLE_CACHE_DIR",
+	"trash": "MOODLE_TRASH_DIR",
+}
+
+// scratchPVCUsed reports whether the storage layout keeps its directories on a
+// PersistentVolumeClaim
+func scratchPVCUsed(mt *moodlev1alpha1.MoodleTenant) bool {
+	layout := mt.Spec.Storage.Layout
+	return layout != nil && layout.Type != "emptyDir"
+}
+
+// scratchPVCName returns the name of the PersistentVolumeClaim of the storage layout
+func scratchPVCName(mt *moodlev1alpha1.MoodleTenant) string {
+	return mt.Name + "-scratch"
+}
+
+// scratchDirectories returns the directories moved off moodledata
+func scratchDirectories(mt *moodlev1alpha1.MoodleTenant) []string {
+	if len(mt.Spec.Storage.Layout.Directories) > 0 {
+		return mt.Spec.Storage.Layout.Directories
+	}
+	return []string{"temp", "cache", "trash"}
+}
+
+// reconcileScratchPVC creates the PersistentVolumeClaim of the storage layout, or removes
+// it when the layout no longer uses one. Like moodledata it is never updated.
+func (r *MoodleTenantReconciler) reconcileScratchPVC(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if !scratchPVCUsed(mt) {
+		pvc := &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: scratchPVCName(mt), Namespace: namespace}}
+		if err := r.Delete(ctx, pvc); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete scratch PVC", "PVC.Namespace", namespace, "PVC.Name", pvc.Name)
+			return err
+		}
+		return nil
+	}
+
+	pvc := r.scratchPVCForMoodle(mt, namespace)
+	err := r.Get(ctx, types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, &corev1.PersistentVolumeClaim{})
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new PVC", "PVC.Namespace", pvc.Namespace, "PVC.Name", pvc.Name)
+		if err := r.Create(ctx, pvc); err != nil {
+			logger.Error(err, "Failed to create new PVC", "PVC.Namespace", pvc.Namespace, "PVC.Name", pvc.Name)
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get PVC")
+		return err
+	}
+	return nil
+}
+
+// scratchPVCForMoodle returns the PersistentVolumeClaim of the storage layout. All
+// replicas share it, as Moodle expects of the temp, cache and trash directories.
+func (r *MoodleTenantReconciler) scratchPVCForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *corev1.PersistentVolumeClaim {
+	layout := mt.Spec.Storage.Layout
+
+	storageClass := "csi-cephfs-sc"
+	switch {
+	case layout.StorageClass != "":
+		storageClass = layout.StorageClass
+	case mt.Spec.Storage.StorageClass != "":
+		storageClass = mt.Spec.Storage.StorageClass
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      scratchPVCName(mt),
+			Namespace: namespace,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				storageClassAccessMode(storageClass),
+			},
+			StorageClassName: &storageClass,
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: *layout.Size,
+				},
+			},
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, pvc, r.Scheme); err != nil {
+		return nil
+	}
+
+	return pvc
+}
+
+// applyStorageLayout mounts the volume of the storage layout into the Moodle container,
+// the first container of podSpec, and points config.php at its directories
+func applyStorageLayout(mt *moodlev1alpha1.MoodleTenant, podSpec *corev1.PodSpec) {
+	layout := mt.Spec.Storage.Layout
+	if layout == nil {
+		return
+	}
+
+	volume := corev1.Volume{Name: "moodle-scratch"}
+	if scratchPVCUsed(mt) {
+		volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{ClaimName: scratchPVCName(mt)}
+	} else {
+		volume.EmptyDir = &corev1.EmptyDirVolumeSource{SizeLimit: layout.Size}
+	}
+	podSpec.Volumes = append(podSpec.Volumes, volume)
+
+	container := &podSpec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "moodle-scratch",
+		MountPath: scratchDir,
+	})
+	for _, directory := range scratchDirectories(mt) {
+		container.Env = append(container.Env, corev1.EnvVar{Name: scratchEnv[directory], Value: path.Join(scratchDir, directory)})
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodletenantclasses,verbs=get;list;watch
+
+// classPreset returns the preset of a class for a tenant field left unset, i.e. at its
+// zero value or the default of the MoodleTenant schema
+func classPreset[T comparable](value, schemaDefault, preset T) T {
+	var zero T
+	if preset != zero && (value == zero || value == schemaDefault) {
+		return preset
+	}
+	return value
+}
+
+// classPresetPtr is classPreset for optional fields
+func classPresetPtr[T comparable](value *T, schemaDefault T, preset *T) *T {
+	if preset != nil && (value == nil || *value == schemaDefault) {
+		return preset
+	}
+	return value
+}
+
+// classResourceList adds the resources of a preset missing from a list
+func classResourceList(list, preset corev1.ResourceList) corev1.ResourceList {
+	for name, quantity := range preset {
+		if _, ok := list[name]; ok {
+			continue
+		}
+		if list == nil {
+			list = corev1.ResourceList{}
+		}
+		list[name] = quantity
+	}
+	return list
+}
+
+// applyTenantClass fills in the fields of a tenant spec left unset with the presets of
+// its class. Resources are filled in one by one, so that a tenant can e.g. raise only
+// its memory limit. Pointer fields are only taken from the class when the tenant has
+// none.
+func applyTenantClass(spec *moodlev1alpha1.MoodleTenantSpec, class *moodlev1alpha1.MoodleTenantClassSpec) {
+	class = class.DeepCopy()
+
+	if preset := class.Resources; preset != nil {
+		spec.Resources.Requests = classResourceList(spec.Resources.Requests, preset.Requests)
+		spec.Resources.Limits = classResourceList(spec.Resources.Limits, preset.Limits)
+	}
+
+	if preset := class.HPA; preset != nil {
+		hpa := &spec.HPA
+		hpa.Enabled = classPreset(hpa.Enabled, false, preset.Enabled)
+		hpa.MinReplicas = classPresetPtr(hpa.MinReplicas, 2, preset.MinReplicas)
+		hpa.MaxReplicas = classPreset(hpa.MaxReplicas, 10, preset.MaxReplicas)
+		hpa.TargetCPU = classPresetPtr(hpa.TargetCPU, 75, preset.TargetCPU)
+	}
+
+	if preset := class.PHPSettings; preset != nil {
+		php := &spec.PHPSettings
+		php.MaxExecutionTime = classPreset(php.MaxExecutionTime, 60, preset.MaxExecutionTime)
+		php.MemoryLimit = classPreset(php.MemoryLimit, "512M", preset.MemoryLimit)
+		php.UploadMaxFilesize = classPreset(php.UploadMaxFilesize, "100M", preset.UploadMaxFilesize)
+	}
+
+	if preset := class.Memcached; preset != nil {
+		memcached := &spec.Memcached
+		memcached.MemoryMB = classPreset(memcached.MemoryMB, 128, preset.MemoryMB)
+		memcached.Image = classPreset(memcached.Image, "", preset.Image)
+		memcached.Mode = classPreset(memcached.Mode, "sidecar", preset.Mode)
+		memcached.Replicas = classPreset(memcached.Replicas, 2, preset.Replicas)
+		if memcached.Resources == nil {
+			memcached.Resources = preset.Resources
+		}
+		if memcached.Auth == nil {
+			memcached.Auth = preset.Auth
+		}
+	}
+
+	if preset := class.Cache; preset != nil {
+		cache := &spec.Cache
+		cache.Type = classPreset(cache.Type, "memcached", preset.Type)
+		cache.Sessions = classPreset(cache.Sessions, "auto", preset.Sessions)
+		cache.MUC = classPreset(cache.MUC, "managed", preset.MUC)
+		if cache.Redis == nil {
+			cache.Redis = preset.Redis
+		}
+		if cache.ClusterRef == nil {
+			cache.ClusterRef = preset.ClusterRef
+		}
+		if cache.Exporter == nil {
+			cache.Exporter = preset.Exporter
+		}
+	}
+
+	spec.Storage.StorageClass = classPreset(spec.Storage.StorageClass, "csi-cephfs-sc", class.StorageClass)
+}
+
+// withTenantClass applies the MoodleTenantClass of classRef to the spec of a tenant in
+// memory. The tenant must not be updated afterwards, or the presets would be written
+// into its spec. A missing class is returned as a NotFound error.
+func withTenantClass(ctx context.Context, c client.Reader, mt *moodlev1alpha1.MoodleTenant) error {
+	ref := mt.Spec.ClassRef
+	if ref == nil {
+		return nil
+	}
+	class := &moodlev1alpha1.MoodleTenantClass{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ref.Name}, class); err != nil {
+		return err
+	}
+	applyTenantClass(&mt.Spec, &class.Spec)
+	return nil
+}
+
+// resolveTenantClass applies the class of a tenant and reports it in the ClassResolved
+// condition. It returns false while the class is missing.
+func (r *MoodleTenantReconciler) resolveTenantClass(ctx context.Context, mt *moodlev1alpha1.MoodleTenant) (bool, error) {
+	if mt.Spec.ClassRef == nil {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionClassResolved)
+		return true, nil
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionClassResolved,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Resolved",
+		Message:            fmt.Sprintf("Unset fields are taken from MoodleTenantClass %s", mt.Spec.ClassRef.Name),
+		ObservedGeneration: mt.Generation,
+	}
+	err := withTenantClass(ctx, r.Client, mt)
+	switch {
+	case errors.IsNotFound(err):
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NotFound"
+		condition.Message = fmt.Sprintf("MoodleTenantClass %s not found", mt.Spec.ClassRef.Name)
+	case err != nil:
+		log.FromContext(ctx).Error(err, "Failed to get MoodleTenantClass")
+		return false, err
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	return err == nil, nil
+}
+
+// tenantsForClass maps a MoodleTenantClass to the MoodleTenants referencing it
+func (r *MoodleTenantReconciler) tenantsForClass(ctx context.Context, obj client.Object) []reconcile.Request {
+	tenants := &moodlev1alpha1.MoodleTenantList{}
+	if err := r.List(ctx, tenants); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MoodleTenants")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, mt := range tenants.Items {
+		if ref := mt.Spec.ClassRef; ref != nil && ref.Name == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: mt.Name, Namespace: mt.Namespace}})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Tenant class", func() {
+	It("should fill in the fields the tenant leaves unset", func() {
+		ctx := context.Background()
+
+		class := &moodlev1alpha1.MoodleTenantClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "large"},
+			Spec: moodlev1alpha1.MoodleTenantClassSpec{
+				Resources: &corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("2Gi")},
+					Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("2Gi")},
+				},
+				HPA:          &moodlev1alpha1.HPASpec{Enabled: true, MinReplicas: ptr.To[int32](3), MaxReplicas: 20},
+				PHPSettings:  &moodlev1alpha1.PHPSettingsSpec{MemoryLimit: "1G"},
+				StorageClass: "ceph-ssd",
+			},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).WithObjects(class).Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "biology"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				ClassRef: &corev1.LocalObjectReference{Name: "large"},
+				Hostname: "biology.bsu.by",
+				Image:    "moodle:4.5",
+				Resources: corev1.ResourceRequirements{
+					Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("4Gi")},
+				},
+				// As defaulted by the MoodleTenant schema
+				HPA:         moodlev1alpha1.HPASpec{MinReplicas: ptr.To[int32](2), MaxReplicas: 10, TargetCPU: ptr.To[int32](75)},
+				PHPSettings: moodlev1alpha1.PHPSettingsSpec{MaxExecutionTime: 120, MemoryLimit: "512M"},
+				Storage:     moodlev1alpha1.StorageSpec{Size: resource.MustParse("10Gi"), StorageClass: "csi-cephfs-sc"},
+			},
+		}
+
+		resolved, err := reconciler.resolveTenantClass(ctx, mt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionClassResolved)).To(BeTrue())
+		Expect(mt.Spec.Resources.Requests.Cpu().String()).To(Equal("1"))
+		Expect(mt.Spec.Resources.Limits.Memory().String()).To(Equal("4Gi"))
+		Expect(mt.Spec.HPA.Enabled).To(BeTrue())
+		Expect(*mt.Spec.HPA.MinReplicas).To(Equal(int32(3)))
+		Expect(mt.Spec.HPA.MaxReplicas).To(Equal(int32(20)))
+		Expect(*mt.Spec.HPA.TargetCPU).To(Equal(int32(75)))
+		Expect(mt.Spec.PHPSettings.MemoryLimit).To(Equal("1G"))
+		Expect(mt.Spec.PHPSettings.MaxExecutionTime).To(Equal(120))
+		Expect(mt.Spec.Storage.StorageClass).To(Equal("ceph-ssd"))
+
+		By("holding the tenant back while its class is missing")
+		mt.Spec.ClassRef.Name = "huge"
+		resolved, err = reconciler.resolveTenantClass(ctx, mt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(BeFalse())
+		Expect(meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionClassResolved).Reason).To(Equal("NotFound"))
+	})
+})
@@ -0,0 +1,197 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// upgradeScript puts the site into maintenance mode, upgrades the database schema and
+// ends maintenance mode. A failed upgrade leaves the site in maintenance mode.
+const upgradeScript = `set -e
+php /var/www/html/admin/cli/maintenance.php --enable
+php /var/www/html/admin/cli/upgrade.php --non-interactive
+php /var/www/html/admin/cli/maintenance.php --disable
+`
+
+// moodleImage returns the image the Moodle workloads run: spec.image once its upgrade
+// has succeeded, the previously upgraded image while it is pending
+func moodleImage(mt *moodlev1alpha1.MoodleTenant) string {
+	if mt.Status.UpgradedImage != "" {
+		return mt.Status.UpgradedImage
+	}
+	return mt.Spec.Image
+}
+
+// reconcileUpgrade runs the upgrade Job when spec.image changes and moves the workloads
+// to the new image once it succeeds. A failed upgrade blocks the rollout and sets the
+// Degraded condition until spec.image is changed again.
+func (r *MoodleTenantReconciler) reconcileUpgrade(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	// The first image is installed rather than upgraded
+	if mt.Status.UpgradedImage == "" {
+		mt.Status.UpgradedImage = mt.Spec.Image
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Upgraded",
+		Message:            fmt.Sprintf("Running %s", mt.Status.UpgradedImage),
+		ObservedGeneration: mt.Generation,
+	}
+	// A rolled back image is not upgraded to again
+	if rollbackStarted(mt) {
+		return r.reconcileRollback(ctx, mt, namespace, condition)
+	}
+	if mt.Status.UpgradedImage == mt.Spec.Image {
+		if mt.Status.UpgradeRolloutDeadline != nil {
+			return r.reconcileUpgradeRollout(ctx, mt, namespace, condition)
+		}
+		meta.SetStatusCondition(&mt.Status.Conditions, condition)
+		return nil
+	}
+
+	job, err := r.upgradeJobForMoodle(mt, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to build the upgrade Job: %w", err)
+	}
+
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		// Upgrades skipping a required intermediate version would break the database
+		violation, err := r.upgradePathAllowed(ctx, mt)
+		if err != nil {
+			return err
+		}
+		if violation != "" {
+			condition.Status = metav1.ConditionTrue
+			condition.Reason = "UnsupportedUpgradePath"
+			condition.Message = violation + "; the upgrade is blocked until spec.image or the MoodleVersionCatalog is changed"
+			meta.SetStatusCondition(&mt.Status.Conditions, condition)
+			return nil
+		}
+
+		// The upgrade restarts the site, only in the maintenance window
+		if !maintenanceAllowed(mt) {
+			condition.Reason = "WaitingForMaintenanceWindow"
+			condition.Message = fmt.Sprintf("The upgrade to %s waits for the maintenance window", mt.Spec.Image)
+			meta.SetStatusCondition(&mt.Status.Conditions, condition)
+			return nil
+		}
+
+		// Cron is suspended for the upgrade, which waits for the runs already started
+		running, err := r.cronRunning(ctx, mt, namespace)
+		if err != nil {
+			return err
+		}
+		if running {
+			condition.Reason = "WaitingForCron"
+			condition.Message = fmt.Sprintf("Waiting for cron to stop before the upgrade to %s", mt.Spec.Image)
+			meta.SetStatusCondition(&mt.Status.Conditions, condition)
+			return nil
+		}
+
+		// A failed upgrade is recovered from the backups taken before it
+		backedUp, err := r.reconcileUpgradeBackup(ctx, mt, namespace, &condition)
+		if err != nil {
+			return err
+		}
+		if !backedUp {
+			meta.SetStatusCondition(&mt.Status.Conditions, condition)
+			return nil
+		}
+
+		logger.Info("Creating a new upgrade Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name, "Image", mt.Spec.Image)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new upgrade Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return err
+		}
+		found = job
+	} else if err != nil {
+		logger.Error(err, "Failed to get upgrade Job")
+		return err
+	}
+
+	switch {
+	case found.Status.Succeeded > 0:
+		logger.Info("Upgrade succeeded, rolling out", "Image", mt.Spec.Image)
+		mt.Status.UpgradedImage = mt.Spec.Image
+		condition.Message = fmt.Sprintf("Running %s", mt.Status.UpgradedImage)
+		// The upgrade lifted the maintenance mode, spec.maintenanceMode enables it again
+		if mt.Spec.MaintenanceMode != nil {
+			mt.Status.MaintenanceMode = nil
+		}
+		if rollbackPossible(mt) {
+			timeout := mt.Spec.Upgrade.Rollback.RolloutTimeoutSeconds
+			if timeout == 0 {
+				timeout = 600
+			}
+			mt.Status.UpgradeRolloutDeadline = ptr.To(metav1.NewTime(time.Now().Add(time.Duration(timeout) * time.Second)))
+			return r.reconcileUpgradeRollout(ctx, mt, namespace, condition)
+		}
+	case jobFailed(found) && rollbackPossible(mt):
+		r.startRollback(mt, "UpgradeFailed", fmt.Sprintf("Upgrade Job %s to %s failed", found.Name, mt.Spec.Image))
+		return r.reconcileRollback(ctx, mt, namespace, condition)
+	case jobFailed(found):
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "UpgradeFailed"
+		condition.Message = fmt.Sprintf("Upgrade Job %s to %s failed, the rollout is blocked; see its logs", found.Name, mt.Spec.Image)
+	default:
+		condition.Reason = "Upgrading"
+		condition.Message = fmt.Sprintf("Upgrade Job %s to %s is running", found.Name, mt.Spec.Image)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	return nil
+}
+
+// upgradeJobForMoodle returns the upgrade Job for spec.image. It runs the Moodle container
+// of the Deployment, with its database settings and moodledata, on the new image.
+func (r *MoodleTenantReconciler) upgradeJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) (*batchv1.Job, error) {
+	// Each image gets its own Job, so a failed upgrade is retried by changing the image
+	hash := fnv.New32a()
+	hash.Write([]byte(mt.Spec.Image))
+	name := fmt.Sprintf("%s-upgrade-%08x", mt.Name, hash.Sum32())
+
+	job, err := r.cliJobForMoodle(mt, namespace, name, "upgrade", []string{"sh", "-c", upgradeScript})
+	if err != nil {
+		return nil, err
+	}
+	job.Spec.Template.Spec.Containers[0].Image = mt.Spec.Image
+	job.Spec.BackoffLimit = ptr.To[int32](0)
+	job.Annotations = map[string]string{
+		"moodle.bsu.by/image": mt.Spec.Image,
+	}
+
+	return job, nil
+}
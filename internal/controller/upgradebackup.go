@@ -0,0 +1,207 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create
+
+// volumeSnapshotGVK is the CSI VolumeSnapshot, which is not part of the operator's scheme
+var volumeSnapshotGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+
+// upgradeBackupName returns the name of the backups taken before the upgrade to
+// spec.image. Each image gets its own backups.
+func upgradeBackupName(mt *moodlev1alpha1.MoodleTenant) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(mt.Spec.Image))
+	return fmt.Sprintf("%s-pre-upgrade-%08x", mt.Name, hash.Sum32())
+}
+
+// reconcileUpgradeBackup takes the backups of spec.upgrade before the upgrade to
+// spec.image and records them in the status. It reports whether they are complete, and
+// otherwise sets the reason of condition to BackingUp, or to BackupFailed with condition
+// True when one failed. The backups are not owned by the MoodleTenant, so that they
+// outlive it.
+func (r *MoodleTenantReconciler) reconcileUpgradeBackup(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string, condition *metav1.Condition) (bool, error) {
+	upgrade := mt.Spec.Upgrade
+	if upgrade.Snapshot == nil && upgrade.Dump == nil {
+		return true, nil
+	}
+
+	name := upgradeBackupName(mt)
+	backup := mt.Status.UpgradeBackup
+	if backup == nil || backup.Image != mt.Spec.Image {
+		backup = &moodlev1alpha1.UpgradeBackupStatus{Image: mt.Spec.Image, FromImage: mt.Status.UpgradedImage}
+		mt.Status.UpgradeBackup = backup
+	}
+
+	pending := []string{}
+	if upgrade.Snapshot != nil {
+		backup.VolumeSnapshot = name
+		done, failure, err := r.reconcileUpgradeSnapshot(ctx, mt, namespace, name)
+		if err != nil {
+			return false, err
+		}
+		if failure != "" {
+			upgradeBackupFailed(mt, condition, fmt.Sprintf("VolumeSnapshot %s of moodledata failed: %s", name, failure))
+			return false, nil
+		}
+		if !done {
+			pending = append(pending, "VolumeSnapshot "+name)
+		}
+	}
+	if upgrade.Dump != nil {
+		backup.DatabaseDump = name
+		done, failure, err := r.reconcileTenantDump(ctx, mt, name, *upgrade.Dump)
+		if err != nil {
+			return false, err
+		}
+		if failure != "" {
+			upgradeBackupFailed(mt, condition, fmt.Sprintf("MoodleDatabaseDump %s failed: %s", name, failure))
+			return false, nil
+		}
+		if !done {
+			pending = append(pending, "MoodleDatabaseDump "+name)
+		}
+	}
+
+	if len(pending) > 0 {
+		condition.Reason = "BackingUp"
+		condition.Message = fmt.Sprintf("Waiting for %v before the upgrade to %s", pending, mt.Spec.Image)
+		return false, nil
+	}
+	return true, nil
+}
+
+// upgradeBackupFailed blocks the upgrade after a failed backup
+func upgradeBackupFailed(mt *moodlev1alpha1.MoodleTenant, condition *metav1.Condition, message string) {
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = "BackupFailed"
+	condition.Message = fmt.Sprintf("%s; the upgrade to %s is blocked until spec.image is changed again", message, mt.Spec.Image)
+}
+
+// reconcileUpgradeSnapshot takes the VolumeSnapshot of moodledata and reports whether it
+// is ready to use, or why it failed
+func (r *MoodleTenantReconciler) reconcileUpgradeSnapshot(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace, name string) (bool, string, error) {
+	logger := log.FromContext(ctx)
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, snapshot)
+	if meta.IsNoMatchError(err) {
+		return false, "the VolumeSnapshot CRD is not installed", nil
+	}
+	if err != nil && errors.IsNotFound(err) {
+		snapshot = upgradeSnapshotForMoodle(mt, namespace, name)
+		logger.Info("Creating a new VolumeSnapshot", "VolumeSnapshot.Namespace", namespace, "VolumeSnapshot.Name", name)
+		if err := r.Create(ctx, snapshot); err != nil {
+			logger.Error(err, "Failed to create new VolumeSnapshot", "VolumeSnapshot.Namespace", namespace, "VolumeSnapshot.Name", name)
+			return false, "", err
+		}
+		return false, "", nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get VolumeSnapshot")
+		return false, "", err
+	}
+
+	if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+		return false, message, nil
+	}
+	ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+	return ready, "", nil
+}
+
+// upgradeSnapshotForMoodle returns the VolumeSnapshot of moodledata. It is
+// crash-consistent: the web pods keep running while it is taken, cron is suspended.
+func upgradeSnapshotForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace, name string) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": mt.Name + "-data",
+		},
+	}
+	if class := mt.Spec.Upgrade.Snapshot.VolumeSnapshotClassName; class != "" {
+		spec["volumeSnapshotClassName"] = class
+	}
+
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	snapshot.SetGroupVersionKind(volumeSnapshotGVK)
+	snapshot.SetName(name)
+	snapshot.SetNamespace(namespace)
+	snapshot.SetLabels(map[string]string{
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+	snapshot.SetAnnotations(map[string]string{
+		"moodle.bsu.by/image": mt.Status.UpgradedImage,
+	})
+	return snapshot
+}
+
+// reconcileTenantDump creates the MoodleDatabaseDump of the database to destination and
+// reports whether it succeeded, or why it failed
+func (r *MoodleTenantReconciler) reconcileTenantDump(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, name string, destination moodlev1alpha1.DumpDestinationSpec) (bool, string, error) {
+	logger := log.FromContext(ctx)
+
+	dump := &moodlev1alpha1.MoodleDatabaseDump{}
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: mt.Namespace}, dump)
+	if err != nil && errors.IsNotFound(err) {
+		dump = &moodlev1alpha1.MoodleDatabaseDump{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: mt.Namespace,
+				Labels: map[string]string{
+					"moodle.bsu.by/tenant": mt.Name,
+				},
+			},
+			Spec: moodlev1alpha1.MoodleDatabaseDumpSpec{
+				TenantRef:   corev1.LocalObjectReference{Name: mt.Name},
+				Destination: destination,
+			},
+		}
+		logger.Info("Creating a new MoodleDatabaseDump", "MoodleDatabaseDump.Namespace", dump.Namespace, "MoodleDatabaseDump.Name", name)
+		if err := r.Create(ctx, dump); err != nil {
+			logger.Error(err, "Failed to create new MoodleDatabaseDump", "MoodleDatabaseDump.Namespace", dump.Namespace, "MoodleDatabaseDump.Name", name)
+			return false, "", err
+		}
+		return false, "", nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get MoodleDatabaseDump")
+		return false, "", err
+	}
+
+	switch dump.Status.Phase {
+	case moodlev1alpha1.DumpPhaseSucceeded:
+		return true, "", nil
+	case moodlev1alpha1.DumpPhaseFailed:
+		return false, "see the logs of its Job", nil
+	}
+	return false, "", nil
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// urlRewriteScript replaces the previous wwwroot with the new one in the database
+// content, e.g. links in course pages, and purges the caches holding the old one
+const urlRewriteScript = `set -e
+php /var/www/html/admin/tool/replace/cli/replace.php --search="$OLD_URL" --replace="$NEW_URL" --non-interactive
+php /var/www/html/admin/cli/purge_caches.php
+`
+
+// urlRewriteJobName returns the name of the Job rewriting the content to url. Each URL
+// gets its own Job, so that a failed rewrite is not repeated until it is deleted.
+func urlRewriteJobName(mt *moodlev1alpha1.MoodleTenant, url string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(url))
+	return fmt.Sprintf("%s-url-rewrite-%08x", mt.Name, hash.Sum32())
+}
+
+// reconcileURLRewrite rewrites the URLs embedded in the database content when the
+// wwwroot changes. The Ingress, certificate and Moodle pods follow spec.hostname on
+// their own; status.url records the wwwroot the content refers to.
+func (r *MoodleTenantReconciler) reconcileURLRewrite(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	url := moodleURL(mt)
+	// A new site, or one from before the URL was recorded, refers to its current wwwroot
+	if mt.Status.URL == "" {
+		mt.Status.URL = url
+	}
+	if mt.Status.URL == url {
+		return nil
+	}
+
+	job, err := r.urlRewriteJobForMoodle(mt, namespace, mt.Status.URL, url)
+	if err != nil {
+		return fmt.Errorf("failed to build the URL rewrite Job: %w", err)
+	}
+
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating a new URL rewrite Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name, "From", mt.Status.URL, "To", url)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new URL rewrite Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return err
+		}
+		found = job
+	} else if err != nil {
+		logger.Error(err, "Failed to get URL rewrite Job")
+		return err
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionURLRewritten,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Rewriting",
+		Message:            fmt.Sprintf("Job %s is replacing %s with %s in the database", found.Name, mt.Status.URL, url),
+		ObservedGeneration: mt.Generation,
+	}
+	switch {
+	case found.Status.Succeeded > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Rewritten"
+		condition.Message = fmt.Sprintf("Replaced %s with %s in the database", mt.Status.URL, url)
+		mt.Status.URL = url
+	case jobFailed(found):
+		// The failed Job is kept for its logs; deleting it retries the rewrite
+		condition.Reason = "RewriteFailed"
+		condition.Message = fmt.Sprintf("Job %s failed to replace %s with %s, see its logs and delete it to retry", found.Name, mt.Status.URL, url)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+	return nil
+}
+
+// urlRewriteJobForMoodle returns the Job rewriting the content from one wwwroot to
+// another. Like the upgrade Job it runs the Moodle container of the Deployment.
+func (r *MoodleTenantReconciler) urlRewriteJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace, from, to string) (*batchv1.Job, error) {
+	job, err := r.cliJobForMoodle(mt, namespace, urlRewriteJobName(mt, to), "url-rewrite", []string{"sh", "-c", urlRewriteScript})
+	if err != nil {
+		return nil, err
+	}
+	container := &job.Spec.Template.Spec.Containers[0]
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "OLD_URL", Value: from},
+		corev1.EnvVar{Name: "NEW_URL", Value: to},
+	)
+
+	return job, nil
+}
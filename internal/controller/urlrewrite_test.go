@@ -0,0 +1,78 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("URL rewrite", func() {
+	It("should rewrite the content when the hostname changes", func() {
+		ctx := context.Background()
+
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "renamed", UID: "renamed-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "old.bsu.by",
+				Image:    "moodle:4.5",
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Host:        "postgres-cluster.db-tier.svc",
+					AdminSecret: "renamed-db",
+				},
+			},
+		}
+
+		By("recording the wwwroot of a new site")
+		Expect(reconciler.reconcileURLRewrite(ctx, mt, "tenant-renamed")).To(Succeed())
+		Expect(mt.Status.URL).To(Equal("https://old.bsu.by"))
+		jobs := &batchv1.JobList{}
+		Expect(c.List(ctx, jobs)).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+
+		By("running replace.php once the hostname changes")
+		mt.Spec.Hostname = "new.bsu.by"
+		Expect(reconciler.reconcileURLRewrite(ctx, mt, "tenant-renamed")).To(Succeed())
+		Expect(mt.Status.URL).To(Equal("https://old.bsu.by"))
+		Expect(meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionURLRewritten).Reason).To(Equal("Rewriting"))
+		job := &batchv1.Job{}
+		name := urlRewriteJobName(mt, "https://new.bsu.by")
+		Expect(c.Get(ctx, types.NamespacedName{Name: name, Namespace: "tenant-renamed"}, job)).To(Succeed())
+		env := job.Spec.Template.Spec.Containers[0].Env
+		Expect(env).To(ContainElement(corev1.EnvVar{Name: "OLD_URL", Value: "https://old.bsu.by"}))
+		Expect(env).To(ContainElement(corev1.EnvVar{Name: "NEW_URL", Value: "https://new.bsu.by"}))
+
+		By("recording the new wwwroot once the rewrite is done")
+		job.Status.Succeeded = 1
+		Expect(c.Status().Update(ctx, job)).To(Succeed())
+		Expect(reconciler.reconcileURLRewrite(ctx, mt, "tenant-renamed")).To(Succeed())
+		Expect(mt.Status.URL).To(Equal("https://new.bsu.by"))
+		Expect(meta.IsStatusConditionTrue(mt.Status.Conditions, moodlev1alpha1.ConditionURLRewritten)).To(BeTrue())
+	})
+})
@@ -0,0 +1,148 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=moodle.bsu.by,resources=moodleversioncatalogs,verbs=get;list;watch
+
+// parseMoodleVersion returns the numbers of a version like 4.1 or 4.1.2
+func parseMoodleVersion(version string) []int {
+	numbers := []int{}
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+// compareMoodleVersions compares two versions as far as both are given, so that 4.1
+// is neither older nor newer than 4.1.2
+func compareMoodleVersions(a, b string) int {
+	x, y := parseMoodleVersion(a), parseMoodleVersion(b)
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if x[i] != y[i] {
+			if x[i] < y[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// catalogVersion returns the version of the catalog running image, if any
+func catalogVersion(versions []moodlev1alpha1.MoodleVersion, image string) *moodlev1alpha1.MoodleVersion {
+	for i := range versions {
+		for _, pattern := range versions[i].Images {
+			if matched, _ := path.Match(pattern, image); matched {
+				return &versions[i]
+			}
+		}
+	}
+	return nil
+}
+
+// upgradePathViolation returns why the catalog does not allow upgrading from one image
+// to another, or "" when it does or does not know either image
+func upgradePathViolation(versions []moodlev1alpha1.MoodleVersion, fromImage, toImage string) string {
+	from, to := catalogVersion(versions, fromImage), catalogVersion(versions, toImage)
+	if from == nil || to == nil {
+		return ""
+	}
+	if compareMoodleVersions(to.Version, from.Version) < 0 {
+		return fmt.Sprintf("%s runs Moodle %s, older than the %s of %s; Moodle cannot be downgraded", toImage, to.Version, from.Version, fromImage)
+	}
+	if to.MinUpgradeFrom == "" || compareMoodleVersions(from.Version, to.MinUpgradeFrom) >= 0 {
+		return ""
+	}
+
+	message := fmt.Sprintf("Moodle %s of %s cannot be upgraded to %s of %s, which requires at least %s", from.Version, fromImage, to.Version, toImage, to.MinUpgradeFrom)
+	// The newest version in between that can be upgraded to directly is the next step
+	var next *moodlev1alpha1.MoodleVersion
+	for i := range versions {
+		v := &versions[i]
+		if compareMoodleVersions(v.Version, from.Version) <= 0 || compareMoodleVersions(v.Version, to.Version) >= 0 {
+			continue
+		}
+		if v.MinUpgradeFrom != "" && compareMoodleVersions(from.Version, v.MinUpgradeFrom) < 0 {
+			continue
+		}
+		if next == nil || compareMoodleVersions(v.Version, next.Version) > 0 {
+			next = v
+		}
+	}
+	if next != nil {
+		message += fmt.Sprintf("; upgrade to Moodle %s first", next.Version)
+	}
+	return message
+}
+
+// upgradePathAllowed checks the upgrade to spec.image against the MoodleVersionCatalogs
+// and returns why it is not allowed, or ""
+func (r *MoodleTenantReconciler) upgradePathAllowed(ctx context.Context, mt *moodlev1alpha1.MoodleTenant) (string, error) {
+	catalogs := &moodlev1alpha1.MoodleVersionCatalogList{}
+	if err := r.List(ctx, catalogs); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MoodleVersionCatalogs")
+		return "", err
+	}
+	versions := []moodlev1alpha1.MoodleVersion{}
+	for _, catalog := range catalogs.Items {
+		versions = append(versions, catalog.Spec.Versions...)
+	}
+	return upgradePathViolation(versions, mt.Status.UpgradedImage, mt.Spec.Image), nil
+}
+
+// upgradeRefused reports whether the upgrade to spec.image is refused by the catalog
+func upgradeRefused(mt *moodlev1alpha1.MoodleTenant) bool {
+	degraded := meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionDegraded)
+	return degraded != nil && degraded.Reason == "UnsupportedUpgradePath"
+}
+
+// tenantsForVersionCatalog maps a MoodleVersionCatalog to the tenants with a pending
+// upgrade, which it may allow or refuse
+func (r *MoodleTenantReconciler) tenantsForVersionCatalog(ctx context.Context, _ client.Object) []reconcile.Request {
+	tenants := &moodlev1alpha1.MoodleTenantList{}
+	if err := r.List(ctx, tenants); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list MoodleTenants")
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, mt := range tenants.Items {
+		if mt.Status.UpgradedImage != "" && mt.Status.UpgradedImage != mt.Spec.Image {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: mt.Name, Namespace: mt.Namespace}})
+		}
+	}
+	return requests
+}
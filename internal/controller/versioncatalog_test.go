@@ -0,0 +1,85 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+var _ = Describe("Moodle version catalog", func() {
+	versions := []moodlev1alpha1.MoodleVersion{
+		{Version: "3.9", Images: []string{"moodle:3.9*"}},
+		{Version: "3.11", Images: []string{"moodle:3.11*"}, MinUpgradeFrom: "3.6.0"},
+		{Version: "4.1", Images: []string{"moodle:4.1*"}, MinUpgradeFrom: "3.9.0"},
+		{Version: "4.3", Images: []string{"moodle:4.3*"}, MinUpgradeFrom: "3.11.8"},
+	}
+
+	It("should allow supported upgrades and images it does not know", func() {
+		Expect(upgradePathViolation(versions, "moodle:3.9.20", "moodle:4.1.3")).To(BeEmpty())
+		Expect(upgradePathViolation(versions, "moodle:3.11.18", "moodle:4.3.0")).To(BeEmpty())
+		Expect(upgradePathViolation(versions, "moodle:3.9.20", "custom:latest")).To(BeEmpty())
+	})
+
+	It("should refuse skipped versions and downgrades", func() {
+		Expect(upgradePathViolation(versions, "moodle:3.9.20", "moodle:4.3.0")).To(
+			ContainSubstring("requires at least 3.11.8; upgrade to Moodle 4.1 first"))
+		Expect(upgradePathViolation(versions, "moodle:4.1.3", "moodle:3.11.18")).To(ContainSubstring("cannot be downgraded"))
+	})
+
+	It("should block the upgrade Job", func() {
+		ctx := context.Background()
+
+		catalog := &moodlev1alpha1.MoodleVersionCatalog{
+			ObjectMeta: metav1.ObjectMeta{Name: "moodle"},
+			Spec:       moodlev1alpha1.MoodleVersionCatalogSpec{Versions: versions},
+		}
+		c := fake.NewClientBuilder().WithScheme(k8sClient.Scheme()).WithObjects(catalog).Build()
+		reconciler := &MoodleTenantReconciler{Client: c, Scheme: c.Scheme()}
+		mt := &moodlev1alpha1.MoodleTenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "physics", UID: "physics-uid"},
+			Spec: moodlev1alpha1.MoodleTenantSpec{
+				Hostname: "physics.bsu.by",
+				Image:    "moodle:4.3.0",
+				DatabaseRef: moodlev1alpha1.DatabaseRefSpec{
+					Host:        "postgres-cluster.db-tier.svc",
+					AdminSecret: "physics-db",
+				},
+			},
+			Status: moodlev1alpha1.MoodleTenantStatus{UpgradedImage: "moodle:3.9.20"},
+		}
+
+		Expect(reconciler.reconcileUpgrade(ctx, mt, "tenant-physics")).To(Succeed())
+		degraded := meta.FindStatusCondition(mt.Status.Conditions, moodlev1alpha1.ConditionDegraded)
+		Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+		Expect(degraded.Reason).To(Equal("UnsupportedUpgradePath"))
+		Expect(cronSuspendedReason(mt)).To(BeEmpty())
+
+		jobs := &batchv1.JobList{}
+		Expect(c.List(ctx, jobs, client.InNamespace("tenant-physics"))).To(Succeed())
+		Expect(jobs.Items).To(BeEmpty())
+	})
+})
@@ -0,0 +1,148 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// reconcileCacheWarmup runs the cache warm-up Job once the Deployment has rolled out the
+// running image, and reports its outcome in the CachesWarmed condition. Each image and
+// trigger is warmed up once.
+func (r *MoodleTenantReconciler) reconcileCacheWarmup(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	if mt.Spec.CacheWarmup == nil {
+		meta.RemoveStatusCondition(&mt.Status.Conditions, moodlev1alpha1.ConditionCachesWarmed)
+		return nil
+	}
+
+	job, err := r.cacheWarmupJobForMoodle(mt, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to build the cache warm-up Job: %w", err)
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionCachesWarmed,
+		Status:             metav1.ConditionUnknown,
+		ObservedGeneration: mt.Generation,
+	}
+
+	found := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		// Pods of the previous image would refill the caches with their own code
+		deployment := &appsv1.Deployment{}
+		if err := r.Get(ctx, types.NamespacedName{Name: activeDeploymentName(mt), Namespace: namespace}, deployment); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			logger.Error(err, "Failed to get Deployment")
+			return err
+		}
+		if !rolloutComplete(deployment, moodleImage(mt)) {
+			condition.Reason = "WaitingForRollout"
+			condition.Message = fmt.Sprintf("Waiting for the rollout of %s", moodleImage(mt))
+			meta.SetStatusCondition(&mt.Status.Conditions, condition)
+			return nil
+		}
+
+		logger.Info("Creating a new cache warm-up Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create new cache warm-up Job", "Job.Namespace", job.Namespace, "Job.Name", job.Name)
+			return err
+		}
+		found = job
+	} else if err != nil {
+		logger.Error(err, "Failed to get cache warm-up Job")
+		return err
+	}
+
+	switch {
+	case found.Status.Succeeded > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Warmed"
+		condition.Message = fmt.Sprintf("Caches primed for %s", moodleImage(mt))
+	case jobFailed(found):
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "WarmupFailed"
+		condition.Message = fmt.Sprintf("Cache warm-up Job %s failed; see its logs", found.Name)
+	default:
+		condition.Reason = "Warming"
+		condition.Message = fmt.Sprintf("Cache warm-up Job %s is running", found.Name)
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	return nil
+}
+
+// rolloutComplete reports whether every replica of the Deployment is updated, available
+// and runs image
+func rolloutComplete(deployment *appsv1.Deployment, image string) bool {
+	containers := deployment.Spec.Template.Spec.Containers
+	if len(containers) == 0 || containers[0].Image != image || deployment.Status.ObservedGeneration < deployment.Generation {
+		return false
+	}
+	replicas := ptr.Deref(deployment.Spec.Replicas, 1)
+	return deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.Replicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+// cacheWarmupJobForMoodle returns the cache warm-up Job for the running image. Like the
+// upgrade Job it runs the Moodle container of the Deployment.
+func (r *MoodleTenantReconciler) cacheWarmupJobForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) (*batchv1.Job, error) {
+	warmup := mt.Spec.CacheWarmup
+
+	// Each image and trigger gets its own Job
+	hash := fnv.New32a()
+	hash.Write([]byte(moodleImage(mt) + "/" + warmup.Trigger))
+	name := fmt.Sprintf("%s-warmup-%08x", mt.Name, hash.Sum32())
+
+	job, err := r.cliJobForMoodle(mt, namespace, name, "cache-warmup", []string{"/usr/local/bin/php", "/usr/local/share/moodle/warm-caches.php"})
+	if err != nil {
+		return nil, err
+	}
+	container := &job.Spec.Template.Spec.Containers[0]
+	if len(warmup.Themes) > 0 {
+		container.Env = append(container.Env, corev1.EnvVar{Name: "WARMUP_THEMES", Value: strings.Join(warmup.Themes, ",")})
+	}
+	if len(warmup.Languages) > 0 {
+		container.Env = append(container.Env, corev1.EnvVar{Name: "WARMUP_LANGUAGES", Value: strings.Join(warmup.Languages, ",")})
+	}
+	job.Annotations = map[string]string{
+		"moodle.bsu.by/image":   moodleImage(mt),
+		"moodle.bsu.by/trigger": warmup.Trigger,
+	}
+
+	return job, nil
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	moodlev1alpha1 "bsu.by/moodle-lms-operator/api/v1alpha1"
+)
+
+// +kubebuilder:rbac:groups=acid.zalan.do,resources=postgresqls,verbs=get;list;watch;create;update;patch;delete
+
+// zalandoPostgresqlGVK is the Zalando postgres-operator postgresql kind
+var zalandoPostgresqlGVK = schema.GroupVersionKind{Group: "acid.zalan.do", Version: "v1", Kind: "postgresql"}
+
+// databaseModeZalando runs the tenant database on a Zalando postgres-operator cluster
+const databaseModeZalando = "zalando"
+
+// patroniPort is the Patroni REST API port polled by the Zalando postgres-operator
+const patroniPort = 8008
+
+// zalandoClusterName returns the name of the tenant cluster, which the postgres-operator
+// requires to start with the team ID
+func zalandoClusterName(mt *moodlev1alpha1.MoodleTenant) string {
+	if ref := mt.Spec.DatabaseRef.Zalando.ClusterRef; ref != nil {
+		return ref.Name
+	}
+
+	teamID := "moodle"
+	if mt.Spec.DatabaseRef.Zalando.TeamID != "" {
+		teamID = mt.Spec.DatabaseRef.Zalando.TeamID
+	}
+	return teamID + "-" + mt.Name
+}
+
+// reconcileZalando creates the tenant cluster or looks up the referenced one, mirrors its
+// status in the DatabaseReady condition and wires the credentials secret generated by the
+// postgres-operator into the database Secret read by Moodle
+func (r *MoodleTenantReconciler) reconcileZalando(ctx context.Context, mt *moodlev1alpha1.MoodleTenant, namespace string) error {
+	logger := log.FromContext(ctx)
+
+	clusterNamespace := namespace
+	host := zalandoClusterName(mt)
+
+	var cluster *unstructured.Unstructured
+	if ref := mt.Spec.DatabaseRef.Zalando.ClusterRef; ref != nil {
+		clusterNamespace = ref.Namespace
+		host = ref.Name + "." + ref.Namespace + ".svc"
+
+		cluster = &unstructured.Unstructured{}
+		cluster.SetGroupVersionKind(zalandoPostgresqlGVK)
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, cluster); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to get referenced postgresql", "Namespace", ref.Namespace, "Name", ref.Name)
+			return err
+		}
+	} else {
+		if backup := mt.Spec.DatabaseRef.Zalando.Backup; backup != nil {
+			source := types.NamespacedName{Name: backup.CredentialsSecretRef.Name, Namespace: mt.Namespace}
+			if err := r.reconcileCopiedSecret(ctx, mt, source, namespace, zalandoClusterName(mt)+"-backup"); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if cluster, err = r.reconcileUnstructured(ctx, r.zalandoClusterForMoodle(mt, namespace)); err != nil {
+			return err
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               moodlev1alpha1.ConditionDatabaseReady,
+		Status:             metav1.ConditionUnknown,
+		Reason:             "Pending",
+		Message:            "Waiting for the postgres-operator to bring up the cluster",
+		ObservedGeneration: mt.Generation,
+	}
+	status, _, _ := unstructured.NestedString(cluster.Object, "status", "PostgresClusterStatus")
+	switch {
+	case status == "Running":
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = status
+		condition.Message = "Cluster " + zalandoClusterName(mt) + " is running"
+	case strings.HasSuffix(status, "Failed"):
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = status
+		condition.Message = "Cluster " + zalandoClusterName(mt) + " reports " + status
+	}
+	meta.SetStatusCondition(&mt.Status.Conditions, condition)
+
+	// The postgres-operator replaces underscores of user names in secret names
+	secretName := strings.ReplaceAll(mt.Spec.DatabaseRef.User, "_", "-") + "." + zalandoClusterName(mt) + ".credentials.postgresql.acid.zalan.do"
+
+	generated := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: clusterNamespace}, generated)
+	if err != nil && errors.IsNotFound(err) {
+		// The secret appears once the user is created; the requeue picks it up
+		logger.Info("Waiting for the postgres-operator credentials Secret", "Secret.Namespace", clusterNamespace, "Secret.Name", secretName)
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get postgres-operator credentials Secret")
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      mt.Spec.DatabaseRef.AdminSecret,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			"host":     []byte(host),
+			"database": []byte(mt.Spec.DatabaseRef.Name),
+			"username": generated.Data["username"],
+			"password": generated.Data["password"],
+		},
+	}
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, secret, r.Scheme); err != nil {
+		return err
+	}
+
+	return r.reconcileSecretData(ctx, secret)
+}
+
+// zalandoClusterForMoodle returns the postgresql resource of the MoodleTenant with the
+// tenant database owned by the tenant user
+func (r *MoodleTenantReconciler) zalandoClusterForMoodle(mt *moodlev1alpha1.MoodleTenant, namespace string) *unstructured.Unstructured {
+	spec := mt.Spec.DatabaseRef.Zalando
+
+	teamID := "moodle"
+	if spec.TeamID != "" {
+		teamID = spec.TeamID
+	}
+	instances := spec.NumberOfInstances
+	if instances == 0 {
+		instances = 1
+	}
+	version := "17"
+	if spec.Version != "" {
+		version = spec.Version
+	}
+	size := "10Gi"
+	if !spec.Volume.Size.IsZero() {
+		size = spec.Volume.Size.String()
+	}
+
+	volume := map[string]interface{}{
+		"size": size,
+	}
+	if spec.Volume.StorageClass != "" {
+		volume["storageClass"] = spec.Volume.StorageClass
+	}
+
+	cluster := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"teamId":            teamID,
+				"numberOfInstances": int64(instances),
+				"volume":            volume,
+				"postgresql": map[string]interface{}{
+					"version": version,
+				},
+				"users": map[string]interface{}{
+					mt.Spec.DatabaseRef.User: []interface{}{},
+				},
+				"databases": map[string]interface{}{
+					mt.Spec.DatabaseRef.Name: mt.Spec.DatabaseRef.User,
+				},
+			},
+		},
+	}
+	if spec.Backup != nil {
+		cluster.Object["spec"].(map[string]interface{})["env"] = zalandoBackupEnv(mt)
+	}
+	cluster.SetGroupVersionKind(zalandoPostgresqlGVK)
+	cluster.SetName(zalandoClusterName(mt))
+	cluster.SetNamespace(namespace)
+	cluster.SetLabels(map[string]string{
+		"app":                  "moodle",
+		"moodle.bsu.by/tenant": mt.Name,
+	})
+
+	// Set MoodleTenant instance as the owner
+	if err := ctrl.SetControllerReference(mt, cluster, r.Scheme); err != nil {
+		return nil
+	}
+
+	return cluster
+}
+
+// zalandoBackupEnv returns the Spilo environment archiving WAL and taking base backups
+// with WAL-G, which together allow point-in-time recovery
+func zalandoBackupEnv(mt *moodlev1alpha1.MoodleTenant) []interface{} {
+	backup := mt.Spec.DatabaseRef.Zalando.Backup
+
+	schedule := "0 1 * * *"
+	if backup.Schedule != "" {
+		schedule = backup.Schedule
+	}
+	retain := int32(5)
+	if backup.Retain != 0 {
+		retain = backup.Retain
+	}
+
+	value := func(name, value string) interface{} {
+		return map[string]interface{}{"name": name, "value": value}
+	}
+	secretValue := func(name, key string) interface{} {
+		return map[string]interface{}{
+			"name": name,
+			"valueFrom": map[string]interface{}{
+				"secretKeyRef": map[string]interface{}{
+					"name": zalandoClusterName(mt) + "-backup",
+					"key":  key,
+				},
+			},
+		}
+	}
+
+	env := []interface{}{
+		value("USE_WALG_BACKUP", "true"),
+		value("USE_WALG_RESTORE", "true"),
+		value("WAL_S3_BUCKET", backup.Bucket),
+		value("BACKUP_SCHEDULE", schedule),
+		value("BACKUP_NUM_TO_RETAIN", strconv.Itoa(int(retain))),
+		secretValue("AWS_ACCESS_KEY_ID", "ACCESS_KEY_ID"),
+		secretValue("AWS_SECRET_ACCESS_KEY", "ACCESS_SECRET_KEY"),
+	}
+	if backup.EndpointURL != "" {
+		// Most S3-compatible stores only serve path-style requests
+		env = append(env, value("AWS_ENDPOINT", backup.EndpointURL), value("AWS_S3_FORCE_PATH_STYLE", "true"))
+	}
+	if backup.Region != "" {
+		env = append(env, value("AWS_REGION", backup.Region))
+	}
+	return env
+}
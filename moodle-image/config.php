@@ -9,26 +9,229 @@ $CFG = new stdClass();
 
 // --- Database Configuration ---
 // These values are injected from a Secret created by the operator.
-$CFG->dbtype    = 'pgsql';
+// DB_TYPE and DB_PORT are derived from `spec.databaseRef.type` and `port`.
+$CFG->dbtype    = getenv('DB_TYPE') ?: 'pgsql';
 $CFG->dblibrary = 'native';
 $CFG->dbhost    = getenv('DB_HOST');
 $CFG->dbname    = getenv('DB_NAME');
 $CFG->dbuser    = getenv('DB_USER');
 $CFG->dbpass    = getenv('DB_PASS');
-$CFG->prefix    = 'mdl_';
+// DB_PASS_FILE holds a short-lived RDS IAM token refreshed by a sidecar.
+if (getenv('DB_PASS_FILE')) {
+    $CFG->dbpass = trim(file_get_contents(getenv('DB_PASS_FILE')));
+}
+// DB_PREFIX, DB_PERSIST, DB_CONNECT_TIMEOUT and DB_COLLATION are derived from
+// `spec.databaseRef.tablePrefix`, `options` and `collation`.
+$CFG->prefix    = getenv('DB_PREFIX') ?: 'mdl_';
+$CFG->dboptions = array(
+    'dbport' => getenv('DB_PORT') ?: '',
+    'dbpersist' => (bool) getenv('DB_PERSIST'),
+);
+if (getenv('DB_CONNECT_TIMEOUT')) {
+    $CFG->dboptions['connecttimeout'] = (int) getenv('DB_CONNECT_TIMEOUT');
+}
+if ($CFG->dbtype !== 'pgsql') {
+    $CFG->dboptions['dbcollation'] = getenv('DB_COLLATION') ?: 'utf8mb4_unicode_ci';
+}
+// DB_READONLY_HOSTS is derived from `spec.databaseRef.readReplicas`.
+if (getenv('DB_READONLY_HOSTS')) {
+    $CFG->dboptions['readonly'] = array(
+        'instance' => explode(',', getenv('DB_READONLY_HOSTS')),
+        'connecttimeout' => 2,
+    );
+}
 
 // --- Site URL and Data Root ---
 // MOODLE_URL is derived from the `spec.hostname` of the CR.
 $CFG->sslproxy = true;
 $CFG->wwwroot   = getenv('MOODLE_URL');
+// MOODLE_ADMIN_URL is derived from `spec.ingress.admin.hostname`. Requests
+// through the internal admin Ingress use it as wwwroot so that Moodle does not
+// redirect them to the public hostname.
+if (getenv('MOODLE_ADMIN_URL') && isset($_SERVER['HTTP_HOST'])
+        && $_SERVER['HTTP_HOST'] === parse_url(getenv('MOODLE_ADMIN_URL'), PHP_URL_HOST)) {
+    $CFG->wwwroot = getenv('MOODLE_ADMIN_URL');
+}
 // The data root is a fixed path inside the container, mounted to a PVC.
 $CFG->dataroot  = '/var/www/moodledata'; 
 $CFG->admin     = 'admin';
+// The local cache is read on nearly every request and rebuilt when missing, so
+// the operator keeps it on an emptyDir of the pod rather than the shared PVC,
+// unless `spec.storage.localCache.enabled` is false.
+if (getenv('MOODLE_LOCALCACHE_DIR')) {
+    $CFG->localcachedir = getenv('MOODLE_LOCALCACHE_DIR');
+}
+// MOODLE_TEMP_DIR, MOODLE_CACHE_DIR and MOODLE_TRASH_DIR are derived from
+// `spec.storage.layout`, which moves these directories off moodledata.
+if (getenv('MOODLE_TEMP_DIR')) {
+    $CFG->tempdir = getenv('MOODLE_TEMP_DIR');
+}
+if (getenv('MOODLE_CACHE_DIR')) {
+    $CFG->cachedir = getenv('MOODLE_CACHE_DIR');
+}
+if (getenv('MOODLE_TRASH_DIR')) {
+    $CFG->trashdir = getenv('MOODLE_TRASH_DIR');
+}
 
-// --- Performance & Caching (Sidecar Pattern) ---
-// Use file-based sessions instead of memcached for simplicity
-$CFG->session_handler_class = '\core\session\file';
-$CFG->session_file_save_path = $CFG->dataroot.'/sessions';
+// --- Locale ---
+// MOODLE_LANG and MOODLE_TIMEZONE are derived from `spec.locale` of the CR.
+if (getenv('MOODLE_LANG')) {
+    $CFG->lang = getenv('MOODLE_LANG');
+}
+if (getenv('MOODLE_TIMEZONE')) {
+    $CFG->timezone = getenv('MOODLE_TIMEZONE');
+}
+
+// --- Data Retention ---
+// Derived from `spec.dataRetention` of the CR. Settings forced here cannot be
+// changed from the Moodle admin UI.
+if (getenv('MOODLE_LOG_LIFETIME_DAYS') !== false) {
+    $CFG->forced_plugin_settings['logstore_standard']['loglifetime'] = (int)getenv('MOODLE_LOG_LIFETIME_DAYS');
+}
+if (getenv('MOODLE_UNCONFIRMED_USER_PURGE_HOURS') !== false) {
+    $CFG->deleteunconfirmed = (int)getenv('MOODLE_UNCONFIRMED_USER_PURGE_HOURS');
+}
+if (getenv('MOODLE_INCOMPLETE_USER_PURGE_DAYS') !== false) {
+    $CFG->deleteincompleteusers = (int)getenv('MOODLE_INCOMPLETE_USER_PURGE_DAYS');
+}
+if (getenv('MOODLE_BACKUP_MAX_KEPT') !== false) {
+    $CFG->forced_plugin_settings['backup']['backup_auto_max_kept'] = (int)getenv('MOODLE_BACKUP_MAX_KEPT');
+}
+if (getenv('MOODLE_BACKUP_DELETE_DAYS') !== false) {
+    $CFG->forced_plugin_settings['backup']['backup_auto_delete_days'] = (int)getenv('MOODLE_BACKUP_DELETE_DAYS');
+}
+if (getenv('MOODLE_LOG_GUESTS') !== false) {
+    $CFG->forced_plugin_settings['logstore_standard']['logguests'] = (int)getenv('MOODLE_LOG_GUESTS');
+}
+if (getenv('MOODLE_TASK_LOG_RETENTION_DAYS') !== false) {
+    $CFG->task_logretention = (int)getenv('MOODLE_TASK_LOG_RETENTION_DAYS') * 86400;
+}
+if (getenv('MOODLE_TASK_LOG_RETAIN_RUNS') !== false) {
+    $CFG->task_logretainruns = (int)getenv('MOODLE_TASK_LOG_RETAIN_RUNS');
+}
+
+// --- Scheduled Tasks ---
+// Derived from `spec.cron.scheduledTasks` and `spec.dataRetention.logCleanupSchedule`
+// of the CR. Overridden schedules cannot be changed from the Moodle admin UI.
+if (getenv('MOODLE_SCHEDULED_TASKS')) {
+    $CFG->scheduled_tasks = json_decode(getenv('MOODLE_SCHEDULED_TASKS'), true);
+}
+
+// --- Task Processing ---
+// Derived from `spec.cron` of the CR. The concurrency limits apply across all
+// cron processes, so they must allow for cron.parallelism or cron.replicas.
+if (getenv('MOODLE_TASK_SCHEDULED_CONCURRENCY_LIMIT') !== false) {
+    $CFG->task_scheduled_concurrency_limit = (int)getenv('MOODLE_TASK_SCHEDULED_CONCURRENCY_LIMIT');
+}
+if (getenv('MOODLE_TASK_ADHOC_CONCURRENCY_LIMIT') !== false) {
+    $CFG->task_adhoc_concurrency_limit = (int)getenv('MOODLE_TASK_ADHOC_CONCURRENCY_LIMIT');
+}
+if (getenv('MOODLE_TASK_SCHEDULED_MAX_RUNTIME') !== false) {
+    $CFG->task_scheduled_max_runtime = (int)getenv('MOODLE_TASK_SCHEDULED_MAX_RUNTIME');
+}
+if (getenv('MOODLE_TASK_ADHOC_MAX_RUNTIME') !== false) {
+    $CFG->task_adhoc_max_runtime = (int)getenv('MOODLE_TASK_ADHOC_MAX_RUNTIME');
+}
+
+// --- Plagiarism Detection ---
+// Derived from `spec.integrations.plagiarism` of the CR. The provider plugin
+// must be installed in the image; its settings are forced from here.
+switch (getenv('MOODLE_PLAGIARISM_PROVIDER')) {
+    case 'turnitin':
+        $CFG->enableplagiarism = 1;
+        $CFG->forced_plugin_settings['plagiarism_turnitin'] = array(
+            'enabled'   => 1,
+            'apiurl'    => getenv('MOODLE_PLAGIARISM_API_URL'),
+            'accountid' => getenv('MOODLE_PLAGIARISM_ACCOUNT_ID'),
+            'secretkey' => getenv('MOODLE_PLAGIARISM_API_KEY'),
+        );
+        break;
+    case 'ouriginal':
+        $CFG->enableplagiarism = 1;
+        $CFG->forced_plugin_settings['plagiarism_ouriginal'] = array(
+            'enabled'  => 1,
+            'api'      => getenv('MOODLE_PLAGIARISM_API_URL'),
+            'username' => getenv('MOODLE_PLAGIARISM_ACCOUNT_ID'),
+            'apikey'   => getenv('MOODLE_PLAGIARISM_API_KEY'),
+        );
+        break;
+}
+
+// --- Performance & Caching ---
+// SESSION_*, MUC_*, REDIS_* and MEMCACHED_* are derived from `spec.sessions`,
+// `spec.cache`, `spec.memcached` and `spec.hpa`. Redis, Memcached and database
+// sessions, with their locks, are shared by all replicas; the MUC stores are set
+// up by configure-muc.php when the container starts.
+// Moodle has no Sentinel client, so with `redis.sentinel` the current master is
+// looked up here on every request and passed on as REDIS_HOST and REDIS_PORT.
+// Sessions thereby follow a failover at once, and the MUC when configure-muc.php
+// runs next, before every cron run.
+if (getenv('REDIS_SENTINEL_MASTER')) {
+    foreach (explode(',', getenv('REDIS_SENTINELS')) as $sentinel) {
+        list($host, $port) = explode(':', $sentinel, 2);
+        try {
+            $sentinelclient = new RedisSentinel(array('host' => $host, 'port' => (int) $port, 'connectTimeout' => 1));
+            $master = $sentinelclient->getMasterAddrByName(getenv('REDIS_SENTINEL_MASTER'));
+        } catch (RedisException $e) {
+            continue;
+        }
+        if ($master) {
+            putenv('REDIS_HOST=' . $master[0]);
+            putenv('REDIS_PORT=' . $master[1]);
+            break;
+        }
+    }
+}
+$sessionlocktimeout = (int) (getenv('SESSION_LOCK_TIMEOUT') ?: 120);
+$sessionlockexpire = (int) (getenv('SESSION_LOCK_EXPIRE') ?: 7200);
+if (getenv('SESSION_HANDLER') === 'redis') {
+    $CFG->session_handler_class = '\core\session\redis';
+    if (getenv('REDIS_CLUSTER')) {
+        // A comma-separated list of cluster nodes
+        $CFG->session_redis_host = getenv('REDIS_CLUSTER');
+    } else {
+        $CFG->session_redis_host = getenv('REDIS_HOST');
+        $CFG->session_redis_port = (int) getenv('REDIS_PORT');
+    }
+    if (getenv('REDIS_TLS')) {
+        $CFG->session_redis_encrypt = getenv('REDIS_CA_FILE')
+            ? array('cafile' => getenv('REDIS_CA_FILE'))
+            : array('verify_peer' => true);
+    }
+    $CFG->session_redis_auth = getenv('REDIS_PASSWORD') ?: '';
+    $CFG->session_redis_prefix = getenv('REDIS_PREFIX') . 'sess_';
+    $CFG->session_redis_acquire_lock_timeout = $sessionlocktimeout;
+    $CFG->session_redis_lock_expire = $sessionlockexpire;
+} else if (getenv('SESSION_HANDLER') === 'memcached') {
+    $CFG->session_handler_class = '\core\session\memcached';
+    $CFG->session_memcached_save_path = getenv('MEMCACHED_SERVERS');
+    $CFG->session_memcached_prefix = getenv('MEMCACHED_PREFIX') . 'sess_';
+    $CFG->session_memcached_acquire_lock_timeout = $sessionlocktimeout;
+    $CFG->session_memcached_lock_expire = $sessionlockexpire;
+    if (getenv('MEMCACHED_USERNAME')) {
+        ini_set('memcached.sess_binary_protocol', '1');
+        ini_set('memcached.sess_sasl_username', getenv('MEMCACHED_USERNAME'));
+        ini_set('memcached.sess_sasl_password', getenv('MEMCACHED_PASSWORD'));
+    }
+} else if (getenv('SESSION_HANDLER') === 'database') {
+    $CFG->session_handler_class = '\core\session\database';
+    $CFG->session_database_acquire_lock_timeout = $sessionlocktimeout;
+} else {
+    // Use file-based sessions instead of memcached for simplicity
+    $CFG->session_handler_class = '\core\session\file';
+    $CFG->session_file_save_path = $CFG->dataroot.'/sessions';
+}
+
+// Moodle's Memcached store has no SASL settings, so the image patches it to pass
+// each of its connections through this function before adding the servers.
+// MEMCACHED_USERNAME and MEMCACHED_PASSWORD are set with `memcached.auth` or an
+// authenticated cache cluster.
+function moodle_memcached_sasl(Memcached $connection) {
+    if (getenv('MEMCACHED_USERNAME')) {
+        $connection->setOption(Memcached::OPT_BINARY_PROTOCOL, true);
+        $connection->setSaslAuthData(getenv('MEMCACHED_USERNAME'), getenv('MEMCACHED_PASSWORD'));
+    }
+}
 
 // Optional: Configure MUC (Moodle Universal Cache) to also use Memcached
 // $CFG->memcached_servers = array( '127.0.0.1' => '11211' );
@@ -38,8 +241,20 @@ $CFG->session_file_save_path = $CFG->dataroot.'/sessions';
 // --- Security & Other Settings ---
 $CFG->passwordsaltmain = getenv('MOODLE_PASSWORD_SALT') ?: 'default-salt-please-change';
 
-// Do not send email from test environments
-$CFG->noemailever = true;
+// --- Outgoing Mail ---
+// Derived from `spec.mail` of the CR. Without an SMTP relay no email is sent,
+// which keeps test environments from mailing real users.
+if (getenv('MOODLE_SMTP_HOSTS')) {
+    $CFG->smtphosts  = getenv('MOODLE_SMTP_HOSTS');
+    $CFG->smtpsecure = getenv('MOODLE_SMTP_SECURE') === 'none' ? '' : getenv('MOODLE_SMTP_SECURE');
+    $CFG->smtpuser   = getenv('MOODLE_SMTP_USER') ?: '';
+    $CFG->smtppass   = getenv('MOODLE_SMTP_PASS') ?: '';
+    if (getenv('MOODLE_NOREPLY_ADDRESS')) {
+        $CFG->noreplyaddress = getenv('MOODLE_NOREPLY_ADDRESS');
+    }
+} else {
+    $CFG->noemailever = true;
+}
 
 // Any other custom settings can be added below this line.
 
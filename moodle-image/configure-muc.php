@@ -0,0 +1,88 @@
+<?php
+// Sets up the stores and mode mappings of the Moodle Universal Cache (MUC) from
+// the environment the operator renders out of the MoodleTenant spec:
+//
+//   MUC_APPLICATION_STORE  redis, memcached or file
+//   MUC_SESSION_STORE      redis or default
+//
+// Request caches always stay in the memory of the request. MUC stores are
+// configured in moodledata rather than config.php, so supervisord runs this
+// script when the container starts, and the mappings follow the spec instead of
+// the MUC admin page. Without MUC_APPLICATION_STORE, with cache.muc set to
+// manual, the configuration is left to the site administrator. The script is
+// idempotent and does nothing before Moodle is installed.
+
+define('CLI_SCRIPT', true);
+
+require('/var/www/html/config.php');
+require_once($CFG->dirroot . '/cache/locallib.php');
+
+$application = getenv('MUC_APPLICATION_STORE');
+$session = getenv('MUC_SESSION_STORE') ?: 'default';
+if ($application === false || $application === '' || during_initial_install()) {
+    exit(0);
+}
+
+$writer = cache_config_writer::instance();
+$stores = $writer->get_all_stores();
+
+// Store instances of this script are named after their plugin
+$configurations = array();
+if ($application === 'redis' || $session === 'redis') {
+    // REDIS_CLUSTER is a comma-separated list of cluster nodes, the store takes one
+    // per line
+    $configurations['redis'] = array(
+        'server' => getenv('REDIS_CLUSTER')
+            ? str_replace(',', "\n", getenv('REDIS_CLUSTER'))
+            : getenv('REDIS_HOST') . ':' . getenv('REDIS_PORT'),
+        'clustermode' => (bool) getenv('REDIS_CLUSTER'),
+        'encryption' => (bool) getenv('REDIS_TLS'),
+        'cafile' => getenv('REDIS_CA_FILE') ?: '',
+        'prefix' => getenv('REDIS_PREFIX'),
+        'password' => getenv('REDIS_PASSWORD') ?: '',
+        'serializer' => Redis::SERIALIZER_PHP,
+        'compressor' => cachestore_redis::COMPRESSOR_NONE,
+    );
+}
+if ($application === 'memcached') {
+    // MEMCACHED_SERVERS is a comma-separated list of host:port
+    $servers = array();
+    foreach (explode(',', getenv('MEMCACHED_SERVERS')) as $server) {
+        $servers[] = explode(':', $server, 2);
+    }
+    $configurations['memcached'] = array(
+        'servers' => $servers,
+        'prefix' => getenv('MEMCACHED_PREFIX'),
+        'compression' => 1,
+        'serialiser' => Memcached::SERIALIZER_PHP,
+        'hash' => Memcached::HASH_DEFAULT,
+        'bufferwrites' => 0,
+        'clustered' => false,
+        'setservers' => array(),
+        // A pool shared with other tenants is purged by prefix instead of flushed
+        'isshared' => getenv('MEMCACHED_SHARED') === '1' ? 1 : 0,
+    );
+}
+
+foreach ($configurations as $name => $configuration) {
+    if (array_key_exists($name, $stores)) {
+        $writer->edit_store_instance($name, $name, $configuration);
+    } else {
+        $writer->add_store_instance($name, $name, $configuration);
+    }
+}
+
+$writer->set_mode_mappings(array(
+    cache_store::MODE_APPLICATION => array($application === 'file' ? 'default_application' : $application),
+    cache_store::MODE_SESSION => array($session === 'redis' ? 'redis' : 'default_session'),
+    cache_store::MODE_REQUEST => array('default_request'),
+));
+
+// Remove the stores that are no longer used
+foreach (array('redis', 'memcached') as $name) {
+    if (!array_key_exists($name, $configurations) && array_key_exists($name, $stores)) {
+        $writer->delete_store_instance($name);
+    }
+}
+
+mtrace("MUC stores: application {$application}, session {$session}, request default");
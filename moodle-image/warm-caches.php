@@ -0,0 +1,58 @@
+<?php
+// Primes the caches that Moodle otherwise rebuilds on the first requests after an
+// upgrade, which purges all caches. The operator runs this script in a Job once the
+// rollout of a new image has completed, with the environment of the Moodle pods:
+//
+//   WARMUP_THEMES     comma-separated themes to compile, default the site theme
+//   WARMUP_LANGUAGES  comma-separated languages to load, default all installed
+//
+// Only caches shared by the replicas are primed: the component cache in cachedir,
+// and the compiled themes and language strings in the MUC application cache. The
+// Memcached sidecar of a single replica and localcachedir belong to their pod.
+
+define('CLI_SCRIPT', true);
+
+require('/var/www/html/config.php');
+require_once($CFG->libdir . '/outputlib.php');
+
+if (during_initial_install()) {
+    exit(0);
+}
+
+$start = microtime(true);
+
+// Component cache
+$components = array();
+foreach (core_component::get_core_subsystems() as $subsystem => $unused) {
+    $components[] = 'core_' . $subsystem;
+}
+foreach (core_component::get_plugin_types() as $type => $unused) {
+    foreach (core_component::get_plugin_list($type) as $plugin => $unused) {
+        $components[] = $type . '_' . $plugin;
+    }
+}
+mtrace('Component cache: ' . count($components) . ' components');
+
+// Themes
+$themes = getenv('WARMUP_THEMES') ? explode(',', getenv('WARMUP_THEMES')) : array($CFG->theme);
+$themeconfigs = array();
+foreach ($themes as $theme) {
+    $themeconfigs[$theme] = theme_config::load($theme);
+}
+theme_build_css_for_themes($themeconfigs);
+mtrace('Themes compiled: ' . implode(', ', array_keys($themeconfigs)));
+
+// Language strings
+$stringmanager = get_string_manager();
+$languages = getenv('WARMUP_LANGUAGES')
+    ? explode(',', getenv('WARMUP_LANGUAGES'))
+    : array_keys($stringmanager->get_list_of_translations());
+foreach ($languages as $language) {
+    $stringmanager->load_component_strings('core', $language);
+    foreach ($components as $component) {
+        $stringmanager->load_component_strings($component, $language);
+    }
+}
+mtrace('Language strings loaded: ' . implode(', ', $languages));
+
+mtrace(sprintf('Caches warmed in %.1f s', microtime(true) - $start));